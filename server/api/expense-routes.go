@@ -2,13 +2,16 @@ package api
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
 	"github.com/sukh-j-14/fingenie-main/internal/handlers/expense"
 	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/storage"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
 	"gorm.io/gorm"
 )
 
-func SetupExpenseRoutes(app *fiber.App, db *gorm.DB) {
-	expenseHandler := expense.NewHandler(db)
+func SetupExpenseRoutes(app *fiber.App, db *gorm.DB, budgetTracker *budget.Tracker, tokens *token.Manager, userLimit fiber.Handler, blobs storage.BlobStore) {
+	expenseHandler := expense.NewHandler(db, budgetTracker, tokens, blobs)
 
 	// Get the v1 group
 	api := app.Group("/api")
@@ -16,16 +19,30 @@ func SetupExpenseRoutes(app *fiber.App, db *gorm.DB) {
 
 	// Expense routes
 	expenses := v1.Group("/expenses")
-	expenses.Use(middleware.AuthMiddleware())
+	expenses.Use(middleware.AuthMiddleware(tokens, token.ResourceExpenses), userLimit)
 	expenses.Post("/", expenseHandler.CreateExpense)
+	expenses.Post("/parse", expenseHandler.DraftExpense)
+	expenses.Post("/from-receipt", expenseHandler.DraftFromReceipt)
 	expenses.Get("/", expenseHandler.ListExpenses) // Added list endpoint
+	expenses.Get("/export", expenseHandler.ExportExpenses)
+	expenses.Post("/import/splitwise", expenseHandler.ImportSplitwise)
+	expenses.Post("/import/statement", expenseHandler.ImportStatement)
+	expenses.Post("/import/share", expenseHandler.ShareImported)
 	expenses.Get("/:id", expenseHandler.GetExpense)
 	expenses.Put("/:id", expenseHandler.UpdateExpense)
 	expenses.Delete("/:id", expenseHandler.DeleteExpense)
+	expenses.Post("/:id/attachments", expenseHandler.UploadAttachment)
+	expenses.Get("/:id/attachments", expenseHandler.ListAttachments)
+	expenses.Delete("/:id/attachments/:attachmentId", expenseHandler.DeleteAttachment)
+	expenses.Put("/:id/attachments/:attachmentId/receipt", expenseHandler.SetAttachmentReceipt)
+
+	// Signed download URLs carry their own token instead of an Authorization
+	// header, so downloads are limited per client IP
+	v1.Get("/attachments/:attachmentId", userLimit, expenseHandler.DownloadAttachment)
 
 	// Split Expense routes
 	splitExpenses := v1.Group("/split-expenses")
-	splitExpenses.Use(middleware.AuthMiddleware())
+	splitExpenses.Use(middleware.AuthMiddleware(tokens, token.ResourceBalances), userLimit)
 	splitExpenses.Post("/", expenseHandler.CreateSplitExpense)
 	splitExpenses.Get("/", expenseHandler.ListSplitExpenses) // Added list endpoint
 	splitExpenses.Get("/:id", expenseHandler.GetSplitExpense)
@@ -34,10 +51,33 @@ func SetupExpenseRoutes(app *fiber.App, db *gorm.DB) {
 
 	// Split Share routes
 	splitShares := v1.Group("/split-shares")
-	splitShares.Use(middleware.AuthMiddleware())
+	splitShares.Use(middleware.AuthMiddleware(tokens, token.ResourceBalances), userLimit)
 	splitShares.Post("/", expenseHandler.CreateSplitShare)
 	splitShares.Get("/", expenseHandler.ListSplitShares)
 	splitShares.Get("/:id", expenseHandler.GetSplitShare)
 	splitShares.Put("/:id", expenseHandler.UpdateSplitShare)
 	splitShares.Delete("/:id", expenseHandler.DeleteSplitShare)
+
+	// Category routes
+	categories := v1.Group("/categories")
+	categories.Use(middleware.AuthMiddleware(tokens, token.ResourceExpenses), userLimit)
+	categories.Get("/", expenseHandler.ListCategories)
+	categories.Post("/", expenseHandler.CreateCategory)
+	categories.Put("/:id", expenseHandler.UpdateCategory)
+	categories.Delete("/:id", expenseHandler.DeleteCategory)
+
+	// Category rule routes
+	rules := v1.Group("/category-rules")
+	rules.Use(middleware.AuthMiddleware(tokens, token.ResourceExpenses), userLimit)
+	rules.Get("/", expenseHandler.ListCategoryRules)
+	rules.Post("/", expenseHandler.CreateCategoryRule)
+	rules.Post("/test", expenseHandler.TestCategoryRules)
+	rules.Put("/learning", expenseHandler.SetCategoryLearning)
+	rules.Put("/:id", expenseHandler.UpdateCategoryRule)
+	rules.Post("/:id/accept", expenseHandler.AcceptCategoryRule)
+	rules.Delete("/:id", expenseHandler.DeleteCategoryRule)
+
+	balances := v1.Group("/balances")
+	balances.Use(middleware.AuthMiddleware(tokens, token.ResourceBalances), userLimit)
+	balances.Get("/", expenseHandler.GetBalances)
 }
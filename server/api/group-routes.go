@@ -4,15 +4,16 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/sukh-j-14/fingenie-main/internal/handlers/group"
 	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
 	"gorm.io/gorm"
 )
 
-func SetupGroupRoutes(app *fiber.App, db *gorm.DB) {
+func SetupGroupRoutes(app *fiber.App, db *gorm.DB, tokens *token.Manager, userLimit fiber.Handler) {
 	h := group.NewHandler(db)
 	mh := group.NewGroupMemberHandler(db) // Group Member Handler
 
 	groupRoutes := app.Group("/api/v1/groups")
-	groupRoutes.Use(middleware.AuthMiddleware())
+	groupRoutes.Use(middleware.AuthMiddleware(tokens, token.ResourceGroups), userLimit)
 	groupRoutes.Post("/", h.CreateGroup)        // Create a new group
 	groupRoutes.Put("/:groupId", h.UpdateGroup) // Update an existing group
 	groupRoutes.Get("/:groupId", h.GetGroup)    // Fetch group details
@@ -21,7 +22,6 @@ func SetupGroupRoutes(app *fiber.App, db *gorm.DB) {
 
 	// Group Member Routes
 	memberRoutes := groupRoutes.Group("/:groupId/members")
-	memberRoutes.Use(middleware.AuthMiddleware())
 	memberRoutes.Post("/", mh.AddMember)               // Add a member
 	memberRoutes.Get("/", mh.GetMembers)               // List group members
 	memberRoutes.Patch("/:memberId", mh.UpdateMember)  // Update member role/share
@@ -2,20 +2,22 @@ package api
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
 	"github.com/sukh-j-14/fingenie-main/internal/handlers/profile"
 	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
 	"gorm.io/gorm"
 )
 
-func SetupProfileRoutes(app *fiber.App, db *gorm.DB) {
+func SetupProfileRoutes(app *fiber.App, db *gorm.DB, budgetTracker *budget.Tracker, tokens *token.Manager, userLimit fiber.Handler) {
 	// Initialize handlers
-	profileHandler := profile.NewHandler(db)
+	profileHandler := profile.NewHandler(db, budgetTracker)
 
 	// Profile routes group
 	profileGroup := app.Group("/api/v1/profile")
 
 	// Apply auth middleware to all profile routes
-	profileGroup.Use(middleware.AuthMiddleware())
+	profileGroup.Use(middleware.AuthMiddleware(tokens, token.ResourceProfile), userLimit)
 
 	// User profile routes
 	profileGroup.Get("/", profileHandler.GetProfile)
@@ -25,8 +27,18 @@ func SetupProfileRoutes(app *fiber.App, db *gorm.DB) {
 	profileGroup.Post("/income-streams", profileHandler.AddIncomeStream)
 	profileGroup.Put("/income-streams/:streamId", profileHandler.UpdateIncomeStream)
 	profileGroup.Delete("/income-streams/:streamId", profileHandler.DeleteIncomeStream)
-	profileGroup.Get("/user/:phoneNumber", profileHandler.GetUsersByPhoneNumber)
+	profileGroup.Post("/income-streams/:streamId/received", profileHandler.MarkIncomeReceived)
+	profileGroup.Get("/cashflow", profileHandler.GetCashflow)
+	profileGroup.Get("/tax-summary", profileHandler.GetTaxSummary)
+	profileGroup.Post("/behavioral-patterns/analyze", profileHandler.AnalyzeBehavioralPatterns)
+	profileGroup.Post("/contacts/match", profileHandler.MatchContacts)
 	// Budget routes
 	profileGroup.Post("/budgets", profileHandler.CreateBudget)
+	profileGroup.Get("/budgets/:budgetId/suggestion", profileHandler.GetBudgetSuggestion)
+	profileGroup.Get("/budgets/:budgetId/adjustments", profileHandler.ListBudgetAdjustments)
+
+	// Notification routes
+	profileGroup.Get("/notifications", profileHandler.ListNotifications)
+	profileGroup.Put("/notifications/:notificationId/read", profileHandler.MarkNotificationRead)
 
 }
@@ -1,12 +1,33 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
 	"github.com/sukh-j-14/fingenie-main/internal/handlers/auth"
+	"github.com/sukh-j-14/fingenie-main/internal/mail"
+	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/otp"
+	"github.com/sukh-j-14/fingenie-main/internal/storage"
+	"github.com/sukh-j-14/fingenie-main/internal/telegram"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"github.com/sukh-j-14/fingenie-main/internal/whatsapp"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(app *fiber.App, db *gorm.DB) {
+// Request limits per route group. Public auth endpoints are limited per client
+// IP; routes behind AuthMiddleware are limited per user.
+var (
+	loginLimit         = middleware.Limit{Max: 10, Window: 15 * time.Minute}
+	signupLimit        = middleware.Limit{Max: 5, Window: time.Hour}
+	publicAuthLimit    = middleware.Limit{Max: 20, Window: 15 * time.Minute}
+	authenticatedLimit = middleware.Limit{Max: 300, Window: time.Minute}
+)
+
+// SetupRoutes registers every route. telegramConfig and whatsappConfig are nil
+// when those integrations are not configured.
+func SetupRoutes(app *fiber.App, db *gorm.DB, budgetTracker *budget.Tracker, tokens *token.Manager, mailer mail.Mailer, phoneOTP *otp.Service, limiter middleware.RateLimitStore, blobs storage.BlobStore, telegramConfig *telegram.Config, whatsappConfig *whatsapp.Config) {
 	// API version group
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
@@ -20,14 +41,54 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	})
 
 	// Initialize handlers
-	authHandler := auth.NewHandler(db)
+	authHandler := auth.NewHandler(db, tokens, mailer, phoneOTP)
+
+	// Public keys for services that verify access tokens
+	app.Get("/.well-known/jwks.json", authHandler.JWKS)
+
+	requireAuth := middleware.AuthMiddleware(tokens)
+	userLimit := middleware.RateLimit(limiter, "user", authenticatedLimit, middleware.KeyByUser)
+	publicLimit := middleware.RateLimit(limiter, "auth", publicAuthLimit, middleware.KeyByIP)
+	// High-risk actions need a recent 2FA check for users who enabled it
+	stepUp := middleware.RequireStepUp(tokens)
 
 	// Auth routes
 	authGroup := v1.Group("/auth")
-	authGroup.Post("/login", authHandler.Login)
-	authGroup.Post("/signup", authHandler.Signup)
+	authGroup.Post("/login", middleware.RateLimit(limiter, "login", loginLimit, middleware.KeyByIP), authHandler.Login)
+	authGroup.Post("/signup", middleware.RateLimit(limiter, "signup", signupLimit, middleware.KeyByIP), authHandler.Signup)
+	authGroup.Post("/refresh", publicLimit, authHandler.Refresh)
+	authGroup.Post("/logout", requireAuth, userLimit, authHandler.Logout)
+	authGroup.Post("/logout-all", requireAuth, userLimit, authHandler.LogoutAll)
+	authGroup.Get("/sessions", requireAuth, userLimit, authHandler.ListSessions)
+	authGroup.Get("/login-history", requireAuth, userLimit, authHandler.LoginHistory)
+	authGroup.Post("/password/forgot", publicLimit, authHandler.ForgotPassword)
+	authGroup.Post("/password/reset", publicLimit, authHandler.ResetPassword)
+	authGroup.Post("/email/verify", publicLimit, authHandler.VerifyEmail)
+	authGroup.Post("/email/verification", requireAuth, userLimit, authHandler.ResendVerification)
+	authGroup.Post("/phone/verification", requireAuth, userLimit, authHandler.RequestPhoneVerification)
+	authGroup.Post("/phone/verify", requireAuth, userLimit, authHandler.VerifyPhone)
+	authGroup.Post("/phone/code", publicLimit, authHandler.RequestPhoneLogin)
+	authGroup.Post("/phone/login", publicLimit, authHandler.PhoneLogin)
+	authGroup.Post("/2fa/verify", publicLimit, authHandler.VerifyTwoFactorLogin)
+	authGroup.Post("/2fa/setup", requireAuth, userLimit, authHandler.SetupTwoFactor)
+	authGroup.Post("/2fa/enable", requireAuth, userLimit, authHandler.EnableTwoFactor)
+	authGroup.Post("/2fa/disable", requireAuth, userLimit, stepUp, authHandler.DisableTwoFactor)
+	authGroup.Post("/2fa/recovery-codes", requireAuth, userLimit, stepUp, authHandler.RegenerateRecoveryCodes)
+	authGroup.Post("/step-up", requireAuth, userLimit, authHandler.StepUp)
+	authGroup.Put("/password", requireAuth, userLimit, stepUp, authHandler.ChangePassword)
+	authGroup.Put("/email", requireAuth, userLimit, stepUp, authHandler.ChangeEmail)
+	authGroup.Delete("/account", requireAuth, userLimit, stepUp, authHandler.DeleteAccount)
+	authGroup.Get("/api-keys", requireAuth, userLimit, authHandler.ListAPIKeys)
+	authGroup.Post("/api-keys", requireAuth, userLimit, stepUp, authHandler.CreateAPIKey)
+	authGroup.Delete("/api-keys/:keyId", requireAuth, userLimit, authHandler.RevokeAPIKey)
 
-	SetupProfileRoutes(app, db)
-	SetupGroupRoutes(app, db)
-	SetupExpenseRoutes(app, db)
+	SetupProfileRoutes(app, db, budgetTracker, tokens, userLimit)
+	SetupGroupRoutes(app, db, tokens, userLimit)
+	SetupExpenseRoutes(app, db, budgetTracker, tokens, userLimit, blobs)
+	if telegramConfig != nil {
+		SetupTelegramRoutes(app, db, budgetTracker, tokens, userLimit, *telegramConfig)
+	}
+	if whatsappConfig != nil {
+		SetupWhatsAppRoutes(app, db, budgetTracker, tokens, userLimit, *whatsappConfig)
+	}
 }
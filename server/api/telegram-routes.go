@@ -0,0 +1,21 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/handlers/messaging"
+	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/telegram"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"gorm.io/gorm"
+)
+
+func SetupTelegramRoutes(app *fiber.App, db *gorm.DB, budgetTracker *budget.Tracker, tokens *token.Manager, userLimit fiber.Handler, cfg telegram.Config) {
+	h := messaging.NewTelegramHandler(db, tokens, budgetTracker, cfg)
+
+	telegramRoutes := app.Group("/api/v1/telegram")
+	// Called by Telegram, authenticated with the webhook secret
+	telegramRoutes.Post("/webhook", h.Webhook)
+	telegramRoutes.Post("/link", middleware.AuthMiddleware(tokens), userLimit, h.CreateLinkCode)
+	telegramRoutes.Delete("/link", middleware.AuthMiddleware(tokens), userLimit, h.Unlink)
+}
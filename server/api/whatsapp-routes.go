@@ -0,0 +1,22 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/handlers/messaging"
+	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"github.com/sukh-j-14/fingenie-main/internal/whatsapp"
+	"gorm.io/gorm"
+)
+
+func SetupWhatsAppRoutes(app *fiber.App, db *gorm.DB, budgetTracker *budget.Tracker, tokens *token.Manager, userLimit fiber.Handler, cfg whatsapp.Config) {
+	h := messaging.NewWhatsAppHandler(db, tokens, budgetTracker, cfg)
+
+	whatsappRoutes := app.Group("/api/v1/whatsapp")
+	// Called by WhatsApp: the GET on registration, the POST with signed payloads
+	whatsappRoutes.Get("/webhook", h.VerifyWebhook)
+	whatsappRoutes.Post("/webhook", h.Webhook)
+	whatsappRoutes.Post("/link", middleware.AuthMiddleware(tokens), userLimit, h.CreateLinkCode)
+	whatsappRoutes.Delete("/link", middleware.AuthMiddleware(tokens), userLimit, h.Unlink)
+}
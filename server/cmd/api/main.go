@@ -1,10 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/sukh-j-14/fingenie-main/api"
+	"github.com/sukh-j-14/fingenie-main/internal/attachment"
+	"github.com/sukh-j-14/fingenie-main/internal/balance"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/cashflow"
+	"github.com/sukh-j-14/fingenie-main/internal/mail"
+	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/notify"
+	"github.com/sukh-j-14/fingenie-main/internal/otp"
+	"github.com/sukh-j-14/fingenie-main/internal/patterns"
+	"github.com/sukh-j-14/fingenie-main/internal/storage"
+	"github.com/sukh-j-14/fingenie-main/internal/telegram"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"github.com/sukh-j-14/fingenie-main/internal/whatsapp"
 	"github.com/sukh-j-14/fingenie-main/pkg/database/postgres"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -13,6 +28,8 @@ import (
 func main() {
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
+		// Leave room for receipt uploads and the multipart framing around them
+		BodyLimit: attachment.MaxSize + 1<<20,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": err.Error(),
@@ -54,7 +71,77 @@ func main() {
 		log.Fatalf("Could not migrate database: %v", err)
 	}
 
-	api.SetupRoutes(app, db)
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatalf("Could not initialize mailer: %v", err)
+	}
+
+	// The Telegram bot is enabled by TELEGRAM_BOT_TOKEN
+	telegramConfig, telegramEnabled, err := telegram.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid Telegram configuration: %v", err)
+	}
+
+	// WhatsApp is enabled by WHATSAPP_ACCESS_TOKEN
+	whatsappConfig, whatsappEnabled, err := whatsapp.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid WhatsApp configuration: %v", err)
+	}
+
+	// Notifications are always stored in-app; external channels are added
+	// here as their transports are configured. Push is only logged until a
+	// push provider is wired up.
+	notifiers := []notify.Notifier{
+		notify.NewLogNotifier(notify.ChannelPush),
+		notify.NewEmailNotifier(mailer),
+	}
+	var telegramBot *telegram.Config
+	if telegramEnabled {
+		telegramBot = &telegramConfig
+		client := telegram.NewClient(telegramConfig)
+		notifiers = append(notifiers, notify.NewTelegramNotifier(client))
+		if telegramConfig.WebhookURL != "" {
+			if err := client.SetWebhook(telegramConfig.WebhookURL, telegramConfig.WebhookSecret); err != nil {
+				log.Printf("Could not register Telegram webhook: %v", err)
+			}
+		}
+	}
+	var whatsappBot *whatsapp.Config
+	if whatsappEnabled {
+		whatsappBot = &whatsappConfig
+		notifiers = append(notifiers, notify.NewWhatsAppNotifier(whatsapp.NewClient(whatsappConfig),
+			whatsappConfig.Template, whatsappConfig.TemplateLanguage))
+	}
+	notifier := notify.NewDispatcher(db, notifiers...)
+
+	budgetTracker := budget.NewTracker(db, notifier)
+
+	// Roll budgets into their next period (and auto-adjust them) in the background
+	go budgetTracker.RunRollover(context.Background(), time.Hour)
+	// Advance income streams past their expected payment dates
+	go cashflow.NewScheduler(db).Run(context.Background(), time.Hour)
+	// Remind people about unpaid split shares
+	go balance.NewReminders(db, notifier).Run(context.Background(), time.Hour)
+	// Refresh behavioral spending patterns once a day
+	go patterns.NewAnalyzer(db).Run(context.Background(), 24*time.Hour)
+
+	tokenConfig, err := token.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid token configuration: %v", err)
+	}
+	tokens := token.NewManager(db, tokenConfig)
+
+	// Codes are only logged until an SMS provider is wired up
+	phoneOTP := otp.NewService(db, otp.NewLogSMSSender())
+
+	blobs, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Could not initialize attachment storage: %v", err)
+	}
+
+	// Rate limits are counted in memory; swap in middleware.NewRedisStore when
+	// running more than one instance
+	api.SetupRoutes(app, db, budgetTracker, tokens, mailer, phoneOTP, middleware.NewMemoryStore(), blobs, telegramBot, whatsappBot)
 
 	// Start server
 	port := os.Getenv("PORT")
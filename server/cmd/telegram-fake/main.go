@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A stand-in for the Telegram Bot API for trying the bot locally. Run the
+// server with TELEGRAM_API_URL=http://localhost:8081 and then:
+//
+//	go run ./cmd/telegram-fake -webhook http://localhost:3000/api/v1/telegram/webhook -secret $TELEGRAM_WEBHOOK_SECRET
+//	curl -X POST 'localhost:8081/chat?id=42' -d '/start <link code>'
+//	curl -X POST 'localhost:8081/chat?id=42' -d '/add 250 Food lunch'
+//	curl localhost:8081/messages
+//
+// POST /chat delivers the body as a message from a private chat to the
+// webhook. Messages the bot sends are logged and listed at /messages.
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	webhook := flag.String("webhook", "", "webhook URL to deliver updates to (setWebhook overrides it)")
+	secret := flag.String("secret", "", "webhook secret token")
+	flag.Parse()
+
+	f := &fake{webhook: *webhook, secret: *secret}
+
+	log.Printf("fake Telegram API listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, f.handler()))
+}
+
+func (f *fake) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat", f.chat)
+	mux.HandleFunc("/messages", f.messages)
+	mux.HandleFunc("/", f.botAPI)
+	return mux
+}
+
+type sentMessage struct {
+	ChatID string    `json:"chat_id"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+type fake struct {
+	mu       sync.Mutex
+	webhook  string
+	secret   string
+	updateID int64
+	sent     []sentMessage
+}
+
+// botAPI handles /bot<token>/<method> calls from the server
+func (f *fake) botAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var params map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		reply(w, false, "invalid JSON body")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch parts[1] {
+	case "sendMessage":
+		msg := sentMessage{
+			ChatID: toString(params["chat_id"]),
+			Text:   toString(params["text"]),
+			SentAt: time.Now(),
+		}
+		f.sent = append(f.sent, msg)
+		log.Printf("bot -> chat %s:\n%s", msg.ChatID, msg.Text)
+	case "setWebhook":
+		f.webhook = toString(params["url"])
+		f.secret = toString(params["secret_token"])
+		log.Printf("webhook set to %s", f.webhook)
+	default:
+		reply(w, false, "method not supported by the fake: "+parts[1])
+		return
+	}
+	reply(w, true, "")
+}
+
+// chat sends the request body to the webhook as a message from chat ?id=
+func (f *fake) chat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	chatID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be a numeric chat ID", http.StatusBadRequest)
+		return
+	}
+	var text bytes.Buffer
+	text.ReadFrom(r.Body)
+
+	f.mu.Lock()
+	f.updateID++
+	update := map[string]interface{}{
+		"update_id": f.updateID,
+		"message": map[string]interface{}{
+			"message_id": f.updateID,
+			"from":       map[string]interface{}{"id": chatID, "first_name": "Test"},
+			"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+			"date":       time.Now().Unix(),
+			"text":       strings.TrimSpace(text.String()),
+		},
+	}
+	webhook, secret := f.webhook, f.secret
+	f.mu.Unlock()
+
+	if webhook == "" {
+		http.Error(w, "no webhook set, pass -webhook or start the server with TELEGRAM_WEBHOOK_URL", http.StatusConflict)
+		return
+	}
+
+	body, _ := json.Marshal(update)
+	req, _ := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, "webhook call failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp.Body.Close()
+	w.WriteHeader(resp.StatusCode)
+}
+
+func (f *fake) messages(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.sent)
+}
+
+func reply(w http.ResponseWriter, ok bool, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]interface{}{"ok": ok}
+	if ok {
+		resp["result"] = true
+	} else {
+		resp["description"] = description
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
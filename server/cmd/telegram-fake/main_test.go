@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/handlers/messaging"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"github.com/sukh-j-14/fingenie-main/internal/telegram"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+)
+
+const (
+	webhookSecret = "test-webhook-secret"
+	asha          = "00000000-0000-4000-8000-0000000000a1"
+	ravi          = "00000000-0000-4000-8000-0000000000a2"
+	chatID        = "42"
+)
+
+// newBot serves the bot's webhook with the fake standing in for the Bot API.
+// The fake sends secret with what it delivers. The database has Asha, whose
+// account no chat is linked to yet and who is owed 45 by Ravi.
+func newBot(t *testing.T, secret string) (*fake, *httptest.Server, *token.Manager, *dbtest.DB) {
+	t.Helper()
+	db, rows := dbtest.Open()
+	rows.Add("users",
+		dbtest.Row{"id": asha, "display_name": "Asha", "telegram_id": "", "preferred_currency": "INR"},
+		dbtest.Row{"id": ravi, "display_name": "Ravi", "telegram_id": "", "preferred_currency": "INR"},
+	)
+	// The fake can't join or sum, so the share carries the columns the
+	// balance query selects from the join
+	rows.Add("split_shares", dbtest.Row{"user_id": ravi, "amount": 45.0, "interest_accrued": 0.0, "is_paid": false,
+		"creditor": asha, "debtor": ravi})
+	rows.Unique("processed_messages", "channel", "message_id")
+	if err := taxonomy.SeedDefaults(db); err != nil {
+		t.Fatalf("SeedDefaults: %v", err)
+	}
+
+	key, err := token.NewHMACKey("test", strings.Repeat("k", token.MinSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := token.NewKeySet("test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := token.NewManager(db, token.Config{Keys: keys, AccessTTL: token.DefaultAccessTTL, RefreshTTL: token.DefaultRefreshTTL})
+
+	f := &fake{secret: secret}
+	api := httptest.NewServer(f.handler())
+	t.Cleanup(api.Close)
+
+	h := messaging.NewTelegramHandler(db, tokens, budget.NewTracker(db, nil), telegram.Config{
+		Token:         "test-token",
+		WebhookSecret: webhookSecret,
+		APIURL:        api.URL,
+	})
+	app := fiber.New()
+	app.Post("/webhook", h.Webhook)
+	bot := httptest.NewServer(adaptor.FiberApp(app))
+	t.Cleanup(bot.Close)
+
+	f.webhook = bot.URL + "/webhook"
+	return f, api, tokens, rows
+}
+
+// send delivers text from a chat through the fake and returns the status the
+// webhook answered with
+func send(t *testing.T, api *httptest.Server, chat, text string) int {
+	t.Helper()
+	resp, err := http.Post(api.URL+"/chat?id="+chat, "text/plain", strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("POST /chat: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// replies waits for the bot, which replies in the background, to have sent
+// n messages and returns everything it sent
+func (f *fake) replies(n int) []sentMessage {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		f.mu.Lock()
+		count := len(f.sent)
+		f.mu.Unlock()
+		if count >= n || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give replies that shouldn't be sent the chance to show up
+	time.Sleep(50 * time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]sentMessage(nil), f.sent...)
+}
+
+func TestLinkAddAndBalance(t *testing.T) {
+	f, api, tokens, rows := newBot(t, webhookSecret)
+	code, err := tokens.IssueOneTime(asha, models.PurposeTelegramLink, token.LinkCodeTTL)
+	if err != nil {
+		t.Fatalf("IssueOneTime: %v", err)
+	}
+
+	steps := []struct {
+		text string
+		want string
+	}{
+		{"/balance", "isn't linked to a FinGenie account"},
+		{"/start " + code, "Linked to Asha's FinGenie account"},
+		{"/add 250 Food lunch", "Added 250.00 INR for Food (lunch)"},
+		{"/add 250 Pottery", `Unknown category "Pottery"`},
+		{"/balance", "Ravi owes you 45.00 INR"},
+		{"/start " + code, "invalid or has expired"}, // codes work once
+	}
+	for i, s := range steps {
+		if status := send(t, api, chatID, s.text); status != http.StatusOK {
+			t.Fatalf("%q: webhook status = %d, want 200", s.text, status)
+		}
+		sent := f.replies(i + 1)
+		if len(sent) != i+1 {
+			t.Fatalf("%q: sent %d messages, want %d", s.text, len(sent), i+1)
+		}
+		if reply := sent[i]; reply.ChatID != chatID || !strings.Contains(reply.Text, s.want) {
+			t.Errorf("%q: sent %+v, want a reply to chat %s containing %q", s.text, reply, chatID, s.want)
+		}
+	}
+
+	var linked, added bool
+	for _, u := range rows.Rows("users") {
+		linked = linked || (u["id"] == asha && u["telegram_id"] == chatID)
+	}
+	for _, e := range rows.Rows("expenses") {
+		added = added || (e["user_id"] == asha && e["amount"] == 250.0 && e["category"] == "Food" && e["description"] == "lunch")
+	}
+	if !linked || !added {
+		t.Errorf("chat linked %v, expense added %v; want both", linked, added)
+	}
+}
+
+func TestWrongWebhookSecretRejected(t *testing.T) {
+	for _, secret := range []string{"wrong-secret", ""} {
+		f, api, _, _ := newBot(t, secret)
+		if status := send(t, api, chatID, "/start"); status != http.StatusUnauthorized {
+			t.Errorf("secret %q: webhook status = %d, want 401", secret, status)
+		}
+		if sent := f.replies(1); len(sent) != 0 {
+			t.Errorf("secret %q: sent %d replies, want 0", secret, len(sent))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A stand-in for the WhatsApp Cloud API for trying the bot locally. Run the
+// server with WHATSAPP_API_URL=http://localhost:8082 and then:
+//
+//	go run ./cmd/whatsapp-fake -webhook http://localhost:3000/api/v1/whatsapp/webhook -secret $WHATSAPP_APP_SECRET
+//	curl -X POST 'localhost:8082/chat?from=919876543210' -d 'link <link code>'
+//	curl -X POST 'localhost:8082/chat?from=919876543210' -d 'what do I owe'
+//	curl localhost:8082/messages
+//
+// POST /chat delivers the body to the webhook as a text message from the
+// number in ?from=, signed with the app secret. Passing the ?id= of an earlier
+// message delivers it again, as WhatsApp does when a webhook call fails.
+// Messages the server sends are logged and listed at /messages.
+func main() {
+	addr := flag.String("addr", ":8082", "address to listen on")
+	webhook := flag.String("webhook", "", "webhook URL to deliver messages to")
+	secret := flag.String("secret", "", "app secret webhook payloads are signed with")
+	flag.Parse()
+
+	f := &fake{webhook: *webhook, secret: *secret}
+
+	log.Printf("fake WhatsApp API listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, f.handler()))
+}
+
+func (f *fake) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat", f.chat)
+	mux.HandleFunc("/messages", f.messages)
+	mux.HandleFunc("/", f.cloudAPI)
+	return mux
+}
+
+type sentMessage struct {
+	To       string          `json:"to"`
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	Template json.RawMessage `json:"template,omitempty"`
+	SentAt   time.Time       `json:"sent_at"`
+}
+
+type fake struct {
+	mu        sync.Mutex
+	webhook   string
+	secret    string
+	messageID int64
+	sent      []sentMessage
+}
+
+// cloudAPI handles POST [/<version>]/<phone number id>/messages calls from
+// the server
+func (f *fake) cloudAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/messages") {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		apiError(w, http.StatusUnauthorized, "missing access token")
+		return
+	}
+
+	var params struct {
+		To       string                `json:"to"`
+		Type     string                `json:"type"`
+		Text     struct{ Body string } `json:"text"`
+		Template json.RawMessage       `json:"template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	msg := sentMessage{To: params.To, Type: params.Type, SentAt: time.Now()}
+	switch params.Type {
+	case "text":
+		msg.Text = params.Text.Body
+		log.Printf("bot -> %s:\n%s", msg.To, msg.Text)
+	case "template":
+		msg.Template = params.Template
+		log.Printf("bot -> %s (template): %s", msg.To, params.Template)
+	default:
+		apiError(w, http.StatusBadRequest, "message type not supported by the fake: "+params.Type)
+		return
+	}
+
+	f.mu.Lock()
+	f.sent = append(f.sent, msg)
+	f.messageID++
+	id := f.messageID
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"contacts":          []map[string]string{{"input": msg.To, "wa_id": msg.To}},
+		"messages":          []map[string]string{{"id": fmt.Sprintf("wamid.fake%d", id)}},
+	})
+}
+
+// chat sends the request body to the webhook as a text message from ?from=
+func (f *fake) chat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	from := strings.TrimPrefix(r.URL.Query().Get("from"), "+")
+	if from == "" || strings.Trim(from, "0123456789") != "" {
+		http.Error(w, "from must be a number in international form, e.g. 919876543210", http.StatusBadRequest)
+		return
+	}
+	if f.webhook == "" {
+		http.Error(w, "no webhook set, pass -webhook", http.StatusConflict)
+		return
+	}
+	var text bytes.Buffer
+	text.ReadFrom(r.Body)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		f.mu.Lock()
+		f.messageID++
+		id = fmt.Sprintf("wamid.fake%d", f.messageID)
+		f.mu.Unlock()
+	}
+
+	payload := map[string]interface{}{
+		"object": "whatsapp_business_account",
+		"entry": []map[string]interface{}{{
+			"id": "fake",
+			"changes": []map[string]interface{}{{
+				"field": "messages",
+				"value": map[string]interface{}{
+					"messaging_product": "whatsapp",
+					"messages": []map[string]interface{}{{
+						"id":        id,
+						"from":      from,
+						"timestamp": fmt.Sprint(time.Now().Unix()),
+						"type":      "text",
+						"text":      map[string]string{"body": strings.TrimSpace(text.String())},
+					}},
+				},
+			}},
+		}},
+	}
+
+	body, _ := json.Marshal(payload)
+	mac := hmac.New(sha256.New, []byte(f.secret))
+	mac.Write(body)
+
+	req, _ := http.NewRequest(http.MethodPost, f.webhook, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, "webhook call failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp.Body.Close()
+	w.WriteHeader(resp.StatusCode)
+}
+
+func (f *fake) messages(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.sent)
+}
+
+func apiError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "code": status},
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/handlers/messaging"
+	"github.com/sukh-j-14/fingenie-main/internal/whatsapp"
+)
+
+const (
+	appSecret = "test-app-secret"
+	linked    = "919876543210"
+	unlinked  = "919800000000"
+	// verified is a phone number verified in the app but never linked
+	verified = "919811111111"
+)
+
+// newBot serves the bot's webhook with the fake standing in for the Cloud
+// API. The fake signs what it delivers with secret. The database has two
+// users: one whose WhatsApp number is linked and one with a verified phone
+// number.
+func newBot(t *testing.T, secret string) (*fake, *httptest.Server) {
+	t.Helper()
+	db, rows := dbtest.Open()
+	rows.Add("users", dbtest.Row{"id": "00000000-0000-4000-8000-0000000000a1", "display_name": "Asha",
+		"whatsapp_number": "+" + linked, "whatsapp_verified_at": time.Now(),
+		"phone_number": "", "phone_verified_at": nil, "preferred_currency": "USD"})
+	rows.Add("users", dbtest.Row{"id": "00000000-0000-4000-8000-0000000000a2", "display_name": "Ravi",
+		"whatsapp_number": "", "whatsapp_verified_at": nil, "whatsapp_unlinked_at": nil,
+		"phone_number": "+" + verified, "phone_verified_at": time.Now(), "preferred_currency": "USD"})
+	rows.Unique("processed_messages", "channel", "message_id")
+
+	f := &fake{secret: secret}
+	api := httptest.NewServer(f.handler())
+	t.Cleanup(api.Close)
+
+	h := messaging.NewWhatsAppHandler(db, nil, budget.NewTracker(db, nil), whatsapp.Config{
+		AccessToken:   "test-token",
+		PhoneNumberID: "100",
+		AppSecret:     appSecret,
+		APIURL:        api.URL,
+	})
+	app := fiber.New()
+	app.Post("/webhook", h.Webhook)
+	bot := httptest.NewServer(adaptor.FiberApp(app))
+	t.Cleanup(bot.Close)
+
+	f.webhook = bot.URL + "/webhook"
+	return f, api
+}
+
+// send delivers text from a number through the fake and returns the status
+// the webhook answered with
+func send(t *testing.T, api *httptest.Server, from, id, text string) int {
+	t.Helper()
+	url := api.URL + "/chat?from=" + from
+	if id != "" {
+		url += "&id=" + id
+	}
+	resp, err := http.Post(url, "text/plain", strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("POST /chat: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// replies waits for the bot, which replies in the background, to have sent
+// n messages and returns everything it sent
+func (f *fake) replies(n int) []sentMessage {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		f.mu.Lock()
+		count := len(f.sent)
+		f.mu.Unlock()
+		if count >= n || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give replies that shouldn't be sent the chance to show up
+	time.Sleep(50 * time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]sentMessage(nil), f.sent...)
+}
+
+func TestBotReplies(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		want string
+	}{
+		{"linked number", linked, "Commands:"},
+		{"unlinked number", unlinked, "isn't linked to a FinGenie account"},
+		{"verified phone number", verified, "Commands:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, api := newBot(t, appSecret)
+			if status := send(t, api, tt.from, "", "help"); status != http.StatusOK {
+				t.Fatalf("webhook status = %d, want 200", status)
+			}
+			sent := f.replies(1)
+			if len(sent) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(sent))
+			}
+			if sent[0].To != tt.from || sent[0].Type != "text" || !strings.Contains(sent[0].Text, tt.want) {
+				t.Errorf("sent %+v, want a text to %s containing %q", sent[0], tt.from, tt.want)
+			}
+		})
+	}
+}
+
+// TestUnlinkTakesEffect checks a number the bot knows, through a link or a
+// verified phone number, isn't recognised after unlinking
+func TestUnlinkTakesEffect(t *testing.T) {
+	for _, from := range []string{linked, verified} {
+		f, api := newBot(t, appSecret)
+		steps := []struct {
+			text string
+			want string
+		}{
+			{"unlink", "has been unlinked"},
+			{"help", "isn't linked to a FinGenie account"},
+			{"unlink", "isn't linked to a FinGenie account"},
+		}
+		for i, s := range steps {
+			send(t, api, from, "", s.text)
+			sent := f.replies(i + 1)
+			if len(sent) != i+1 {
+				t.Fatalf("%s %q: sent %d messages, want %d", from, s.text, len(sent), i+1)
+			}
+			if !strings.Contains(sent[i].Text, s.want) {
+				t.Errorf("%s %q: replied %q, want %q", from, s.text, sent[i].Text, s.want)
+			}
+		}
+	}
+}
+
+func TestRedeliveredMessageAnsweredOnce(t *testing.T) {
+	f, api := newBot(t, appSecret)
+	for i := 0; i < 2; i++ {
+		if status := send(t, api, linked, "wamid.redelivered", "help"); status != http.StatusOK {
+			t.Fatalf("delivery %d: webhook status = %d, want 200", i+1, status)
+		}
+	}
+	if sent := f.replies(2); len(sent) != 1 {
+		t.Errorf("sent %d replies to a message delivered twice, want 1", len(sent))
+	}
+
+	// Another message still gets its own reply
+	send(t, api, linked, "wamid.other", "help")
+	if sent := f.replies(2); len(sent) != 2 {
+		t.Errorf("sent %d replies, want 2", len(sent))
+	}
+}
+
+func TestUnsignedMessagesRejected(t *testing.T) {
+	f, api := newBot(t, "wrong-secret")
+	if status := send(t, api, linked, "", "help"); status != http.StatusUnauthorized {
+		t.Errorf("webhook status = %d, want 401", status)
+	}
+	if sent := f.replies(1); len(sent) != 0 {
+		t.Errorf("sent %d replies to an unsigned message, want 0", len(sent))
+	}
+}
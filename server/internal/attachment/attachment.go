@@ -0,0 +1,130 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxSize is the largest file accepted
+	MaxSize = 10 << 20
+	// MaxPixels guards against images that are small on disk but huge once
+	// decoded
+	MaxPixels = 50_000_000
+	// ThumbnailSize is the longest side of a thumbnail in pixels
+	ThumbnailSize = 320
+	// MaxPerExpense caps how many files one expense can have
+	MaxPerExpense = 10
+)
+
+var (
+	ErrEmpty           = errors.New("file is empty")
+	ErrTooLarge        = fmt.Errorf("file is larger than %d MB", MaxSize>>20)
+	ErrUnsupportedType = errors.New("only JPEG, PNG, WebP and PDF files are accepted")
+	ErrInvalidImage    = errors.New("image could not be read")
+)
+
+// allowed are the accepted content types. Only JPEG and PNG get thumbnails,
+// as those are the formats the standard library decodes.
+var allowed = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// Validate checks the size of an upload and sniffs its content type from
+// the bytes; the type the client declared is not trusted
+func Validate(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", ErrEmpty
+	}
+	if len(data) > MaxSize {
+		return "", ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !allowed[contentType] {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Thumbnail returns a JPEG no larger than ThumbnailSize on either side, and
+// the original's dimensions. It returns nil for types without thumbnails.
+func Thumbnail(data []byte, contentType string) ([]byte, int, int, error) {
+	var decode func([]byte) (image.Image, error)
+	var decodeConfig func([]byte) (image.Config, error)
+	switch contentType {
+	case "image/jpeg":
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+	case "image/png":
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+	default:
+		return nil, 0, 0, nil
+	}
+
+	cfg, err := decodeConfig(data)
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, 0, 0, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, 0, 0, fmt.Errorf("image is larger than %d megapixels", MaxPixels/1_000_000)
+	}
+	img, err := decode(data)
+	if err != nil {
+		return nil, 0, 0, ErrInvalidImage
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(img, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), cfg.Width, cfg.Height, nil
+}
+
+// scale shrinks img so its longest side is at most size, on a white
+// background. Each output pixel averages a 4x4 grid of samples from the area
+// it covers, which is smooth enough for a thumbnail without reading every
+// source pixel.
+func scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	const samples = 4
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint32
+			for sy := 0; sy < samples; sy++ {
+				py := y0 + (y1-y0)*sy/samples
+				for sx := 0; sx < samples; sx++ {
+					px := x0 + (x1-x0)*sx/samples
+					cr, cg, cb, ca := img.At(px, py).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			// Colours are premultiplied, so this puts transparent areas on white
+			bg := 0xffff - a/n
+			out.Set(x, y, color.RGBA64{R: uint16(r/n + bg), G: uint16(g/n + bg), B: uint16(bl/n + bg), A: 0xffff})
+		}
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package balance
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// LargePaymentAmount is the share size, in BaseCurrency, from which marking
+// it paid needs a recent 2FA check
+const LargePaymentAmount = 1000
+
+// Balance is what the user and one other person owe each other across all
+// unpaid split shares. A positive Amount means they owe the user, a negative
+// one that the user owes them.
+type Balance struct {
+	UserID      string  `json:"userId"`
+	DisplayName string  `json:"displayName"`
+	Handle      *string `json:"handle,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+type Summary struct {
+	OwedToYou float64   `json:"owedToYou"`
+	YouOwe    float64   `json:"youOwe"`
+	Net       float64   `json:"net"`
+	People    []Balance `json:"people"`
+}
+
+// Service works out who owes whom from split shares. The creator of a split
+// paid for it, so every unpaid share of someone else is owed to the creator.
+type Service struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, now: time.Now}
+}
+
+type debt struct {
+	Creditor string
+	Debtor   string
+	Amount   float64
+}
+
+// Summary nets the user's debts against what they are owed, per person
+func (s *Service) Summary(userID string) (*Summary, error) {
+	var debts []debt
+	err := s.db.Model(&models.SplitShare{}).
+		Select("split_expenses.created_by AS creditor, split_shares.user_id AS debtor, SUM(split_shares.amount + split_shares.interest_accrued) AS amount").
+		Joins("JOIN split_expenses ON split_expenses.id = split_shares.split_expense_id AND split_expenses.deleted_at IS NULL").
+		Where("split_shares.is_paid = ? AND split_shares.user_id <> split_expenses.created_by", false).
+		Where("split_expenses.created_by = ? OR split_shares.user_id = ?", userID, userID).
+		Group("split_expenses.created_by, split_shares.user_id").
+		Scan(&debts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	net := make(map[string]float64)
+	for _, d := range debts {
+		if d.Creditor == userID {
+			net[d.Debtor] += d.Amount
+		} else {
+			net[d.Creditor] -= d.Amount
+		}
+	}
+
+	ids := make([]string, 0, len(net))
+	for id := range net {
+		ids = append(ids, id)
+	}
+	var users []models.User
+	if len(ids) > 0 {
+		if err := s.db.Select("id", "display_name", "handle").Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[string]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	summary := &Summary{People: []Balance{}}
+	for id, amount := range net {
+		amount = round(amount)
+		if amount == 0 {
+			continue
+		}
+		summary.People = append(summary.People, Balance{
+			UserID:      id,
+			DisplayName: byID[id].DisplayName,
+			Handle:      byID[id].Handle,
+			Amount:      amount,
+		})
+		if amount > 0 {
+			summary.OwedToYou += amount
+		} else {
+			summary.YouOwe -= amount
+		}
+	}
+	summary.OwedToYou = round(summary.OwedToYou)
+	summary.YouOwe = round(summary.YouOwe)
+	summary.Net = round(summary.OwedToYou - summary.YouOwe)
+
+	sort.Slice(summary.People, func(i, j int) bool {
+		return math.Abs(summary.People[i].Amount) > math.Abs(summary.People[j].Amount)
+	})
+	return summary, nil
+}
+
+// Owed returns what debtor owes creditor across their unpaid shares, as the
+// sum of the share amounts and converted to BaseCurrency
+func (s *Service) Owed(creditorID, debtorID string) (float64, float64, error) {
+	var shares []struct {
+		Amount   float64
+		Currency string
+	}
+	if err := owedShares(s.db, debtorID, creditorID).
+		Select("split_shares.amount + split_shares.interest_accrued AS amount, COALESCE(expenses.original_currency, '') AS currency").
+		Joins("LEFT JOIN split_expenses ON split_expenses.id = split_shares.split_expense_id").
+		Joins("LEFT JOIN expenses ON expenses.id = split_expenses.expense_id").
+		Scan(&shares).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var total, base float64
+	for _, share := range shares {
+		total += share.Amount
+		base += InBase(share.Amount, share.Currency)
+	}
+	return round(total), round(base), nil
+}
+
+// SettleUp records that debtor has paid creditor: every unpaid share debtor
+// has in a split creditor created is marked paid. Only the person who was
+// paid can confirm that, so callers pass the acting user as creditorID; what
+// they owe debtor in return waits for debtor to settle. It returns the amount
+// cleared.
+func (s *Service) SettleUp(creditorID, debtorID string) (float64, error) {
+	var cleared float64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var shares []models.SplitShare
+		if err := owedShares(tx, debtorID, creditorID).Find(&shares).Error; err != nil {
+			return err
+		}
+
+		var ids []string
+		for _, share := range shares {
+			ids = append(ids, share.ID)
+			cleared += share.Amount + share.InterestAccrued
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&models.SplitShare{}).
+			Where("id IN ? AND is_paid = ?", ids, false).
+			Updates(map[string]interface{}{"is_paid": true, "paid_at": s.now()}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return round(cleared), nil
+}
+
+// owedShares selects payer's unpaid shares in splits created by payee
+func owedShares(db *gorm.DB, payerID, payeeID string) *gorm.DB {
+	return db.Model(&models.SplitShare{}).
+		Where("split_shares.user_id = ? AND split_shares.is_paid = ?", payerID, false).
+		Where("split_shares.split_expense_id IN (?)", db.Model(&models.SplitExpense{}).Select("id").Where("created_by = ?", payeeID))
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,54 @@
+package balance
+
+import "strings"
+
+// BaseCurrency is the currency LargePaymentAmount is expressed in
+const BaseCurrency = "USD"
+
+// baseRates are rough units of each currency per US dollar. They only decide
+// when a payment is large enough to need a 2FA check, so they don't have to
+// track the market closely.
+var baseRates = map[string]float64{
+	"USD": 1,
+	"EUR": 0.92,
+	"GBP": 0.79,
+	"CHF": 0.88,
+	"INR": 83,
+	"JPY": 150,
+	"CNY": 7.2,
+	"AUD": 1.5,
+	"CAD": 1.36,
+	"NZD": 1.65,
+	"SGD": 1.35,
+	"HKD": 7.8,
+	"AED": 3.67,
+	"SAR": 3.75,
+	"KWD": 0.31,
+	"BHD": 0.38,
+	"OMR": 0.38,
+	"JOD": 0.71,
+	"ZAR": 18.5,
+	"BRL": 5.1,
+	"MXN": 17,
+	"SEK": 10.5,
+	"NOK": 10.6,
+	"DKK": 6.9,
+	"PKR": 280,
+	"BDT": 110,
+	"LKR": 300,
+	"NPR": 133,
+}
+
+// InBase converts amount in currency to BaseCurrency. Amounts in currencies
+// without a rate are returned unchanged.
+func InBase(amount float64, currency string) float64 {
+	if rate, ok := baseRates[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return amount / rate
+	}
+	return amount
+}
+
+// IsLarge reports whether amount in currency reaches LargePaymentAmount
+func IsLarge(amount float64, currency string) bool {
+	return InBase(amount, currency) >= LargePaymentAmount
+}
@@ -0,0 +1,101 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/notify"
+	"gorm.io/gorm"
+)
+
+// Reminders nudges people about unpaid split shares. A share with a
+// ReminderFrequency of daily, weekly or monthly is first reminded when its
+// split falls due and then once per period until it is paid.
+type Reminders struct {
+	db       *gorm.DB
+	notifier *notify.Dispatcher
+}
+
+func NewReminders(db *gorm.DB, notifier *notify.Dispatcher) *Reminders {
+	return &Reminders{db: db, notifier: notifier}
+}
+
+// Run sends due reminders every interval until ctx is cancelled
+func (r *Reminders) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Send(time.Now()); err != nil {
+			log.Printf("balance: sending reminders failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send delivers every reminder due at now and schedules the next one
+func (r *Reminders) Send(now time.Time) error {
+	var shares []models.SplitShare
+	err := r.db.Preload("SplitExpense.Expense").Preload("SplitExpense.Creator").
+		Joins("JOIN split_expenses ON split_expenses.id = split_shares.split_expense_id AND split_expenses.deleted_at IS NULL").
+		Where("split_shares.is_paid = ? AND split_shares.reminder_frequency IN ?", false, []string{"daily", "weekly", "monthly"}).
+		Where("split_shares.user_id <> split_expenses.created_by").
+		Where("split_shares.next_reminder_date <= ? OR (split_shares.next_reminder_date IS NULL AND split_expenses.due_date <= ?)", now, now).
+		Find(&shares).Error
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		if err := r.notifier.Notify(share.UserID, reminderMessage(share)); err != nil {
+			log.Printf("balance: could not remind user %s about share %s: %v", share.UserID, share.ID, err)
+			continue
+		}
+		next := nextReminder(now, share.ReminderFrequency)
+		if err := r.db.Model(&models.SplitShare{}).Where("id = ?", share.ID).Update("next_reminder_date", next).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nextReminder(now time.Time, frequency string) time.Time {
+	switch frequency {
+	case "daily":
+		return now.AddDate(0, 0, 1)
+	case "weekly":
+		return now.AddDate(0, 0, 7)
+	}
+	return now.AddDate(0, 1, 0)
+}
+
+func reminderMessage(share models.SplitShare) notify.Message {
+	split := share.SplitExpense
+	amount := round(share.Amount + share.InterestAccrued)
+
+	body := fmt.Sprintf("You owe %s %.2f", split.Creator.DisplayName, amount)
+	if description := strings.TrimSpace(split.Expense.Description); description != "" {
+		body += " for " + description
+	}
+	body += fmt.Sprintf(", due %s.", split.DueDate.Format("2 Jan 2006"))
+
+	return notify.Message{
+		Type:  "payment_reminder",
+		Title: "Payment reminder",
+		Body:  body,
+		Data: map[string]interface{}{
+			"splitShareId":   share.ID,
+			"splitExpenseId": split.ID,
+			"amount":         amount,
+		},
+	}
+}
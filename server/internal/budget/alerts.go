@@ -0,0 +1,197 @@
+package budget
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/notify"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultAlertThresholds are used for budgets that don't set their own
+var DefaultAlertThresholds = []int{50, 80, 100}
+
+// Tracker keeps Budget.CurrentSpent in sync with expenses and raises an alert
+// the first time spending crosses each threshold in a budget period.
+type Tracker struct {
+	db       *gorm.DB
+	notifier *notify.Dispatcher
+}
+
+func NewTracker(db *gorm.DB, notifier *notify.Dispatcher) *Tracker {
+	return &Tracker{
+		db:       db,
+		notifier: notifier,
+	}
+}
+
+// ExpenseChanged refreshes every budget the expense counts towards: those for
+// its category and for the category's parent. It is called after an expense
+// is created, updated or deleted. Payments count towards no budget.
+func (t *Tracker) ExpenseChanged(expense models.Expense) {
+	if expense.IsPayment() {
+		return
+	}
+	var budgets []models.Budget
+	query := t.db.Where("start_date <= ? AND end_date >= ?", expense.Date, expense.Date)
+	if expense.CategoryID != nil {
+		query = query.Where("(category_id = ? OR category_id = (SELECT parent_id FROM categories WHERE id = ?))",
+			*expense.CategoryID, *expense.CategoryID)
+	} else {
+		query = query.Where("LOWER(category) = LOWER(?)", expense.Category)
+	}
+	if expense.GroupID != nil && *expense.GroupID != "" {
+		query = query.Where("(group_id IS NULL AND user_id = ?) OR group_id = ?", expense.UserID, *expense.GroupID)
+	} else {
+		query = query.Where("group_id IS NULL AND user_id = ?", expense.UserID)
+	}
+	if err := query.Find(&budgets).Error; err != nil {
+		log.Printf("budget: could not load budgets for expense %s: %v", expense.ID, err)
+		return
+	}
+
+	for i := range budgets {
+		if err := t.Refresh(&budgets[i]); err != nil {
+			log.Printf("budget: could not refresh budget %s: %v", budgets[i].ID, err)
+		}
+	}
+}
+
+// Refresh recomputes CurrentSpent for the budget's current period and sends
+// any threshold alerts that have not been sent yet.
+func (t *Tracker) Refresh(budget *models.Budget) error {
+	spent, err := t.spent(budget)
+	if err != nil {
+		return err
+	}
+
+	if err := t.db.Model(budget).Update("current_spent", spent).Error; err != nil {
+		return fmt.Errorf("could not update current spent: %w", err)
+	}
+	budget.CurrentSpent = spent
+
+	return t.checkThresholds(budget)
+}
+
+func (t *Tracker) spent(budget *models.Budget) (float64, error) {
+	return t.spentBetween(budget, budget.StartDate, budget.EndDate)
+}
+
+func (t *Tracker) spentBetween(budget *models.Budget, from, to time.Time) (float64, error) {
+	var spent float64
+	if err := t.scope(budget).
+		Where("date >= ? AND date <= ?", from, to).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&spent).Error; err != nil {
+		return 0, fmt.Errorf("could not sum expenses: %w", err)
+	}
+	return spent, nil
+}
+
+// scope selects the expenses that count towards a budget, ignoring dates. A
+// budget for a category includes its subcategories; payments are left out.
+func (t *Tracker) scope(budget *models.Budget) *gorm.DB {
+	query := t.db.Model(&models.Expense{}).
+		Where("NOT (COALESCE(tags, '[]'::jsonb) @> ?::jsonb)", `["`+models.TagPayment+`"]`)
+	if budget.CategoryID != nil {
+		query = query.Where("category_id IN (SELECT id FROM categories WHERE id = ? OR parent_id = ?)",
+			*budget.CategoryID, *budget.CategoryID)
+	} else {
+		query = query.Where("LOWER(category) = LOWER(?)", budget.Category)
+	}
+	if budget.GroupID != nil {
+		return query.Where("group_id = ?", *budget.GroupID)
+	}
+	return query.Where("user_id = ?", budget.UserID)
+}
+
+func (t *Tracker) checkThresholds(budget *models.Budget) error {
+	if budget.Amount <= 0 {
+		return nil
+	}
+
+	thresholds := budget.AlertThresholds
+	if len(thresholds) == 0 {
+		thresholds = DefaultAlertThresholds
+	}
+	thresholds = append([]int(nil), thresholds...)
+	sort.Ints(thresholds)
+
+	percent := budget.CurrentSpent / budget.Amount * 100
+	for _, threshold := range thresholds {
+		if threshold <= 0 || percent < float64(threshold) {
+			continue
+		}
+
+		alert := models.BudgetAlert{
+			BudgetID:    budget.ID,
+			Threshold:   threshold,
+			PeriodStart: budget.StartDate,
+			Spent:       budget.CurrentSpent,
+			TriggeredAt: time.Now(),
+		}
+		result := t.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+		if result.Error != nil {
+			return fmt.Errorf("could not record budget alert: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// Already alerted for this threshold in this period
+			continue
+		}
+
+		recipients, err := t.recipients(budget)
+		if err != nil {
+			return err
+		}
+		if err := t.notifier.NotifyAll(recipients, alertMessage(budget, threshold, percent)); err != nil {
+			log.Printf("budget: could not deliver alert for budget %s: %v", budget.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// recipients returns the owner of a personal budget, or every active member of
+// the group for a group budget
+func (t *Tracker) recipients(budget *models.Budget) ([]string, error) {
+	if budget.GroupID == nil {
+		return []string{budget.UserID}, nil
+	}
+
+	var userIDs []string
+	if err := t.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND is_active = ?", *budget.GroupID, true).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, fmt.Errorf("could not load group members: %w", err)
+	}
+	return userIDs, nil
+}
+
+func alertMessage(budget *models.Budget, threshold int, percent float64) notify.Message {
+	title := fmt.Sprintf("%s budget %d%% used", budget.Category, threshold)
+	if threshold >= 100 {
+		title = fmt.Sprintf("%s budget exceeded", budget.Category)
+	}
+
+	data := map[string]interface{}{
+		"budgetId":  budget.ID,
+		"threshold": threshold,
+		"spent":     budget.CurrentSpent,
+		"amount":    budget.Amount,
+	}
+	if budget.GroupID != nil {
+		data["groupId"] = *budget.GroupID
+	}
+
+	return notify.Message{
+		Type:  "budget_alert",
+		Title: title,
+		Body: fmt.Sprintf("You have spent %.2f of your %.2f %s budget (%.0f%%) for this %s.",
+			budget.CurrentSpent, budget.Amount, budget.Category, percent, budget.Period),
+		Data: data,
+	}
+}
@@ -0,0 +1,54 @@
+package budget
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestPaymentsChangeNoBudget(t *testing.T) {
+	const userID = "00000000-0000-4000-8000-0000000000a1"
+	now := time.Now()
+	tests := []struct {
+		name    string
+		tags    []string
+		refresh bool
+	}{
+		{"spending", []string{"splitwise"}, true},
+		{"payment", []string{"splitwise", models.TagPayment}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open()
+			fake.Add("budgets", dbtest.Row{"user_id": userID, "category": "Transfers", "amount": 100.0,
+				"start_date": now.AddDate(0, 0, -1), "end_date": now.AddDate(0, 0, 1)})
+
+			NewTracker(db, nil).ExpenseChanged(models.Expense{UserID: userID, Category: "Transfers", Amount: 500, Date: now, Tags: tt.tags})
+
+			refreshed := false
+			for _, s := range fake.Statements() {
+				refreshed = refreshed || strings.HasPrefix(s, `UPDATE "budgets"`)
+			}
+			if refreshed != tt.refresh {
+				t.Errorf("budget refreshed = %v, want %v", refreshed, tt.refresh)
+			}
+		})
+	}
+}
+
+func TestScopeLeavesOutPayments(t *testing.T) {
+	db, _ := dbtest.Open()
+	tracker := NewTracker(db.Session(&gorm.Session{DryRun: true}), nil)
+	stmt := tracker.scope(&models.Budget{UserID: "u", Category: "Food"}).Find(&[]models.Expense{}).Statement
+
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "NOT (COALESCE(tags, '[]'::jsonb) @> $1::jsonb)") {
+		t.Fatalf("scope doesn't exclude payments: %s", sql)
+	}
+	if len(stmt.Vars) == 0 || stmt.Vars[0] != `["payment"]` {
+		t.Errorf("vars = %v, want the payment tag first", stmt.Vars)
+	}
+}
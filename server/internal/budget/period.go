@@ -0,0 +1,64 @@
+package budget
+
+import (
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+)
+
+// Anchor returns the start of the budget's first period, which later periods
+// are counted from. Budgets saved before anchors were recorded use their
+// current start.
+func Anchor(budget *models.Budget) time.Time {
+	if budget.PeriodAnchor != nil {
+		return *budget.PeriodAnchor
+	}
+	return budget.StartDate
+}
+
+// NextPeriod returns the budget period that follows [start, end]. For known
+// periods starts are counted from the anchor, so a monthly budget anchored on
+// Jan 31 starts on Feb 28 and then Mar 31 rather than drifting to the 28th,
+// and the gap between the end and the following start is preserved, so a
+// budget running Jan 1 00:00 - Jan 31 23:59:59 rolls to Feb 1 - Feb 28 23:59:59.
+// Custom periods are repeated with the same duration.
+func NextPeriod(period string, anchor, start, end time.Time) (time.Time, time.Time) {
+	if !schedule.IsKnown(period) {
+		length := end.Sub(start)
+		return end, end.Add(length)
+	}
+
+	n := index(period, anchor, start)
+	nextStart := schedule.Shift(anchor, period, n+1)
+	gap := nextStart.Sub(end)
+	return nextStart, schedule.Shift(anchor, period, n+2).Add(-gap)
+}
+
+// PreviousPeriod is the inverse of NextPeriod
+func PreviousPeriod(period string, anchor, start, end time.Time) (time.Time, time.Time) {
+	if !schedule.IsKnown(period) {
+		length := end.Sub(start)
+		return start.Add(-length), start
+	}
+
+	n := index(period, anchor, start)
+	gap := schedule.Shift(anchor, period, n+1).Sub(end)
+	return schedule.Shift(anchor, period, n-1), schedule.Shift(anchor, period, n).Add(-gap)
+}
+
+// index returns the number of the period counted from the anchor that t falls
+// in, negative before the anchor
+func index(period string, anchor, t time.Time) int {
+	n := 0
+	if length := schedule.Advance(anchor, period).Sub(anchor); length > 0 {
+		n = int(t.Sub(anchor) / length)
+	}
+	for schedule.Shift(anchor, period, n).After(t) {
+		n--
+	}
+	for !schedule.Shift(anchor, period, n+1).After(t) {
+		n++
+	}
+	return n
+}
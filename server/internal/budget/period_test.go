@@ -0,0 +1,49 @@
+package budget
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextPeriodKeepsAnchorDay(t *testing.T) {
+	anchor := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	start, end := anchor, time.Date(2026, 2, 27, 23, 59, 59, 0, time.UTC)
+
+	want := []time.Time{
+		time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 4, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC),
+	}
+	for _, w := range want {
+		previousEnd := end
+		start, end = NextPeriod("monthly", anchor, start, end)
+		if !start.Equal(w) {
+			t.Fatalf("next start = %v, want %v", start, w)
+		}
+		if gap := start.Sub(previousEnd); gap != time.Second {
+			t.Fatalf("gap before %v = %v, want 1s", start, gap)
+		}
+	}
+
+	for i := len(want) - 2; i >= 0; i-- {
+		start, end = PreviousPeriod("monthly", anchor, start, end)
+		if !start.Equal(want[i]) {
+			t.Fatalf("previous start = %v, want %v", start, want[i])
+		}
+	}
+	start, end = PreviousPeriod("monthly", anchor, start, end)
+	if !start.Equal(anchor) || !end.Equal(time.Date(2026, 2, 27, 23, 59, 59, 0, time.UTC)) {
+		t.Fatalf("first period = %v - %v", start, end)
+	}
+}
+
+func TestNextPeriodCustom(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 10)
+
+	nextStart, nextEnd := NextPeriod("custom", start, start, end)
+	if !nextStart.Equal(end) || nextEnd.Sub(nextStart) != end.Sub(start) {
+		t.Fatalf("custom next = %v - %v", nextStart, nextEnd)
+	}
+}
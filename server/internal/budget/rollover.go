@@ -0,0 +1,106 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+	"gorm.io/gorm"
+)
+
+// RunRollover rolls over expired budgets every interval until ctx is done
+func (t *Tracker) RunRollover(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Rollover(time.Now()); err != nil {
+			log.Printf("budget: rollover failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Rollover moves every recurring budget whose period has ended into the
+// period that contains now. Budgets with a custom period cover a single
+// range and are left to expire. Auto-adjusting budgets take the suggested amount for the new
+// period and the change is recorded as a BudgetAdjustment.
+func (t *Tracker) Rollover(now time.Time) error {
+	var budgets []models.Budget
+	if err := t.db.Where("end_date < ?", now).Find(&budgets).Error; err != nil {
+		return fmt.Errorf("could not load expired budgets: %w", err)
+	}
+
+	for i := range budgets {
+		if !schedule.IsKnown(budgets[i].Period) {
+			continue
+		}
+		if err := t.rollover(&budgets[i], now); err != nil {
+			log.Printf("budget: could not roll over budget %s: %v", budgets[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) rollover(budget *models.Budget, now time.Time) error {
+	if !budget.EndDate.After(budget.StartDate) {
+		return fmt.Errorf("budget period is empty")
+	}
+
+	for budget.EndDate.Before(now) {
+		budget.StartDate, budget.EndDate = NextPeriod(budget.Period, Anchor(budget), budget.StartDate, budget.EndDate)
+	}
+
+	suggestion, err := t.Suggest(budget)
+	if err != nil {
+		return err
+	}
+
+	previous := budget.Amount
+	budget.AISuggestedAmount = suggestion.Amount
+	if budget.IsAutoAdjusting && suggestion.Amount > 0 {
+		budget.Amount = suggestion.Amount
+	}
+
+	err = t.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(budget).Updates(map[string]interface{}{
+			"start_date":          budget.StartDate,
+			"end_date":            budget.EndDate,
+			"amount":              budget.Amount,
+			"ai_suggested_amount": budget.AISuggestedAmount,
+			"current_spent":       0,
+		}).Error; err != nil {
+			return err
+		}
+
+		if !budget.IsAutoAdjusting {
+			return nil
+		}
+
+		adjustment := models.BudgetAdjustment{
+			BudgetID:        budget.ID,
+			PeriodStart:     budget.StartDate,
+			PreviousAmount:  previous,
+			NewAmount:       budget.Amount,
+			TrailingAverage: suggestion.TrailingAverage,
+			SeasonalFactor:  suggestion.SeasonalFactor,
+			PeriodIncome:    suggestion.PeriodIncome,
+			Reasons:         suggestion.Reasons,
+		}
+		return tx.Create(&adjustment).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not save rolled over budget: %w", err)
+	}
+
+	// Expenses may already have been recorded in the new period
+	return t.Refresh(budget)
+}
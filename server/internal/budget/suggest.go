@@ -0,0 +1,192 @@
+package budget
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+)
+
+const (
+	// lookbackPeriods is how many past periods feed the trailing average
+	lookbackPeriods = 6
+	// spendBuffer leaves headroom above the expected spend
+	spendBuffer = 1.10
+	// seasonal adjustments are clamped so one unusual year can't dominate
+	minSeasonalFactor = 0.75
+	maxSeasonalFactor = 1.5
+	// maxIncomeShare caps a single category budget relative to income
+	maxIncomeShare = 0.5
+	// suggestions are rounded up to a multiple of this
+	roundingStep = 5
+)
+
+// Suggestion is a deterministic budget amount together with the inputs and
+// reasoning that produced it
+type Suggestion struct {
+	Amount          float64  `json:"amount"`
+	TrailingAverage float64  `json:"trailingAverage"`
+	PeriodsUsed     int      `json:"periodsUsed"`
+	SeasonalFactor  float64  `json:"seasonalFactor"`
+	PeriodIncome    float64  `json:"periodIncome"`
+	Reasons         []string `json:"reasons"`
+}
+
+// suggestionInput holds everything the engine needs so it can be evaluated
+// without a database
+type suggestionInput struct {
+	current float64
+	// history is the spend in each past period, most recent first
+	history []float64
+	// lastYear is the spend in the same period one year earlier and
+	// lastYearBaseline the average of the periods leading up to it
+	lastYear         float64
+	lastYearBaseline float64
+	periodIncome     float64
+}
+
+func suggest(in suggestionInput) Suggestion {
+	s := Suggestion{
+		SeasonalFactor: 1,
+		PeriodIncome:   in.periodIncome,
+		PeriodsUsed:    len(in.history),
+	}
+
+	if len(in.history) == 0 {
+		s.Amount = in.current
+		s.Reasons = append(s.Reasons, "No spending history in this category yet; keeping the current amount")
+		return s
+	}
+
+	// Weight recent periods more heavily: n, n-1, ..., 1
+	var weighted, weights float64
+	for i, spent := range in.history {
+		w := float64(len(in.history) - i)
+		weighted += spent * w
+		weights += w
+	}
+	s.TrailingAverage = weighted / weights
+	s.Reasons = append(s.Reasons, fmt.Sprintf("Weighted average spend over the last %d periods is %.2f",
+		len(in.history), s.TrailingAverage))
+
+	amount := s.TrailingAverage
+	if in.lastYear > 0 && in.lastYearBaseline > 0 {
+		factor := in.lastYear / in.lastYearBaseline
+		factor = math.Max(minSeasonalFactor, math.Min(maxSeasonalFactor, factor))
+		if math.Abs(factor-1) >= 0.05 {
+			s.SeasonalFactor = factor
+			amount *= factor
+			s.Reasons = append(s.Reasons, fmt.Sprintf("Spending in this period last year was %.0f%% of the usual level",
+				factor*100))
+		}
+	}
+
+	amount *= spendBuffer
+	s.Reasons = append(s.Reasons, fmt.Sprintf("Added a %.0f%% buffer", (spendBuffer-1)*100))
+
+	if in.periodIncome > 0 {
+		limit := in.periodIncome * maxIncomeShare
+		if amount > limit {
+			amount = limit
+			s.Reasons = append(s.Reasons, fmt.Sprintf("Capped at %.0f%% of expected income (%.2f) for the period",
+				maxIncomeShare*100, in.periodIncome))
+		}
+	}
+
+	s.Amount = math.Ceil(amount/roundingStep) * roundingStep
+	return s
+}
+
+// Suggest computes a suggested amount for the budget's current period from
+// the spending history of its category, last year's seasonality and the
+// owner's (or group members') income streams.
+func (t *Tracker) Suggest(budget *models.Budget) (Suggestion, error) {
+	in := suggestionInput{current: budget.Amount}
+
+	earliest, err := t.earliestExpense(budget)
+	if err != nil {
+		return Suggestion{}, err
+	}
+
+	start, end := budget.StartDate, budget.EndDate
+	if earliest != nil {
+		for i := 0; i < lookbackPeriods; i++ {
+			start, end = PreviousPeriod(budget.Period, Anchor(budget), start, end)
+			if end.Before(*earliest) {
+				break
+			}
+			spent, err := t.spentBetween(budget, start, end)
+			if err != nil {
+				return Suggestion{}, err
+			}
+			in.history = append(in.history, spent)
+		}
+
+		lyStart, lyEnd := budget.StartDate.AddDate(-1, 0, 0), budget.EndDate.AddDate(-1, 0, 0)
+		if !lyStart.Before(*earliest) {
+			if in.lastYear, err = t.spentBetween(budget, lyStart, lyEnd); err != nil {
+				return Suggestion{}, err
+			}
+			var total float64
+			var count int
+			start, end = lyStart, lyEnd
+			for i := 0; i < lookbackPeriods; i++ {
+				start, end = PreviousPeriod(budget.Period, Anchor(budget), start, end)
+				if end.Before(*earliest) {
+					break
+				}
+				spent, err := t.spentBetween(budget, start, end)
+				if err != nil {
+					return Suggestion{}, err
+				}
+				total += spent
+				count++
+			}
+			if count > 0 {
+				in.lastYearBaseline = total / float64(count)
+			}
+		}
+	}
+
+	if in.periodIncome, err = t.periodIncome(budget); err != nil {
+		return Suggestion{}, err
+	}
+
+	return suggest(in), nil
+}
+
+func (t *Tracker) earliestExpense(budget *models.Budget) (*time.Time, error) {
+	var expense models.Expense
+	result := t.scope(budget).Order("date ASC").Limit(1).Find(&expense)
+	if result.Error != nil {
+		return nil, fmt.Errorf("could not load expense history: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &expense.Date, nil
+}
+
+// periodIncome is the expected income over one budget period, summed across
+// the budget owner's income streams, or all active members for a group budget
+func (t *Tracker) periodIncome(budget *models.Budget) (float64, error) {
+	userIDs, err := t.recipients(budget)
+	if err != nil {
+		return 0, err
+	}
+
+	var streams []models.IncomeStream
+	if err := t.db.Where("user_id IN ?", userIDs).Find(&streams).Error; err != nil {
+		return 0, fmt.Errorf("could not load income streams: %w", err)
+	}
+
+	var monthly float64
+	for _, stream := range streams {
+		monthly += schedule.PerMonth(stream.Amount, stream.Frequency)
+	}
+
+	days := budget.EndDate.Sub(budget.StartDate).Hours() / 24
+	return monthly * days / (365.0 / 12), nil
+}
@@ -0,0 +1,407 @@
+package cashflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+	"gorm.io/gorm"
+)
+
+// Event types that make up a forecast
+const (
+	EventIncome           = "income"
+	EventRecurringExpense = "recurring_expense"
+	EventShareOwed        = "share_owed"
+	EventShareReceivable  = "share_receivable"
+	EventBudget           = "budget_allocation"
+	EventPlanned          = "planned"
+)
+
+// Event is a single expected inflow (positive Amount) or outflow (negative)
+type Event struct {
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	ReferenceID string    `json:"referenceId,omitempty"`
+}
+
+// Day is the projected position at the end of one day
+type Day struct {
+	Date    time.Time `json:"date"`
+	Inflow  float64   `json:"inflow"`
+	Outflow float64   `json:"outflow"`
+	Balance float64   `json:"balance"`
+}
+
+// Forecast is in the user's preferred currency, which income streams and
+// budgets are kept in. There are no exchange rates to convert the rest with,
+// so events in other currencies stay out of the totals and the balance;
+// OtherCurrencies has their net change by currency instead.
+type Forecast struct {
+	From              time.Time `json:"from"`
+	To                time.Time `json:"to"`
+	Currency          string    `json:"currency"`
+	StartingBalance   float64   `json:"startingBalance"`
+	ExpectedIncome    float64   `json:"expectedIncome"`
+	RecurringExpenses float64   `json:"recurringExpenses"`
+	SharesOwed        float64   `json:"sharesOwed"`
+	SharesReceivable  float64   `json:"sharesReceivable"`
+	BudgetAllocations float64   `json:"budgetAllocations"`
+	PlannedSpend      float64   `json:"plannedSpend"`
+	NetChange         float64   `json:"netChange"`
+	EndingBalance     float64   `json:"endingBalance"`
+	LowestBalance     float64   `json:"lowestBalance"`
+	LowestBalanceDate time.Time `json:"lowestBalanceDate"`
+	CanAfford         bool      `json:"canAfford"`
+	Events            []Event   `json:"events"`
+	Days              []Day     `json:"days"`
+
+	OtherCurrencies map[string]float64 `json:"otherCurrencies,omitempty"`
+}
+
+// Options controls the forecast window. Planned, when set, is an extra
+// one-off outflow (such as a group trip) to test affordability against.
+// StartingBalance and Planned are in the user's preferred currency.
+type Options struct {
+	From            time.Time
+	Days            int
+	StartingBalance float64
+	Planned         *Event
+}
+
+type Forecaster struct {
+	db *gorm.DB
+}
+
+func NewForecaster(db *gorm.DB) *Forecaster {
+	return &Forecaster{db: db}
+}
+
+// Forecast projects the user's cash position over the window, combining
+// expected income, recurring expenses, outstanding split shares in both
+// directions and the unspent part of their personal budgets. Recurring
+// expenses in a budgeted category are treated as covered by that budget so
+// they are not counted twice.
+func (f *Forecaster) Forecast(userID string, opts Options) (*Forecast, error) {
+	from := startOfDay(opts.From)
+	to := from.AddDate(0, 0, opts.Days)
+
+	var user models.User
+	if err := f.db.Select("id", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("could not load user: %w", err)
+	}
+	currency := user.PreferredCurrency
+
+	var events []Event
+
+	income, err := f.incomeEvents(userID, currency, from, to)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, income...)
+
+	budgets, budgeted, err := f.budgetEvents(userID, currency, opts.From, to)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, budgets...)
+
+	recurring, err := f.recurringEvents(userID, from, to, budgeted)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, recurring...)
+
+	shares, err := f.shareEvents(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, shares...)
+
+	if opts.Planned != nil {
+		planned := *opts.Planned
+		planned.Type = EventPlanned
+		planned.Currency = currency
+		if planned.Date.Before(from) {
+			planned.Date = from
+		}
+		if planned.Date.Before(to) {
+			events = append(events, planned)
+		}
+	}
+
+	return build(from, to, currency, opts.StartingBalance, events), nil
+}
+
+// build totals the events in currency and produces the daily balance series
+func build(from, to time.Time, currency string, startingBalance float64, events []Event) *Forecast {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+
+	fc := &Forecast{
+		From:              from,
+		To:                to,
+		Currency:          currency,
+		StartingBalance:   startingBalance,
+		LowestBalance:     startingBalance,
+		LowestBalanceDate: from,
+		Events:            events,
+	}
+
+	var counted []Event
+	for _, e := range events {
+		if !strings.EqualFold(e.Currency, currency) {
+			if fc.OtherCurrencies == nil {
+				fc.OtherCurrencies = make(map[string]float64)
+			}
+			fc.OtherCurrencies[strings.ToUpper(e.Currency)] += e.Amount
+			continue
+		}
+		counted = append(counted, e)
+
+		switch e.Type {
+		case EventIncome:
+			fc.ExpectedIncome += e.Amount
+		case EventRecurringExpense:
+			fc.RecurringExpenses -= e.Amount
+		case EventShareOwed:
+			fc.SharesOwed -= e.Amount
+		case EventShareReceivable:
+			fc.SharesReceivable += e.Amount
+		case EventBudget:
+			fc.BudgetAllocations -= e.Amount
+		case EventPlanned:
+			fc.PlannedSpend -= e.Amount
+		}
+		fc.NetChange += e.Amount
+	}
+
+	balance := startingBalance
+	i := 0
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		d := Day{Date: day}
+		for ; i < len(counted) && counted[i].Date.Before(next); i++ {
+			if counted[i].Amount >= 0 {
+				d.Inflow += counted[i].Amount
+			} else {
+				d.Outflow -= counted[i].Amount
+			}
+		}
+		balance += d.Inflow - d.Outflow
+		d.Balance = balance
+		if balance < fc.LowestBalance {
+			fc.LowestBalance = balance
+			fc.LowestBalanceDate = day
+		}
+		fc.Days = append(fc.Days, d)
+	}
+
+	fc.EndingBalance = balance
+	fc.CanAfford = fc.LowestBalance >= 0
+	return fc
+}
+
+func (f *Forecaster) incomeEvents(userID, currency string, from, to time.Time) ([]Event, error) {
+	var streams []models.IncomeStream
+	if err := f.db.Where("user_id = ?", userID).Find(&streams).Error; err != nil {
+		return nil, fmt.Errorf("could not load income streams: %w", err)
+	}
+
+	var events []Event
+	for _, stream := range streams {
+		ScheduleStream(&stream, from.Add(-time.Nanosecond))
+		if stream.NextExpected == nil {
+			continue
+		}
+		for date := *stream.NextExpected; date.Before(to); date = schedule.Advance(date, stream.Frequency) {
+			if !date.Before(from) {
+				events = append(events, Event{
+					Date:        date,
+					Type:        EventIncome,
+					Description: stream.Name,
+					Amount:      stream.Amount,
+					Currency:    currency,
+					ReferenceID: stream.ID,
+				})
+			}
+			if !schedule.IsKnown(stream.Frequency) {
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+func (f *Forecaster) recurringEvents(userID string, from, to time.Time, budgeted map[string]bool) ([]Event, error) {
+	var recurring []models.RecurringExpense
+	if err := f.db.Where("is_active = ?", true).
+		Where("(group_id IS NULL AND user_id = ?) OR group_id IN (?)", userID,
+			f.db.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ? AND is_active = ?", userID, true)).
+		Find(&recurring).Error; err != nil {
+		return nil, fmt.Errorf("could not load recurring expenses: %w", err)
+	}
+
+	memberCounts := make(map[string]int64)
+	var events []Event
+	for _, r := range recurring {
+		if budgeted[strings.ToLower(r.Category)] || !schedule.IsKnown(r.Frequency) {
+			continue
+		}
+
+		amount := r.Amount
+		description := r.Description
+		if r.GroupID != nil {
+			count, ok := memberCounts[*r.GroupID]
+			if !ok {
+				if err := f.db.Model(&models.GroupMember{}).
+					Where("group_id = ? AND is_active = ?", *r.GroupID, true).
+					Count(&count).Error; err != nil {
+					return nil, fmt.Errorf("could not count group members: %w", err)
+				}
+				memberCounts[*r.GroupID] = count
+			}
+			if count > 1 {
+				amount /= float64(count)
+				description += " (your share)"
+			}
+		}
+
+		date := r.NextDueDate
+		if date.IsZero() {
+			date = r.StartDate
+		}
+		for ; date.Before(to); date = schedule.Advance(date, r.Frequency) {
+			if r.EndDate != nil && date.After(*r.EndDate) {
+				break
+			}
+			if date.Before(from) {
+				continue
+			}
+			events = append(events, Event{
+				Date:        date,
+				Type:        EventRecurringExpense,
+				Description: description,
+				Amount:      -amount,
+				Currency:    r.Currency,
+				ReferenceID: r.ID,
+			})
+		}
+	}
+	return events, nil
+}
+
+// openShares selects the unpaid shares of live splits the user owes or is
+// owed
+func (f *Forecaster) openShares(userID string) *gorm.DB {
+	return f.db.Preload("SplitExpense").Preload("SplitExpense.Expense").
+		Joins("JOIN split_expenses ON split_expenses.id = split_shares.split_expense_id").
+		Where("split_shares.is_paid = ? AND split_expenses.deleted_at IS NULL", false).
+		Where("(split_shares.user_id = ? AND split_expenses.created_by <> ?) OR (split_expenses.created_by = ? AND split_shares.user_id <> ?)",
+			userID, userID, userID, userID)
+}
+
+func (f *Forecaster) shareEvents(userID string, from, to time.Time) ([]Event, error) {
+	var shares []models.SplitShare
+	if err := f.openShares(userID).Find(&shares).Error; err != nil {
+		return nil, fmt.Errorf("could not load split shares: %w", err)
+	}
+
+	var events []Event
+	for _, share := range shares {
+		date := share.SplitExpense.DueDate
+		if date.Before(from) {
+			// Overdue shares are expected to settle straight away
+			date = from
+		}
+		if !date.Before(to) {
+			continue
+		}
+
+		amount := share.Amount + share.InterestAccrued
+		e := Event{
+			Date:        date,
+			Description: share.SplitExpense.Expense.Description,
+			Currency:    share.SplitExpense.Expense.OriginalCurrency,
+			ReferenceID: share.ID,
+		}
+		if share.UserID == userID {
+			e.Type = EventShareOwed
+			e.Amount = -amount
+		} else {
+			e.Type = EventShareReceivable
+			e.Amount = amount
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// budgetEvents reserves what is left of each personal budget in its current
+// period, and the full amount of each later period that starts in the window,
+// prorated when the period runs past the end of the window. It also returns
+// the set of budgeted categories.
+func (f *Forecaster) budgetEvents(userID, currency string, now, to time.Time) ([]Event, map[string]bool, error) {
+	var budgets []models.Budget
+	if err := f.db.Where("user_id = ? AND group_id IS NULL AND end_date >= ?", userID, now).
+		Find(&budgets).Error; err != nil {
+		return nil, nil, fmt.Errorf("could not load budgets: %w", err)
+	}
+
+	budgeted := make(map[string]bool)
+	var events []Event
+	for _, b := range budgets {
+		budgeted[strings.ToLower(b.Category)] = true
+
+		start, end := b.StartDate, b.EndDate
+		if !end.After(start) {
+			continue
+		}
+
+		if !start.After(now) {
+			if remaining := b.Amount - b.CurrentSpent; remaining > 0 {
+				events = append(events, Event{
+					Date:        startOfDay(now),
+					Type:        EventBudget,
+					Description: b.Category + " budget (remaining)",
+					Amount:      -remaining,
+					Currency:    currency,
+					ReferenceID: b.ID,
+				})
+			}
+		}
+
+		for {
+			start, end = budget.NextPeriod(b.Period, budget.Anchor(&b), start, end)
+			if !start.Before(to) {
+				break
+			}
+			amount := b.Amount
+			if end.After(to) {
+				amount *= to.Sub(start).Hours() / end.Sub(start).Hours()
+			}
+			events = append(events, Event{
+				Date:        start,
+				Type:        EventBudget,
+				Description: b.Category + " budget",
+				Amount:      -amount,
+				Currency:    currency,
+				ReferenceID: b.ID,
+			})
+		}
+	}
+	return events, budgeted, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,70 @@
+package cashflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+func date(day int) time.Time {
+	return time.Date(2026, time.March, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuild(t *testing.T) {
+	events := []Event{
+		{Date: date(3).Add(9 * time.Hour), Type: EventRecurringExpense, Amount: -700, Currency: "USD"},
+		{Date: date(1), Type: EventBudget, Amount: -200, Currency: "USD"},
+		{Date: date(2), Type: EventIncome, Amount: 500, Currency: "usd"},
+		{Date: date(2), Type: EventShareReceivable, Amount: 40, Currency: "USD"},
+		{Date: date(3), Type: EventShareOwed, Amount: -25, Currency: "EUR"},
+		{Date: date(4), Type: EventShareOwed, Amount: -1000, Currency: "INR"},
+		{Date: date(4), Type: EventPlanned, Amount: -100, Currency: "USD"},
+		// After the window
+		{Date: date(5), Type: EventIncome, Amount: 900, Currency: "USD"},
+	}
+	fc := build(date(1), date(5), "USD", 300, events)
+
+	totals := []float64{fc.ExpectedIncome, fc.RecurringExpenses, fc.SharesOwed, fc.SharesReceivable, fc.BudgetAllocations, fc.PlannedSpend}
+	if want := []float64{1400, 700, 0, 40, 200, 100}; !reflect.DeepEqual(totals, want) {
+		t.Errorf("totals = %v, want %v", totals, want)
+	}
+
+	var balances []float64
+	for _, d := range fc.Days {
+		balances = append(balances, d.Balance)
+	}
+	if want := []float64{100, 640, -60, -160}; !reflect.DeepEqual(balances, want) {
+		t.Errorf("balances = %v, want %v", balances, want)
+	}
+	if fc.EndingBalance != -160 || fc.LowestBalance != -160 || !fc.LowestBalanceDate.Equal(date(4)) || fc.CanAfford {
+		t.Errorf("ending %v, lowest %v on %v, can afford %v; want -160, -160 on %v, false",
+			fc.EndingBalance, fc.LowestBalance, fc.LowestBalanceDate, fc.CanAfford, date(4))
+	}
+	if want := map[string]float64{"EUR": -25, "INR": -1000}; !reflect.DeepEqual(fc.OtherCurrencies, want) {
+		t.Errorf("other currencies = %v, want %v", fc.OtherCurrencies, want)
+	}
+	if len(fc.Events) != len(events) || !fc.Events[0].Date.Equal(date(1)) {
+		t.Errorf("events aren't all kept in date order: %v", fc.Events)
+	}
+}
+
+func TestBuildWithoutEvents(t *testing.T) {
+	fc := build(date(1), date(3), "USD", 50, nil)
+	if len(fc.Days) != 2 || fc.EndingBalance != 50 || fc.LowestBalance != 50 || !fc.CanAfford || fc.OtherCurrencies != nil {
+		t.Errorf("forecast = %+v, want two days at 50", fc)
+	}
+}
+
+func TestOpenSharesSkipDeletedSplits(t *testing.T) {
+	db, _ := dbtest.Open()
+	f := NewForecaster(db.Session(&gorm.Session{DryRun: true}))
+	sql := f.openShares("u").Find(&[]models.SplitShare{}).Statement.SQL.String()
+	if !strings.Contains(sql, "split_expenses.deleted_at IS NULL") {
+		t.Errorf("shares of deleted splits count: %s", sql)
+	}
+}
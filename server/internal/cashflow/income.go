@@ -0,0 +1,173 @@
+package cashflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+	"gorm.io/gorm"
+)
+
+// ScheduleStream fills in NextExpected for an income stream. If the stream
+// has been received before, the next payment follows LastReceived; otherwise
+// an explicit NextExpected from the client is kept. A NextExpected that has
+// already passed is moved forward to the first occurrence after now.
+func ScheduleStream(stream *models.IncomeStream, now time.Time) {
+	if !schedule.IsKnown(stream.Frequency) {
+		return
+	}
+
+	var next time.Time
+	switch {
+	case stream.LastReceived != nil:
+		next = schedule.Advance(*stream.LastReceived, stream.Frequency)
+		if !next.After(now) {
+			next = schedule.NextAfter(*stream.LastReceived, stream.Frequency, now)
+		}
+	case stream.NextExpected != nil:
+		next = *stream.NextExpected
+		if !next.After(now) {
+			next = schedule.NextAfter(next, stream.Frequency, now)
+		}
+	default:
+		return
+	}
+	stream.NextExpected = &next
+}
+
+// MarkReceived records a payment and schedules the following one
+func MarkReceived(stream *models.IncomeStream, receivedAt time.Time) {
+	stream.LastReceived = &receivedAt
+	if schedule.IsKnown(stream.Frequency) {
+		next := schedule.Advance(receivedAt, stream.Frequency)
+		stream.NextExpected = &next
+	}
+}
+
+// SalaryTypes are the IncomeStream.Type values (lower-cased) treated as salary
+var SalaryTypes = []string{"salary", "wages", "payroll"}
+
+// isSalary reports whether a stream should drive User.NextSalaryDate
+func isSalary(stream models.IncomeStream) bool {
+	t := strings.ToLower(stream.Type)
+	for _, salary := range SalaryTypes {
+		if t == salary {
+			return true
+		}
+	}
+	return false
+}
+
+// Scheduler keeps income stream dates and User.NextSalaryDate current
+type Scheduler struct {
+	db *gorm.DB
+}
+
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{db: db}
+}
+
+// Run advances overdue income streams every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.AdvanceDue(time.Now()); err != nil {
+			log.Printf("cashflow: advancing income streams failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AdvanceDue moves NextExpected of every income stream whose payment date
+// has passed to its next occurrence. Nothing is recorded as received; that
+// waits for the user to confirm the payment through Receive.
+func (s *Scheduler) AdvanceDue(now time.Time) error {
+	var streams []models.IncomeStream
+	if err := s.db.Where("next_expected IS NOT NULL AND next_expected <= ?", now).
+		Find(&streams).Error; err != nil {
+		return fmt.Errorf("could not load due income streams: %w", err)
+	}
+
+	users := make(map[string]bool)
+	for i := range streams {
+		stream := &streams[i]
+		if !schedule.IsKnown(stream.Frequency) {
+			continue
+		}
+
+		next := schedule.NextAfter(*stream.NextExpected, stream.Frequency, now)
+		if err := s.db.Model(stream).Update("next_expected", next).Error; err != nil {
+			log.Printf("cashflow: could not advance income stream %s: %v", stream.ID, err)
+			continue
+		}
+		users[stream.UserID] = true
+	}
+
+	for userID := range users {
+		if err := s.SyncSalaryDate(userID); err != nil {
+			log.Printf("cashflow: could not update salary date for user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// Receive records a payment on the stream as an IncomeReceipt and schedules
+// the next one. The caller is responsible for SyncSalaryDate.
+func (s *Scheduler) Receive(stream *models.IncomeStream, receivedAt time.Time) error {
+	MarkReceived(stream, receivedAt)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(stream).Updates(map[string]interface{}{
+			"last_received": stream.LastReceived,
+			"next_expected": stream.NextExpected,
+		}).Error; err != nil {
+			return err
+		}
+
+		receipt := models.IncomeReceipt{
+			UserID:         stream.UserID,
+			IncomeStreamID: stream.ID,
+			Amount:         stream.Amount,
+			ReceivedAt:     receivedAt,
+			TaxCategory:    stream.TaxCategory,
+			IsFreelance:    stream.IsFreelance,
+		}
+		return tx.Create(&receipt).Error
+	})
+}
+
+// SyncSalaryDate sets User.NextSalaryDate to the earliest upcoming salary
+// payment. Users without a salary stream keep whatever date they entered.
+func (s *Scheduler) SyncSalaryDate(userID string) error {
+	var streams []models.IncomeStream
+	if err := s.db.Where("user_id = ? AND next_expected IS NOT NULL", userID).
+		Find(&streams).Error; err != nil {
+		return err
+	}
+
+	var next *time.Time
+	for _, stream := range streams {
+		if !isSalary(stream) {
+			continue
+		}
+		if next == nil || stream.NextExpected.Before(*next) {
+			next = stream.NextExpected
+		}
+	}
+	if next == nil {
+		return nil
+	}
+
+	return s.db.Model(&models.User{}).Where("id = ?", userID).Update("next_salary_date", next).Error
+}
@@ -0,0 +1,69 @@
+package cashflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+func at(t time.Time) *time.Time { return &t }
+
+func TestScheduleStream(t *testing.T) {
+	now := date(10)
+	tests := []struct {
+		name   string
+		stream models.IncomeStream
+		want   *time.Time
+	}{
+		{"follows last payment", models.IncomeStream{Frequency: "monthly", LastReceived: at(date(1))}, at(date(1).AddDate(0, 1, 0))},
+		{"last payment long ago", models.IncomeStream{Frequency: "weekly", LastReceived: at(date(1).AddDate(0, -1, 0))}, at(date(15))},
+		{"keeps a future date", models.IncomeStream{Frequency: "monthly", NextExpected: at(date(20))}, at(date(20))},
+		{"moves a past date on", models.IncomeStream{Frequency: "biweekly", NextExpected: at(date(1))}, at(date(15))},
+		{"due now moves on", models.IncomeStream{Frequency: "daily", NextExpected: at(now)}, at(date(11))},
+		{"nothing to go on", models.IncomeStream{Frequency: "monthly"}, nil},
+		{"unknown frequency", models.IncomeStream{Frequency: "sometimes", NextExpected: at(date(1))}, at(date(1))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := tt.stream
+			ScheduleStream(&stream, now)
+			switch {
+			case tt.want == nil && stream.NextExpected != nil:
+				t.Errorf("next = %v, want none", *stream.NextExpected)
+			case tt.want != nil && (stream.NextExpected == nil || !stream.NextExpected.Equal(*tt.want)):
+				t.Errorf("next = %v, want %v", stream.NextExpected, *tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvanceDue(t *testing.T) {
+	const (
+		userID = "00000000-0000-4000-8000-0000000000a1"
+		salary = "00000000-0000-4000-8000-0000000000c1"
+		rent   = "00000000-0000-4000-8000-0000000000c2"
+		gift   = "00000000-0000-4000-8000-0000000000c3"
+	)
+	db, fake := dbtest.Open()
+	fake.Add("users", dbtest.Row{"id": userID, "next_salary_date": nil})
+	fake.Add("income_streams",
+		dbtest.Row{"id": salary, "user_id": userID, "type": "Salary", "frequency": "monthly", "next_expected": date(1)},
+		dbtest.Row{"id": rent, "user_id": userID, "type": "rental", "frequency": "weekly", "next_expected": date(8)},
+		dbtest.Row{"id": gift, "user_id": userID, "type": "gift", "frequency": "sometimes", "next_expected": date(2)},
+	)
+
+	if err := NewScheduler(db).AdvanceDue(date(10)); err != nil {
+		t.Fatalf("AdvanceDue: %v", err)
+	}
+	want := map[string]time.Time{salary: date(1).AddDate(0, 1, 0), rent: date(15), gift: date(2)}
+	for _, row := range fake.Rows("income_streams") {
+		if next, _ := row["next_expected"].(time.Time); !next.Equal(want[row["id"].(string)]) {
+			t.Errorf("stream %s is next expected %v, want %v", row["id"], row["next_expected"], want[row["id"].(string)])
+		}
+	}
+	if next, _ := fake.Rows("users")[0]["next_salary_date"].(time.Time); !next.Equal(want[salary]) {
+		t.Errorf("next salary date = %v, want %v", fake.Rows("users")[0]["next_salary_date"], want[salary])
+	}
+}
@@ -0,0 +1,220 @@
+// Package categorize picks expense categories from rules. A user's own rules
+// come first, then global rules; within each, higher priority and longer
+// patterns win.
+package categorize
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	MatchKeyword = "keyword"
+	MatchRegex   = "regex"
+
+	StatusActive   = "active"
+	StatusProposed = "proposed"
+
+	SourceManual  = "manual"
+	SourceLearned = "learned"
+	SourceSystem  = "system"
+)
+
+const (
+	// MaxPatternLength caps rule patterns
+	MaxPatternLength = 200
+	// MaxRulesPerUser caps the active rules one user can have. Proposals
+	// don't count until they are accepted.
+	MaxRulesPerUser = 500
+	// MaxProposalsPerUser caps the learned rules waiting for a user to
+	// accept them
+	MaxProposalsPerUser = 100
+	// maxCachedRegexps bounds the compiled regular expressions an Engine
+	// keeps; the cache starts over when it is full
+	maxCachedRegexps = 1000
+)
+
+var ErrTooManyRules = fmt.Errorf("a user can have at most %d category rules", MaxRulesPerUser)
+
+// Result is the outcome of the first matching rule
+type Result struct {
+	Category string   `json:"category"`
+	Tags     []string `json:"tags,omitempty"`
+	RuleID   string   `json:"ruleId"`
+}
+
+// Apply sets category from the result and adds its tags. It reports
+// whether there was a result, so a nil Result leaves both alone.
+func (r *Result) Apply(category *string, tags *[]string) bool {
+	if r == nil {
+		return false
+	}
+	*category = r.Category
+	for _, tag := range r.Tags {
+		if !containsFold(*tags, tag) {
+			*tags = append(*tags, tag)
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Engine loads and applies rules. Compiled regular expressions are cached.
+type Engine struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	regexps map[string]*regexp.Regexp
+}
+
+func New(db *gorm.DB) *Engine {
+	return &Engine{db: db, regexps: map[string]*regexp.Regexp{}}
+}
+
+// Validate checks a rule from a client and normalizes it: keywords are
+// lower-cased and regular expressions must compile
+func Validate(rule *models.CategoryRule) error {
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.Category = strings.TrimSpace(rule.Category)
+	if rule.MatchType == "" {
+		rule.MatchType = MatchKeyword
+	}
+	switch {
+	case rule.Pattern == "":
+		return errors.New("pattern is required")
+	case len(rule.Pattern) > MaxPatternLength:
+		return fmt.Errorf("pattern must be at most %d characters", MaxPatternLength)
+	case rule.Category == "":
+		return errors.New("category is required")
+	}
+
+	switch rule.MatchType {
+	case MatchKeyword:
+		rule.Pattern = normalize(rule.Pattern)
+		if rule.Pattern == "" {
+			return errors.New("keyword must contain letters or digits")
+		}
+	case MatchRegex:
+		if _, err := regexp.Compile("(?i)" + rule.Pattern); err != nil {
+			return fmt.Errorf("pattern is not a valid regular expression: %v", err)
+		}
+	default:
+		return errors.New("matchType must be keyword or regex")
+	}
+
+	tags := rule.Tags[:0]
+	for _, tag := range rule.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	rule.Tags = tags
+	return nil
+}
+
+// Matcher applies one user's active rules, loaded once, to many descriptions
+type Matcher struct {
+	engine *Engine
+	rules  []models.CategoryRule
+}
+
+// Matcher loads the rules that apply to userID
+func (e *Engine) Matcher(userID string) (*Matcher, error) {
+	var rules []models.CategoryRule
+	if err := e.db.Where("status = ? AND (user_id = ? OR user_id IS NULL)", StatusActive, userID).
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if (a.UserID != nil) != (b.UserID != nil) {
+			return a.UserID != nil
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if len(a.Pattern) != len(b.Pattern) {
+			return len(a.Pattern) > len(b.Pattern)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return &Matcher{engine: e, rules: rules}, nil
+}
+
+// Match returns the first rule matching text, or nil
+func (m *Matcher) Match(text string) *Result {
+	words := " " + normalize(text) + " "
+	for i := range m.rules {
+		rule := &m.rules[i]
+		if m.engine.matches(rule, text, words) {
+			return &Result{Category: rule.Category, Tags: rule.Tags, RuleID: rule.ID}
+		}
+	}
+	return nil
+}
+
+// Apply matches text against the user's rules; nil means no rule matched
+func (e *Engine) Apply(userID, text string) (*Result, error) {
+	m, err := e.Matcher(userID)
+	if err != nil {
+		return nil, err
+	}
+	return m.Match(text), nil
+}
+
+// Count returns how many of userID's rules have status
+func (e *Engine) Count(userID, status string) (int64, error) {
+	var count int64
+	err := e.db.Model(&models.CategoryRule{}).Where("user_id = ? AND status = ?", userID, status).Count(&count).Error
+	return count, err
+}
+
+// Matches reports whether a single rule matches text
+func (e *Engine) Matches(rule *models.CategoryRule, text string) bool {
+	return e.matches(rule, text, " "+normalize(text)+" ")
+}
+
+func (e *Engine) matches(rule *models.CategoryRule, text, words string) bool {
+	if rule.MatchType == MatchRegex {
+		re := e.regexp(rule.Pattern)
+		return re != nil && re.MatchString(text)
+	}
+	// Keywords match whole words, so "bar" doesn't match "barber"
+	return strings.Contains(words, " "+rule.Pattern+" ")
+}
+
+func (e *Engine) regexp(pattern string) *regexp.Regexp {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if re, ok := e.regexps[pattern]; ok {
+		return re
+	}
+	// Stored rules were validated; one that no longer compiles never matches
+	re, _ := regexp.Compile("(?i)" + pattern)
+	if len(e.regexps) >= maxCachedRegexps {
+		e.regexps = map[string]*regexp.Regexp{}
+	}
+	e.regexps[pattern] = re
+	return re
+}
+
+// normalize lower-cases text and keeps only words of letters and digits
+func normalize(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	}), " ")
+}
@@ -0,0 +1,158 @@
+package categorize
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+const userID = "00000000-0000-4000-8000-0000000000a1"
+
+func rule(user *string, matchType, pattern, category string, priority int, status string) dbtest.Row {
+	return dbtest.Row{"user_id": user, "match_type": matchType, "pattern": pattern, "category": category,
+		"priority": priority, "status": status, "created_at": time.Now(), "tags": `[]`}
+}
+
+func TestMatch(t *testing.T) {
+	db, fake := dbtest.Open()
+	user := userID
+	fake.Add("category_rules",
+		rule(nil, MatchKeyword, "uber", "Transport", 0, StatusActive),
+		rule(nil, MatchKeyword, "bar", "Entertainment", 0, StatusActive),
+		rule(nil, MatchRegex, `^amzn\s+mktp`, "Shopping", 0, StatusActive),
+		rule(&user, MatchKeyword, "uber", "Work Travel", 0, StatusActive),
+		rule(&user, MatchKeyword, "coffee", "Food", 0, StatusActive),
+		rule(&user, MatchKeyword, "coffee beans", "Groceries", 0, StatusActive),
+		rule(&user, MatchKeyword, "gym", "Health", 0, StatusActive),
+		rule(&user, MatchKeyword, "gym", "Fitness", 5, StatusActive),
+		rule(&user, MatchKeyword, "netflix", "Entertainment", 0, StatusProposed),
+	)
+
+	m, err := New(db).Matcher(userID)
+	if err != nil {
+		t.Fatalf("Matcher: %v", err)
+	}
+	tests := []struct {
+		text string
+		want string // empty for no match
+	}{
+		{"UBER *TRIP 1234", "Work Travel"}, // the user's rule beats the global one
+		{"Coffee beans, 1kg", "Groceries"}, // longer patterns win
+		{"coffee with Asha", "Food"},       //
+		{"Gym membership", "Fitness"},      // higher priority wins
+		{"Barber shop", ""},                // keywords match whole words
+		{"Rooftop bar", "Entertainment"},   //
+		{"AMZN Mktp IN*2K4", "Shopping"},   // regexps ignore case
+		{"Refund from amzn mktp", ""},      //
+		{"NETFLIX.COM", ""},                // proposals don't apply
+		{"", ""},                           //
+	}
+	for _, tt := range tests {
+		got := m.Match(tt.text)
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("Match(%q) = %s, want no match", tt.text, got.Category)
+		case tt.want != "" && (got == nil || got.Category != tt.want):
+			t.Errorf("Match(%q) = %+v, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLearn(t *testing.T) {
+	user := userID
+	tests := []struct {
+		name     string
+		rules    []dbtest.Row
+		text     string
+		category string
+		want     string // category of the proposal, empty for none
+		hits     int
+	}{
+		{"new merchant", nil, "POS 4411 STARBUCKS #12", "Food", "Food", 1},
+		{"no keyword", nil, "POS 4411 #12", "Food", "", 0},
+		{"rules already agree", []dbtest.Row{rule(&user, MatchKeyword, "starbucks", "Food", 0, StatusActive)},
+			"STARBUCKS #12", "Food", "", 0},
+		{"active rule for the keyword", []dbtest.Row{rule(&user, MatchKeyword, "starbucks", "Coffee", 0, StatusActive)},
+			"STARBUCKS #12", "Food", "", 0},
+		{"same correction again", []dbtest.Row{withHits(rule(&user, MatchKeyword, "starbucks", "Food", 0, StatusProposed), 2)},
+			"STARBUCKS #12", "Food", "Food", 3},
+		{"different correction", []dbtest.Row{withHits(rule(&user, MatchKeyword, "starbucks", "Coffee", 0, StatusProposed), 2)},
+			"STARBUCKS #12", "Food", "Food", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open()
+			fake.Add("category_rules", tt.rules...)
+
+			got, err := New(db).Learn(userID, tt.text, tt.category)
+			if err != nil {
+				t.Fatalf("Learn: %v", err)
+			}
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("Learn proposed %+v, want nothing", got)
+			case tt.want != "" && got == nil:
+				t.Errorf("Learn proposed nothing, want %s", tt.want)
+			case got != nil && (got.Category != tt.want || got.Hits != tt.hits || got.Status != StatusProposed):
+				t.Errorf("Learn = %s with %d hits (%s), want %s with %d hits", got.Category, got.Hits, got.Status, tt.want, tt.hits)
+			}
+		})
+	}
+}
+
+func withHits(row dbtest.Row, hits int) dbtest.Row {
+	row["hits"] = hits
+	return row
+}
+
+// TestLearnLimits checks only active rules count towards MaxRulesPerUser,
+// while proposals have their own cap
+func TestLearnLimits(t *testing.T) {
+	user := userID
+	tests := []struct {
+		name     string
+		active   int
+		proposed int
+		want     bool
+	}{
+		{"room for both", MaxRulesPerUser - 1, MaxProposalsPerUser - 1, true},
+		{"proposals don't use up active rules", 0, MaxProposalsPerUser - 1, true},
+		{"active rules full", MaxRulesPerUser, 0, false},
+		{"proposals full", 0, MaxProposalsPerUser, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open()
+			for i := 0; i < tt.active; i++ {
+				fake.Add("category_rules", rule(&user, MatchKeyword, fmt.Sprintf("shop%d", i), "Shopping", 0, StatusActive))
+			}
+			for i := 0; i < tt.proposed; i++ {
+				fake.Add("category_rules", rule(&user, MatchKeyword, fmt.Sprintf("cafe%d", i), "Food", 0, StatusProposed))
+			}
+
+			got, err := New(db).Learn(userID, "STARBUCKS #12", "Food")
+			if err != nil {
+				t.Fatalf("Learn: %v", err)
+			}
+			if (got != nil) != tt.want {
+				t.Errorf("Learn proposed %v, want %v", got != nil, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexpCacheIsBounded(t *testing.T) {
+	e := New(nil)
+	for i := 0; i < maxCachedRegexps*2+10; i++ {
+		r := &models.CategoryRule{MatchType: MatchRegex, Pattern: fmt.Sprintf("^shop%d$", i)}
+		if !e.Matches(r, fmt.Sprintf("SHOP%d", i)) {
+			t.Fatalf("pattern %d didn't match", i)
+		}
+	}
+	if n := len(e.regexps); n > maxCachedRegexps {
+		t.Errorf("%d cached regexps, want at most %d", n, maxCachedRegexps)
+	}
+}
@@ -0,0 +1,102 @@
+package categorize
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// noiseWords say how a payment was made rather than where, so they never
+// become learned keywords
+var noiseWords = map[string]bool{
+	"pos": true, "card": true, "debit": true, "credit": true, "visa": true, "mastercard": true,
+	"payment": true, "purchase": true, "paid": true, "pay": true, "transfer": true, "upi": true,
+	"online": true, "contactless": true, "direct": true, "www": true, "com": true, "the": true,
+	"and": true, "for": true, "from": true, "ltd": true, "inc": true, "llc": true, "store": true,
+}
+
+// Keyword picks the word of a description most likely to name the merchant:
+// the first one that isn't a number, a short code or payment noise. It is
+// empty when there is none.
+func Keyword(description string) string {
+	for _, word := range strings.Fields(normalize(description)) {
+		if len([]rune(word)) < 3 || noiseWords[word] || strings.IndexFunc(word, func(r rune) bool {
+			return r < '0' || r > '9'
+		}) < 0 {
+			continue
+		}
+		return word
+	}
+	return ""
+}
+
+// Learn proposes a rule after the user moved an expense to category. The
+// merchant keyword of the description becomes a proposed rule the user can
+// accept; repeating the same correction raises its Hits. Nothing is proposed
+// when the user's rules already give that category, or when they have an
+// active rule for the keyword, which they can edit instead. The rule is nil
+// when nothing was learned.
+func (e *Engine) Learn(userID, description, category string) (*models.CategoryRule, error) {
+	keyword := Keyword(description)
+	category = strings.TrimSpace(category)
+	if keyword == "" || category == "" {
+		return nil, nil
+	}
+
+	current, err := e.Apply(userID, description)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && strings.EqualFold(current.Category, category) {
+		return nil, nil
+	}
+
+	var rule models.CategoryRule
+	err = e.db.Where("user_id = ? AND match_type = ? AND pattern = ?", userID, MatchKeyword, keyword).First(&rule).Error
+	switch {
+	case err == nil:
+		if rule.Status != StatusProposed {
+			return nil, nil
+		}
+		if strings.EqualFold(rule.Category, category) {
+			rule.Hits++
+		} else {
+			rule.Category, rule.Hits = category, 1
+		}
+		if err := e.db.Model(&rule).Select("category", "hits").Updates(&rule).Error; err != nil {
+			return nil, err
+		}
+		return &rule, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	// A proposal the user couldn't accept isn't worth making
+	active, err := e.Count(userID, StatusActive)
+	if err != nil {
+		return nil, err
+	}
+	proposed, err := e.Count(userID, StatusProposed)
+	if err != nil {
+		return nil, err
+	}
+	if active >= MaxRulesPerUser || proposed >= MaxProposalsPerUser {
+		return nil, nil
+	}
+
+	rule = models.CategoryRule{
+		UserID:    &userID,
+		Pattern:   keyword,
+		MatchType: MatchKeyword,
+		Category:  category,
+		Status:    StatusProposed,
+		Source:    SourceLearned,
+		Hits:      1,
+	}
+	if err := e.db.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
@@ -0,0 +1,42 @@
+package categorize
+
+import (
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// systemRules are the global rules every user starts with. They name common
+// merchants that the parser's keywords don't cover.
+var systemRules = []models.CategoryRule{
+	{Pattern: `\b(uber|lyft|ola|bolt|rapido)\b`, Category: "Transport"},
+	{Pattern: `\b(shell|bp|exxon|chevron|indian oil|hp petrol)\b`, Category: "Transport", Tags: []string{"fuel"}},
+	{Pattern: `\b(starbucks|costa|dunkin|mcdonald'?s|kfc|burger king|domino'?s|subway)\b`, Category: "Food"},
+	{Pattern: `\b(walmart|tesco|aldi|lidl|kroger|safeway|whole foods|bigbasket|blinkit|instamart)\b`, Category: "Groceries"},
+	{Pattern: `\b(netflix|spotify|disney|hulu|prime video|youtube premium|hotstar)\b`, Category: "Entertainment", Tags: []string{"subscription"}},
+	{Pattern: `\b(airbnb|booking\.com|expedia|marriott|hilton|makemytrip)\b`, Category: "Travel"},
+	{Pattern: `\b(amazon|flipkart|ebay|myntra|ikea|zara)\b`, Category: "Shopping"},
+	{Pattern: `\b(cvs|walgreens|boots|apollo pharmacy|pharmeasy)\b`, Category: "Health"},
+}
+
+// SeedGlobal adds the system rules the first time it runs. Once any system
+// rule exists nothing is added, so edits to them in the database stick.
+func SeedGlobal(db *gorm.DB) error {
+	var count int64
+	if err := db.Unscoped().Model(&models.CategoryRule{}).
+		Where("user_id IS NULL AND source = ?", SourceSystem).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	rules := make([]models.CategoryRule, len(systemRules))
+	for i, rule := range systemRules {
+		rule.MatchType = MatchRegex
+		rule.Status = StatusActive
+		rule.Source = SourceSystem
+		rules[i] = rule
+	}
+	return db.Create(&rules).Error
+}
@@ -0,0 +1,474 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/balance"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/parse"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+)
+
+// MaxAmount caps what a single chat command can record
+const MaxAmount = 10000000
+
+// DraftTTL is how long a drafted expense or payment waits for "yes"
+const DraftTTL = 10 * time.Minute
+
+// Help lists the commands every messaging integration understands
+const Help = `Commands:
+/add <amount> <category> [description] - record an expense
+/balance - who owes you and whom you owe
+/owe - what you still owe
+/settle <handle or name> - record that someone paid you what they owe
+
+You can also write "what do I owe" or "mark paid <name>", or describe a shared
+expense like "paid 1200 for dinner with Asha and Ravi, split equally".`
+
+// Commands runs the text commands shared by the messaging integrations. The
+// caller identifies the user; each command returns the reply to send back.
+type Commands struct {
+	db         *gorm.DB
+	budgets    *budget.Tracker
+	balances   *balance.Service
+	rules      *categorize.Engine
+	categories *taxonomy.Service
+}
+
+// pendingDraft is an expense, or a payment made to the user, waiting for
+// the user to confirm it. It is kept as a models.PendingDraft, so drafts
+// survive restarts and reach whichever server gets the reply.
+type pendingDraft struct {
+	Draft  *parse.Draft     `json:"draft,omitempty"`
+	Settle *balance.Balance `json:"settle,omitempty"` // who paid the user, for payments
+}
+
+func NewCommands(db *gorm.DB, budgets *budget.Tracker) *Commands {
+	return &Commands{
+		db:         db,
+		budgets:    budgets,
+		balances:   balance.NewService(db),
+		rules:      categorize.New(db),
+		categories: taxonomy.New(db),
+	}
+}
+
+// phrases let people type commands as plain words, e.g. "what do I owe" or
+// "mark paid alice". They are tried in order, so longer phrases come first.
+var phrases = []struct {
+	words   []string
+	command string
+}{
+	{[]string{"what", "do", "i", "owe"}, "owe"},
+	{[]string{"who", "do", "i", "owe"}, "owe"},
+	{[]string{"mark", "as", "paid"}, "settle"},
+	{[]string{"mark", "paid"}, "settle"},
+	{[]string{"settle", "up", "with"}, "settle"},
+	{[]string{"add", "expense"}, "add"},
+}
+
+// Parse splits a message like "/add@FinGenieBot 500 Food" into the command
+// name and its arguments. The leading slash is optional and a few plain
+// phrases are understood as well.
+func Parse(text string) (string, []string) {
+	fields := strings.Fields(strings.TrimRight(strings.TrimSpace(text), "?!."))
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	for _, p := range phrases {
+		if len(fields) >= len(p.words) && hasWords(fields, p.words) {
+			return p.command, fields[len(p.words):]
+		}
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	return name, fields[1:]
+}
+
+func hasWords(fields, words []string) bool {
+	for i, w := range words {
+		if strings.ToLower(fields[i]) != w {
+			return false
+		}
+	}
+	return true
+}
+
+// Run executes a parsed command for the user
+func (c *Commands) Run(user models.User, name string, args []string) string {
+	switch name {
+	case "add":
+		return c.add(user, args)
+	case "balance":
+		return c.balance(user)
+	case "owe":
+		return c.owe(user)
+	case "settle":
+		return c.settle(user, args)
+	case "paid":
+		// "paid asha" records a payment, "paid 1200 for dinner with ..." is
+		// an expense
+		if len(args) > 0 {
+			if _, err := ParseAmount(args[0]); err != nil {
+				return c.settle(user, args)
+			}
+		}
+	case "yes", "y", "ok", "confirm":
+		return c.confirm(user)
+	case "no", "n", "cancel":
+		return c.cancel(user)
+	}
+
+	text := strings.Join(append([]string{name}, args...), " ")
+	if _, err := parse.Expense(text, parse.Context{}); err == nil {
+		return c.draft(user, text)
+	}
+	return Help
+}
+
+func (c *Commands) add(user models.User, args []string) string {
+	// Anything naming other people goes through a draft to confirm
+	if draft, err := c.parse(user, strings.Join(args, " ")); err == nil && (len(draft.Shares) > 0 || len(draft.Unresolved) > 0) {
+		return c.draft(user, strings.Join(args, " "))
+	}
+
+	if len(args) < 2 {
+		return "Usage: /add <amount> <category> [description]"
+	}
+	amount, err := ParseAmount(args[0])
+	if err != nil {
+		return "Invalid amount, please enter a number like 250 or 99.50"
+	}
+
+	category, err := c.categories.Find(taxonomy.ScopeOf(user.ID, nil), "", args[1])
+	if errors.Is(err, taxonomy.ErrUnknown) {
+		return fmt.Sprintf("Unknown category %q. Try one of: %s", args[1], c.topCategories(user))
+	}
+	if err != nil {
+		return "Sorry, the expense could not be saved. Please try again."
+	}
+
+	expense := models.Expense{
+		UserID:           user.ID,
+		Amount:           amount,
+		OriginalCurrency: user.PreferredCurrency,
+		Category:         category.Name,
+		CategoryID:       &category.ID,
+		Description:      strings.Join(args[2:], " "),
+		Date:             time.Now(),
+	}
+	if err := c.db.Create(&expense).Error; err != nil {
+		return "Sorry, the expense could not be saved. Please try again."
+	}
+	c.budgets.ExpenseChanged(expense)
+
+	reply := fmt.Sprintf("Added %s for %s", money(amount, user), expense.Category)
+	if expense.Description != "" {
+		reply += " (" + expense.Description + ")"
+	}
+	return reply
+}
+
+// topCategories lists the names of the user's top-level categories
+func (c *Commands) topCategories(user models.User) string {
+	categories, err := c.categories.List(taxonomy.ScopeOf(user.ID, nil))
+	if err != nil {
+		return "Food, Transport, Other"
+	}
+	var names []string
+	for _, category := range categories {
+		if category.ParentID == nil {
+			names = append(names, category.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c *Commands) balance(user models.User) string {
+	summary, err := c.balances.Summary(user.ID)
+	if err != nil {
+		return "Sorry, balances are unavailable right now."
+	}
+	if len(summary.People) == 0 {
+		return "You're all settled up."
+	}
+
+	lines := []string{
+		"You are owed " + money(summary.OwedToYou, user),
+		"You owe " + money(summary.YouOwe, user),
+		"",
+	}
+	for _, p := range summary.People {
+		if p.Amount > 0 {
+			lines = append(lines, fmt.Sprintf("%s owes you %s", name(p), money(p.Amount, user)))
+		} else {
+			lines = append(lines, fmt.Sprintf("You owe %s %s", name(p), money(-p.Amount, user)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Commands) owe(user models.User) string {
+	summary, err := c.balances.Summary(user.ID)
+	if err != nil {
+		return "Sorry, balances are unavailable right now."
+	}
+
+	lines := []string{"You owe:"}
+	for _, p := range summary.People {
+		if p.Amount < 0 {
+			lines = append(lines, fmt.Sprintf("%s - %s", name(p), money(-p.Amount, user)))
+		}
+	}
+	if len(lines) == 1 {
+		return "You don't owe anyone."
+	}
+	lines = append(lines, "", "Once you've paid, ask them to /settle with you.")
+	return strings.Join(lines, "\n")
+}
+
+func (c *Commands) settle(user models.User, args []string) string {
+	if len(args) == 0 {
+		return "Usage: /settle <handle or name>"
+	}
+	summary, err := c.balances.Summary(user.ID)
+	if err != nil {
+		return "Sorry, balances are unavailable right now."
+	}
+
+	who := strings.Join(args, " ")
+	matches := match(summary.People, who)
+	switch len(matches) {
+	case 0:
+		return fmt.Sprintf("You have nothing to settle with %q.", who)
+	case 1:
+	default:
+		return fmt.Sprintf("More than one person matches %q, please use their handle.", who)
+	}
+	other := matches[0]
+
+	owed, reply := c.settleable(user, other)
+	if reply != "" {
+		return reply
+	}
+
+	if err := c.hold(user, pendingDraft{Settle: &other}); err != nil {
+		return "Sorry, something went wrong. Please try again."
+	}
+	return fmt.Sprintf("Record that %s paid you %s?\n\nReply yes to save or no to cancel.", name(other), money(owed, user))
+}
+
+// settleable returns what other owes the user, or why the user can't settle
+// it in chat. Only the person who was paid can settle, so debtors can't
+// clear their own debts.
+func (c *Commands) settleable(user models.User, other balance.Balance) (float64, string) {
+	owed, inBase, err := c.balances.Owed(user.ID, other.UserID)
+	if err != nil {
+		return 0, "Sorry, balances are unavailable right now."
+	}
+	if owed == 0 {
+		return 0, fmt.Sprintf("%s doesn't owe you anything. Once you've paid them, ask them to /settle with you.", name(other))
+	}
+
+	// Large payments need a fresh 2FA check, which only the app can do. The
+	// gross amount counts, not what's left after netting.
+	if user.TwoFactorEnabledAt != nil && inBase >= balance.LargePaymentAmount {
+		return 0, fmt.Sprintf("For your security, please settle amounts of %.2f %s or more in the app.", float64(balance.LargePaymentAmount), balance.BaseCurrency)
+	}
+	return owed, ""
+}
+
+// settleUp records a confirmed payment. What is owed is checked again, as
+// more may have been split since the user was asked.
+func (c *Commands) settleUp(user models.User, other balance.Balance) string {
+	if _, reply := c.settleable(user, other); reply != "" {
+		return reply
+	}
+	paid, err := c.balances.SettleUp(user.ID, other.UserID)
+	if err != nil {
+		return "Sorry, the payment could not be recorded. Please try again."
+	}
+	return fmt.Sprintf("Recorded that %s paid you %s.", name(other), money(paid, user))
+}
+
+func (c *Commands) parse(user models.User, text string) (*parse.Draft, error) {
+	ctx, err := parse.LoadContext(c.db, user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+	draft, err := parse.Expense(text, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rules, err := c.rules.Matcher(user.ID); err == nil {
+		draft.ApplyRules(rules)
+	}
+	return draft, nil
+}
+
+// draft parses a described expense and asks the user to confirm it
+func (c *Commands) draft(user models.User, text string) string {
+	draft, err := c.parse(user, text)
+	switch {
+	case errors.Is(err, parse.ErrNoAmount):
+		return "Please include an amount, e.g. \"paid 1200 for dinner with Asha\"."
+	case err != nil:
+		return "Sorry, I couldn't read that: " + err.Error()
+	case draft.Expense.Amount > MaxAmount:
+		return "Invalid amount, please enter a number like 250 or 99.50"
+	case len(draft.Unresolved) > 0:
+		return fmt.Sprintf("I couldn't find %s in your groups. Use their handle or full name.", strings.Join(draft.Unresolved, ", "))
+	}
+
+	if err := c.hold(user, pendingDraft{Draft: draft}); err != nil {
+		return "Sorry, something went wrong. Please try again."
+	}
+
+	e := draft.Expense
+	summary := fmt.Sprintf("%.2f %s", e.Amount, e.OriginalCurrency)
+	if e.Description != "" {
+		summary += " for " + e.Description
+	}
+	summary += " (" + e.Category + ")"
+	if draft.GroupName != "" {
+		summary += " in " + draft.GroupName
+	}
+
+	lines := []string{"Add " + summary + "?"}
+	if len(draft.Shares) > 0 {
+		lines = append(lines, "Split "+strings.ToLower(e.SplitType)+":")
+		for _, share := range draft.Shares {
+			who := share.DisplayName
+			if share.UserID == user.ID {
+				who += " (you)"
+			}
+			lines = append(lines, fmt.Sprintf("%s - %.2f %s", who, share.Amount, e.OriginalCurrency))
+		}
+	}
+	lines = append(lines, draft.Warnings...)
+	lines = append(lines, "", "Reply yes to save or no to cancel.")
+	return strings.Join(lines, "\n")
+}
+
+// hold keeps a draft for the user to confirm, replacing any earlier one
+func (c *Commands) hold(user models.User, pending pendingDraft) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.PendingDraft{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PendingDraft{UserID: user.ID, Draft: data, ExpiresAt: time.Now().Add(DraftTTL)}).Error
+	})
+}
+
+// takeDraft removes the user's draft and returns it, or nil when there is
+// none or it expired. Only the reply that removes it gets it, so a repeated
+// "yes" can't save a draft twice.
+func (c *Commands) takeDraft(user models.User) (*pendingDraft, error) {
+	var held models.PendingDraft
+	err := c.db.Where("user_id = ?", user.ID).First(&held).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := c.db.Unscoped().Where("id = ?", held.ID).Delete(&models.PendingDraft{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(held.ExpiresAt) {
+		return nil, nil
+	}
+	var pending pendingDraft
+	if err := json.Unmarshal(held.Draft, &pending); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+func (c *Commands) confirm(user models.User) string {
+	pending, err := c.takeDraft(user)
+	if err != nil {
+		return "Sorry, something went wrong. Please try again."
+	}
+	if pending == nil {
+		return "There's nothing to confirm. Describe an expense first, e.g. \"paid 1200 for dinner with Asha\"."
+	}
+	if pending.Settle != nil {
+		return c.settleUp(user, *pending.Settle)
+	}
+	draft := pending.Draft
+	if _, err := parse.Save(c.db, c.budgets, user.ID, draft); err != nil {
+		return "Sorry, the expense could not be saved. Please try again."
+	}
+	if len(draft.Shares) > 0 {
+		return fmt.Sprintf("Saved %.2f %s, split between %d people.", draft.Expense.Amount, draft.Expense.OriginalCurrency, len(draft.Shares))
+	}
+	return fmt.Sprintf("Saved %.2f %s.", draft.Expense.Amount, draft.Expense.OriginalCurrency)
+}
+
+func (c *Commands) cancel(user models.User) string {
+	pending, err := c.takeDraft(user)
+	if err != nil {
+		return "Sorry, something went wrong. Please try again."
+	}
+	if pending == nil {
+		return "There's nothing to cancel."
+	}
+	return "Cancelled, nothing was saved."
+}
+
+// ParseAmount reads a positive amount such as "250", "1,200" or "99.50"
+func ParseAmount(s string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil || math.IsNaN(amount) || amount <= 0 || amount > MaxAmount {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return math.Round(amount*100) / 100, nil
+}
+
+// match finds people by handle, then by display name
+func match(people []balance.Balance, who string) []balance.Balance {
+	who = strings.ToLower(strings.TrimPrefix(who, "@"))
+	for _, p := range people {
+		if p.Handle != nil && *p.Handle == who {
+			return []balance.Balance{p}
+		}
+	}
+	var matches []balance.Balance
+	for _, p := range people {
+		if strings.ToLower(p.DisplayName) == who {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
+
+func name(p balance.Balance) string {
+	if p.Handle != nil {
+		return fmt.Sprintf("%s (@%s)", p.DisplayName, *p.Handle)
+	}
+	return p.DisplayName
+}
+
+func money(amount float64, user models.User) string {
+	return fmt.Sprintf("%.2f %s", amount, user.PreferredCurrency)
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/parse"
+)
+
+func TestDraftsAreKeptInTheDatabase(t *testing.T) {
+	db, fake := dbtest.Open()
+	user := models.User{Base: models.Base{ID: "00000000-0000-4000-8000-0000000000a1"}}
+	draft := &parse.Draft{Expense: parse.Details{Amount: 120, OriginalCurrency: "INR", Description: "dinner"}}
+
+	if err := NewCommands(db, budget.NewTracker(db, nil)).hold(user, pendingDraft{Draft: draft}); err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+
+	// Another server, or this one after a restart, sees the draft
+	c := NewCommands(db, budget.NewTracker(db, nil))
+	pending, err := c.takeDraft(user)
+	if err != nil {
+		t.Fatalf("takeDraft: %v", err)
+	}
+	if pending == nil || pending.Draft == nil || pending.Draft.Expense.Description != "dinner" || pending.Draft.Expense.Amount != 120 {
+		t.Fatalf("takeDraft = %+v, want the held draft", pending)
+	}
+
+	// Taking it removes it, so a second "yes" finds nothing
+	if pending, err := c.takeDraft(user); err != nil || pending != nil {
+		t.Errorf("second takeDraft = %+v, %v, want nothing", pending, err)
+	}
+	if rows := fake.Rows("pending_drafts"); len(rows) != 0 {
+		t.Errorf("%d drafts left, want 0", len(rows))
+	}
+}
+
+func TestHoldReplacesDraft(t *testing.T) {
+	db, fake := dbtest.Open()
+	c := NewCommands(db, budget.NewTracker(db, nil))
+	user := models.User{Base: models.Base{ID: "00000000-0000-4000-8000-0000000000a1"}}
+
+	c.hold(user, pendingDraft{Draft: &parse.Draft{Expense: parse.Details{Description: "first"}}})
+	c.hold(user, pendingDraft{Draft: &parse.Draft{Expense: parse.Details{Description: "second"}}})
+	if rows := fake.Rows("pending_drafts"); len(rows) != 1 {
+		t.Fatalf("%d drafts held, want 1", len(rows))
+	}
+	pending, err := c.takeDraft(user)
+	if err != nil || pending == nil || pending.Draft.Expense.Description != "second" {
+		t.Errorf("takeDraft = %+v, %v, want the second draft", pending, err)
+	}
+}
+
+func TestExpiredDraftsAreDropped(t *testing.T) {
+	db, fake := dbtest.Open()
+	c := NewCommands(db, budget.NewTracker(db, nil))
+	user := models.User{Base: models.Base{ID: "00000000-0000-4000-8000-0000000000a1"}}
+	fake.Add("pending_drafts", dbtest.Row{"user_id": user.ID, "draft": []byte(`{"draft":{"expense":{"amount":5}}}`),
+		"expires_at": time.Now().Add(-time.Minute)})
+
+	if pending, err := c.takeDraft(user); err != nil || pending != nil {
+		t.Errorf("takeDraft = %+v, %v, want nothing", pending, err)
+	}
+	if got := c.Run(user, "yes", nil); !strings.HasPrefix(got, "There's nothing to confirm") {
+		t.Errorf("yes = %q, want nothing to confirm", got)
+	}
+}
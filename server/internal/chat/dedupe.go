@@ -0,0 +1,25 @@
+package chat
+
+import (
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Channels whose webhooks deliver messages, for Claim
+const (
+	ChannelTelegram = "telegram"
+	ChannelWhatsApp = "whatsapp"
+)
+
+// Claim records that the message with the channel's ID is being handled. It
+// returns false when it was handled before: webhooks redeliver messages they
+// didn't see acknowledged, and a repeated command must not run twice.
+func Claim(db *gorm.DB, channel, messageID string) (bool, error) {
+	processed := models.ProcessedMessage{Channel: channel, MessageID: messageID}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&processed)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,151 @@
+package contacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// Lookup limits per user
+const (
+	MaxHashesPerRequest = 500
+	MaxLookupsPerHour   = 10
+	MaxHashesPerDay     = 5000
+)
+
+var (
+	ErrTooManyHashes = fmt.Errorf("at most %d hashes can be matched at once", MaxHashesPerRequest)
+	ErrRateLimited   = errors.New("contact lookup limit reached")
+	ErrMalformedHash = errors.New("hashes must be hex encoded SHA-256 digests")
+)
+
+// HashEmail is the identifier clients send for an email address: the hex
+// SHA-256 of the trimmed, lower-cased address
+func HashEmail(email string) string {
+	return hash(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// HashPhone is the identifier clients send for a phone number: the hex
+// SHA-256 of the number in E.164 form, e.g. "+919876543210"
+func HashPhone(phone string) string {
+	return hash(phone)
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Match is a discoverable user found for one of the submitted hashes
+type Match struct {
+	Hash        string  `json:"hash"`
+	DisplayName string  `json:"displayName"`
+	Handle      *string `json:"handle"`
+}
+
+// Matcher finds discoverable users from hashed contact identifiers. Only
+// users who opted in and verified the matching email or phone are returned.
+type Matcher struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewMatcher(db *gorm.DB) *Matcher {
+	return &Matcher{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Match looks up the hashes on behalf of userID, enforcing the lookup limits
+func (m *Matcher) Match(userID string, hashes []string) ([]Match, error) {
+	if len(hashes) > MaxHashesPerRequest {
+		return nil, ErrTooManyHashes
+	}
+
+	unique := make([]string, 0, len(hashes))
+	seen := make(map[string]bool)
+	for _, h := range hashes {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if len(h) != sha256.Size*2 {
+			return nil, ErrMalformedHash
+		}
+		if _, err := hex.DecodeString(h); err != nil {
+			return nil, ErrMalformedHash
+		}
+		if !seen[h] {
+			seen[h] = true
+			unique = append(unique, h)
+		}
+	}
+
+	if err := m.checkLimits(userID, len(unique)); err != nil {
+		return nil, err
+	}
+	if err := m.db.Create(&models.ContactLookup{UserID: userID, Hashes: len(unique)}).Error; err != nil {
+		return nil, fmt.Errorf("could not record contact lookup: %w", err)
+	}
+
+	matches := []Match{}
+	if len(unique) == 0 {
+		return matches, nil
+	}
+
+	var users []models.User
+	if err := m.db.Select("id", "display_name", "handle", "email_hash", "phone_hash", "email_verified_at", "phone_verified_at").
+		Where("discoverable = ? AND id <> ?", true, userID).
+		Where(m.db.Where("email_hash IN ? AND email_verified_at IS NOT NULL", unique).
+			Or("phone_hash IN ? AND phone_verified_at IS NOT NULL", unique)).
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not match contacts: %w", err)
+	}
+
+	for _, user := range users {
+		// Only verified identifiers match, even when the other one found the user
+		var verified []string
+		if user.EmailVerifiedAt != nil {
+			verified = append(verified, user.EmailHash)
+		}
+		if user.PhoneVerifiedAt != nil {
+			verified = append(verified, user.PhoneHash)
+		}
+		for _, h := range verified {
+			if h != "" && seen[h] {
+				matches = append(matches, Match{Hash: h, DisplayName: user.DisplayName, Handle: user.Handle})
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (m *Matcher) checkLimits(userID string, hashes int) error {
+	now := m.now()
+
+	var lookups int64
+	if err := m.db.Model(&models.ContactLookup{}).
+		Where("user_id = ? AND created_at > ?", userID, now.Add(-time.Hour)).
+		Count(&lookups).Error; err != nil {
+		return err
+	}
+	if lookups >= MaxLookupsPerHour {
+		return ErrRateLimited
+	}
+
+	var daily int64
+	if err := m.db.Model(&models.ContactLookup{}).
+		Where("user_id = ? AND created_at > ?", userID, now.Add(-24*time.Hour)).
+		Select("COALESCE(SUM(hashes), 0)").
+		Scan(&daily).Error; err != nil {
+		return err
+	}
+	if daily+int64(hashes) > MaxHashesPerDay {
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package contacts
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+)
+
+const (
+	caller = "00000000-0000-4000-8000-0000000000a0"
+	asha   = "00000000-0000-4000-8000-0000000000a1"
+	ravi   = "00000000-0000-4000-8000-0000000000a2"
+	priya  = "00000000-0000-4000-8000-0000000000a3"
+)
+
+func user(id, name, email, phone string, emailVerified, phoneVerified, discoverable bool) dbtest.Row {
+	verifiedAt := func(ok bool) interface{} {
+		if ok {
+			return time.Now()
+		}
+		return nil
+	}
+	return dbtest.Row{"id": id, "display_name": name, "handle": nil, "discoverable": discoverable,
+		"email_hash": HashEmail(email), "phone_hash": HashPhone(phone),
+		"email_verified_at": verifiedAt(emailVerified), "phone_verified_at": verifiedAt(phoneVerified)}
+}
+
+func TestMatchOnlyVerifiedIdentifiers(t *testing.T) {
+	db, fake := dbtest.Open()
+	fake.Add("users",
+		// Asha verified the phone but not the email changed to since
+		user(asha, "Asha", "asha.new@example.com", "+919876543210", false, true, true),
+		user(ravi, "Ravi", "ravi@example.com", "+919800000001", true, false, true),
+		user(priya, "Priya", "priya@example.com", "+919800000002", true, true, false),
+	)
+
+	hashes := []string{
+		HashEmail("asha.new@example.com"), HashPhone("+919876543210"),
+		HashEmail(" Ravi@Example.com"), HashPhone("+919800000001"),
+		HashEmail("priya@example.com"),
+	}
+	matches, err := NewMatcher(db).Match(caller, hashes)
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, m := range matches {
+		got[m.Hash] = m.DisplayName
+	}
+	want := map[string]string{
+		HashPhone("+919876543210"):    "Asha",
+		HashEmail("ravi@example.com"): "Ravi",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+}
+
+func TestMatchRejectsMalformedHashes(t *testing.T) {
+	db, _ := dbtest.Open()
+	tests := [][]string{
+		{"not-a-hash"},
+		{strings.Repeat("z", 64)},
+		{HashEmail("a@example.com")[:63]},
+	}
+	for _, hashes := range tests {
+		if _, err := NewMatcher(db).Match(caller, hashes); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("Match(%q) = %v, want ErrMalformedHash", hashes, err)
+		}
+	}
+	if _, err := NewMatcher(db).Match(caller, make([]string, MaxHashesPerRequest+1)); !errors.Is(err, ErrTooManyHashes) {
+		t.Errorf("too many hashes: err = %v, want ErrTooManyHashes", err)
+	}
+}
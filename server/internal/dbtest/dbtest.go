@@ -0,0 +1,709 @@
+// Package dbtest is an in-memory stand-in for Postgres in tests. It speaks
+// just enough of the SQL GORM generates for lookups by key: SELECT, count,
+// INSERT, UPDATE and DELETE on one table, with WHERE clauses made of
+// equality, IN, <> and IS [NOT] NULL conditions joined by AND and OR, row
+// comparisons such as (date, id) > ($1, $2) for keyset paging, and ORDER BY
+// on plain columns.
+// Conditions it can't read, such as subqueries or conditions on joined
+// tables, are ignored, so tests should only rely on simple lookups. Unique
+// indexes are declared with Unique.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Row is a table row by column name
+type Row map[string]interface{}
+
+// DB holds the tables behind a fake connection
+type DB struct {
+	mu         sync.Mutex
+	tables     map[string][]Row
+	unique     map[string][][]string
+	statements []string
+	rejected   map[string]error
+	nextID     int
+}
+
+// UniqueViolation is the error of an insert a unique index refuses. Its
+// Code is Postgres's, so GORM translates it to gorm.ErrDuplicatedKey.
+type UniqueViolation struct {
+	Code    string
+	Message string
+}
+
+func (e *UniqueViolation) Error() string { return e.Message }
+
+// Open returns a GORM connection backed by a new, empty DB
+func Open() (*gorm.DB, *DB) {
+	fake := &DB{tables: make(map[string][]Row), unique: make(map[string][][]string), rejected: make(map[string]error)}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(connector{fake})}), &gorm.Config{
+		Logger:         logger.Discard,
+		NowFunc:        func() time.Time { return time.Now().UTC() },
+		TranslateError: true,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("dbtest: %v", err))
+	}
+	return db, fake
+}
+
+// Add inserts rows into table. Rows without an id get one.
+func (d *DB) Add(table string, rows ...Row) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range rows {
+		stored := Row{"deleted_at": nil}
+		for k, v := range row {
+			stored[k] = value(v)
+		}
+		if stored["id"] == nil {
+			stored["id"] = d.newID()
+		}
+		d.tables[table] = append(d.tables[table], stored)
+	}
+}
+
+// Unique adds a unique index on columns of table. Inserts of rows that
+// match a live row on every column fail with a UniqueViolation, or are
+// skipped with ON CONFLICT DO NOTHING.
+func (d *DB) Unique(table string, columns ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unique[table] = append(d.unique[table], columns)
+}
+
+// Reject makes every statement with value as an argument fail with err, as
+// Postgres fails on a value the column's type can't hold
+func (d *DB) Reject(value string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rejected[value] = err
+}
+
+// Rows returns the rows of table
+func (d *DB) Rows(table string) []Row {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Row(nil), d.tables[table]...)
+}
+
+// Statements returns every INSERT, UPDATE and DELETE run so far
+func (d *DB) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+func (d *DB) newID() string {
+	d.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", d.nextID)
+}
+
+var (
+	tablePattern  = regexp.MustCompile(`(?:FROM|INTO|UPDATE) "?(\w+)"?`)
+	limitPattern  = regexp.MustCompile(`LIMIT \$(\d+)`)
+	orderPattern  = regexp.MustCompile(`ORDER BY (.*?)(?: LIMIT | OFFSET |$)`)
+	tuplePattern  = regexp.MustCompile(`^\(([\w", ]+)\)\s*(<=|>=|<|>)\s*\(([$\d, ]+)\)$`)
+	setPattern    = regexp.MustCompile(`^"?(\w+)"?\s*=\s*\$(\d+)$`)
+	insertPattern = regexp.MustCompile(`^INSERT INTO "?\w+"? \(([^)]*)\) VALUES (.*?)(?: ON CONFLICT.*?)?(?: RETURNING (.*))?$`)
+	termPattern   = regexp.MustCompile(`^(?:"?(\w+)"?\.)?"?(\w+)"?\s*(=|<>|IN|IS NULL|IS NOT NULL)\s*(.*)$`)
+	argPattern    = regexp.MustCompile(`\$(\d+)`)
+)
+
+func (d *DB) query(query string, args []driver.Value) (*rows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.rejects(args); err != nil {
+		return nil, err
+	}
+
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		return d.insert(query, args)
+	case strings.HasPrefix(query, "UPDATE"), strings.HasPrefix(query, "DELETE"):
+		d.exec(query, args)
+		return &rows{}, nil
+	case !strings.HasPrefix(query, "SELECT"):
+		return &rows{}, nil
+	}
+
+	table := tableOf(query)
+	matched := d.match(table, query, args)
+	if m := orderPattern.FindStringSubmatch(query); m != nil {
+		order(matched, m[1])
+	}
+	if m := limitPattern.FindStringSubmatch(query); m != nil {
+		if n, ok := arg(args, m[1]).(int64); ok && int(n) < len(matched) {
+			matched = matched[:n]
+		}
+	}
+
+	selected := strings.TrimSpace(query[len("SELECT"):strings.Index(query, " FROM ")])
+	if strings.HasPrefix(strings.ToLower(selected), "count(") {
+		return &rows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(matched))}}}, nil
+	}
+
+	var columns []string
+	if selected == "*" || strings.HasSuffix(selected, ".*") {
+		seen := make(map[string]bool)
+		for _, row := range matched {
+			for k := range row {
+				if !seen[k] {
+					seen[k] = true
+					columns = append(columns, k)
+				}
+			}
+		}
+		sort.Strings(columns)
+	} else {
+		for _, column := range splitTop(selected, ',') {
+			column = strings.TrimSpace(column)
+			if i := strings.LastIndex(strings.ToUpper(column), " AS "); i >= 0 {
+				column = column[i+4:]
+			} else if i := strings.LastIndex(column, "."); i >= 0 {
+				column = column[i+1:]
+			}
+			columns = append(columns, strings.Trim(column, `"`))
+		}
+	}
+
+	result := &rows{columns: columns}
+	for _, row := range matched {
+		values := make([]driver.Value, len(columns))
+		for i, c := range columns {
+			values[i] = row[c]
+		}
+		result.values = append(result.values, values)
+	}
+	return result, nil
+}
+
+func (d *DB) rejects(args []driver.Value) error {
+	for _, a := range args {
+		if s, ok := a.(string); ok && d.rejected[s] != nil {
+			return d.rejected[s]
+		}
+	}
+	return nil
+}
+
+func (d *DB) insert(query string, args []driver.Value) (*rows, error) {
+	d.statements = append(d.statements, query)
+	m := insertPattern.FindStringSubmatch(query)
+	if m == nil {
+		return &rows{}, nil
+	}
+	table := tableOf(query)
+	var columns []string
+	for _, c := range strings.Split(m[1], ",") {
+		columns = append(columns, strings.Trim(strings.TrimSpace(c), `"`))
+	}
+	var returning []string
+	if m[3] != "" {
+		for _, c := range strings.Split(m[3], ",") {
+			returning = append(returning, strings.Trim(strings.TrimSpace(c), `"`))
+		}
+	}
+
+	result := &rows{columns: returning}
+	for _, tuple := range splitTop(strings.TrimSpace(m[2]), ',') {
+		tuple = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(tuple), "("), ")")
+		row := Row{"deleted_at": nil}
+		for i, v := range splitTop(tuple, ',') {
+			if i >= len(columns) {
+				break
+			}
+			if a := argPattern.FindStringSubmatch(strings.TrimSpace(v)); a != nil {
+				row[columns[i]] = arg(args, a[1])
+			}
+		}
+		if id, _ := row["id"].(string); id == "" {
+			row["id"] = d.newID()
+		}
+		if d.duplicate(table, row) {
+			if strings.Contains(query, " ON CONFLICT DO NOTHING") {
+				continue
+			}
+			return nil, &UniqueViolation{Code: "23505", Message: "duplicate key value violates unique constraint on " + table}
+		}
+		d.tables[table] = append(d.tables[table], row)
+
+		values := make([]driver.Value, len(returning))
+		for i, c := range returning {
+			values[i] = row[c]
+		}
+		result.values = append(result.values, values)
+	}
+	return result, nil
+}
+
+// duplicate reports whether row breaks one of the unique indexes of table
+func (d *DB) duplicate(table string, row Row) bool {
+	for _, columns := range d.unique[table] {
+		for _, existing := range d.tables[table] {
+			if existing["deleted_at"] != nil {
+				continue
+			}
+			clash := true
+			for _, c := range columns {
+				if !same(existing[c], row[c]) {
+					clash = false
+					break
+				}
+			}
+			if clash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *DB) exec(query string, args []driver.Value) int64 {
+	d.statements = append(d.statements, query)
+	table := tableOf(query)
+	matched := d.match(table, query, args)
+
+	if strings.HasPrefix(query, "DELETE") {
+		kept := d.tables[table][:0]
+		for _, row := range d.tables[table] {
+			if !contains(matched, row) {
+				kept = append(kept, row)
+			}
+		}
+		d.tables[table] = kept
+		return int64(len(matched))
+	}
+
+	set := query[strings.Index(query, " SET ")+5:]
+	if i := strings.Index(set, " WHERE "); i >= 0 {
+		set = set[:i]
+	}
+	for _, assignment := range splitTop(set, ',') {
+		m := setPattern.FindStringSubmatch(strings.TrimSpace(assignment))
+		if m == nil {
+			continue
+		}
+		for _, row := range matched {
+			row[m[1]] = arg(args, m[2])
+		}
+	}
+	return int64(len(matched))
+}
+
+// match returns the rows of table the WHERE clause of query selects
+func (d *DB) match(table, query string, args []driver.Value) []Row {
+	where := ""
+	if i := strings.Index(query, " WHERE "); i >= 0 {
+		where = query[i+7:]
+		for _, end := range []string{" GROUP BY ", " ORDER BY ", " LIMIT ", " OFFSET ", " RETURNING "} {
+			if j := strings.Index(where, end); j >= 0 {
+				where = where[:j]
+			}
+		}
+	}
+
+	var matched []Row
+	for _, row := range d.tables[table] {
+		if holds(table, row, where, args) {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+// holds evaluates a WHERE clause against a row. AND binds tighter than OR
+// as in SQL; conditions that can't be read count as true.
+func holds(table string, row Row, where string, args []driver.Value) bool {
+	where = strings.TrimSpace(where)
+	if where == "" {
+		return true
+	}
+	if parts := splitWord(where, " OR "); len(parts) > 1 {
+		for _, p := range parts {
+			if holds(table, row, p, args) {
+				return true
+			}
+		}
+		return false
+	}
+	if parts := splitWord(where, " AND "); len(parts) > 1 {
+		for _, p := range parts {
+			if !holds(table, row, p, args) {
+				return false
+			}
+		}
+		return true
+	}
+	if strings.HasPrefix(where, "(") && strings.HasSuffix(where, ")") && balanced(where[1:len(where)-1]) {
+		return holds(table, row, where[1:len(where)-1], args)
+	}
+
+	if m := tuplePattern.FindStringSubmatch(where); m != nil {
+		return holdsTuple(row, m[1], m[2], m[3], args)
+	}
+
+	m := termPattern.FindStringSubmatch(where)
+	if m == nil || (m[1] != "" && m[1] != table) {
+		return true
+	}
+	current, known := row[m[2]]
+	if !known && m[3] != "IS NULL" {
+		return true
+	}
+	switch m[3] {
+	case "IS NULL":
+		return current == nil
+	case "IS NOT NULL":
+		return current != nil
+	case "=", "<>":
+		a := argPattern.FindStringSubmatch(m[4])
+		if a == nil || strings.TrimSpace(m[4]) != a[0] {
+			return true
+		}
+		return same(current, arg(args, a[1])) == (m[3] == "=")
+	case "IN":
+		list := strings.TrimSpace(m[4])
+		if !strings.HasPrefix(list, "(") || strings.HasPrefix(list, "(SELECT") {
+			return true
+		}
+		for _, a := range argPattern.FindAllStringSubmatch(list, -1) {
+			if same(current, arg(args, a[1])) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// holdsTuple compares a row value such as (date, id) with arguments the way
+// Postgres does: column by column until one differs
+func holdsTuple(row Row, columns, op, params string, args []driver.Value) bool {
+	names, refs := strings.Split(columns, ","), argPattern.FindAllStringSubmatch(params, -1)
+	if len(names) != len(refs) {
+		return true
+	}
+	c := 0
+	for i, name := range names {
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		current, known := row[name]
+		if !known {
+			return true
+		}
+		var ok bool
+		if c, ok = compare(current, arg(args, refs[i][1])); !ok {
+			return true
+		}
+		if c != 0 {
+			break
+		}
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// order sorts rows by an ORDER BY clause. Terms other than plain columns
+// are skipped.
+func order(rows []Row, clause string) {
+	type term struct {
+		column string
+		desc   bool
+	}
+	var terms []term
+	for _, t := range splitTop(clause, ',') {
+		fields := strings.Fields(t)
+		if len(fields) == 0 || len(fields) > 2 {
+			continue
+		}
+		column := fields[0]
+		if i := strings.LastIndex(column, "."); i >= 0 {
+			column = column[i+1:]
+		}
+		column = strings.Trim(column, `"`)
+		if strings.ContainsAny(column, "()") {
+			continue
+		}
+		terms = append(terms, term{column, len(fields) == 2 && strings.EqualFold(fields[1], "DESC")})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, t := range terms {
+			c, ok := compare(rows[i][t.column], rows[j][t.column])
+			if !ok || c == 0 {
+				continue
+			}
+			return (c < 0) != t.desc
+		}
+		return false
+	})
+}
+
+// compare orders two values of the same kind. NULLs sort last, as in
+// Postgres.
+func compare(a, b driver.Value) (int, bool) {
+	switch {
+	case a == nil && b == nil:
+		return 0, true
+	case a == nil:
+		return 1, true
+	case b == nil:
+		return -1, true
+	}
+	switch a := a.(type) {
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), true
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return compareNumbers(float64(a), float64(b)), true
+		}
+		if b, ok := b.(float64); ok {
+			return compareNumbers(float64(a), b), true
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return compareNumbers(a, b), true
+		}
+		if b, ok := b.(int64); ok {
+			return compareNumbers(a, float64(b)), true
+		}
+	case string, []byte:
+		if _, ok := b.(string); ok {
+			return strings.Compare(fmt.Sprintf("%s", a), fmt.Sprintf("%s", b)), true
+		}
+		if _, ok := b.([]byte); ok {
+			return strings.Compare(fmt.Sprintf("%s", a), fmt.Sprintf("%s", b)), true
+		}
+	}
+	return 0, false
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// splitTop splits s on sep outside parentheses
+func splitTop(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitWord splits s on the keyword outside parentheses
+func splitWord(s, word string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		default:
+			if depth == 0 && strings.HasPrefix(s[i:], word) {
+				parts = append(parts, s[start:i])
+				start = i + len(word)
+				i += len(word) - 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func balanced(s string) bool {
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+func tableOf(query string) string {
+	if m := tablePattern.FindStringSubmatch(query); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func arg(args []driver.Value, n string) driver.Value {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(args) {
+		return nil
+	}
+	return args[i-1]
+}
+
+func same(a, b driver.Value) bool {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Equal(tb)
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func contains(rows []Row, row Row) bool {
+	for _, r := range rows {
+		if fmt.Sprint(r["id"]) == fmt.Sprint(row["id"]) {
+			return true
+		}
+	}
+	return false
+}
+
+// value converts what tests pass to Add into a driver value
+func value(v interface{}) driver.Value {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	converted, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return v
+	}
+	return converted
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{db: c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("dbtest: use Open")
+}
+
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("dbtest: prepared statements are not supported")
+}
+func (c *conn) Close() error              { return nil }
+func (c *conn) Begin() (driver.Tx, error) { return tx{}, nil }
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return tx{}, nil }
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	nv.Value = value(nv.Value)
+	return nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query, values(named))
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	query = strings.TrimSpace(query)
+	if strings.HasPrefix(query, "INSERT") {
+		r, err := c.db.query(query, values(named))
+		if err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(len(r.values)), nil
+	}
+	if !strings.HasPrefix(query, "UPDATE") && !strings.HasPrefix(query, "DELETE") {
+		return driver.RowsAffected(0), nil
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if err := c.db.rejects(values(named)); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(c.db.exec(query, values(named))), nil
+}
+
+func values(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		args[i] = nv.Value
+	}
+	return args
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	// Postgres hands text back as bytes, which is what Scanners such as
+	// models.JSON expect
+	for i, v := range r.values[r.next] {
+		if s, ok := v.(string); ok {
+			v = []byte(s)
+		}
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
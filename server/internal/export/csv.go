@@ -0,0 +1,47 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	opened bool
+}
+
+// NewCSV writes a single sheet as CSV
+func NewCSV(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Sheet(name string, header []string) error {
+	if c.opened {
+		return errors.New("csv export holds a single sheet")
+	}
+	c.opened = true
+	return c.w.Write(header)
+}
+
+func (c *csvWriter) Row(cells ...interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		text, numeric := formatCell(cell)
+		if !numeric {
+			text = SafeText(text)
+		}
+		record[i] = text
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	// Flushed per row so large exports stream instead of buffering
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
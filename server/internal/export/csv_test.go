@@ -0,0 +1,39 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSV(&buf)
+	if err := w.Sheet("Expenses", []string{"Date", "Description", "Amount", "Note"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), "=1+1", 12.5, "+91 98765"},
+		{nil, "-lunch", -3.0, "@SUM(A1)"},
+		{nil, "\tTab", 0, "safe, with \"quotes\""},
+	}
+	for _, row := range rows {
+		if err := w.Row(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Sheet("Splits", nil); err == nil {
+		t.Error("second Sheet: no error")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Date,Description,Amount,Note\n" +
+		"2025-03-01,'=1+1,12.50,'+91 98765\n" +
+		",'-lunch,-3.00,'@SUM(A1)\n" +
+		",'\tTab,0,\"safe, with \"\"quotes\"\"\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or xlsx")
+
+// Writer streams tables. CSV holds a single sheet; XLSX can hold several.
+// Close must be called to finish the file.
+type Writer interface {
+	Sheet(name string, header []string) error
+	Row(cells ...interface{}) error
+	Close() error
+}
+
+// New returns a Writer for format
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSV(w), nil
+	case FormatXLSX:
+		return NewXLSX(w), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// formatCell renders a cell as text and reports whether it is a number.
+// Money keeps two decimals, dates are YYYY-MM-DD and nil is an empty cell.
+func formatCell(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, false
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case bool:
+		if v {
+			return "yes", false
+		}
+		return "no", false
+	case time.Time:
+		if v.IsZero() {
+			return "", false
+		}
+		return v.Format("2006-01-02"), false
+	case *time.Time:
+		if v == nil {
+			return "", false
+		}
+		return formatCell(*v)
+	case *float64:
+		if v == nil {
+			return "", false
+		}
+		return formatCell(*v)
+	}
+	return "", false
+}
+
+// SafeText stops spreadsheet apps from running text as a formula, as
+// descriptions and names come from users
+func SafeText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,23 @@
+package export
+
+import "testing"
+
+func TestSafeText(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"Lunch":       "Lunch",
+		"=cmd|' /C'":  "'=cmd|' /C'",
+		"+1":          "'+1",
+		"-1":          "'-1",
+		"@A1":         "'@A1",
+		"\r=1":        "'\r=1",
+		"a=1":         "a=1",
+		"'=1":         "'=1",
+		"Ravi's cafe": "Ravi's cafe",
+	}
+	for in, want := range tests {
+		if got := SafeText(in); got != want {
+			t.Errorf("SafeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
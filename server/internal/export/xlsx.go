@@ -0,0 +1,172 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xlsxWriter writes a minimal Office Open XML workbook. Each sheet is
+// streamed straight into the zip; strings are stored inline rather than in
+// a shared table so nothing has to be held in memory.
+type xlsxWriter struct {
+	zip    *zip.Writer
+	sheet  *bufio.Writer
+	names  []string
+	row    int
+	closed bool
+}
+
+// NewXLSX writes sheets as an Excel workbook
+func NewXLSX(w io.Writer) Writer {
+	return &xlsxWriter{zip: zip.NewWriter(w)}
+}
+
+// invalidSheetChars can't appear in Excel sheet names
+const invalidSheetChars = `[]:*?/\`
+
+func (x *xlsxWriter) Sheet(name string, header []string) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalidSheetChars, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	x.names = append(x.names, name)
+
+	f, err := x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.names)))
+	if err != nil {
+		return err
+	}
+	x.sheet = bufio.NewWriter(f)
+	x.row = 0
+	x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	cells := make([]interface{}, len(header))
+	for i, h := range header {
+		cells[i] = h
+	}
+	return x.Row(cells...)
+}
+
+func (x *xlsxWriter) Row(cells ...interface{}) error {
+	if x.sheet == nil {
+		return errors.New("xlsx export: Row called before Sheet")
+	}
+	x.row++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.row)
+	for i, cell := range cells {
+		text, numeric := formatCell(cell)
+		if text == "" {
+			continue
+		}
+		ref := column(i) + fmt.Sprint(x.row)
+		if numeric {
+			fmt.Fprintf(x.sheet, `<c r="%s"><v>%s</v></c>`, ref, text)
+			continue
+		}
+		fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		xml.EscapeText(x.sheet, []byte(SafeText(text)))
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	x.sheet.WriteString(`</row>`)
+	// Keep the zip stream moving for large sheets
+	if x.row%500 == 0 {
+		if err := x.sheet.Flush(); err != nil {
+			return err
+		}
+		return x.zip.Flush()
+	}
+	return nil
+}
+
+func (x *xlsxWriter) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	err := x.sheet.Flush()
+	x.sheet = nil
+	return err
+}
+
+// Close finishes the last sheet and writes the workbook parts that list the
+// sheets
+func (x *xlsxWriter) Close() error {
+	if x.closed {
+		return nil
+	}
+	x.closed = true
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	if len(x.names) == 0 {
+		if err := x.Sheet("Sheet1", nil); err != nil {
+			return err
+		}
+		if err := x.endSheet(); err != nil {
+			return err
+		}
+	}
+
+	var contentTypes, workbook, rels strings.Builder
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, name := range x.names {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		fmt.Fprintf(&workbook, `" sheetId="%d" r:id="rId%d"/>`, n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+	}
+	for _, part := range parts {
+		f, err := x.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return err
+		}
+	}
+	return x.zip.Close()
+}
+
+// column turns a zero-based index into a column name: 0 is A, 26 is AA
+func column(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
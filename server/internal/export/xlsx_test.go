@@ -0,0 +1,179 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 1: "B", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA", 16383: "XFD"}
+	for i, want := range tests {
+		if got := column(i); got != want {
+			t.Errorf("column(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
+
+// sheet is a worksheet part as far as the tests read it
+type sheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX unzips a workbook and returns its parts by name
+func readXLSX(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		parts[f.Name] = body
+	}
+	return parts
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewXLSX(&buf)
+	if err := w.Row("too early"); err == nil {
+		t.Error("Row before Sheet: no error")
+	}
+	if err := w.Sheet("Expenses", []string{"Date", "Description", "Amount", "Verified"}); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2025, 3, 1, 18, 30, 0, 0, time.UTC)
+	wide := make([]interface{}, 28)
+	wide[27] = 7
+	rows := [][]interface{}{
+		{date, "Dinner <with> Asha & Ravi", 1250.5, true},
+		{nil, "=HYPERLINK(\"http://evil\")", -20.0, false},
+		wide,
+	}
+	for _, row := range rows {
+		if err := w.Row(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Sheet("Splits: March/April [draft]?", []string{"Member"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Sheet(strings.Repeat("Payments", 5), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	parts := readXLSX(t, buf.Bytes())
+	var names []string
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/workbook.xml",
+		"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("parts = %v, want %v", names, want)
+	}
+	for name, body := range parts {
+		d := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s isn't well-formed XML: %v", name, err)
+				break
+			}
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatalf("workbook: %v", err)
+	}
+	var sheetNames []string
+	for _, s := range workbook.Sheets {
+		sheetNames = append(sheetNames, s.Name)
+	}
+	if want := []string{"Expenses", "Splits_ March_April _draft__", strings.Repeat("Payments", 5)[:31]}; !reflect.DeepEqual(sheetNames, want) {
+		t.Errorf("sheet names = %q, want %q", sheetNames, want)
+	}
+	for i := 1; i <= 3; i++ {
+		if !bytes.Contains(parts["[Content_Types].xml"], []byte("/xl/worksheets/sheet"+string(rune('0'+i))+".xml")) ||
+			!bytes.Contains(parts["xl/_rels/workbook.xml.rels"], []byte("worksheets/sheet"+string(rune('0'+i))+".xml")) {
+			t.Errorf("sheet %d is missing from the content types or relationships", i)
+		}
+	}
+
+	var expenses sheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &expenses); err != nil {
+		t.Fatalf("sheet1: %v", err)
+	}
+	got := map[string]string{}
+	for _, row := range expenses.Rows {
+		for _, c := range row.Cells {
+			if c.Type == "inlineStr" {
+				got[c.Ref] = c.Inline
+			} else {
+				got[c.Ref] = "#" + c.Value
+			}
+		}
+	}
+	wantCells := map[string]string{
+		"A1": "Date", "B1": "Description", "C1": "Amount", "D1": "Verified",
+		"A2": "2025-03-01", "B2": "Dinner <with> Asha & Ravi", "C2": "#1250.50", "D2": "yes",
+		"B3": `'=HYPERLINK("http://evil")`, "C3": "#-20.00", "D3": "no",
+		"AB4": "#7",
+	}
+	if !reflect.DeepEqual(got, wantCells) {
+		t.Errorf("cells = %v, want %v", got, wantCells)
+	}
+	if n := len(expenses.Rows); n != 4 || expenses.Rows[3].R != 4 {
+		t.Errorf("%d rows, want 4 numbered from 1", n)
+	}
+}
+
+func TestXLSXWithoutSheets(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewXLSX(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, buf.Bytes())
+	if _, ok := parts["xl/worksheets/sheet1.xml"]; !ok || !bytes.Contains(parts["xl/workbook.xml"], []byte(`name="Sheet1"`)) {
+		t.Errorf("an empty workbook has no Sheet1: %v", parts)
+	}
+}
@@ -0,0 +1,401 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/contacts"
+	"github.com/sukh-j-14/fingenie-main/internal/mail"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPassword emails a password reset link. It responds the same way
+// whether or not the address is registered.
+func (h *Handler) ForgotPassword(c *fiber.Ctx) error {
+	var req emailRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Email is required",
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ?", strings.TrimSpace(req.Email)).First(&user).Error; err == nil {
+		raw, err := h.tokens.IssueOneTime(user.ID, models.PurposePasswordReset, token.PasswordResetTTL)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not start password reset",
+			})
+		}
+		h.sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "Reset your FinGenie password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+				user.DisplayName, token.PasswordResetTTL, link("/reset-password", raw)),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "If that email is registered, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password with a reset token and signs the user
+// out everywhere
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var req resetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Token and password are required",
+		})
+	}
+	if len(req.Password) < minPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   fmt.Sprintf("Password must be at least %d characters", minPasswordLength),
+		})
+	}
+
+	userID, err := h.tokens.ConsumeOneTime(req.Token, models.PurposePasswordReset)
+	if err != nil {
+		return oneTimeTokenError(c, err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not hash password",
+		})
+	}
+
+	// A successful reset also lifts any login lockout
+	if err := h.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":             string(hashedPassword),
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update password",
+		})
+	}
+	if err := h.tokens.RevokeAll(userID); err != nil {
+		log.Printf("auth: could not revoke sessions after password reset for %s: %v", userID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Password has been reset",
+	})
+}
+
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	var req verifyEmailRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Token is required",
+		})
+	}
+
+	userID, err := h.tokens.ConsumeOneTime(req.Token, models.PurposeEmailVerification)
+	if err != nil {
+		return oneTimeTokenError(c, err)
+	}
+
+	if err := h.db.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", userID).
+		Update("email_verified_at", h.db.NowFunc()).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not verify email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Email verified",
+	})
+}
+
+// ResendVerification emails a new verification link to the current user
+func (h *Handler) ResendVerification(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "Email is already verified",
+		})
+	}
+
+	if err := h.sendVerification(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not send verification email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
+
+func (h *Handler) sendVerification(user models.User) error {
+	raw, err := h.tokens.IssueOneTime(user.ID, models.PurposeEmailVerification, token.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your FinGenie email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.DisplayName, token.EmailVerificationTTL, link("/verify-email", raw)),
+	})
+	return nil
+}
+
+// sendMail sends in the background so response times don't reveal whether an
+// email was sent
+func (h *Handler) sendMail(msg mail.Message) {
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Printf("auth: %v", err)
+		}
+	}()
+}
+
+// link builds a client URL for a token using APP_URL
+func link(path, raw string) string {
+	base := strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path + "?token=" + url.QueryEscape(raw)
+}
+
+func oneTimeTokenError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, token.ErrExpiredToken):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Token has expired",
+		})
+	case errors.Is(err, token.ErrInvalidToken):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid token",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Could not verify token",
+	})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type changeEmailRequest struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// ChangePassword sets a new password and signs out every other session
+func (h *Handler) ChangePassword(c *fiber.Ctx) error {
+	var req changePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   fmt.Sprintf("Password must be at least %d characters", minPasswordLength),
+		})
+	}
+
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)) != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "Current password is incorrect",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not hash password",
+		})
+	}
+	if err := h.db.Model(&models.User{}).Where("id = ?", user.ID).Update("password", string(hashedPassword)).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update password",
+		})
+	}
+
+	sessionID, _ := c.Locals("sessionId").(string)
+	if err := h.db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, sessionID).
+		Update("revoked_at", h.db.NowFunc()).Error; err != nil {
+		log.Printf("auth: could not revoke sessions after password change for %s: %v", user.ID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Password changed",
+	})
+}
+
+// ChangeEmail moves the account to a new address, which has to be verified
+// again
+func (h *Handler) ChangeEmail(c *fiber.Ctx) error {
+	var req changeEmailRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Email and password are required",
+		})
+	}
+	email := strings.TrimSpace(req.Email)
+
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "Password is incorrect",
+		})
+	}
+
+	var taken int64
+	if err := h.db.Model(&models.User{}).Where("email = ? AND id <> ?", email, user.ID).Count(&taken).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not check email",
+		})
+	}
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "Email already registered",
+		})
+	}
+
+	if err := h.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"email":             email,
+		"email_hash":        contacts.HashEmail(email),
+		"email_verified_at": nil,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update email",
+		})
+	}
+
+	user.Email = email
+	if err := h.sendVerification(*user); err != nil {
+		log.Printf("auth: could not send verification email to %s: %v", user.ID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Email changed, please verify the new address",
+	})
+}
+
+// DeleteAccount deletes the current user, signs them out everywhere and
+// revokes their API keys
+func (h *Handler) DeleteAccount(c *fiber.Ctx) error {
+	var req deleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "Password is incorrect",
+		})
+	}
+
+	if err := h.tokens.RevokeAll(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not delete account",
+		})
+	}
+	if err := h.tokens.RevokeAllAPIKeys(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not delete account",
+		})
+	}
+	if err := h.db.Delete(&models.User{}, "id = ?", user.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not delete account",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateAPIKey issues a personal access token for bots and scripts. The key
+// is only returned in this response.
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	var req createAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Name is required and must be at most 100 characters",
+		})
+	}
+
+	raw, key, err := h.tokens.CreateAPIKey(userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, token.ErrInvalidScope), errors.Is(err, token.ErrInvalidExpiry):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, token.ErrTooManyKeys):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   "Too many API keys, revoke one first",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"key":    raw,
+			"apiKey": key,
+		},
+	})
+}
+
+func (h *Handler) ListAPIKeys(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	keys, err := h.tokens.APIKeys(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not fetch API keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    keys,
+	})
+}
+
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	if err := h.tokens.RevokeAPIKey(userID, c.Params("keyId")); err != nil {
+		if errors.Is(err, token.ErrKeyNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "API key not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not revoke API key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
@@ -1,23 +1,37 @@
 package auth
 
 import (
-	"os"
-	"time"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/sukh-j-14/fingenie-main/internal/contacts"
+	"github.com/sukh-j-14/fingenie-main/internal/lockout"
+	"github.com/sukh-j-14/fingenie-main/internal/mail"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/otp"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"github.com/sukh-j-14/fingenie-main/internal/twofactor"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	tokens    *token.Manager
+	mailer    mail.Mailer
+	otp       *otp.Service
+	guard     *lockout.Guard
+	twoFactor *twofactor.Service
 }
 
-func NewHandler(db *gorm.DB) *Handler {
+func NewHandler(db *gorm.DB, tokens *token.Manager, mailer mail.Mailer, phoneOTP *otp.Service) *Handler {
 	return &Handler{
-		db: db,
+		db:        db,
+		tokens:    tokens,
+		mailer:    mailer,
+		otp:       phoneOTP,
+		guard:     lockout.NewGuard(db),
+		twoFactor: twofactor.NewService(db),
 	}
 }
 
@@ -46,51 +60,29 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 	var user models.User
 	result := h.db.Where("email = ?", req.Email).First(&user)
 	if result.Error != nil {
+		if err := h.guard.Check(nil, req.Email, c.IP()); err != nil {
+			return loginBlocked(c, err)
+		}
+		h.recordLogin(c, nil, req.Email, lockout.MethodPassword, false)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"error":   "Invalid credentials",
 		})
 	}
 
+	if err := h.guard.Check(&user, req.Email, c.IP()); err != nil {
+		return loginBlocked(c, err)
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		h.recordLogin(c, &user, req.Email, lockout.MethodPassword, false)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"success": false,
 			"error":   "Invalid credentials",
 		})
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-default-secret-key"
-	}
-
-	jwtExpirationHours := 24
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": user.ID,
-		"email":  user.Email,
-		"exp":    time.Now().Add(time.Duration(jwtExpirationHours) * time.Hour).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Could not generate token",
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": fiber.Map{
-			"token": tokenString,
-			"user": fiber.Map{
-				"id":          user.ID,
-				"email":       user.Email,
-				"displayName": user.DisplayName,
-			},
-		},
-	})
+	return h.completeLogin(c, user, req.Email, lockout.MethodPassword)
 }
 
 func (h *Handler) Signup(c *fiber.Ctx) error {
@@ -128,6 +120,7 @@ func (h *Handler) Signup(c *fiber.Ctx) error {
 	user := models.User{
 		Email:       req.Email,
 		Password:    string(hashedPassword),
+		EmailHash:   contacts.HashEmail(req.Email),
 		DisplayName: req.DisplayName,
 		PhoneNumber: req.PhoneNumber,
 		SocialScore: 0,
@@ -141,35 +134,67 @@ func (h *Handler) Signup(c *fiber.Ctx) error {
 		})
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-default-secret-key"
+	if err := h.sendVerification(user); err != nil {
+		log.Printf("auth: could not send verification email to %s: %v", user.ID, err)
 	}
 
-	jwtExpirationHours := 24
+	return h.startSession(c, user, fiber.StatusCreated, false)
+}
+
+// completeLogin finishes a login whose first factor passed. Users with 2FA
+// get a challenge to answer at /auth/2fa/verify; everyone else gets a session.
+func (h *Handler) completeLogin(c *fiber.Ctx, user models.User, identifier, method string) error {
+	if user.TwoFactorEnabledAt != nil {
+		challenge, err := h.tokens.IssueChallenge(user.ID, method)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not generate token",
+			})
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data": fiber.Map{
+				"twoFactorRequired": true,
+				"challengeToken":    challenge.Token,
+				"expiresAt":         challenge.ExpiresAt,
+			},
+		})
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": user.ID,
-		"email":  user.Email,
-		"exp":    time.Now().Add(time.Duration(jwtExpirationHours) * time.Hour).Unix(),
-	})
+	h.recordLogin(c, &user, identifier, method, true)
+	return h.startSession(c, user, fiber.StatusOK, false)
+}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+// startSession issues a token pair and responds with it. steppedUp marks the
+// new session as having just passed 2FA.
+func (h *Handler) startSession(c *fiber.Ctx, user models.User, status int, steppedUp bool) error {
+	pair, err := h.tokens.Issue(user, clientInfo(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"error":   "Could not generate token",
 		})
 	}
+	if steppedUp {
+		if err := h.tokens.MarkSteppedUp(pair.SessionID); err != nil {
+			log.Printf("auth: could not mark session %s as stepped up: %v", pair.SessionID, err)
+		}
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+	return c.Status(status).JSON(fiber.Map{
 		"success": true,
 		"data": fiber.Map{
-			"token": tokenString,
+			"token":        pair.AccessToken,
+			"refreshToken": pair.RefreshToken,
+			"expiresAt":    pair.ExpiresAt,
+			"sessionId":    pair.SessionID,
 			"user": fiber.Map{
-				"id":          user.ID,
-				"email":       user.Email,
-				"displayName": user.DisplayName,
+				"id":               user.ID,
+				"email":            user.Email,
+				"displayName":      user.DisplayName,
+				"emailVerified":    user.EmailVerifiedAt != nil,
+				"twoFactorEnabled": user.TwoFactorEnabledAt != nil,
 			},
 		},
 	})
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/lockout"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+const maxHistoryLimit = 100
+
+// LoginHistory lists the current user's recent sign-in attempts
+// (?limit=, default 20)
+func (h *Handler) LoginHistory(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "limit must be between 1 and 100",
+			})
+		}
+		limit = n
+	}
+
+	attempts, err := h.guard.History(userID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not fetch login history",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    attempts,
+	})
+}
+
+func (h *Handler) recordLogin(c *fiber.Ctx, user *models.User, identifier, method string, success bool) {
+	client := lockout.Client{IPAddress: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+	if err := h.guard.Record(user, identifier, method, client, success); err != nil {
+		log.Printf("auth: could not record login attempt: %v", err)
+	}
+}
+
+func loginBlocked(c *fiber.Ctx, err error) error {
+	var blocked *lockout.BlockedError
+	if !errors.As(err, &blocked) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not process login",
+		})
+	}
+
+	retryAfter := int(time.Until(blocked.Until).Seconds() + 0.999)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"success": false,
+		"error":   "Too many failed login attempts, please try again later",
+	})
+}
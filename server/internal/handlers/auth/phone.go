@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/contacts"
+	"github.com/sukh-j-14/fingenie-main/internal/lockout"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/otp"
+	"gorm.io/gorm"
+)
+
+type phoneRequest struct {
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+type phoneCodeRequest struct {
+	PhoneNumber string `json:"phoneNumber"`
+	Code        string `json:"code"`
+}
+
+// RequestPhoneVerification texts a code to the number the user wants to
+// verify, defaulting to the number on their profile
+func (h *Handler) RequestPhoneVerification(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	var req phoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+	if req.PhoneNumber == "" {
+		req.PhoneNumber = user.PhoneNumber
+	}
+
+	phone, err := otp.NormalizePhone(req.PhoneNumber)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Phone number must be in international format, e.g. +919876543210",
+		})
+	}
+
+	var taken int64
+	if err := h.db.Model(&models.User{}).
+		Where("phone_number = ? AND id <> ? AND phone_verified_at IS NOT NULL", phone, userID).
+		Count(&taken).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not send code",
+		})
+	}
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "Phone number is already verified on another account",
+		})
+	}
+
+	if err := h.otp.Send(phone, models.PurposePhoneVerification, userID); err != nil {
+		return otpError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Verification code sent",
+	})
+}
+
+// VerifyPhone checks the code and marks the number as verified on the
+// user's account. Unverified accounts that claimed the same number lose it.
+func (h *Handler) VerifyPhone(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	var req phoneCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Phone number and code are required",
+		})
+	}
+	phone, err := otp.NormalizePhone(req.PhoneNumber)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Phone number must be in international format, e.g. +919876543210",
+		})
+	}
+
+	record, err := h.otp.Verify(phone, models.PurposePhoneVerification, userID, req.Code)
+	if err != nil {
+		return otpError(c, err)
+	}
+	if record.UserID == nil || *record.UserID != userID {
+		return otpError(c, otp.ErrInvalidCode)
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("phone_number = ? AND id <> ? AND phone_verified_at IS NULL", phone, userID).
+			Updates(map[string]interface{}{"phone_number": gorm.Expr("NULL"), "phone_hash": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"phone_number":      phone,
+			"phone_hash":        contacts.HashPhone(phone),
+			"phone_verified_at": h.db.NowFunc(),
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not verify phone number",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Phone number verified",
+	})
+}
+
+// RequestPhoneLogin texts a sign-in code to a verified phone number. It
+// responds the same way whether or not the number is registered.
+func (h *Handler) RequestPhoneLogin(c *fiber.Ctx) error {
+	var req phoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	phone, err := otp.NormalizePhone(req.PhoneNumber)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Phone number must be in international format, e.g. +919876543210",
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("phone_number = ? AND phone_verified_at IS NOT NULL", phone).First(&user).Error; err == nil {
+		if err := h.otp.Send(phone, models.PurposePhoneLogin, user.ID); err != nil && !errors.Is(err, otp.ErrTooManyRequests) {
+			log.Printf("auth: could not send login code to user %s: %v", user.ID, err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "If that number is registered, a code has been sent",
+	})
+}
+
+// PhoneLogin signs in with a code sent by RequestPhoneLogin
+func (h *Handler) PhoneLogin(c *fiber.Ctx) error {
+	var req phoneCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Phone number and code are required",
+		})
+	}
+	phone, err := otp.NormalizePhone(req.PhoneNumber)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid credentials",
+		})
+	}
+
+	var user models.User
+	var known *models.User
+	if h.db.Where("phone_number = ? AND phone_verified_at IS NOT NULL", phone).First(&user).Error == nil {
+		known = &user
+	}
+	if err := h.guard.Check(known, phone, c.IP()); err != nil {
+		return loginBlocked(c, err)
+	}
+
+	var knownID string
+	if known != nil {
+		knownID = known.ID
+	}
+	record, err := h.otp.Verify(phone, models.PurposePhoneLogin, knownID, req.Code)
+	if err == nil && (known == nil || record.UserID == nil || *record.UserID != known.ID) {
+		err = otp.ErrInvalidCode
+	}
+	if err != nil {
+		if errors.Is(err, otp.ErrInvalidCode) || errors.Is(err, otp.ErrExpiredCode) || errors.Is(err, otp.ErrTooManyAttempts) {
+			h.recordLogin(c, known, phone, lockout.MethodPhoneOTP, false)
+		}
+		if errors.Is(err, otp.ErrInvalidCode) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid credentials",
+			})
+		}
+		return otpError(c, err)
+	}
+	return h.completeLogin(c, *known, phone, lockout.MethodPhoneOTP)
+}
+
+func otpError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, otp.ErrTooManyRequests):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"success": false,
+			"error":   "Too many codes requested, please try again later",
+		})
+	case errors.Is(err, otp.ErrTooManyAttempts):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"success": false,
+			"error":   "Too many attempts, please request a new code",
+		})
+	case errors.Is(err, otp.ErrExpiredCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Code has expired",
+		})
+	case errors.Is(err, otp.ErrInvalidCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid code",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Could not process code",
+	})
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func clientInfo(c *fiber.Ctx) token.ClientInfo {
+	return token.ClientInfo{
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IPAddress: c.IP(),
+	}
+}
+
+// Refresh exchanges a refresh token for a new access/refresh token pair
+func (h *Handler) Refresh(c *fiber.Ctx) error {
+	var req refreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Refresh token is required",
+		})
+	}
+
+	pair, err := h.tokens.Refresh(req.RefreshToken)
+	if err != nil {
+		message := "Invalid refresh token"
+		switch {
+		case errors.Is(err, token.ErrExpiredToken):
+			message = "Refresh token has expired"
+		case errors.Is(err, token.ErrSessionRevoked), errors.Is(err, token.ErrTokenReuse):
+			message = "Session has been revoked"
+		case !errors.Is(err, token.ErrInvalidToken):
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not refresh token",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   message,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    pair,
+	})
+}
+
+// Logout revokes the session the request was authenticated with
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	sessionID, _ := c.Locals("sessionId").(string)
+	if err := h.tokens.RevokeSession(sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not log out",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Logged out",
+	})
+}
+
+// LogoutAll revokes every session of the current user
+func (h *Handler) LogoutAll(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	if err := h.tokens.RevokeAll(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not log out",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Logged out on all devices",
+	})
+}
+
+func (h *Handler) ListSessions(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	sessions, err := h.tokens.ActiveSessions(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not fetch sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    sessions,
+	})
+}
+
+// JWKS publishes the public keys access tokens can be verified with
+func (h *Handler) JWKS(c *fiber.Ctx) error {
+	return c.JSON(h.tokens.JWKS())
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/middleware"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+)
+
+const userID = "00000000-0000-4000-8000-0000000000a1"
+
+// newSessionApp serves the session routes over a fake database holding one
+// user, and returns a token pair for them
+func newSessionApp(t *testing.T) (*fiber.App, *token.Pair) {
+	t.Helper()
+	db, fake := dbtest.Open()
+	fake.Add("users", dbtest.Row{"id": userID, "email": "asha@example.com"})
+
+	key, err := token.NewHMACKey("test", strings.Repeat("k", token.MinSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := token.NewKeySet("test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := token.NewManager(db, token.Config{Keys: keys, AccessTTL: token.DefaultAccessTTL, RefreshTTL: token.DefaultRefreshTTL})
+	pair, err := tokens.Issue(models.User{Base: models.Base{ID: userID}}, token.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	h := NewHandler(db, tokens, nil, nil)
+	requireAuth := middleware.AuthMiddleware(tokens)
+	app := fiber.New()
+	app.Post("/auth/refresh", h.Refresh)
+	app.Post("/auth/logout", requireAuth, h.Logout)
+	app.Get("/auth/sessions", requireAuth, h.ListSessions)
+	return app, pair
+}
+
+func call(t *testing.T, app *fiber.App, method, path, bearer, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if bearer != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+bearer)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func refresh(t *testing.T, app *fiber.App, refreshToken string) (int, *token.Pair, string) {
+	t.Helper()
+	status, body := call(t, app, "POST", "/auth/refresh", "", `{"refreshToken": "`+refreshToken+`"}`)
+	var resp struct {
+		Data  *token.Pair `json:"data"`
+		Error string      `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("refresh response %q: %v", body, err)
+	}
+	return status, resp.Data, resp.Error
+}
+
+func TestRefreshEndpoint(t *testing.T) {
+	app, first := newSessionApp(t)
+
+	status, second, _ := refresh(t, app, first.RefreshToken)
+	if status != fiber.StatusOK || second == nil || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh: status %d, pair %+v; want a new pair", status, second)
+	}
+	if status, body := call(t, app, "GET", "/auth/sessions", second.AccessToken, ""); status != fiber.StatusOK {
+		t.Fatalf("new access token: status %d (%s)", status, body)
+	}
+
+	// Replaying the exchanged token revokes the session
+	if status, _, message := refresh(t, app, first.RefreshToken); status != fiber.StatusUnauthorized || message != "Session has been revoked" {
+		t.Errorf("replay: status %d %q, want 401 Session has been revoked", status, message)
+	}
+	if status, _, _ := refresh(t, app, second.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Errorf("current refresh token after replay: status %d, want 401", status)
+	}
+	if status, _ := call(t, app, "GET", "/auth/sessions", second.AccessToken, ""); status != fiber.StatusUnauthorized {
+		t.Errorf("current access token after replay: status %d, want 401", status)
+	}
+
+	if status, _, _ := refresh(t, app, "unknown"); status != fiber.StatusUnauthorized {
+		t.Errorf("unknown token: status %d, want 401", status)
+	}
+	if status, _ := call(t, app, "POST", "/auth/refresh", "", `{}`); status != fiber.StatusBadRequest {
+		t.Errorf("no token: status %d, want 400", status)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	app, pair := newSessionApp(t)
+	if status, body := call(t, app, "POST", "/auth/logout", pair.AccessToken, ""); status != fiber.StatusOK {
+		t.Fatalf("logout: status %d (%s)", status, body)
+	}
+	if status, _ := call(t, app, "GET", "/auth/sessions", pair.AccessToken, ""); status != fiber.StatusUnauthorized {
+		t.Errorf("access token after logout: status %d, want 401", status)
+	}
+	if status, _, message := refresh(t, app, pair.RefreshToken); status != fiber.StatusUnauthorized || message != "Session has been revoked" {
+		t.Errorf("refresh after logout: status %d %q, want 401 Session has been revoked", status, message)
+	}
+}
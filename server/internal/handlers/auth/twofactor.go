@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/lockout"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"github.com/sukh-j-14/fingenie-main/internal/twofactor"
+)
+
+type twoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// SetupTwoFactor starts 2FA enrolment and returns the secret and the
+// otpauth:// URI to show as a QR code
+func (h *Handler) SetupTwoFactor(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+
+	enrollment, err := h.twoFactor.Setup(*user)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    enrollment,
+	})
+}
+
+// EnableTwoFactor confirms enrolment with a code from the app and returns the
+// recovery codes. They are only shown once.
+func (h *Handler) EnableTwoFactor(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Code is required",
+		})
+	}
+
+	codes, err := h.twoFactor.Enable(*user, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	h.markSteppedUp(c)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	if err := h.twoFactor.Disable(userID); err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(*user)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+// VerifyTwoFactorLogin answers the challenge returned by Login with a TOTP or
+// recovery code and starts the session
+func (h *Handler) VerifyTwoFactorLogin(c *fiber.Ctx) error {
+	var req twoFactorLoginRequest
+	if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Challenge token and code are required",
+		})
+	}
+
+	userID, method, err := h.tokens.VerifyChallenge(req.ChallengeToken)
+	if err != nil {
+		message := "Invalid challenge token"
+		if errors.Is(err, token.ErrExpiredToken) {
+			message = "Challenge has expired, please log in again"
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   message,
+		})
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid challenge token",
+		})
+	}
+	if err := h.guard.Check(&user, user.Email, c.IP()); err != nil {
+		return loginBlocked(c, err)
+	}
+
+	// Wrong codes count towards the account lockout like wrong passwords
+	if err := h.twoFactor.Verify(user, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.recordLogin(c, &user, user.Email, method, false)
+		}
+		return twoFactorError(c, err)
+	}
+
+	h.recordLogin(c, &user, user.Email, method, true)
+	return h.startSession(c, user, fiber.StatusOK, true)
+}
+
+// StepUp re-checks the second factor on the current session so high-risk
+// actions are allowed for token.StepUpWindow
+func (h *Handler) StepUp(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return userNotFound(c)
+	}
+
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	if err := h.guard.Check(user, user.Email, c.IP()); err != nil {
+		return loginBlocked(c, err)
+	}
+
+	// Wrong codes count towards the account lockout like they do at login
+	if err := h.twoFactor.Verify(*user, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.recordLogin(c, user, user.Email, lockout.MethodStepUp, false)
+		}
+		return twoFactorError(c, err)
+	}
+	h.recordLogin(c, user, user.Email, lockout.MethodStepUp, true)
+	h.markSteppedUp(c)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor verification complete",
+	})
+}
+
+func (h *Handler) markSteppedUp(c *fiber.Ctx) {
+	sessionID, _ := c.Locals("sessionId").(string)
+	if err := h.tokens.MarkSteppedUp(sessionID); err != nil {
+		log.Printf("auth: could not mark session %s as stepped up: %v", sessionID, err)
+	}
+}
+
+func (h *Handler) currentUser(c *fiber.Ctx) (*models.User, error) {
+	userID := c.Locals("userId").(string)
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func userNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"success": false,
+		"error":   "User not found",
+	})
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid two-factor code",
+		})
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "Two-factor authentication is already enabled",
+		})
+	case errors.Is(err, twofactor.ErrNotEnabled), errors.Is(err, twofactor.ErrNotSetUp):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Two-factor authentication is not set up",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Could not process two-factor request",
+	})
+}
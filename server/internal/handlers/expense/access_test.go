@@ -0,0 +1,253 @@
+package expense
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+)
+
+const (
+	admin    = "00000000-0000-4000-8000-0000000000a1"
+	debtor   = "00000000-0000-4000-8000-0000000000a2"
+	outsider = "00000000-0000-4000-8000-0000000000a3"
+
+	groupID   = "00000000-0000-4000-8000-0000000000b1"
+	expenseID = "00000000-0000-4000-8000-0000000000c1"
+	splitID   = "00000000-0000-4000-8000-0000000000d1"
+	shareID   = "00000000-0000-4000-8000-0000000000e1"
+	snacksID  = "00000000-0000-4000-8000-0000000000f1"
+	missingID = "00000000-0000-4000-8000-0000000000ff"
+	// malformedID fails in Postgres like any id that isn't a UUID
+	malformedID = "not-a-uuid"
+)
+
+// newTestApp serves the expense, split and share routes over a fake
+// database holding a group with an admin and a member who owes the admin a
+// share of an expense. The caller is taken from the X-User header.
+func newTestApp(t *testing.T) (*fiber.App, *dbtest.DB) {
+	t.Helper()
+	db, fake := dbtest.Open()
+	now := time.Now()
+
+	fake.Add("groups", dbtest.Row{"id": groupID, "name": "Flat", "created_by": admin, "default_currency": "USD"})
+	fake.Add("group_members",
+		dbtest.Row{"group_id": groupID, "user_id": admin, "role": "admin", "is_active": true},
+		dbtest.Row{"group_id": groupID, "user_id": debtor, "role": "member", "is_active": true},
+	)
+	fake.Add("expenses", dbtest.Row{"id": expenseID, "user_id": admin, "group_id": groupID, "amount": 90.0,
+		"original_currency": "USD", "category": "Food", "date": now})
+	fake.Add("split_expenses", dbtest.Row{"id": splitID, "group_id": groupID, "expense_id": expenseID,
+		"created_by": admin, "total_amount": 90.0, "split_type": "EQUAL", "due_date": now})
+	fake.Add("split_shares", dbtest.Row{"id": shareID, "split_expense_id": splitID, "user_id": debtor,
+		"amount": 45.0, "is_paid": false, "interest_rate": 0.0, "interest_accrued": 0.0})
+	fake.Add("categories", dbtest.Row{"id": snacksID, "name": "Snacks", "slug": "snacks", "parent_id": nil,
+		"user_id": nil, "group_id": groupID, "icon": "", "color": "", "position": 0})
+
+	h := NewHandler(db, budget.NewTracker(db, nil), nil, nil)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", c.Get("X-User"))
+		return c.Next()
+	})
+
+	expenses := app.Group("/expenses")
+	expenses.Post("/", h.CreateExpense)
+	expenses.Get("/:id", h.GetExpense)
+	expenses.Put("/:id", h.UpdateExpense)
+	expenses.Delete("/:id", h.DeleteExpense)
+	expenses.Post("/:id/attachments", h.UploadAttachment)
+	expenses.Get("/:id/attachments", h.ListAttachments)
+	expenses.Delete("/:id/attachments/:attachmentId", h.DeleteAttachment)
+	expenses.Put("/:id/attachments/:attachmentId/receipt", h.SetAttachmentReceipt)
+
+	splitExpenses := app.Group("/split-expenses")
+	splitExpenses.Post("/", h.CreateSplitExpense)
+	splitExpenses.Get("/:id", h.GetSplitExpense)
+	splitExpenses.Put("/:id", h.UpdateSplitExpense)
+	splitExpenses.Delete("/:id", h.DeleteSplitExpense)
+
+	splitShares := app.Group("/split-shares")
+	splitShares.Post("/", h.CreateSplitShare)
+	splitShares.Get("/:id", h.GetSplitShare)
+	splitShares.Put("/:id", h.UpdateSplitShare)
+	splitShares.Delete("/:id", h.DeleteSplitShare)
+
+	categories := app.Group("/categories")
+	categories.Put("/:id", h.UpdateCategory)
+	categories.Delete("/:id", h.DeleteCategory)
+	return app, fake
+}
+
+func call(t *testing.T, app *fiber.App, user, method, path, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User", user)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+// TestRoutesDenyOutsiders checks every route that loads an expense, split,
+// share or group through the policy: a user outside the group gets 403 and
+// an id that doesn't exist, or isn't a UUID, gets 404.
+func TestRoutesDenyOutsiders(t *testing.T) {
+	routes := []struct {
+		method, path, body string
+		existing           string // id of the fixture the route loads
+	}{
+		{"GET", "/expenses/%s", "", expenseID},
+		{"PUT", "/expenses/%s", `{"amount": 10}`, expenseID},
+		{"DELETE", "/expenses/%s", "", expenseID},
+		{"POST", "/expenses/%s/attachments", "", expenseID},
+		{"GET", "/expenses/%s/attachments", "", expenseID},
+		{"DELETE", "/expenses/%s/attachments/" + missingID, "", expenseID},
+		{"PUT", "/expenses/%s/attachments/" + missingID + "/receipt", `{}`, expenseID},
+		{"POST", "/expenses/", `{"amount": 10, "category": "Food", "groupId": "%s"}`, groupID},
+		{"POST", "/split-expenses/", `{"groupId": "%s", "totalAmount": 10}`, groupID},
+		{"GET", "/split-expenses/%s", "", splitID},
+		{"PUT", "/split-expenses/%s", `{"totalAmount": 10}`, splitID},
+		{"DELETE", "/split-expenses/%s", "", splitID},
+		{"POST", "/split-shares/", `{"splitExpenseId": "%s", "userId": "` + debtor + `", "amount": 5}`, splitID},
+		{"GET", "/split-shares/%s", "", shareID},
+		{"PUT", "/split-shares/%s", `{"reminderFrequency": "weekly"}`, shareID},
+		{"DELETE", "/split-shares/%s", "", shareID},
+	}
+	for _, r := range routes {
+		name := r.method + " " + strings.ReplaceAll(r.path, "%s", ":id")
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range []struct {
+				id   string
+				want int
+			}{
+				{r.existing, fiber.StatusForbidden},
+				{missingID, fiber.StatusNotFound},
+				{malformedID, fiber.StatusNotFound},
+			} {
+				app, fake := newTestApp(t)
+				fake.Reject(malformedID, errors.New("invalid input syntax for type uuid"))
+				path, body := r.path, r.body
+				if strings.Contains(path, "%s") {
+					path = fmt.Sprintf(path, tt.id)
+				} else {
+					body = fmt.Sprintf(body, tt.id)
+				}
+				if status, resp := call(t, app, outsider, r.method, path, body); status != tt.want {
+					t.Errorf("id %s: status = %d, want %d (%s)", tt.id, status, tt.want, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestMembersCanView(t *testing.T) {
+	app, _ := newTestApp(t)
+	for _, path := range []string{"/expenses/" + expenseID, "/split-shares/" + shareID} {
+		if status, resp := call(t, app, debtor, "GET", path, ""); status != fiber.StatusOK {
+			t.Errorf("GET %s: status = %d, want 200 (%s)", path, status, resp)
+		}
+	}
+}
+
+func TestShareOwnerCannotSettleOwnDebt(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		body string
+		want int
+	}{
+		{"debtor marks paid", debtor, `{"amount": 45, "isPaid": true}`, fiber.StatusForbidden},
+		{"debtor lowers amount", debtor, `{"amount": 0}`, fiber.StatusForbidden},
+		{"debtor adds interest", debtor, `{"amount": 45, "interestAccrued": -45}`, fiber.StatusForbidden},
+		{"debtor changes reminders", debtor, `{"amount": 45, "reminderFrequency": "weekly"}`, fiber.StatusOK},
+		{"creditor marks paid", admin, `{"amount": 45, "isPaid": true}`, fiber.StatusOK},
+		{"outsider", outsider, `{"amount": 45, "isPaid": true}`, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, fake := newTestApp(t)
+			status, resp := call(t, app, tt.user, "PUT", "/split-shares/"+shareID, tt.body)
+			if status != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.want, resp)
+			}
+			if tt.want != fiber.StatusOK {
+				for _, s := range fake.Statements() {
+					if strings.HasPrefix(s, "UPDATE \"split_shares\"") {
+						t.Fatalf("share was saved: %s", s)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSharesOnlyForMembers(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"split with outsider", "/split-expenses/",
+			`{"groupId": "` + groupID + `", "totalAmount": 10, "shares": [{"userId": "` + debtor + `", "amount": 5}, {"userId": "` + outsider + `", "amount": 5}]}`,
+			fiber.StatusBadRequest},
+		{"split with members", "/split-expenses/",
+			`{"groupId": "` + groupID + `", "totalAmount": 10, "shares": [{"userId": "` + debtor + `", "amount": 5}, {"userId": "` + admin + `", "amount": 5}]}`,
+			fiber.StatusCreated},
+		{"share for outsider", "/split-shares/",
+			`{"splitExpenseId": "` + splitID + `", "userId": "` + outsider + `", "amount": 5}`,
+			fiber.StatusBadRequest},
+		{"share for member", "/split-shares/",
+			`{"splitExpenseId": "` + splitID + `", "userId": "` + debtor + `", "amount": 5}`,
+			fiber.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApp(t)
+			if status, resp := call(t, app, admin, "POST", tt.path, tt.body); status != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.want, resp)
+			}
+		})
+	}
+}
+
+// TestGroupCategoriesNeedManage checks only group admins change or delete a
+// group's categories, and that ids which can't exist are simply not found
+func TestGroupCategoriesNeedManage(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		id     string
+		want   int
+	}{
+		{"member renames", debtor, "PUT", snacksID, fiber.StatusForbidden},
+		{"member deletes", debtor, "DELETE", snacksID, fiber.StatusForbidden},
+		{"admin renames", admin, "PUT", snacksID, fiber.StatusOK},
+		{"missing category", admin, "PUT", missingID, fiber.StatusNotFound},
+		{"malformed id", admin, "PUT", malformedID, fiber.StatusNotFound},
+		{"malformed id on delete", admin, "DELETE", malformedID, fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, fake := newTestApp(t)
+			fake.Reject(malformedID, errors.New("invalid input syntax for type uuid"))
+			status, resp := call(t, app, tt.user, tt.method, "/categories/"+tt.id, `{"name": "Treats"}`)
+			if status != tt.want {
+				t.Errorf("status = %d, want %d (%s)", status, tt.want, resp)
+			}
+		})
+	}
+}
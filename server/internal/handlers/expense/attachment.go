@@ -0,0 +1,264 @@
+package expense
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/attachment"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/storage"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+)
+
+const (
+	variantOriginal  = "original"
+	variantThumbnail = "thumbnail"
+)
+
+// AttachmentResponse is an attachment with signed URLs to download it. The
+// URLs need no Authorization header, so they work in image widgets, and stop
+// working after token.DownloadTTL.
+type AttachmentResponse struct {
+	models.Attachment
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailUrl,omitempty"`
+	ExpiresAt    time.Time `json:"urlExpiresAt"`
+}
+
+// UploadAttachment stores a receipt sent as the multipart field "file". The
+// type is sniffed from the content and images get a thumbnail. Only people
+// who may edit the expense can attach files to it.
+func (h *Handler) UploadAttachment(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	expense, err := h.policy.Expense(userID, c.Params("id"), policy.ActionEdit)
+	if err != nil {
+		return denied(c, err, "Expense")
+	}
+
+	var count int64
+	if err := h.db.Model(&models.Attachment{}).Where("expense_id = ?", expense.ID).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to upload attachment"})
+	}
+	if count >= attachment.MaxPerExpense {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This expense already has the maximum number of attachments"})
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A file is required in the \"file\" field"})
+	}
+	if header.Size > attachment.MaxSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": attachment.ErrTooLarge.Error()})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not read the file"})
+	}
+	data, err := io.ReadAll(io.LimitReader(file, attachment.MaxSize+1))
+	file.Close()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not read the file"})
+	}
+
+	contentType, err := attachment.Validate(data)
+	switch {
+	case errors.Is(err, attachment.ErrTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	var existing int64
+	if err := h.db.Model(&models.Attachment{}).Where("expense_id = ? AND sha256 = ?", expense.ID, hash).Count(&existing).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to upload attachment"})
+	}
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This file is already attached to the expense"})
+	}
+
+	thumbnail, width, height, err := attachment.Thumbnail(data, contentType)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Keys are content addressed, so a retried upload overwrites itself
+	att := models.Attachment{
+		ExpenseID:   expense.ID,
+		UploadedBy:  userID,
+		FileName:    cleanFileName(header.Filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hash,
+		Width:       width,
+		Height:      height,
+		StorageKey:  "receipts/" + expense.ID + "/" + hash,
+	}
+	if err := h.blobs.Put(att.StorageKey, data, contentType); err != nil {
+		log.Printf("expense: storing attachment for %s failed: %v", expense.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to store attachment"})
+	}
+	if thumbnail != nil {
+		att.ThumbnailKey = att.StorageKey + "-thumb.jpg"
+		if err := h.blobs.Put(att.ThumbnailKey, thumbnail, "image/jpeg"); err != nil {
+			log.Printf("expense: storing thumbnail for %s failed: %v", expense.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to store attachment"})
+		}
+	}
+
+	if err := h.db.Create(&att).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to upload attachment"})
+	}
+
+	resp, err := h.attachmentResponse(c, userID, att)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign download URL"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// ListAttachments lists an expense's files with fresh download URLs
+func (h *Handler) ListAttachments(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	expense, err := h.policy.Expense(userID, c.Params("id"), policy.ActionView)
+	if err != nil {
+		return denied(c, err, "Expense")
+	}
+
+	var attachments []models.Attachment
+	if err := h.db.Where("expense_id = ?", expense.ID).Order("created_at").Find(&attachments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list attachments"})
+	}
+
+	resp := make([]AttachmentResponse, 0, len(attachments))
+	for _, att := range attachments {
+		r, err := h.attachmentResponse(c, userID, att)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign download URL"})
+		}
+		resp = append(resp, r)
+	}
+	return c.JSON(resp)
+}
+
+// DeleteAttachment removes a file from the expense. The stored bytes are
+// kept, as receipts may be needed to resolve a dispute later.
+func (h *Handler) DeleteAttachment(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	expense, err := h.policy.Expense(userID, c.Params("id"), policy.ActionEdit)
+	if err != nil {
+		return denied(c, err, "Expense")
+	}
+
+	result := h.db.Where("id = ? AND expense_id = ?", c.Params("attachmentId"), expense.ID).Delete(&models.Attachment{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete attachment"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	if err := h.refreshVerified(expense); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete attachment"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DownloadAttachment serves a file through a signed URL. Access is checked
+// again for the user the URL was issued to, so leaving the group stops
+// URLs from working even before they expire.
+func (h *Handler) DownloadAttachment(c *fiber.Ctx) error {
+	grant, err := h.tokens.VerifyDownload(c.Query("token"))
+	if err != nil || grant.ResourceID != c.Params("attachmentId") {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired download link"})
+	}
+
+	var att models.Attachment
+	if err := h.db.First(&att, "id = ?", grant.ResourceID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	if _, err := h.policy.Expense(grant.UserID, att.ExpenseID, policy.ActionView); err != nil {
+		return denied(c, err, "Attachment")
+	}
+
+	key, contentType := att.StorageKey, att.ContentType
+	if grant.Variant == variantThumbnail {
+		if att.ThumbnailKey == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment has no thumbnail"})
+		}
+		key, contentType = att.ThumbnailKey, "image/jpeg"
+	}
+
+	blob, err := h.blobs.Open(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	if err != nil {
+		log.Printf("expense: reading attachment %s failed: %v", att.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read attachment"})
+	}
+
+	// PDFs are downloaded rather than shown so they can't run in our origin
+	disposition := "inline"
+	if contentType == "application/pdf" {
+		disposition = "attachment"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, disposition+`; filename="`+att.FileName+`"`)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+	return c.SendStream(blob)
+}
+
+func (h *Handler) attachmentResponse(c *fiber.Ctx, userID string, att models.Attachment) (AttachmentResponse, error) {
+	resp := AttachmentResponse{Attachment: att}
+	base := c.BaseURL() + "/api/v1/attachments/" + att.ID + "?token="
+
+	signed, expiresAt, err := h.tokens.IssueDownload(token.Download{UserID: userID, ResourceID: att.ID, Variant: variantOriginal})
+	if err != nil {
+		return resp, err
+	}
+	resp.URL, resp.ExpiresAt = base+signed, expiresAt
+
+	if att.ThumbnailKey != "" {
+		signed, _, err := h.tokens.IssueDownload(token.Download{UserID: userID, ResourceID: att.ID, Variant: variantThumbnail})
+		if err != nil {
+			return resp, err
+		}
+		resp.ThumbnailURL = base + signed
+	}
+	return resp, nil
+}
+
+// cleanFileName keeps the base name of an uploaded file as printable ASCII,
+// so it is safe in the Content-Disposition header
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r > unicode.MaxASCII:
+			return '_'
+		case unicode.IsControl(r) || r == '"' || r == '/':
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	if name == "" || name == "." {
+		return "receipt"
+	}
+	return name
+}
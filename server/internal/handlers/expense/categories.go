@@ -0,0 +1,223 @@
+package expense
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+)
+
+// findCategory looks up the category of something of userID's, in groupID
+// when set. A category the client chose must exist; one filled in by rules
+// or keywords falls back to Other.
+func (h *Handler) findCategory(userID string, groupID *string, id, name string, chosen bool) (*models.Category, error) {
+	scope := taxonomy.ScopeOf(userID, groupID)
+	if chosen {
+		return h.categories.Find(scope, id, name)
+	}
+	return h.categories.FindOrOther(scope, name)
+}
+
+// categoryError reports a category that can't be used, or a failed lookup
+func categoryError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, taxonomy.ErrUnknown) || errors.Is(err, taxonomy.ErrRequired) || errors.Is(err, taxonomy.ErrInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load categories"})
+}
+
+// CategoryRequest creates or changes a custom category
+type CategoryRequest struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parentId"`
+	Icon     string  `json:"icon"`
+	Color    string  `json:"color"` // #RRGGBB
+	Position int     `json:"position"`
+	GroupID  string  `json:"groupId"` // only when creating a group category
+}
+
+// ListCategories returns the system categories and the user's own, or with
+// groupId the group's, nested under their parents
+func (h *Handler) ListCategories(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var groupID *string
+	if id := c.Query("groupId"); id != "" {
+		if _, err := h.policy.Group(userID, id, policy.ActionView); err != nil {
+			return denied(c, err, "Group")
+		}
+		groupID = &id
+	}
+	categories, err := h.categories.List(taxonomy.ScopeOf(userID, groupID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve categories"})
+	}
+	return c.JSON(taxonomy.Tree(categories))
+}
+
+// CreateCategory adds a custom category for the user or, with groupId, for
+// a group they can add expenses to
+func (h *Handler) CreateCategory(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var req CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	var groupID *string
+	if req.GroupID != "" {
+		if _, err := h.policy.Group(userID, req.GroupID, policy.ActionContribute); err != nil {
+			return denied(c, err, "Group")
+		}
+		groupID = &req.GroupID
+	}
+
+	category := models.Category{
+		Name:     req.Name,
+		ParentID: req.ParentID,
+		Icon:     req.Icon,
+		Color:    req.Color,
+		Position: req.Position,
+	}
+	if err := h.categories.Create(taxonomy.ScopeOf(userID, groupID), &category); err != nil {
+		return categoryError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// UpdateCategory changes a custom category; renaming it renames everything
+// filed under it
+func (h *Handler) UpdateCategory(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	category, err := h.ownCategory(userID, c.Params("id"))
+	if err != nil {
+		return ownCategoryError(c, err)
+	}
+
+	var req CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	previousName, previousParent := category.Name, category.ParentID
+	category.Name, category.ParentID = req.Name, req.ParentID
+	category.Icon, category.Color, category.Position = req.Icon, req.Color, req.Position
+	if err := h.categories.Update(category, previousName); err != nil {
+		return categoryError(c, err)
+	}
+
+	// A parent's budgets count its subcategories, so moving one moves its
+	// spending between them
+	if !sameID(previousParent, category.ParentID) {
+		var ids []string
+		for _, id := range []*string{previousParent, category.ParentID} {
+			if id != nil {
+				ids = append(ids, *id)
+			}
+		}
+		h.refreshCategoryBudgets(taxonomy.Of(category), ids)
+	}
+	return c.JSON(category)
+}
+
+func sameID(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// refreshCategoryBudgets recalculates the scope's budgets of the categories
+// in ids after spending moved between them
+func (h *Handler) refreshCategoryBudgets(scope taxonomy.Scope, ids []string) {
+	query := h.db.Where("category_id IN ?", ids)
+	if scope.GroupID != nil {
+		query = query.Where("group_id = ?", *scope.GroupID)
+	} else {
+		query = query.Where("user_id = ? AND group_id IS NULL", scope.UserID)
+	}
+	var budgets []models.Budget
+	if err := query.Find(&budgets).Error; err != nil {
+		log.Printf("expense: could not load budgets of categories %v: %v", ids, err)
+	}
+	for i := range budgets {
+		if err := h.budgets.Refresh(&budgets[i]); err != nil {
+			log.Printf("expense: could not refresh budget %s: %v", budgets[i].ID, err)
+		}
+	}
+}
+
+// DeleteCategory removes a custom category. Its expenses, recurring expenses
+// and budgets move to the category in replaceWith, by default its parent or
+// else Other.
+func (h *Handler) DeleteCategory(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	category, err := h.ownCategory(userID, c.Params("id"))
+	if err != nil {
+		return ownCategoryError(c, err)
+	}
+
+	scope := taxonomy.Of(category)
+	var replacement *models.Category
+	switch {
+	case c.Query("replaceWith") != "":
+		replacement, err = h.categories.Find(scope, c.Query("replaceWith"), "")
+	case category.ParentID != nil:
+		replacement, err = h.categories.Find(scope, *category.ParentID, "")
+	default:
+		replacement, err = h.categories.FindOrOther(scope, taxonomy.Other)
+	}
+	if err != nil {
+		return categoryError(c, err)
+	}
+	if err := h.categories.Delete(category, replacement); err != nil {
+		return categoryError(c, err)
+	}
+
+	// Spending moved into the owner's budgets for the replacement
+	ids := []string{replacement.ID}
+	if replacement.ParentID != nil {
+		ids = append(ids, *replacement.ParentID)
+	}
+	h.refreshCategoryBudgets(scope, ids)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// errSystemCategory refuses changes to the categories everyone shares
+var errSystemCategory = errors.New("system categories can't be changed")
+
+// ownCategory loads a category the user may change: their own, or one of a
+// group they manage
+func (h *Handler) ownCategory(userID, categoryID string) (*models.Category, error) {
+	if !taxonomy.IsID(categoryID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var category models.Category
+	if err := h.db.First(&category, "id = ?", categoryID).Error; err != nil {
+		return nil, err
+	}
+	switch {
+	case category.IsSystem():
+		return nil, errSystemCategory
+	case category.GroupID != nil:
+		if _, err := h.policy.Group(userID, *category.GroupID, policy.ActionManage); err != nil {
+			return nil, err
+		}
+	case *category.UserID != userID:
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &category, nil
+}
+
+func ownCategoryError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, policy.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	case errors.Is(err, errSystemCategory), errors.Is(err, policy.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not authorized to change this category"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load category"})
+}
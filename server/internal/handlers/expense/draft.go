@@ -0,0 +1,37 @@
+package expense
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/parse"
+)
+
+type ParseExpenseRequest struct {
+	Text    string `json:"text"`
+	GroupID string `json:"groupId"`
+}
+
+// DraftExpense turns a sentence into a draft expense and split for the user
+// to review. Nothing is saved: the app creates the expense with the draft and
+// then the split with the shares.
+func (h *Handler) DraftExpense(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var req ParseExpenseRequest
+	if err := c.BodyParser(&req); err != nil || req.Text == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	ctx, err := parse.LoadContext(h.db, userID, req.GroupID)
+	if err != nil {
+		return denied(c, err, "Group")
+	}
+
+	draft, err := parse.Expense(req.Text, ctx)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rules, err := h.rules.Matcher(userID); err == nil {
+		draft.ApplyRules(rules)
+	}
+	return c.JSON(draft)
+}
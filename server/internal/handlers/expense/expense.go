@@ -1,29 +1,75 @@
 package expense
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/balance"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/storage"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	budgets    *budget.Tracker
+	tokens     *token.Manager
+	policy     *policy.Policy
+	balances   *balance.Service
+	blobs      storage.BlobStore
+	rules      *categorize.Engine
+	categories *taxonomy.Service
 }
 
-func NewHandler(db *gorm.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *gorm.DB, budgets *budget.Tracker, tokens *token.Manager, blobs storage.BlobStore) *Handler {
+	return &Handler{
+		db:         db,
+		budgets:    budgets,
+		tokens:     tokens,
+		policy:     policy.New(db),
+		balances:   balance.NewService(db),
+		blobs:      blobs,
+		rules:      categorize.New(db),
+		categories: taxonomy.New(db),
+	}
+}
+
+// denied responds to a policy error: 404 for resources that don't exist, 403
+// for non-members and actions the user isn't allowed to take
+func denied(c *fiber.Ctx, err error, resource string) error {
+	switch {
+	case errors.Is(err, policy.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": resource + " not found",
+		})
+	case errors.Is(err, policy.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Not authorized to perform this action",
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check permissions",
+		})
+	}
 }
 
 // CreateExpenseRequest represents the structure of the expense creation request
 type CreateExpenseRequest struct {
-	Amount           float64 `json:"amount"`
-	Category         string  `json:"category"`
-	GroupID          string  `json:"groupId"`
-	Description      string  `json:"description"`
-	OriginalCurrency string  `json:"originalCurrency"`
-	SplitType        string  `json:"splitType"` // EQUAL, PERCENTAGE, CUSTOM
+	Amount           float64    `json:"amount"`
+	Category         string     `json:"category"`
+	CategoryID       string     `json:"categoryId,omitempty"` // instead of category
+	GroupID          string     `json:"groupId"`
+	Description      string     `json:"description"`
+	OriginalCurrency string     `json:"originalCurrency"`
+	SplitType        string     `json:"splitType"` // EQUAL, PERCENTAGE, CUSTOM
+	Tags             []string   `json:"tags"`
+	Date             *time.Time `json:"date,omitempty"` // defaults to now
 }
 
 // CreateExpense handles the creation of an expense with split expenses
@@ -42,15 +88,36 @@ func (h *Handler) CreateExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	var groupID *string
+	if req.GroupID != "" {
+		if _, err := h.policy.Group(userID, req.GroupID, policy.ActionContribute); err != nil {
+			return denied(c, err, "Group")
+		}
+		groupID = &req.GroupID
+	}
+
 	expense := models.Expense{
 		UserID:           userID,
-		GroupID:          &req.GroupID,
+		GroupID:          groupID,
 		Amount:           req.Amount,
 		OriginalCurrency: req.OriginalCurrency,
 		Category:         req.Category,
 		Description:      req.Description,
 		Date:             time.Now(),
+		Tags:             req.Tags,
+	}
+	if req.Date != nil && !req.Date.IsZero() {
+		expense.Date = *req.Date
 	}
+	chosen := req.CategoryID != "" || !needsCategory(req.Category)
+	if !chosen {
+		h.categorizeExpense(userID, &expense)
+	}
+	category, err := h.findCategory(userID, groupID, req.CategoryID, expense.Category, chosen)
+	if err != nil {
+		return categoryError(c, err)
+	}
+	expense.Category, expense.CategoryID = category.Name, &category.ID
 
 	if err := h.db.Create(&expense).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -58,58 +125,91 @@ func (h *Handler) CreateExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	h.budgets.ExpenseChanged(expense)
+
 	return c.Status(fiber.StatusCreated).JSON(expense)
 }
 
 // UpdateExpense updates an existing expense
 func (h *Handler) UpdateExpense(c *fiber.Ctx) error {
-	expenseID := c.Params("id")
+	userID, _ := c.Locals("userId").(string)
 	var req models.Expense
 
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
 	}
 
-	var expense models.Expense
-	if err := h.db.First(&expense, "id = ?", expenseID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
+	found, err := h.policy.Expense(userID, c.Params("id"), policy.ActionEdit)
+	if err != nil {
+		return denied(c, err, "Expense")
+	}
+	expense := *found
+	previous := expense
+
+	// Without a category the expense keeps its own
+	if req.CategoryID != nil || req.Category != "" {
+		id := ""
+		if req.CategoryID != nil {
+			id = *req.CategoryID
+		}
+		category, err := h.findCategory(expense.UserID, expense.GroupID, id, req.Category, true)
+		if err != nil {
+			return categoryError(c, err)
+		}
+		expense.Category, expense.CategoryID = category.Name, &category.ID
 	}
 
 	expense.Amount = req.Amount
-	expense.Category = req.Category
 	expense.Description = req.Description
 	expense.Date = req.Date
+	if req.Tags != nil {
+		expense.Tags = req.Tags
+	}
 
 	if err := h.db.Save(&expense).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update expense"})
 	}
+	if err := h.refreshVerified(&expense); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update expense"})
+	}
+
+	h.learnCategory(userID, &previous, &expense)
+
+	h.budgets.ExpenseChanged(previous)
+	h.budgets.ExpenseChanged(expense)
 
 	return c.JSON(expense)
 }
 
 // DeleteExpense removes an expense from the database
 func (h *Handler) DeleteExpense(c *fiber.Ctx) error {
-	expenseID := c.Params("id")
-	if err := h.db.Delete(&models.Expense{}, "id = ?", expenseID).Error; err != nil {
+	userID, _ := c.Locals("userId").(string)
+	expense, err := h.policy.Expense(userID, c.Params("id"), policy.ActionDelete)
+	if err != nil {
+		return denied(c, err, "Expense")
+	}
+	if err := h.db.Delete(expense).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete expense"})
 	}
+	h.budgets.ExpenseChanged(*expense)
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 // GetExpense retrieves a single expense by ID
 func (h *Handler) GetExpense(c *fiber.Ctx) error {
-	expenseID := c.Params("id")
-	var expense models.Expense
-	if err := h.db.First(&expense, "id = ?", expenseID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
+	userID, _ := c.Locals("userId").(string)
+	expense, err := h.policy.Expense(userID, c.Params("id"), policy.ActionView)
+	if err != nil {
+		return denied(c, err, "Expense")
 	}
 	return c.JSON(expense)
 }
 
-// ListExpenses retrieves all expenses
+// ListExpenses retrieves the user's own expenses and those of their groups
 func (h *Handler) ListExpenses(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
 	var expenses []models.Expense
-	if err := h.db.Find(&expenses).Error; err != nil {
+	if err := h.db.Scopes(h.policy.VisibleExpenses(userID)).Order("date DESC").Find(&expenses).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve expenses"})
 	}
 	return c.JSON(expenses)
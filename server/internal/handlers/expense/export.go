@@ -0,0 +1,338 @@
+package expense
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/export"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"gorm.io/gorm"
+)
+
+// exportBatch is how many expenses are loaded at a time while streaming
+const exportBatch = 200
+
+// Export sheets. CSV holds one of them, chosen with ?sheet=; XLSX holds all.
+const (
+	SheetExpenses = "expenses"
+	SheetSplits   = "splits"
+	SheetPayments = "payments"
+)
+
+// expenseExport describes what to export and for whom
+type expenseExport struct {
+	userID     string
+	group      *models.Group
+	currency   string // converted amounts are in this currency
+	from, to   *time.Time
+	categories []string
+	members    []models.User // share columns, group exports only
+	names      map[string]string
+}
+
+// ExportExpenses streams expenses as CSV or XLSX. With groupId it exports the
+// group's expenses, splits and settled shares with a share column per
+// member; without it, the user's own expenses with their share. Filters:
+// from and to (YYYY-MM-DD, inclusive) and category (comma separated).
+func (h *Handler) ExportExpenses(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	format := strings.ToLower(c.Query("format", export.FormatCSV))
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": export.ErrUnknownFormat.Error()})
+	}
+	sheets := []string{SheetExpenses, SheetSplits, SheetPayments}
+	if format == export.FormatCSV {
+		sheet := c.Query("sheet", SheetExpenses)
+		if sheet != SheetExpenses && sheet != SheetSplits && sheet != SheetPayments {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sheet must be expenses, splits or payments"})
+		}
+		sheets = []string{sheet}
+	}
+
+	ex := expenseExport{userID: userID, names: map[string]string{}}
+	var err error
+	if ex.from, err = queryDate(c, "from"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if ex.to, err = queryDate(c, "to"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if ex.from != nil && ex.to != nil && ex.to.Before(*ex.from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "to must not be before from"})
+	}
+	for _, category := range strings.Split(c.Query("category"), ",") {
+		if category = strings.ToLower(strings.TrimSpace(category)); category != "" {
+			// Query strings point into fiber's buffer, which outlives the
+			// handler only until the stream ends
+			ex.categories = append(ex.categories, strings.Clone(category))
+		}
+	}
+
+	name := "expenses"
+	if groupID := c.Query("groupId"); groupID != "" {
+		group, err := h.policy.Group(userID, groupID, policy.ActionView)
+		if err != nil {
+			return denied(c, err, "Group")
+		}
+		ex.group = group
+		ex.currency = group.DefaultCurrency
+		name = "group-" + slug(group.Name)
+
+		// Former members stay as columns so their old shares still add up
+		var members []models.GroupMember
+		if err := h.db.Preload("User").Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load group members"})
+		}
+		for _, m := range members {
+			if _, seen := ex.names[m.UserID]; seen {
+				continue // left and rejoined
+			}
+			ex.members = append(ex.members, m.User)
+			ex.names[m.UserID] = m.User.DisplayName
+		}
+		sort.Slice(ex.members, func(i, j int) bool {
+			return strings.ToLower(ex.members[i].DisplayName) < strings.ToLower(ex.members[j].DisplayName)
+		})
+	} else {
+		var user models.User
+		if err := h.db.Select("id", "display_name", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load user"})
+		}
+		ex.currency = user.PreferredCurrency
+		ex.names[user.ID] = user.DisplayName
+	}
+	if format == export.FormatCSV && sheets[0] != SheetExpenses {
+		name += "-" + sheets[0]
+	}
+
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("2006-01-02"), format))
+
+	// Headers are sent before the first row, so errors from here on can only
+	// cut the file short
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		out, _ := export.New(format, w)
+		for _, sheet := range sheets {
+			if err := h.writeSheet(out, &ex, sheet, w); err != nil {
+				log.Printf("export: could not write %s for user %s: %v", sheet, userID, err)
+				return
+			}
+		}
+		if err := out.Close(); err != nil {
+			log.Printf("export: could not finish export for user %s: %v", userID, err)
+			return
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+func (h *Handler) writeSheet(out export.Writer, ex *expenseExport, sheet string, w *bufio.Writer) error {
+	switch sheet {
+	case SheetExpenses:
+		header := []string{"Date", "Description", "Category", "Group", "Paid by", "Amount", "Currency",
+			"Amount (" + ex.currency + ")", "Tags", "Verified"}
+		if ex.group != nil {
+			for _, m := range ex.members {
+				header = append(header, "Share: "+m.DisplayName)
+			}
+		} else {
+			header = append(header, "Your share")
+		}
+		if err := out.Sheet("Expenses", header); err != nil {
+			return err
+		}
+	case SheetSplits:
+		if err := out.Sheet("Splits", []string{"Date", "Expense", "Split type", "Owed to", "Member",
+			"Amount", "Currency", "Interest", "Paid", "Paid at", "Due"}); err != nil {
+			return err
+		}
+	case SheetPayments:
+		if err := out.Sheet("Payments", []string{"Paid at", "From", "To", "Amount", "Currency", "Expense"}); err != nil {
+			return err
+		}
+	}
+
+	return h.eachExpenseBatch(ex, func(batch []models.Expense) error {
+		for i := range batch {
+			if err := ex.writeRows(out, sheet, &batch[i]); err != nil {
+				return err
+			}
+		}
+		// Push each batch to the client rather than holding the whole file
+		return w.Flush()
+	})
+}
+
+func (ex *expenseExport) writeRows(out export.Writer, sheet string, e *models.Expense) error {
+	switch sheet {
+	case SheetExpenses:
+		groupName := ""
+		if e.Group != nil {
+			groupName = e.Group.Name
+		}
+		row := []interface{}{e.Date, e.Description, e.Category, groupName, e.User.DisplayName,
+			e.Amount, e.OriginalCurrency, ex.converted(e), strings.Join(e.Tags, ", "), e.IsVerified}
+
+		shares := map[string]float64{}
+		split := false
+		for _, s := range e.SplitExpenses {
+			for _, share := range s.Shares {
+				shares[share.UserID] += share.Amount
+				split = true
+			}
+		}
+		if ex.group != nil {
+			for _, m := range ex.members {
+				if amount, ok := shares[m.ID]; ok {
+					row = append(row, amount)
+				} else {
+					row = append(row, nil)
+				}
+			}
+		} else if split {
+			row = append(row, shares[ex.userID])
+		} else {
+			row = append(row, e.Amount)
+		}
+		return out.Row(row...)
+
+	case SheetSplits:
+		for _, s := range e.SplitExpenses {
+			for _, share := range s.Shares {
+				if err := out.Row(e.Date, e.Description, s.SplitType, ex.name(s.Creator), ex.name(share.User),
+					share.Amount, e.OriginalCurrency, share.InterestAccrued, share.IsPaid, share.PaidAt, s.DueDate); err != nil {
+					return err
+				}
+			}
+		}
+
+	case SheetPayments:
+		for _, s := range e.SplitExpenses {
+			for _, share := range s.Shares {
+				// The creator's own share is never paid to anyone
+				if !share.IsPaid || share.UserID == s.CreatedBy {
+					continue
+				}
+				if err := out.Row(share.PaidAt, ex.name(share.User), ex.name(s.Creator),
+					share.Amount+share.InterestAccrued, e.OriginalCurrency, e.Description); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// converted is the amount in the export currency, or nil when no
+// conversion is recorded
+func (ex *expenseExport) converted(e *models.Expense) interface{} {
+	if strings.EqualFold(e.OriginalCurrency, ex.currency) {
+		return e.Amount
+	}
+	if e.ConvertedAmount != 0 {
+		return e.ConvertedAmount
+	}
+	return nil
+}
+
+func (ex *expenseExport) name(user models.User) string {
+	if name, ok := ex.names[user.ID]; ok {
+		return name
+	}
+	return user.DisplayName
+}
+
+// eachExpenseBatch pages through the exported expenses in date order. It
+// uses keyset pagination on (date, id) so large groups are read in constant
+// memory and rows added mid-export don't shift pages.
+func (h *Handler) eachExpenseBatch(ex *expenseExport, fn func([]models.Expense) error) error {
+	var lastDate time.Time
+	lastID := ""
+	userColumns := func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "display_name")
+	}
+
+	for {
+		query := h.db.Model(&models.Expense{}).
+			Preload("User", userColumns).
+			Preload("Group").
+			Preload("SplitExpenses").
+			Preload("SplitExpenses.Creator", userColumns).
+			Preload("SplitExpenses.Shares").
+			Preload("SplitExpenses.Shares.User", userColumns).
+			Order("date, id").
+			Limit(exportBatch)
+
+		if ex.group != nil {
+			query = query.Where("group_id = ?", ex.group.ID)
+		} else {
+			query = query.Where("user_id = ?", ex.userID)
+		}
+		if ex.from != nil {
+			query = query.Where("date >= ?", *ex.from)
+		}
+		if ex.to != nil {
+			query = query.Where("date < ?", ex.to.AddDate(0, 0, 1))
+		}
+		if len(ex.categories) > 0 {
+			query = query.Where("LOWER(category) IN ?", ex.categories)
+		}
+		if lastID != "" {
+			query = query.Where("(date, id) > (?, ?)", lastDate, lastID)
+		}
+
+		var batch []models.Expense
+		if err := query.Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < exportBatch {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		lastDate, lastID = last.Date, last.ID
+	}
+}
+
+func queryDate(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be YYYY-MM-DD", key)
+	}
+	return &t, nil
+}
+
+// slug makes a name safe for a download filename
+func slug(name string) string {
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+	s = strings.Trim(s, "-")
+	if s == "" {
+		return "export"
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package expense
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+// TestEachExpenseBatchPages checks keyset paging visits every expense once,
+// in date then id order, including expenses sharing a date across a page
+// boundary
+func TestEachExpenseBatchPages(t *testing.T) {
+	for _, n := range []int{0, 1, exportBatch - 1, exportBatch, 2*exportBatch + 50} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			db, fake := dbtest.Open()
+			start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			type key struct {
+				date time.Time
+				id   string
+			}
+			var keys []key
+			for _, i := range rand.New(rand.NewSource(int64(n))).Perm(n) {
+				// Few dates, so most expenses tie on date and order by id
+				k := key{start.AddDate(0, 0, i%3), fmt.Sprintf("00000000-0000-4000-8000-%012d", i+1000)}
+				fake.Add("expenses", dbtest.Row{"id": k.id, "user_id": admin, "group_id": nil, "amount": 1.0,
+					"category": "Food", "date": k.date})
+				keys = append(keys, k)
+			}
+			fake.Add("expenses", dbtest.Row{"user_id": debtor, "group_id": nil, "amount": 1.0, "category": "Food", "date": start})
+			sort.Slice(keys, func(i, j int) bool {
+				if !keys[i].date.Equal(keys[j].date) {
+					return keys[i].date.Before(keys[j].date)
+				}
+				return keys[i].id < keys[j].id
+			})
+			var want []string
+			for _, k := range keys {
+				want = append(want, k.id)
+			}
+
+			h := NewHandler(db, budget.NewTracker(db, nil), nil, nil)
+			var got []string
+			var sizes []int
+			err := h.eachExpenseBatch(&expenseExport{userID: admin}, func(batch []models.Expense) error {
+				sizes = append(sizes, len(batch))
+				for _, e := range batch {
+					got = append(got, e.ID)
+				}
+				if len(sizes) > n/exportBatch+1 {
+					return fmt.Errorf("%d batches for %d expenses", len(sizes), n)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("eachExpenseBatch: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("visited %d expenses out of order or more than once, want %d", len(got), len(want))
+			}
+			for i, size := range sizes {
+				if size > exportBatch || (i < len(sizes)-1 && size != exportBatch) {
+					t.Errorf("batch sizes = %v, want full batches of %d", sizes, exportBatch)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package expense
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/splitwise"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImportParticipant is how a Splitwise name maps to a group member
+type ImportParticipant struct {
+	Name        string `json:"name"`
+	UserID      string `json:"userId,omitempty"` // empty for placeholders not created yet
+	DisplayName string `json:"displayName"`
+	Placeholder bool   `json:"placeholder"`
+	New         bool   `json:"new"` // a placeholder member the import will add
+}
+
+// ImportShare is one participant's share of an imported row
+type ImportShare struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+// ImportRow is what the import does with one line of the file
+type ImportRow struct {
+	Line        int           `json:"line"`
+	Date        string        `json:"date"`
+	Description string        `json:"description"`
+	Category    string        `json:"category"`
+	Tags        []string      `json:"tags,omitempty"`
+	Amount      float64       `json:"amount"`
+	Currency    string        `json:"currency"`
+	PaidBy      string        `json:"paidBy,omitempty"`
+	Shares      []ImportShare `json:"shares,omitempty"`
+	Payment     bool          `json:"payment"`
+	Status      string        `json:"status"` // create, duplicate or skip
+	Warnings    []string      `json:"warnings,omitempty"`
+
+	key        string
+	row        *splitwise.Row
+	payer      int
+	shares     []splitwise.Share
+	categoryID string
+}
+
+// Import row statuses
+const (
+	ImportCreate    = "create"
+	ImportDuplicate = "duplicate"
+	ImportSkip      = "skip"
+)
+
+// ImportResult summarizes a Splitwise import. On a dry run nothing is saved
+// and Created counts what would be.
+type ImportResult struct {
+	DryRun       bool                `json:"dryRun"`
+	Participants []ImportParticipant `json:"participants"`
+	Created      int                 `json:"created"`
+	Duplicates   int                 `json:"duplicates"`
+	Skipped      int                 `json:"skipped"`
+	Rows         []ImportRow         `json:"rows"`
+}
+
+// ImportSplitwise imports a Splitwise group export into a group. It is a
+// dry run unless dryRun=false, so the app can show what will be created
+// first. Participants map to members by the members field (a JSON object of
+// Splitwise name to user ID), then by display name, and otherwise to
+// placeholder members. Rows already imported are skipped, so re-running an
+// import, or importing a newer export of the same group, adds only what's new.
+func (h *Handler) ImportSplitwise(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	// Placeholders become group members, so importing is an admin action
+	group, err := h.policy.Group(userID, c.FormValue("groupId"), policy.ActionManage)
+	if err != nil {
+		return denied(c, err, "Group")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A Splitwise CSV file is required"})
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not read file"})
+	}
+	defer f.Close()
+	file, err := splitwise.Parse(f)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	mapping := map[string]string{}
+	if raw := c.FormValue("members"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "members must be a JSON object of name to user ID"})
+		}
+	}
+	participants, err := h.mapParticipants(group.ID, file.Participants, mapping)
+	if err != nil {
+		var invalid *invalidMemberError
+		if errors.As(err, &invalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": invalid.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load group members"})
+	}
+
+	rules, err := h.rules.Matcher(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load category rules"})
+	}
+	result := &ImportResult{DryRun: c.FormValue("dryRun") != "false", Participants: participants}
+	if err := h.planImport(group.ID, file, rules, result); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check for earlier imports"})
+	}
+	if result.DryRun || result.Created == 0 {
+		return c.JSON(result)
+	}
+
+	expenses, err := h.saveImport(group, result)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to import expenses"})
+	}
+	for _, expense := range expenses {
+		h.budgets.ExpenseChanged(expense)
+	}
+	return c.Status(fiber.StatusCreated).JSON(result)
+}
+
+type invalidMemberError struct{ name string }
+
+func (e *invalidMemberError) Error() string {
+	return fmt.Sprintf("%s is mapped to someone who isn't a member of the group", e.name)
+}
+
+// mapParticipants matches Splitwise names to group members. A display name
+// only matches when exactly one member has it; placeholders from earlier
+// imports are reused by name.
+func (h *Handler) mapParticipants(groupID string, names []string, mapping map[string]string) ([]ImportParticipant, error) {
+	var members []models.GroupMember
+	if err := h.db.Preload("User").Where("group_id = ? AND is_active = ?", groupID, true).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	byID := map[string]models.User{}
+	byName := map[string][]models.User{}
+	for _, m := range members {
+		byID[m.UserID] = m.User
+		key := strings.ToLower(strings.TrimSpace(m.User.DisplayName))
+		byName[key] = append(byName[key], m.User)
+	}
+
+	participants := make([]ImportParticipant, len(names))
+	for i, name := range names {
+		p := ImportParticipant{Name: name, DisplayName: name}
+		var user *models.User
+		if id, ok := lookupFold(mapping, name); ok {
+			u, found := byID[id]
+			if !found {
+				return nil, &invalidMemberError{name: name}
+			}
+			user = &u
+		} else if matches := byName[strings.ToLower(name)]; len(matches) == 1 {
+			user = &matches[0]
+		}
+
+		if user != nil {
+			p.UserID, p.DisplayName, p.Placeholder = user.ID, user.DisplayName, user.IsPlaceholder
+		} else {
+			p.Placeholder, p.New = true, true
+		}
+		participants[i] = p
+	}
+	return participants, nil
+}
+
+func lookupFold(m map[string]string, name string) (string, bool) {
+	for k, v := range m {
+		if strings.EqualFold(strings.TrimSpace(k), name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// planImport works out each row's payer and shares, categorizes rows left
+// in Splitwise's catch-all category with the importing user's rules, and
+// marks rows imported before as duplicates
+func (h *Handler) planImport(groupID string, file *splitwise.File, rules *categorize.Matcher, result *ImportResult) error {
+	occurrences := map[string]int{}
+	keys := make([]string, 0, len(file.Rows))
+	categories := h.categories.Lookup(taxonomy.ScopeOf("", &groupID))
+	result.Rows = make([]ImportRow, 0, len(file.Rows))
+	for i := range file.Rows {
+		row := &file.Rows[i]
+		content := row.Key(groupID, file.Participants, 0)
+		key := row.Key(groupID, file.Participants, occurrences[content])
+		occurrences[content]++
+
+		payer, shares, warnings := row.Split()
+		plan := ImportRow{
+			Line:        row.Line,
+			Date:        row.Date.Format("2006-01-02"),
+			Description: row.Description,
+			Category:    row.Category,
+			Amount:      row.Cost,
+			Currency:    row.Currency,
+			Payment:     row.IsPayment(),
+			Status:      ImportCreate,
+			Warnings:    warnings,
+			key:         key,
+			row:         row,
+			payer:       payer,
+			shares:      shares,
+		}
+		if !plan.Payment && (needsCategory(plan.Category) || strings.EqualFold(plan.Category, splitwise.CategoryGeneral)) {
+			rules.Match(row.Description).Apply(&plan.Category, &plan.Tags)
+		}
+		category, err := categories.FindOrOther(plan.Category)
+		if err != nil {
+			return err
+		}
+		plan.Category, plan.categoryID = category.Name, category.ID
+		if payer < 0 || row.Cost == 0 {
+			plan.Status = ImportSkip
+		} else {
+			plan.PaidBy = result.Participants[payer].DisplayName
+			for _, share := range shares {
+				plan.Shares = append(plan.Shares, ImportShare{
+					Name:   result.Participants[share.Participant].DisplayName,
+					Amount: share.Amount,
+				})
+			}
+		}
+		keys = append(keys, key)
+		result.Rows = append(result.Rows, plan)
+	}
+
+	existing := map[string]bool{}
+	for start := 0; start < len(keys); start += 1000 {
+		end := start + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var found []string
+		if err := h.db.Unscoped().Model(&models.Expense{}).
+			Where("import_key IN ?", keys[start:end]).
+			Pluck("import_key", &found).Error; err != nil {
+			return err
+		}
+		for _, key := range found {
+			existing[key] = true
+		}
+	}
+
+	for i := range result.Rows {
+		row := &result.Rows[i]
+		switch {
+		case row.Status == ImportSkip:
+			result.Skipped++
+		case existing[row.key]:
+			// Deleted expenses count too, so an import doesn't bring back
+			// what a member removed
+			row.Status = ImportDuplicate
+			result.Duplicates++
+		default:
+			result.Created++
+		}
+	}
+	return nil
+}
+
+// saveImport creates placeholder members and the planned expenses with
+// their splits in one transaction. Historical debts between two people that
+// cancel out in the imported rows are marked paid so only what is still
+// outstanding shows up as owed.
+func (h *Handler) saveImport(group *models.Group, result *ImportResult) ([]models.Expense, error) {
+	var created []models.Expense
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for i := range result.Participants {
+			p := &result.Participants[i]
+			if !p.New || !usedBy(result.Rows, i) {
+				continue
+			}
+			user, err := placeholderMember(tx, group.ID, p.Name)
+			if err != nil {
+				return err
+			}
+			p.UserID, p.New = user.ID, false
+		}
+
+		type pair struct{ creditor, debtor, currency string }
+		owed := map[pair]float64{}
+		pairShares := map[pair][]string{}
+		lastDate := map[pair]time.Time{}
+
+		for i := range result.Rows {
+			plan := &result.Rows[i]
+			if plan.Status != ImportCreate {
+				continue
+			}
+			row := plan.row
+			payerID := result.Participants[plan.payer].UserID
+			key := plan.key
+			expense := models.Expense{
+				UserID:           payerID,
+				GroupID:          &group.ID,
+				Amount:           row.Cost,
+				OriginalCurrency: row.Currency,
+				Category:         plan.Category,
+				CategoryID:       &plan.categoryID,
+				Description:      row.Description,
+				Date:             row.Date,
+				Tags:             append([]string{"splitwise"}, plan.Tags...),
+				ImportKey:        &key,
+			}
+			if plan.Payment {
+				expense.Tags = append(expense.Tags, models.TagPayment)
+			}
+			if expense.OriginalCurrency == "" {
+				expense.OriginalCurrency = group.DefaultCurrency
+			}
+			if err := tx.Create(&expense).Error; err != nil {
+				return err
+			}
+			created = append(created, expense)
+
+			split := models.SplitExpense{
+				GroupID:      group.ID,
+				ExpenseID:    expense.ID,
+				CreatedBy:    payerID,
+				TotalAmount:  row.Cost,
+				SplitType:    "CUSTOM",
+				GraceEndDate: row.Date,
+				DueDate:      row.Date,
+			}
+			if err := tx.Create(&split).Error; err != nil {
+				return err
+			}
+			for _, s := range plan.shares {
+				share := models.SplitShare{
+					SplitExpenseID: split.ID,
+					UserID:         result.Participants[s.Participant].UserID,
+					Amount:         s.Amount,
+				}
+				if err := tx.Create(&share).Error; err != nil {
+					return err
+				}
+				if share.UserID == payerID {
+					continue
+				}
+				k := pair{payerID, share.UserID, expense.OriginalCurrency}
+				owed[k] += share.Amount
+				pairShares[k] = append(pairShares[k], share.ID)
+				if row.Date.After(lastDate[k]) {
+					lastDate[k] = row.Date
+				}
+			}
+		}
+
+		for k, amount := range owed {
+			back := pair{k.debtor, k.creditor, k.currency}
+			if k.creditor > k.debtor || math.Abs(amount-owed[back]) > 0.01 {
+				continue // handle each pair once, and only when it's square
+			}
+			paidAt := lastDate[k]
+			if lastDate[back].After(paidAt) {
+				paidAt = lastDate[back]
+			}
+			ids := append(append([]string{}, pairShares[k]...), pairShares[back]...)
+			if err := tx.Model(&models.SplitShare{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{"is_paid": true, "paid_at": paidAt}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func usedBy(rows []ImportRow, participant int) bool {
+	for _, row := range rows {
+		if row.Status != ImportCreate {
+			continue
+		}
+		if row.payer == participant {
+			return true
+		}
+		for _, share := range row.shares {
+			if share.Participant == participant {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// placeholderMember returns the group's placeholder member called name,
+// adding one if there is none
+func placeholderMember(tx *gorm.DB, groupID, name string) (*models.User, error) {
+	var user models.User
+	err := tx.Joins("JOIN group_members ON group_members.user_id = users.id AND group_members.deleted_at IS NULL").
+		Where("group_members.group_id = ? AND users.is_placeholder = ? AND LOWER(users.display_name) = LOWER(?)", groupID, true, name).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Email and phone are unique, so placeholders get values no one can
+	// receive mail or codes at
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+	user = models.User{
+		DisplayName:   name,
+		Email:         "placeholder-" + id + "@placeholder.invalid",
+		PhoneNumber:   "placeholder-" + id,
+		IsPlaceholder: true,
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	member := models.GroupMember{
+		GroupID:  groupID,
+		UserID:   user.ID,
+		JoinedAt: time.Now(),
+		IsActive: true,
+	}
+	if err := tx.Create(&member).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,161 @@
+package expense
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+)
+
+const priya = "00000000-0000-4000-8000-0000000000a4"
+
+// splitwiseExport has an equal split, the same taxi ride twice, a payment
+// and a row nobody owes anything for. Ravi's debt for the groceries and
+// Asha's for the taxis cancel out; Priya's payment covers only part of hers.
+const splitwiseExport = `Date,Description,Category,Cost,Currency,Asha,Ravi,Priya
+2025-01-05,Groceries,Groceries,90.00,USD,60.00,-30.00,-30.00
+2025-01-06,Taxi,Taxi,30.00,USD,-15.00,15.00,0.00
+2025-01-06,Taxi,Taxi,30.00,USD,-15.00,15.00,0.00
+2025-01-07,Payment,Payment,20.00,USD,-20.00,0.00,20.00
+2025-01-08,Solo,General,12.00,USD,0.00,0.00,0.00
+2025-01-09,Total balance, , ,USD,40.00,-0.00,-10.00
+`
+
+// newImportApp serves the Splitwise import for a group whose members, Asha
+// (the admin), Ravi and Priya, match the export's participants by name
+func newImportApp(t *testing.T) (*fiber.App, *dbtest.DB) {
+	t.Helper()
+	db, fake := dbtest.Open()
+	if err := taxonomy.SeedDefaults(db); err != nil {
+		t.Fatalf("SeedDefaults: %v", err)
+	}
+	fake.Unique("expenses", "import_key")
+	fake.Add("groups", dbtest.Row{"id": groupID, "name": "Flat", "created_by": admin, "default_currency": "USD"})
+	fake.Add("users",
+		dbtest.Row{"id": admin, "display_name": "Asha", "is_placeholder": false},
+		dbtest.Row{"id": debtor, "display_name": "Ravi", "is_placeholder": false},
+		dbtest.Row{"id": priya, "display_name": "Priya", "is_placeholder": false},
+	)
+	fake.Add("group_members",
+		dbtest.Row{"group_id": groupID, "user_id": admin, "role": "admin", "is_active": true},
+		dbtest.Row{"group_id": groupID, "user_id": debtor, "role": "member", "is_active": true},
+		dbtest.Row{"group_id": groupID, "user_id": priya, "role": "member", "is_active": true},
+	)
+
+	h := NewHandler(db, budget.NewTracker(db, nil), nil, nil)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", c.Get("X-User"))
+		return c.Next()
+	})
+	app.Post("/expenses/import/splitwise", h.ImportSplitwise)
+	return app, fake
+}
+
+func importSplitwise(t *testing.T, app *fiber.App, dryRun bool) (int, ImportResult) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("groupId", groupID)
+	form.WriteField("dryRun", fmt.Sprint(dryRun))
+	file, _ := form.CreateFormFile("file", "flat.csv")
+	io.WriteString(file, splitwiseExport)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/expenses/import/splitwise", &body)
+	req.Header.Set("X-User", admin)
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	defer resp.Body.Close()
+	var result ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("import response: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestImportSplitwise(t *testing.T) {
+	app, fake := newImportApp(t)
+
+	status, plan := importSplitwise(t, app, true)
+	if status != fiber.StatusOK || plan.Created != 4 || plan.Skipped != 1 || plan.Duplicates != 0 {
+		t.Fatalf("dry run = %d, %+v; want 4 to create and 1 to skip", status, plan)
+	}
+	if n := len(fake.Rows("expenses")); n != 0 {
+		t.Fatalf("dry run saved %d expenses", n)
+	}
+	groceries := plan.Rows[0]
+	if groceries.PaidBy != "Asha" || !reflect.DeepEqual(groceries.Shares, []ImportShare{{"Asha", 30}, {"Ravi", 30}, {"Priya", 30}}) {
+		t.Errorf("groceries paid by %s with shares %v, want Asha with 30 each", groceries.PaidBy, groceries.Shares)
+	}
+
+	status, result := importSplitwise(t, app, false)
+	if status != fiber.StatusCreated || result.Created != 4 || result.Skipped != 1 {
+		t.Fatalf("import = %d, %+v; want 4 created and 1 skipped", status, result)
+	}
+
+	expenses := map[string]dbtest.Row{}
+	var payers, keys []string
+	for _, e := range fake.Rows("expenses") {
+		expenses[e["id"].(string)] = e
+		payers = append(payers, fmt.Sprintf("%s:%v", e["description"], e["user_id"]))
+		keys = append(keys, e["import_key"].(string))
+	}
+	wantPayers := []string{"Groceries:" + admin, "Taxi:" + debtor, "Taxi:" + debtor, "Payment:" + priya}
+	if !reflect.DeepEqual(payers, wantPayers) {
+		t.Errorf("expenses = %v, want %v", payers, wantPayers)
+	}
+	if keys[1] == keys[2] {
+		t.Error("the two identical taxi rows have the same import key")
+	}
+
+	splits := map[string]string{}
+	for _, s := range fake.Rows("split_expenses") {
+		splits[s["id"].(string)] = expenses[s["expense_id"].(string)]["description"].(string)
+	}
+	var shares []string
+	for _, s := range fake.Rows("split_shares") {
+		paid := "owed"
+		if s["is_paid"] == true {
+			paid = "paid " + s["paid_at"].(time.Time).Format("Jan 2")
+		}
+		shares = append(shares, fmt.Sprintf("%s %v %.2f %s", splits[s["split_expense_id"].(string)], s["user_id"], s["amount"], paid))
+	}
+	sort.Strings(shares)
+	wantShares := []string{
+		"Groceries " + admin + " 30.00 owed",
+		"Groceries " + debtor + " 30.00 paid Jan 6", // squared by the taxis
+		"Groceries " + priya + " 30.00 owed",        // only partly paid back
+		"Payment " + admin + " 20.00 owed",
+		"Taxi " + admin + " 15.00 paid Jan 6",
+		"Taxi " + admin + " 15.00 paid Jan 6",
+		"Taxi " + debtor + " 15.00 owed",
+		"Taxi " + debtor + " 15.00 owed",
+	}
+	if !reflect.DeepEqual(shares, wantShares) {
+		t.Errorf("shares =\n%q\nwant\n%q", shares, wantShares)
+	}
+
+	// Importing the same file again finds every row
+	status, again := importSplitwise(t, app, false)
+	if status != fiber.StatusOK || again.Created != 0 || again.Duplicates != 4 || again.Skipped != 1 {
+		t.Errorf("re-import = %d, %+v; want 4 duplicates and 1 skipped", status, again)
+	}
+	if n := len(fake.Rows("expenses")); n != 4 {
+		t.Errorf("re-import left %d expenses, want 4", n)
+	}
+}
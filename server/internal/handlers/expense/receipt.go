@@ -0,0 +1,155 @@
+package expense
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/parse"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/receipt"
+)
+
+// ReceiptDraft is an itemized expense pre-filled from a scanned receipt
+type ReceiptDraft struct {
+	Expense CreateExpenseRequest `json:"expense"`
+	Items   []models.ReceiptItem `json:"items"`
+	Check   receipt.Check        `json:"check"`
+}
+
+// DraftFromReceipt turns the app's OCR output into an expense draft. Nothing
+// is saved. Receipts whose items don't add up to the total are rejected
+// with the check so the app can ask the user to correct them.
+func (h *Handler) DraftFromReceipt(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var r models.Receipt
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	receipt.Normalize(&r)
+	check, err := receipt.Validate(&r, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	draft := ReceiptDraft{
+		Expense: CreateExpenseRequest{
+			Amount:           r.Total,
+			OriginalCurrency: r.Currency,
+			Description:      r.Merchant,
+			Category:         h.receiptCategory(userID, &r),
+		},
+		Items: r.Items,
+		Check: check,
+	}
+	if draft.Expense.OriginalCurrency == "" {
+		var user models.User
+		if err := h.db.Select("preferred_currency").First(&user, "id = ?", userID).Error; err == nil {
+			draft.Expense.OriginalCurrency = user.PreferredCurrency
+		}
+	}
+	if draft.Expense.Description == "" && len(r.Items) > 0 {
+		draft.Expense.Description = r.Items[0].Description
+	}
+	if date, err := receipt.ParsedDate(&r); err == nil && date != nil {
+		draft.Expense.Date = date
+	}
+
+	if !check.Balanced {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Receipt failed validation",
+			"draft": draft,
+		})
+	}
+	return c.JSON(draft)
+}
+
+// SetAttachmentReceipt stores the OCR result of an attached receipt. The
+// expense is marked verified while one of its receipts matches its amount.
+func (h *Handler) SetAttachmentReceipt(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	expense, err := h.policy.Expense(userID, c.Params("id"), policy.ActionEdit)
+	if err != nil {
+		return denied(c, err, "Expense")
+	}
+
+	var att models.Attachment
+	if err := h.db.Where("id = ? AND expense_id = ?", c.Params("attachmentId"), expense.ID).First(&att).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	var r models.Receipt
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	receipt.Normalize(&r)
+	check, err := receipt.Validate(&r, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !check.Balanced {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Receipt failed validation",
+			"check": check,
+		})
+	}
+
+	// Updates with a struct so the value goes through the JSON serializer
+	att.Receipt = &r
+	if err := h.db.Model(&att).Select("receipt").Updates(&models.Attachment{Receipt: &r}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save receipt"})
+	}
+	if err := h.refreshVerified(expense); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify expense"})
+	}
+
+	return c.JSON(fiber.Map{
+		"attachment": att,
+		"check":      check,
+		"matches":    receipt.Matches(&r, expense.Amount, expense.OriginalCurrency),
+		"isVerified": expense.IsVerified,
+	})
+}
+
+// refreshVerified sets IsVerified from the expense's receipts. It runs
+// whenever the amount or the receipts change, so a verified expense can't
+// keep the flag after being edited to a different amount.
+func (h *Handler) refreshVerified(expense *models.Expense) error {
+	var attachments []models.Attachment
+	if err := h.db.Select("id", "receipt").
+		Where("expense_id = ? AND receipt IS NOT NULL", expense.ID).
+		Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	verified := false
+	for _, att := range attachments {
+		if att.Receipt != nil && receipt.Matches(att.Receipt, expense.Amount, expense.OriginalCurrency) {
+			verified = true
+			break
+		}
+	}
+	if verified == expense.IsVerified {
+		return nil
+	}
+	if err := h.db.Model(&models.Expense{}).Where("id = ?", expense.ID).Update("is_verified", verified).Error; err != nil {
+		return err
+	}
+	expense.IsVerified = verified
+	return nil
+}
+
+// receiptCategory tries the user's rules on the merchant, then the built-in
+// keywords on the merchant and items
+func (h *Handler) receiptCategory(userID string, r *models.Receipt) string {
+	if result, err := h.rules.Apply(userID, r.Merchant); err == nil && result != nil {
+		return result.Category
+	}
+	text := []string{r.Merchant}
+	for _, item := range r.Items {
+		text = append(text, item.Description)
+	}
+	return parse.Category(strings.Join(text, " "))
+}
@@ -0,0 +1,51 @@
+package expense
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+)
+
+const receiptID = "00000000-0000-4000-8000-0000000000c2"
+
+// TestAmountEditClearsVerified checks an expense is verified while a receipt
+// backs up its amount, and only then
+func TestAmountEditClearsVerified(t *testing.T) {
+	app, fake := newTestApp(t)
+	fake.Add("attachments", dbtest.Row{"id": receiptID, "expense_id": expenseID, "uploaded_by": admin, "receipt": nil})
+	verified := func() interface{} {
+		for _, e := range fake.Rows("expenses") {
+			if e["id"] == expenseID {
+				return e["is_verified"]
+			}
+		}
+		return nil
+	}
+
+	status, resp := call(t, app, admin, "PUT", "/expenses/"+expenseID+"/attachments/"+receiptID+"/receipt",
+		`{"merchant": "Cafe", "currency": "usd", "items": [{"description": "Dinner", "amount": 90}], "total": 90}`)
+	if status != fiber.StatusOK || !strings.Contains(resp, `"isVerified":true`) || verified() != true {
+		t.Fatalf("adding a matching receipt = %d (%s), verified %v; want it verified", status, resp, verified())
+	}
+
+	steps := []struct {
+		amount string
+		want   bool
+	}{
+		{"100", false},
+		{"90.04", true}, // within the receipt tolerance
+		{"45", false},
+		{"90", true},
+	}
+	for _, s := range steps {
+		status, resp := call(t, app, admin, "PUT", "/expenses/"+expenseID, `{"amount": `+s.amount+`}`)
+		if status != fiber.StatusOK {
+			t.Fatalf("editing the amount to %s = %d (%s)", s.amount, status, resp)
+		}
+		if got := verified(); got != s.want {
+			t.Errorf("after editing the amount to %s, verified = %v, want %v", s.amount, got, s.want)
+		}
+	}
+}
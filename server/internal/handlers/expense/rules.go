@@ -0,0 +1,241 @@
+package expense
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/parse"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+)
+
+// needsCategory reports whether a client left the category for rules to fill
+func needsCategory(category string) bool {
+	category = strings.TrimSpace(category)
+	return category == "" || strings.EqualFold(category, parse.DefaultCategory)
+}
+
+// categorizeExpense fills in the category of a new expense the client left
+// uncategorized: from the user's rules, then the built-in keywords
+func (h *Handler) categorizeExpense(userID string, expense *models.Expense) {
+	if !needsCategory(expense.Category) {
+		return
+	}
+	result, err := h.rules.Apply(userID, expense.Description)
+	if err != nil {
+		log.Printf("categorize: could not load rules for user %s: %v", userID, err)
+	}
+	if !result.Apply(&expense.Category, &expense.Tags) {
+		expense.Category = parse.Category(expense.Description)
+	}
+}
+
+// learnCategory proposes a rule when a user who turned on learning moves an
+// expense to another category
+func (h *Handler) learnCategory(userID string, previous, expense *models.Expense) {
+	if strings.EqualFold(previous.Category, expense.Category) || needsCategory(expense.Category) {
+		return
+	}
+	var user models.User
+	if err := h.db.Select("id", "learn_categories").First(&user, "id = ?", userID).Error; err != nil || !user.LearnCategories {
+		return
+	}
+	if _, err := h.rules.Learn(userID, expense.Description, expense.Category); err != nil {
+		log.Printf("categorize: could not learn from user %s: %v", userID, err)
+	}
+}
+
+// CategoryRuleRequest creates or changes a rule
+type CategoryRuleRequest struct {
+	Pattern   string   `json:"pattern"`
+	MatchType string   `json:"matchType"` // keyword (default) or regex
+	Category  string   `json:"category"`
+	Tags      []string `json:"tags"`
+	Priority  int      `json:"priority"`
+}
+
+// ListCategoryRules returns the user's rules, including proposals, followed
+// by the global rules. status=proposed lists only proposals.
+func (h *Handler) ListCategoryRules(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	query := h.db.Where("user_id = ? OR user_id IS NULL", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var rules []models.CategoryRule
+	if err := query.Order("user_id IS NULL, priority DESC, created_at").Find(&rules).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve category rules"})
+	}
+	return c.JSON(rules)
+}
+
+// CreateCategoryRule adds an active rule for the user
+func (h *Handler) CreateCategoryRule(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var req CategoryRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	rule := models.CategoryRule{
+		UserID:    &userID,
+		Pattern:   req.Pattern,
+		MatchType: req.MatchType,
+		Category:  req.Category,
+		Tags:      req.Tags,
+		Priority:  req.Priority,
+		Status:    categorize.StatusActive,
+		Source:    categorize.SourceManual,
+	}
+	if err := categorize.Validate(&rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.ruleCategory(&rule); err != nil {
+		return categoryError(c, err)
+	}
+
+	count, err := h.rules.Count(userID, categorize.StatusActive)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create category rule"})
+	}
+	if count >= categorize.MaxRulesPerUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": categorize.ErrTooManyRules.Error()})
+	}
+
+	if err := h.db.Create(&rule).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create category rule"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdateCategoryRule changes one of the user's rules. Global rules can't be
+// changed.
+func (h *Handler) UpdateCategoryRule(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	rule, err := h.ownRule(userID, c.Params("id"))
+	if err != nil {
+		return ruleError(c, err)
+	}
+
+	var req CategoryRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	rule.Pattern, rule.MatchType, rule.Category = req.Pattern, req.MatchType, req.Category
+	rule.Tags, rule.Priority = req.Tags, req.Priority
+	if err := categorize.Validate(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.ruleCategory(rule); err != nil {
+		return categoryError(c, err)
+	}
+	if err := h.db.Save(rule).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update category rule"})
+	}
+	return c.JSON(rule)
+}
+
+// AcceptCategoryRule turns a proposed rule into an active one
+func (h *Handler) AcceptCategoryRule(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	rule, err := h.ownRule(userID, c.Params("id"))
+	if err != nil {
+		return ruleError(c, err)
+	}
+	if rule.Status != categorize.StatusActive {
+		count, err := h.rules.Count(userID, categorize.StatusActive)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update category rule"})
+		}
+		if count >= categorize.MaxRulesPerUser {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": categorize.ErrTooManyRules.Error()})
+		}
+	}
+	rule.Status = categorize.StatusActive
+	if err := h.db.Model(rule).Update("status", rule.Status).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update category rule"})
+	}
+	return c.JSON(rule)
+}
+
+// DeleteCategoryRule removes one of the user's rules, or rejects a proposal
+func (h *Handler) DeleteCategoryRule(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+	rule, err := h.ownRule(userID, c.Params("id"))
+	if err != nil {
+		return ruleError(c, err)
+	}
+	// Rejected proposals are deleted for good so the same correction can
+	// propose them again later
+	if err := h.db.Unscoped().Delete(rule).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category rule"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// TestCategoryRules shows which rule, if any, would categorize a description
+func (h *Handler) TestCategoryRules(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	result, err := h.rules.Apply(userID, req.Text)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load category rules"})
+	}
+	if result == nil {
+		result = &categorize.Result{Category: parse.Category(req.Text)}
+	}
+	return c.JSON(result)
+}
+
+// SetCategoryLearning turns "learn from my corrections" on or off
+func (h *Handler) SetCategoryLearning(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	if err := h.db.Model(&models.User{}).Where("id = ?", userID).Update("learn_categories", req.Enabled).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update setting"})
+	}
+	return c.JSON(fiber.Map{"learnCategories": req.Enabled})
+}
+
+// ruleCategory checks a rule names one of the user's categories and spells
+// it the way the category does
+func (h *Handler) ruleCategory(rule *models.CategoryRule) error {
+	category, err := h.categories.Find(taxonomy.ScopeOf(*rule.UserID, nil), "", rule.Category)
+	if err != nil {
+		return err
+	}
+	rule.Category = category.Name
+	return nil
+}
+
+func (h *Handler) ownRule(userID, ruleID string) (*models.CategoryRule, error) {
+	var rule models.CategoryRule
+	if err := h.db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func ruleError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category rule not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load category rule"})
+}
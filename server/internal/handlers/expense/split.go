@@ -2,10 +2,13 @@ package expense
 
 import (
 	"errors"
+	"math"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/balance"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
 	"gorm.io/gorm"
 )
 
@@ -42,6 +45,30 @@ func (h *Handler) CreateSplitExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, err := h.policy.Group(userID, req.GroupID, policy.ActionContribute); err != nil {
+		return denied(c, err, "Group")
+	}
+	if req.ExpenseID != "" {
+		if _, err := h.policy.Expense(userID, req.ExpenseID, policy.ActionView); err != nil {
+			return denied(c, err, "Expense")
+		}
+	}
+	shareUsers := make([]string, 0, len(req.Shares))
+	for _, share := range req.Shares {
+		shareUsers = append(shareUsers, share.UserID)
+	}
+	members, err := h.policy.AllMembers(req.GroupID, shareUsers)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check group members",
+		})
+	}
+	if !members {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Shares can only be assigned to group members",
+		})
+	}
+
 	// Set default values if not provided
 	if req.SplitType == "" {
 		req.SplitType = "EQUAL"
@@ -137,16 +164,9 @@ func (h *Handler) UpdateSplitExpense(c *fiber.Ctx) error {
 		})
 	}
 
-	var splitExpense models.SplitExpense
-	if err := h.db.First(&splitExpense, "id = ? AND created_by = ?", splitExpenseID, userID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error": "Split expense not found or unauthorized",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve split expense",
-		})
+	splitExpense, err := h.policy.SplitExpense(userID, splitExpenseID, policy.ActionEdit)
+	if err != nil {
+		return denied(c, err, "Split expense")
 	}
 
 	splitExpense.TotalAmount = req.TotalAmount
@@ -156,7 +176,7 @@ func (h *Handler) UpdateSplitExpense(c *fiber.Ctx) error {
 	splitExpense.DueDate = req.DueDate
 	splitExpense.NeedsApproval = req.NeedsApproval
 
-	if err := h.db.Save(&splitExpense).Error; err != nil {
+	if err := h.db.Save(splitExpense).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update split expense",
 		})
@@ -181,16 +201,14 @@ func (h *Handler) DeleteSplitExpense(c *fiber.Ctx) error {
 		})
 	}
 
-	result := h.db.Delete(&models.SplitExpense{}, "id = ? AND created_by = ?", splitExpenseID, userID)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete split expense",
-		})
+	splitExpense, err := h.policy.SplitExpense(userID, splitExpenseID, policy.ActionDelete)
+	if err != nil {
+		return denied(c, err, "Split expense")
 	}
 
-	if result.RowsAffected == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Split expense not found or unauthorized",
+	if err := h.db.Delete(splitExpense).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete split expense",
 		})
 	}
 
@@ -213,6 +231,10 @@ func (h *Handler) GetSplitExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, err := h.policy.SplitExpense(userID, splitExpenseID, policy.ActionView); err != nil {
+		return denied(c, err, "Split expense")
+	}
+
 	var splitExpense models.SplitExpense
 	if err := h.db.Preload("Shares").Preload("Expense").
 		First(&splitExpense, "id = ?", splitExpenseID).Error; err != nil {
@@ -226,23 +248,6 @@ func (h *Handler) GetSplitExpense(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is either the creator or part of the shares
-	isAuthorized := splitExpense.CreatedBy == userID
-	if !isAuthorized {
-		for _, share := range splitExpense.Shares {
-			if share.UserID == userID {
-				isAuthorized = true
-				break
-			}
-		}
-	}
-
-	if !isAuthorized {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Not authorized to view this split expense",
-		})
-	}
-
 	return c.JSON(splitExpense)
 }
 
@@ -285,11 +290,19 @@ func (h *Handler) CreateSplitShare(c *fiber.Ctx) error {
 		})
 	}
 
-	// Verify split expense exists and user is authorized
-	var splitExpense models.SplitExpense
-	if err := h.db.First(&splitExpense, "id = ? AND created_by = ?", req.SplitExpenseID, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Split expense not found or unauthorized",
+	split, err := h.policy.SplitExpense(userID, req.SplitExpenseID, policy.ActionManage)
+	if err != nil {
+		return denied(c, err, "Split expense")
+	}
+	members, err := h.policy.AllMembers(split.GroupID, []string{req.UserID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check group members",
+		})
+	}
+	if !members {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Shares can only be assigned to group members",
 		})
 	}
 
@@ -333,19 +346,47 @@ func (h *Handler) UpdateSplitShare(c *fiber.Ctx) error {
 		})
 	}
 
-	var splitShare models.SplitShare
-	if err := h.db.Preload("SplitExpense").First(&splitShare, "id = ?", splitShareID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Split share not found",
-		})
+	splitShare, err := h.policy.SplitShare(userID, splitShareID, policy.ActionEdit)
+	if err != nil {
+		return denied(c, err, "Split share")
+	}
+	// Only the people owed the share may change what it's worth or mark it
+	// paid; the person who owes it may only change reminders
+	if req.Amount != splitShare.Amount || req.IsPaid != splitShare.IsPaid ||
+		req.InterestRate != splitShare.InterestRate || req.InterestAccrued != splitShare.InterestAccrued {
+		if _, err := h.policy.SplitShare(userID, splitShareID, policy.ActionSettle); err != nil {
+			return denied(c, err, "Split share")
+		}
 	}
 
-	// Check if user is either the expense creator or the share owner
-	if splitShare.SplitExpense.CreatedBy != userID && splitShare.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Not authorized to update this split share",
+	// Whichever of the old and new amount is larger decides, so lowering the
+	// amount in the same request doesn't skip the check
+	var currencies []string
+	if err := h.db.Model(&models.Expense{}).Where("id = ?", splitShare.SplitExpense.ExpenseID).
+		Pluck("original_currency", &currencies).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load split expense",
 		})
 	}
+	currency := balance.BaseCurrency
+	if len(currencies) > 0 {
+		currency = currencies[0]
+	}
+	if req.IsPaid && !splitShare.IsPaid && balance.IsLarge(math.Max(splitShare.Amount, req.Amount), currency) {
+		sessionID, _ := c.Locals("sessionId").(string)
+		required, err := h.tokens.StepUpRequired(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to verify two-factor status",
+			})
+		}
+		if required {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":          "Two-factor verification required for large payments",
+				"stepUpRequired": true,
+			})
+		}
+	}
 
 	splitShare.Amount = req.Amount
 	splitShare.IsPaid = req.IsPaid
@@ -353,7 +394,7 @@ func (h *Handler) UpdateSplitShare(c *fiber.Ctx) error {
 	splitShare.InterestAccrued = req.InterestAccrued
 	splitShare.ReminderFrequency = req.ReminderFrequency
 
-	if err := h.db.Save(&splitShare).Error; err != nil {
+	if err := h.db.Save(splitShare).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update split share",
 		})
@@ -378,21 +419,12 @@ func (h *Handler) DeleteSplitShare(c *fiber.Ctx) error {
 		})
 	}
 
-	var splitShare models.SplitShare
-	if err := h.db.Preload("SplitExpense").First(&splitShare, "id = ?", splitShareID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Split share not found",
-		})
-	}
-
-	// Only expense creator can delete shares
-	if splitShare.SplitExpense.CreatedBy != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Not authorized to delete this split share",
-		})
+	splitShare, err := h.policy.SplitShare(userID, splitShareID, policy.ActionDelete)
+	if err != nil {
+		return denied(c, err, "Split share")
 	}
 
-	if err := h.db.Delete(&splitShare).Error; err != nil {
+	if err := h.db.Delete(splitShare).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete split share",
 		})
@@ -417,18 +449,9 @@ func (h *Handler) GetSplitShare(c *fiber.Ctx) error {
 		})
 	}
 
-	var splitShare models.SplitShare
-	if err := h.db.Preload("SplitExpense").First(&splitShare, "id = ?", splitShareID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Split share not found",
-		})
-	}
-
-	// Check if user is either the expense creator or the share owner
-	if splitShare.SplitExpense.CreatedBy != userID && splitShare.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Not authorized to view this split share",
-		})
+	splitShare, err := h.policy.SplitShare(userID, splitShareID, policy.ActionView)
+	if err != nil {
+		return denied(c, err, "Split share")
 	}
 
 	return c.JSON(splitShare)
@@ -455,3 +478,23 @@ func (h *Handler) ListSplitShares(c *fiber.Ctx) error {
 
 	return c.JSON(splitShares)
 }
+
+// GetBalances nets the user's unpaid split shares per person: who owes them
+// and whom they owe
+func (h *Handler) GetBalances(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userId").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized - valid user ID required",
+		})
+	}
+
+	summary, err := h.balances.Summary(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to calculate balances",
+		})
+	}
+
+	return c.JSON(summary)
+}
@@ -0,0 +1,396 @@
+package expense
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/parse"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/statement"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+)
+
+// StatementRow is what a statement import does with one transaction
+type StatementRow struct {
+	statement.Transaction
+	Category    string          `json:"category"`
+	Tags        []string        `json:"tags,omitempty"`
+	Status      string          `json:"status"` // create, duplicate or skip
+	Reason      string          `json:"reason,omitempty"`
+	DuplicateOf string          `json:"duplicateOf,omitempty"`
+	Expense     *models.Expense `json:"expense,omitempty"`
+
+	key        string
+	categoryID string
+}
+
+// StatementImport summarizes a bank statement import. On a dry run nothing is
+// saved and Created counts what would be.
+type StatementImport struct {
+	DryRun     bool           `json:"dryRun"`
+	Format     string         `json:"format"`
+	Currency   string         `json:"currency"`
+	Created    int            `json:"created"`
+	Duplicates int            `json:"duplicates"`
+	Skipped    int            `json:"skipped"`
+	Rows       []StatementRow `json:"rows"`
+}
+
+// ImportStatement turns a bank statement into personal expenses. Only money
+// leaving the account is imported. Transactions already imported, or
+// matching an existing expense on date, amount and description, are marked
+// duplicates. It is a dry run unless dryRun=false.
+//
+// Form fields: file, format (ofx, qif or csv; guessed when empty), currency
+// (when the file doesn't say) and csv (a JSON statement.CSVConfig).
+func (h *Handler) ImportStatement(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A statement file is required"})
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not read file"})
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not read file"})
+	}
+
+	var cfg statement.CSVConfig
+	if raw := c.FormValue("csv"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "csv must be a JSON column mapping"})
+		}
+	}
+	format := strings.ToLower(c.FormValue("format"))
+	if format == "" {
+		format = statement.Detect(fileHeader.Filename, data)
+	}
+	parsed, err := statement.Parse(format, bytes.NewReader(data), cfg)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result := &StatementImport{
+		DryRun:   c.FormValue("dryRun") != "false",
+		Format:   format,
+		Currency: parsed.Currency,
+	}
+	if result.Currency == "" {
+		result.Currency = strings.ToUpper(c.FormValue("currency"))
+	}
+	if result.Currency == "" {
+		var user models.User
+		if err := h.db.Select("preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load user"})
+		}
+		result.Currency = user.PreferredCurrency
+	}
+
+	rules, err := h.rules.Matcher(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load category rules"})
+	}
+	if err := h.planStatement(userID, parsed, rules, result); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check for duplicates"})
+	}
+	if result.DryRun || result.Created == 0 {
+		return c.JSON(result)
+	}
+
+	var created []models.Expense
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for i := range result.Rows {
+			row := &result.Rows[i]
+			if row.Status != ImportCreate {
+				continue
+			}
+			key := row.key
+			expense := models.Expense{
+				UserID:           userID,
+				Amount:           -row.Amount,
+				OriginalCurrency: result.Currency,
+				Category:         row.Category,
+				CategoryID:       &row.categoryID,
+				Description:      row.Description,
+				Date:             row.Date,
+				Tags:             append([]string{"bank-import"}, row.Tags...),
+				ImportKey:        &key,
+			}
+			if err := tx.Create(&expense).Error; err != nil {
+				return err
+			}
+			row.Expense = &expense
+			created = append(created, expense)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to import expenses"})
+	}
+	for _, expense := range created {
+		h.budgets.ExpenseChanged(expense)
+	}
+	return c.Status(fiber.StatusCreated).JSON(result)
+}
+
+// planStatement categorizes the transactions and finds the ones already
+// recorded
+func (h *Handler) planStatement(userID string, s *statement.Statement, rules *categorize.Matcher, result *StatementImport) error {
+	from, to := s.Transactions[0].Date, s.Transactions[0].Date
+	occurrences := map[string]int{}
+	keys := make([]string, 0, len(s.Transactions))
+	categories := h.categories.Lookup(taxonomy.ScopeOf(userID, nil))
+	result.Rows = make([]StatementRow, len(s.Transactions))
+	for i, t := range s.Transactions {
+		if t.Date.Before(from) {
+			from = t.Date
+		}
+		if t.Date.After(to) {
+			to = t.Date
+		}
+		content := statementKey(userID, t, 0)
+		row := StatementRow{Transaction: t, Status: ImportCreate, key: statementKey(userID, t, occurrences[content])}
+		occurrences[content]++
+
+		text := t.Description + " " + t.Memo
+		if !rules.Match(text).Apply(&row.Category, &row.Tags) {
+			row.Category = parse.Category(text)
+			if row.Category == parse.DefaultCategory && t.Category != "" {
+				row.Category = t.Category
+			}
+		}
+		category, err := categories.FindOrOther(row.Category)
+		if err != nil {
+			return err
+		}
+		row.Category, row.categoryID = category.Name, category.ID
+		if t.Amount >= 0 {
+			row.Status, row.Reason = ImportSkip, "money in"
+		}
+		keys = append(keys, row.key)
+		result.Rows[i] = row
+	}
+
+	var existing []models.Expense
+	if err := h.db.Unscoped().
+		Select("id", "date", "amount", "description", "import_key", "deleted_at").
+		Where("user_id = ?", userID).
+		Where("import_key IN ? OR (date >= ? AND date < ? AND deleted_at IS NULL)", keys, from, to.AddDate(0, 0, 1)).
+		Find(&existing).Error; err != nil {
+		return err
+	}
+	byKey := map[string]string{}
+	for _, e := range existing {
+		if e.ImportKey != nil {
+			byKey[*e.ImportKey] = e.ID
+		}
+	}
+
+	matched := map[string]bool{}
+	for i := range result.Rows {
+		row := &result.Rows[i]
+		if row.Status == ImportSkip {
+			result.Skipped++
+			continue
+		}
+		if id, ok := byKey[row.key]; ok {
+			row.Status, row.Reason, row.DuplicateOf = ImportDuplicate, "imported before", id
+			result.Duplicates++
+			continue
+		}
+		if match := matchExpense(existing, row.Transaction, matched); match != nil {
+			matched[match.ID] = true
+			row.Status, row.Reason, row.DuplicateOf = ImportDuplicate, "matches an existing expense", match.ID
+			result.Duplicates++
+			continue
+		}
+		result.Created++
+	}
+	return nil
+}
+
+// matchExpense finds an expense on the same day for the same amount whose
+// description matches the transaction's, ignoring case and punctuation.
+// Expenses in matched are skipped so two identical transactions don't both
+// match one expense.
+func matchExpense(expenses []models.Expense, t statement.Transaction, matched map[string]bool) *models.Expense {
+	description := normalizeDescription(t.Description)
+	for i := range expenses {
+		e := &expenses[i]
+		if matched[e.ID] || e.DeletedAt.Valid || !sameDay(e.Date, t.Date) || math.Abs(e.Amount+t.Amount) > 0.005 {
+			continue
+		}
+		other := normalizeDescription(e.Description)
+		if other == description || (other != "" && description != "" &&
+			(strings.Contains(other, description) || strings.Contains(description, other))) {
+			return e
+		}
+	}
+	return nil
+}
+
+func normalizeDescription(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	}), " ")
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+// statementKey identifies a transaction for idempotent imports. The bank's
+// ID is only unique within an account, so it is combined with the date and
+// amount.
+func statementKey(userID string, t statement.Transaction, occurrence int) string {
+	h := sha256.New()
+	if t.ID != "" {
+		fmt.Fprintf(h, "%s\x00id\x00%s\x00%s\x00%.2f", userID, t.ID, t.Date.Format("2006-01-02"), t.Amount)
+	} else {
+		fmt.Fprintf(h, "%s\x00%s\x00%.2f\x00%s\x00%d", userID, t.Date.Format("2006-01-02"), t.Amount,
+			normalizeDescription(t.Description), occurrence)
+	}
+	return "statement:" + hex.EncodeToString(h.Sum(nil))
+}
+
+var errAlreadyShared = errors.New("expense is already in a group")
+
+// ShareImportedRequest picks personal expenses to split with a group.
+// MemberIDs defaults to all active members, including the user.
+type ShareImportedRequest struct {
+	GroupID    string   `json:"groupId"`
+	ExpenseIDs []string `json:"expenseIds"`
+	MemberIDs  []string `json:"memberIds"`
+}
+
+// ShareImported moves the user's personal expenses, typically just imported
+// from a statement, into a group and splits each equally between the chosen
+// members. The user paid, so the others owe them their shares.
+func (h *Handler) ShareImported(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var req ShareImportedRequest
+	if err := c.BodyParser(&req); err != nil || len(req.ExpenseIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	if _, err := h.policy.Group(userID, req.GroupID, policy.ActionContribute); err != nil {
+		return denied(c, err, "Group")
+	}
+
+	var members []models.GroupMember
+	if err := h.db.Where("group_id = ? AND is_active = ?", req.GroupID, true).Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load group members"})
+	}
+	active := map[string]bool{}
+	var all []string
+	for _, m := range members {
+		if !active[m.UserID] {
+			active[m.UserID] = true
+			all = append(all, m.UserID)
+		}
+	}
+	participants := all
+	if len(req.MemberIDs) > 0 {
+		participants = nil
+		seen := map[string]bool{}
+		for _, id := range req.MemberIDs {
+			if !active[id] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Every member must belong to the group"})
+			}
+			if !seen[id] {
+				seen[id] = true
+				participants = append(participants, id)
+			}
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, id := range req.ExpenseIDs {
+		ids[id] = true
+	}
+	var expenses []models.Expense
+	if err := h.db.Where("id IN ? AND user_id = ? AND group_id IS NULL", req.ExpenseIDs, userID).Find(&expenses).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load expenses"})
+	}
+	if len(expenses) != len(ids) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only your own expenses that aren't in a group can be shared"})
+	}
+
+	weights := make([]float64, len(participants))
+	for i := range weights {
+		weights[i] = 1
+	}
+	now := time.Now()
+	splits := make([]models.SplitExpense, 0, len(expenses))
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for i := range expenses {
+			expense := &expenses[i]
+			// Only claims expenses still outside a group, so two requests
+			// can't split the same one
+			claim := tx.Model(&models.Expense{}).
+				Where("id = ? AND group_id IS NULL", expense.ID).
+				Update("group_id", req.GroupID)
+			if claim.Error != nil {
+				return claim.Error
+			}
+			if claim.RowsAffected == 0 {
+				return errAlreadyShared
+			}
+			expense.GroupID = &req.GroupID
+
+			split := models.SplitExpense{
+				GroupID:      req.GroupID,
+				ExpenseID:    expense.ID,
+				CreatedBy:    userID,
+				TotalAmount:  expense.Amount,
+				SplitType:    "EQUAL",
+				GraceEndDate: now.AddDate(0, 0, 7),
+				DueDate:      now.AddDate(0, 0, 7),
+			}
+			if err := tx.Create(&split).Error; err != nil {
+				return err
+			}
+			cents := parse.Allocate(int64(math.Round(expense.Amount*100)), weights)
+			for j, memberID := range participants {
+				share := models.SplitShare{
+					SplitExpenseID: split.ID,
+					UserID:         memberID,
+					Amount:         float64(cents[j]) / 100,
+				}
+				if err := tx.Create(&share).Error; err != nil {
+					return err
+				}
+				split.Shares = append(split.Shares, share)
+			}
+			splits = append(splits, split)
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyShared) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "An expense was shared with a group meanwhile"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to split expenses"})
+	}
+	for _, expense := range expenses {
+		h.budgets.ExpenseChanged(expense)
+	}
+	return c.Status(fiber.StatusCreated).JSON(splits)
+}
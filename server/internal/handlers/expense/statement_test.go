@@ -0,0 +1,231 @@
+package expense
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/statement"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestMatchExpense(t *testing.T) {
+	deleted := gorm.DeletedAt{Time: date("2025-02-04"), Valid: true}
+	expenses := []models.Expense{
+		{Base: models.Base{ID: "coffee"}, Date: date("2025-02-03").Add(9 * time.Hour), Amount: 250, Description: "Blue Tokai coffee"},
+		{Base: models.Base{ID: "lunch"}, Date: date("2025-02-03"), Amount: 250, Description: "Lunch"},
+		{Base: models.Base{ID: "cab"}, Date: date("2025-02-03"), Amount: 180, Description: ""},
+		{Base: models.Base{ID: "uber", DeletedAt: deleted}, Date: date("2025-02-05"), Amount: 180, Description: "Uber"},
+	}
+	tests := []struct {
+		name        string
+		transaction statement.Transaction
+		matched     map[string]bool
+		want        string // empty for no match
+	}{
+		{"case and punctuation", statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "BLUE TOKAI-COFFEE"}, nil, "coffee"},
+		{"bank adds detail", statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "POS 4411 LUNCH BLR"}, nil, "lunch"},
+		{"within a cent", statement.Transaction{Date: date("2025-02-03"), Amount: -250.004, Description: "Lunch"}, nil, "lunch"},
+		{"another amount", statement.Transaction{Date: date("2025-02-03"), Amount: -251, Description: "Lunch"}, nil, ""},
+		{"another day", statement.Transaction{Date: date("2025-02-04"), Amount: -250, Description: "Lunch"}, nil, ""},
+		{"money in", statement.Transaction{Date: date("2025-02-03"), Amount: 250, Description: "Lunch"}, nil, ""},
+		{"another description", statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "Zomato"}, nil, ""},
+		{"both blank", statement.Transaction{Date: date("2025-02-03"), Amount: -180}, nil, "cab"},
+		{"blank only on one side", statement.Transaction{Date: date("2025-02-03"), Amount: -180, Description: "Ola"}, nil, ""},
+		{"already matched", statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "Blue Tokai Coffee"},
+			map[string]bool{"coffee": true}, ""},
+		{"deleted", statement.Transaction{Date: date("2025-02-05"), Amount: -180, Description: "Uber"}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchExpense(expenses, tt.transaction, tt.matched)
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("matchExpense = %s, want no match", got.ID)
+			case tt.want != "" && (got == nil || got.ID != tt.want):
+				t.Errorf("matchExpense = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementKey(t *testing.T) {
+	coffee := statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "BLUE TOKAI COFFEE"}
+	withID := statement.Transaction{ID: "202502030001", Date: date("2025-02-03"), Amount: -250, Description: "BLUE TOKAI"}
+	key := statementKey(admin, coffee, 0)
+
+	same := []struct {
+		name        string
+		transaction statement.Transaction
+	}{
+		{"description spacing and case", statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "Blue  Tokai, coffee"}},
+		{"time of day", statement.Transaction{Date: date("2025-02-03").Add(15 * time.Hour), Amount: -250, Description: "BLUE TOKAI COFFEE"}},
+		{"memo", statement.Transaction{Date: date("2025-02-03"), Amount: -250, Description: "BLUE TOKAI COFFEE", Memo: "UPI/1234"}},
+	}
+	for _, tt := range same {
+		if got := statementKey(admin, tt.transaction, 0); got != key {
+			t.Errorf("%s changed the key", tt.name)
+		}
+	}
+
+	different := []struct {
+		name string
+		key  string
+	}{
+		{"user", statementKey(debtor, coffee, 0)},
+		{"occurrence", statementKey(admin, coffee, 1)},
+		{"amount", statementKey(admin, statement.Transaction{Date: coffee.Date, Amount: -25, Description: coffee.Description}, 0)},
+		{"day", statementKey(admin, statement.Transaction{Date: date("2025-02-04"), Amount: -250, Description: coffee.Description}, 0)},
+		{"description", statementKey(admin, statement.Transaction{Date: coffee.Date, Amount: -250, Description: "Third Wave"}, 0)},
+		{"bank ID", statementKey(admin, statement.Transaction{ID: "202502030001", Date: coffee.Date, Amount: -250, Description: coffee.Description}, 0)},
+	}
+	for _, tt := range different {
+		if tt.key == key {
+			t.Errorf("another %s gave the same key", tt.name)
+		}
+	}
+
+	// With a bank ID the description and occurrence don't matter, but the
+	// date and amount still do
+	idKey := statementKey(admin, withID, 0)
+	if statementKey(admin, statement.Transaction{ID: withID.ID, Date: withID.Date, Amount: -250, Description: "Renamed"}, 3) != idKey {
+		t.Error("the bank ID key depends on the description or occurrence")
+	}
+	if statementKey(admin, statement.Transaction{ID: withID.ID, Date: date("2026-02-03"), Amount: -250}, 0) == idKey {
+		t.Error("a reused bank ID on another date gave the same key")
+	}
+}
+
+// bankStatement has the same coffee twice on one day, money in, and a cab
+// Asha already recorded by hand, then deleted
+const bankStatement = `Date,Description,Amount
+2025-02-03,BLUE TOKAI COFFEE,-250.00
+2025-02-03,BLUE TOKAI COFFEE,-250.00
+2025-02-04,SALARY ACME,50000.00
+2025-02-05,UBER *TRIP,-180.00
+`
+
+func newStatementApp(t *testing.T) (*fiber.App, *dbtest.DB) {
+	t.Helper()
+	db, fake := dbtest.Open()
+	if err := taxonomy.SeedDefaults(db); err != nil {
+		t.Fatalf("SeedDefaults: %v", err)
+	}
+	fake.Unique("expenses", "import_key")
+
+	h := NewHandler(db, budget.NewTracker(db, nil), nil, nil)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", c.Get("X-User"))
+		return c.Next()
+	})
+	app.Post("/expenses/import/statement", h.ImportStatement)
+	return app, fake
+}
+
+func importStatement(t *testing.T, app *fiber.App, dryRun bool) (int, StatementImport) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("currency", "inr")
+	form.WriteField("dryRun", fmt.Sprint(dryRun))
+	file, _ := form.CreateFormFile("file", "february.csv")
+	io.WriteString(file, bankStatement)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/expenses/import/statement", &body)
+	req.Header.Set("X-User", admin)
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	defer resp.Body.Close()
+	var result StatementImport
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("import response: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func statuses(result StatementImport) []string {
+	var got []string
+	for _, row := range result.Rows {
+		got = append(got, row.Status+" "+row.Reason)
+	}
+	return got
+}
+
+func TestImportStatement(t *testing.T) {
+	app, fake := newStatementApp(t)
+	fake.Add("expenses",
+		dbtest.Row{"id": expenseID, "user_id": admin, "date": date("2025-02-03"), "amount": 250.0,
+			"description": "Blue Tokai coffee", "deleted_at": nil},
+		dbtest.Row{"id": snacksID, "user_id": admin, "date": date("2025-02-05"), "amount": 180.0,
+			"description": "Uber", "deleted_at": date("2025-02-06")},
+	)
+
+	status, plan := importStatement(t, app, true)
+	want := []string{
+		"duplicate matches an existing expense",
+		"create ", // the second coffee that day
+		"skip money in",
+		"create ", // the matching expense was deleted
+	}
+	if status != fiber.StatusOK || !reflect.DeepEqual(statuses(plan), want) {
+		t.Fatalf("dry run = %d, %q; want %q", status, statuses(plan), want)
+	}
+	if plan.Rows[0].DuplicateOf != expenseID || plan.Created != 2 || plan.Duplicates != 1 || plan.Skipped != 1 {
+		t.Errorf("dry run = %+v, want the coffee a duplicate of %s", plan, expenseID)
+	}
+	if n := len(fake.Rows("expenses")); n != 2 {
+		t.Fatalf("dry run saved %d expenses", n)
+	}
+
+	status, result := importStatement(t, app, false)
+	if status != fiber.StatusCreated || result.Created != 2 {
+		t.Fatalf("import = %d, %+v; want 2 created", status, result)
+	}
+	var saved []string
+	for _, e := range fake.Rows("expenses")[2:] {
+		saved = append(saved, fmt.Sprintf("%s %.2f %s", e["description"], e["amount"], e["original_currency"]))
+	}
+	if want := []string{"BLUE TOKAI COFFEE 250.00 INR", "UBER *TRIP 180.00 INR"}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+
+	// Importing the file again finds the rows by key, and the first coffee
+	// still by the expense recorded by hand
+	status, again := importStatement(t, app, false)
+	want = []string{
+		"duplicate matches an existing expense",
+		"duplicate imported before",
+		"skip money in",
+		"duplicate imported before",
+	}
+	if status != fiber.StatusOK || !reflect.DeepEqual(statuses(again), want) {
+		t.Errorf("re-import = %d, %q; want %q", status, statuses(again), want)
+	}
+	if n := len(fake.Rows("expenses")); n != 4 {
+		t.Errorf("re-import left %d expenses, want 4", n)
+	}
+}
@@ -1,21 +1,47 @@
 package group
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	policy *policy.Policy
 }
 
 func NewHandler(db *gorm.DB) *Handler {
 	return &Handler{
-		db: db,
+		db:     db,
+		policy: policy.New(db),
+	}
+}
+
+// denied responds to a policy error: 404 for groups the user isn't in, 403
+// for actions their role doesn't allow
+func denied(c *fiber.Ctx, err error, forbidden string) error {
+	switch {
+	case errors.Is(err, policy.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Group not found",
+		})
+	case errors.Is(err, policy.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"error":   forbidden,
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not check permissions",
+		})
 	}
 }
 
@@ -89,7 +115,7 @@ func (h *Handler) CreateGroup(c *fiber.Ctx) error {
 		member := models.GroupMember{
 			GroupID:  group.ID,
 			UserID:   userID,
-			Role:     "admin",
+			Role:     policy.RoleAdmin,
 			JoinedAt: time.Now(),
 			IsActive: true,
 		}
@@ -129,15 +155,8 @@ func (h *Handler) UpdateGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	var member models.GroupMember
-	err := h.db.Where("group_id = ? AND user_id = ? AND role = ?", groupID, userID, "admin").
-		First(&member).Error
-
-	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"error":   "Only admin can update group",
-		})
+	if _, err := h.policy.Group(userID, groupID, policy.ActionEdit); err != nil {
+		return denied(c, err, "Only admin can update group")
 	}
 
 	updates := models.Group{
@@ -173,6 +192,10 @@ func (h *Handler) GetGroup(c *fiber.Ctx) error {
 	userID := c.Locals("userId").(string)
 	groupID := c.Params("groupId")
 
+	if _, err := h.policy.Group(userID, groupID, policy.ActionView); err != nil {
+		return denied(c, err, "Not authorized to view this group")
+	}
+
 	var group models.Group
 	err := h.db.Preload("Members").
 		Preload("Members.User").
@@ -189,21 +212,6 @@ func (h *Handler) GetGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	isMember := false
-	for _, member := range group.Members {
-		if member.UserID == userID {
-			isMember = true
-			break
-		}
-	}
-
-	if !isMember {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"error":   "Not authorized to view this group",
-		})
-	}
-
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    group,
@@ -214,18 +222,11 @@ func (h *Handler) DeleteGroup(c *fiber.Ctx) error {
 	userID := c.Locals("userId").(string)
 	groupID := c.Params("groupId")
 
-	var member models.GroupMember
-	err := h.db.Where("group_id = ? AND user_id = ? AND role = ?", groupID, userID, "admin").
-		First(&member).Error
-
-	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"error":   "Only admin can delete group",
-		})
+	if _, err := h.policy.Group(userID, groupID, policy.ActionDelete); err != nil {
+		return denied(c, err, "Only admin can delete group")
 	}
 
-	err = h.db.Transaction(func(tx *gorm.DB) error {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("group_id = ?", groupID).Delete(&models.GroupMember{}).Error; err != nil {
 			return err
 		}
@@ -242,7 +243,7 @@ func (h *Handler) DeleteGroup(c *fiber.Ctx) error {
 			return err
 		}
 
-		if err := tx.Delete(&models.Group{}, groupID).Error; err != nil {
+		if err := tx.Where("id = ?", groupID).Delete(&models.Group{}).Error; err != nil {
 			return err
 		}
 
@@ -267,7 +268,7 @@ func (h *Handler) ListUserGroups(c *fiber.Ctx) error {
 
 	var groups []models.Group
 	err := h.db.Joins("JOIN group_members ON groups.id = group_members.group_id").
-		Where("group_members.user_id = ?", userID).
+		Where("group_members.user_id = ? AND group_members.is_active = ?", userID, true).
 		Preload("Members").
 		Preload("Members.User").
 		Find(&groups).Error
@@ -1,19 +1,22 @@
 package group
 
 import (
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
 	"gorm.io/gorm"
 )
 
 type GroupMemberHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	policy *policy.Policy
 }
 
 func NewGroupMemberHandler(db *gorm.DB) *GroupMemberHandler {
-	return &GroupMemberHandler{db: db}
+	return &GroupMemberHandler{db: db, policy: policy.New(db)}
 }
 
 // Add a new member to a group
@@ -23,6 +26,7 @@ func (h *GroupMemberHandler) AddMember(c *fiber.Ctx) error {
 
 	var req struct {
 		UserID       string  `json:"userId"`
+		Handle       string  `json:"handle"`
 		Role         string  `json:"role"`
 		SharePercent float64 `json:"sharePercent"`
 	}
@@ -31,10 +35,18 @@ func (h *GroupMemberHandler) AddMember(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
 	}
 
-	var admin models.GroupMember
-	h.db.Where("group_id = ? AND user_id = ? AND role = ?", groupID, userID, "admin").First(&admin)
-	if admin.UserID == "" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only admin can add members"})
+	if _, err := h.policy.Group(userID, groupID, policy.ActionManage); err != nil {
+		return denied(c, err, "Only admin can add members")
+	}
+
+	// Members found through contact matching are added by handle; users who
+	// turned discovery off can't be found that way
+	if req.UserID == "" && req.Handle != "" {
+		var user models.User
+		if err := h.db.Select("id").Where("handle = ? AND discoverable = ?", strings.ToLower(req.Handle), true).First(&user).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "User not found"})
+		}
+		req.UserID = user.ID
 	}
 
 	member := models.GroupMember{
@@ -55,7 +67,13 @@ func (h *GroupMemberHandler) AddMember(c *fiber.Ctx) error {
 
 // Get all members of a group
 func (h *GroupMemberHandler) GetMembers(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
 	groupID := c.Params("groupId")
+
+	if _, err := h.policy.Group(userID, groupID, policy.ActionView); err != nil {
+		return denied(c, err, "Not authorized to view this group")
+	}
+
 	var members []models.GroupMember
 
 	if err := h.db.Where("group_id = ?", groupID).Preload("User").Find(&members).Error; err != nil {
@@ -80,15 +98,17 @@ func (h *GroupMemberHandler) UpdateMember(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": "Invalid request body"})
 	}
 
-	var admin models.GroupMember
-	h.db.Where("group_id = ? AND user_id = ? AND role = ?", groupID, userID, "admin").First(&admin)
-	if admin.UserID == "" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only admin can update members"})
+	if _, err := h.policy.Group(userID, groupID, policy.ActionManage); err != nil {
+		return denied(c, err, "Only admin can update members")
 	}
 
-	if err := h.db.Model(&models.GroupMember{}).Where("id = ?", memberID).Updates(req).Error; err != nil {
+	result := h.db.Model(&models.GroupMember{}).Where("id = ? AND group_id = ?", memberID, groupID).Updates(req)
+	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Could not update member"})
 	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
 
 	return c.JSON(fiber.Map{"success": true, "message": "Member updated successfully"})
 }
@@ -99,15 +119,17 @@ func (h *GroupMemberHandler) RemoveMember(c *fiber.Ctx) error {
 	groupID := c.Params("groupId")
 	memberID := c.Params("memberId")
 
-	var admin models.GroupMember
-	h.db.Where("group_id = ? AND user_id = ? AND role = ?", groupID, userID, "admin").First(&admin)
-	if admin.UserID == "" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "error": "Only admin can remove members"})
+	if _, err := h.policy.Group(userID, groupID, policy.ActionManage); err != nil {
+		return denied(c, err, "Only admin can remove members")
 	}
 
-	if err := h.db.Where("id = ?", memberID).Delete(&models.GroupMember{}).Error; err != nil {
+	result := h.db.Where("id = ? AND group_id = ?", memberID, groupID).Delete(&models.GroupMember{})
+	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "Could not remove member"})
 	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "Member not found"})
+	}
 
 	return c.JSON(fiber.Map{"success": true, "message": "Member removed successfully"})
 }
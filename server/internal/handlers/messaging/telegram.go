@@ -0,0 +1,177 @@
+package messaging
+
+import (
+	"crypto/subtle"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/chat"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/telegram"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"gorm.io/gorm"
+)
+
+const telegramWelcome = `Welcome to FinGenie!
+
+To use this bot, link it to your account: open the app, go to Profile > Telegram and tap "Link Telegram".`
+
+const telegramNotLinked = `This chat isn't linked to a FinGenie account yet. Open the app, go to Profile > Telegram and tap "Link Telegram".`
+
+// TelegramHandler links Telegram chats to accounts and answers bot commands
+// sent to the webhook
+type TelegramHandler struct {
+	db       *gorm.DB
+	tokens   *token.Manager
+	commands *chat.Commands
+	client   *telegram.Client
+	cfg      telegram.Config
+}
+
+func NewTelegramHandler(db *gorm.DB, tokens *token.Manager, budgets *budget.Tracker, cfg telegram.Config) *TelegramHandler {
+	return &TelegramHandler{
+		db:       db,
+		tokens:   tokens,
+		commands: chat.NewCommands(db, budgets),
+		client:   telegram.NewClient(cfg),
+		cfg:      cfg,
+	}
+}
+
+// CreateLinkCode issues a short-lived code that links the chat it is sent
+// from to the current user. The t.me URL opens the bot with the code filled
+// in.
+func (h *TelegramHandler) CreateLinkCode(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	code, err := h.tokens.IssueOneTime(userID, models.PurposeTelegramLink, token.LinkCodeTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not create link code",
+		})
+	}
+
+	data := fiber.Map{
+		"code":      code,
+		"command":   "/start " + code,
+		"expiresIn": int(token.LinkCodeTTL.Seconds()),
+	}
+	if h.cfg.Username != "" {
+		data["url"] = "https://t.me/" + h.cfg.Username + "?start=" + code
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// Unlink disconnects the user's Telegram chat
+func (h *TelegramHandler) Unlink(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	if err := h.db.Model(&models.User{}).Where("id = ?", userID).Update("telegram_id", "").Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not unlink Telegram",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Telegram unlinked",
+	})
+}
+
+// Webhook receives updates from Telegram. Only private chats are answered,
+// and each update only once. Replies are sent in the background so Telegram
+// gets its 200 straight away and doesn't redeliver the update.
+func (h *TelegramHandler) Webhook(c *fiber.Ctx) error {
+	secret := c.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(h.cfg.WebhookSecret)) != 1 {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	var update telegram.Update
+	if err := c.BodyParser(&update); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	msg := update.Message
+	if msg == nil || msg.Chat.Type != "private" || msg.Text == "" {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	first, err := chat.Claim(h.db, chat.ChannelTelegram, strconv.FormatInt(update.UpdateID, 10))
+	if err != nil {
+		log.Printf("telegram: could not record update %d: %v", update.UpdateID, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if !first {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	chatID := strconv.FormatInt(msg.Chat.ID, 10)
+	reply := h.handle(chatID, msg.Text)
+	go func() {
+		if err := h.client.SendMessage(chatID, reply); err != nil {
+			log.Printf("telegram: could not reply to chat %s: %v", chatID, err)
+		}
+	}()
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (h *TelegramHandler) handle(chatID, text string) string {
+	name, args := chat.Parse(text)
+
+	switch name {
+	case "start", "link":
+		if len(args) > 0 {
+			return h.link(chatID, args[0])
+		}
+		if name == "start" {
+			return telegramWelcome
+		}
+		return "Usage: /link <code>"
+	case "unlink":
+		if err := h.db.Model(&models.User{}).Where("telegram_id = ?", chatID).Update("telegram_id", "").Error; err != nil {
+			return "Sorry, something went wrong. Please try again."
+		}
+		return "This chat has been unlinked from your FinGenie account."
+	}
+
+	var user models.User
+	if err := h.db.Where("telegram_id = ?", chatID).First(&user).Error; err != nil {
+		return telegramNotLinked
+	}
+	return h.commands.Run(user, name, args)
+}
+
+// link binds the chat to the account the code was issued for. A chat can only
+// belong to one account, so any earlier link is replaced.
+func (h *TelegramHandler) link(chatID, code string) string {
+	userID, err := h.tokens.ConsumeOneTime(code, models.PurposeTelegramLink)
+	if err != nil {
+		return "That link code is invalid or has expired. Get a new one in the app."
+	}
+
+	var user models.User
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("telegram_id = ? AND id <> ?", chatID, userID).
+			Update("telegram_id", "").Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("telegram_id", chatID).Error; err != nil {
+			return err
+		}
+		return tx.First(&user, "id = ?", userID).Error
+	})
+	if err != nil {
+		return "Sorry, the chat could not be linked. Please try again."
+	}
+
+	return "Linked to " + user.DisplayName + "'s FinGenie account.\n\n" + chat.Help
+}
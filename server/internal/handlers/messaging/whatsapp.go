@@ -0,0 +1,221 @@
+package messaging
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/chat"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/otp"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+	"github.com/sukh-j-14/fingenie-main/internal/whatsapp"
+	"gorm.io/gorm"
+)
+
+const whatsAppNotLinked = `This number isn't linked to a FinGenie account yet. Open the app, go to Profile > WhatsApp and tap "Link WhatsApp".`
+
+// WhatsAppHandler links WhatsApp numbers to accounts and answers commands
+// sent to the business number
+type WhatsAppHandler struct {
+	db       *gorm.DB
+	tokens   *token.Manager
+	commands *chat.Commands
+	client   *whatsapp.Client
+	cfg      whatsapp.Config
+}
+
+func NewWhatsAppHandler(db *gorm.DB, tokens *token.Manager, budgets *budget.Tracker, cfg whatsapp.Config) *WhatsAppHandler {
+	return &WhatsAppHandler{
+		db:       db,
+		tokens:   tokens,
+		commands: chat.NewCommands(db, budgets),
+		client:   whatsapp.NewClient(cfg),
+		cfg:      cfg,
+	}
+}
+
+// CreateLinkCode issues a short-lived code. Sending "link <code>" from
+// WhatsApp links the sending number to the current user; the wa.me URL opens
+// a chat with that message filled in.
+func (h *WhatsAppHandler) CreateLinkCode(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	code, err := h.tokens.IssueOneTime(userID, models.PurposeWhatsAppLink, token.LinkCodeTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not create link code",
+		})
+	}
+
+	data := fiber.Map{
+		"code":      code,
+		"message":   "link " + code,
+		"expiresIn": int(token.LinkCodeTTL.Seconds()),
+	}
+	if h.cfg.BusinessNumber != "" {
+		data["url"] = "https://wa.me/" + strings.TrimPrefix(h.cfg.BusinessNumber, "+") + "?text=" + url.QueryEscape("link "+code)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// Unlink disconnects the user's WhatsApp number
+func (h *WhatsAppHandler) Unlink(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	if err := h.unlink(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not unlink WhatsApp",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "WhatsApp unlinked",
+	})
+}
+
+// VerifyWebhook answers the challenge WhatsApp sends when the webhook URL is
+// registered
+func (h *WhatsAppHandler) VerifyWebhook(c *fiber.Ctx) error {
+	if c.Query("hub.mode") != "subscribe" ||
+		subtle.ConstantTimeCompare([]byte(c.Query("hub.verify_token")), []byte(h.cfg.VerifyToken)) != 1 {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	return c.SendString(c.Query("hub.challenge"))
+}
+
+// Webhook receives inbound messages. Payloads must carry a valid
+// X-Hub-Signature-256, and each message is answered only once. Replies are
+// sent in the background so WhatsApp gets its 200 straight away and doesn't
+// redeliver the message.
+func (h *WhatsAppHandler) Webhook(c *fiber.Ctx) error {
+	if !whatsapp.VerifySignature(h.cfg.AppSecret, c.Body(), c.Get("X-Hub-Signature-256")) {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	var payload whatsapp.Webhook
+	if err := c.BodyParser(&payload); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	for _, msg := range payload.Messages() {
+		if msg.Type != "text" || msg.Text.Body == "" {
+			continue
+		}
+		number, err := otp.NormalizePhone("+" + msg.From)
+		if err != nil {
+			continue
+		}
+		first, err := chat.Claim(h.db, chat.ChannelWhatsApp, msg.ID)
+		if err != nil {
+			log.Printf("whatsapp: could not record message %s: %v", msg.ID, err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if !first {
+			continue
+		}
+
+		reply := h.handle(number, msg.Text.Body)
+		go func() {
+			if err := h.client.SendText(number, reply); err != nil {
+				log.Printf("whatsapp: could not reply to %s: %v", number, err)
+			}
+		}()
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (h *WhatsAppHandler) handle(number, text string) string {
+	name, args := chat.Parse(text)
+
+	switch name {
+	case "link":
+		if len(args) == 0 {
+			return "Usage: link <code>"
+		}
+		return h.link(number, args[0])
+	case "unlink":
+		user, err := h.findUser(number)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return whatsAppNotLinked
+		}
+		if err != nil || h.unlink(user.ID) != nil {
+			return "Sorry, something went wrong. Please try again."
+		}
+		return "This number has been unlinked from your FinGenie account."
+	}
+
+	user, err := h.findUser(number)
+	if err != nil {
+		return whatsAppNotLinked
+	}
+	return h.commands.Run(*user, name, args)
+}
+
+// findUser maps a sender to an account through a linked WhatsApp number, or
+// failing that a verified phone number of a user who hasn't unlinked
+// WhatsApp. Unverified numbers are never trusted.
+func (h *WhatsAppHandler) findUser(number string) (*models.User, error) {
+	var user models.User
+	err := h.db.Where("whatsapp_number = ? AND whatsapp_verified_at IS NOT NULL", number).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if err := h.db.Where("phone_number = ? AND phone_verified_at IS NOT NULL AND whatsapp_unlinked_at IS NULL", number).
+		First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// unlink disconnects the user's number, including their phone number when
+// that is what the bot knew them by
+func (h *WhatsAppHandler) unlink(userID string) error {
+	return h.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"whatsapp_number":      "",
+		"whatsapp_verified_at": nil,
+		"whatsapp_unlinked_at": time.Now(),
+	}).Error
+}
+
+// link binds the number to the account the code was issued for. A number can
+// only belong to one account, so any earlier link is replaced.
+func (h *WhatsAppHandler) link(number, code string) string {
+	userID, err := h.tokens.ConsumeOneTime(code, models.PurposeWhatsAppLink)
+	if err != nil {
+		return "That link code is invalid or has expired. Get a new one in the app."
+	}
+
+	var user models.User
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("whatsapp_number = ? AND id <> ?", number, userID).
+			Updates(map[string]interface{}{"whatsapp_number": "", "whatsapp_verified_at": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"whatsapp_number":      number,
+			"whatsapp_verified_at": time.Now(),
+			"whatsapp_unlinked_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.First(&user, "id = ?", userID).Error
+	})
+	if err != nil {
+		return "Sorry, the number could not be linked. Please try again."
+	}
+
+	return "Linked to " + user.DisplayName + "'s FinGenie account.\n\n" + chat.Help
+}
@@ -1,22 +1,47 @@
 package profile
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
 )
 
 type budgetRequest struct {
-	Category          string      `json:"category"`
-	Tags              interface{} `json:"tags"`
-	Amount            float64     `json:"amount"`
-	Period            string      `json:"period"`
-	StartDate         time.Time   `json:"startDate"`
-	EndDate           time.Time   `json:"endDate"`
-	AISuggestedAmount float64     `json:"aiSuggestedAmount"`
-	IsAutoAdjusting   bool        `json:"isAutoAdjusting"`
-	GroupID           *string     `json:"groupId"`
+	Category        string      `json:"category"`
+	CategoryID      string      `json:"categoryId"` // instead of category
+	Tags            interface{} `json:"tags"`
+	Amount          float64     `json:"amount"`
+	Period          string      `json:"period"`
+	StartDate       time.Time   `json:"startDate"`
+	EndDate         time.Time   `json:"endDate"`
+	IsAutoAdjusting bool        `json:"isAutoAdjusting"`
+	GroupID         *string     `json:"groupId"`
+	AlertThresholds []int       `json:"alertThresholds"`
+}
+
+// denied responds to a policy error: 404 for resources that don't exist, 403
+// for ones the user may not use
+func denied(c *fiber.Ctx, err error, resource string) error {
+	switch {
+	case errors.Is(err, policy.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   resource + " not found",
+		})
+	case errors.Is(err, policy.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"error":   "Not authorized to perform this action",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   "Could not check permissions",
+	})
 }
 
 func (h *Handler) CreateBudget(c *fiber.Ctx) error {
@@ -30,13 +55,44 @@ func (h *Handler) CreateBudget(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Category == "" || req.Amount == 0 || req.Period == "" {
+	if (req.Category == "" && req.CategoryID == "") || req.Amount == 0 || req.Period == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
 			"error":   "Category, amount, and period are required",
 		})
 	}
 
+	for _, threshold := range req.AlertThresholds {
+		if threshold <= 0 || threshold > 1000 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Alert thresholds must be percentages between 1 and 1000",
+			})
+		}
+	}
+
+	if req.GroupID != nil && *req.GroupID != "" {
+		if _, err := h.policy.Group(userID, *req.GroupID, policy.ActionContribute); err != nil {
+			return denied(c, err, "Group")
+		}
+	} else {
+		req.GroupID = nil
+	}
+
+	category, err := h.categories.Find(taxonomy.ScopeOf(userID, req.GroupID), req.CategoryID, req.Category)
+	if err != nil {
+		if errors.Is(err, taxonomy.ErrUnknown) || errors.Is(err, taxonomy.ErrRequired) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not check category",
+		})
+	}
+
 	var tags []string
 	switch v := req.Tags.(type) {
 	case string:
@@ -53,17 +109,19 @@ func (h *Handler) CreateBudget(c *fiber.Ctx) error {
 	}
 
 	budget := models.Budget{
-		UserID:            userID,
-		GroupID:           req.GroupID,
-		Category:          req.Category,
-		Tags:              tags,
-		Amount:            req.Amount,
-		Period:            req.Period,
-		StartDate:         req.StartDate,
-		EndDate:           req.EndDate,
-		AISuggestedAmount: req.AISuggestedAmount,
-		IsAutoAdjusting:   req.IsAutoAdjusting,
-		CurrentSpent:      0,
+		UserID:          userID,
+		GroupID:         req.GroupID,
+		Category:        category.Name,
+		CategoryID:      &category.ID,
+		Tags:            tags,
+		Amount:          req.Amount,
+		Period:          req.Period,
+		StartDate:       req.StartDate,
+		EndDate:         req.EndDate,
+		PeriodAnchor:    &req.StartDate,
+		IsAutoAdjusting: req.IsAutoAdjusting,
+		AlertThresholds: req.AlertThresholds,
+		CurrentSpent:    0,
 	}
 
 	if result := h.db.Create(&budget); result.Error != nil {
@@ -73,8 +131,77 @@ func (h *Handler) CreateBudget(c *fiber.Ctx) error {
 		})
 	}
 
+	// Pick up expenses already recorded in this period
+	if err := h.budgets.Refresh(&budget); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not calculate budget spending",
+		})
+	}
+
+	suggestion, err := h.budgets.Suggest(&budget)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not calculate suggested amount",
+		})
+	}
+	budget.AISuggestedAmount = suggestion.Amount
+	if err := h.db.Model(&budget).Update("ai_suggested_amount", budget.AISuggestedAmount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not save suggested amount",
+		})
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"data":    budget,
 	})
 }
+
+func (h *Handler) GetBudgetSuggestion(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	budget, err := h.policy.Budget(userID, c.Params("budgetId"), policy.ActionView)
+	if err != nil {
+		return denied(c, err, "Budget")
+	}
+
+	suggestion, err := h.budgets.Suggest(budget)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not calculate suggested amount",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    suggestion,
+	})
+}
+
+func (h *Handler) ListBudgetAdjustments(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	budget, err := h.policy.Budget(userID, c.Params("budgetId"), policy.ActionView)
+	if err != nil {
+		return denied(c, err, "Budget")
+	}
+
+	var adjustments []models.BudgetAdjustment
+	if err := h.db.Where("budget_id = ?", budget.ID).
+		Order("period_start DESC").
+		Find(&adjustments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not fetch budget adjustments",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    adjustments,
+	})
+}
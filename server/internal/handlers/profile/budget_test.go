@@ -0,0 +1,87 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+)
+
+const (
+	member    = "00000000-0000-4000-8000-0000000000a1"
+	outsider  = "00000000-0000-4000-8000-0000000000a3"
+	groupID   = "00000000-0000-4000-8000-0000000000b1"
+	budgetID  = "00000000-0000-4000-8000-0000000000c1"
+	missingID = "00000000-0000-4000-8000-0000000000ff"
+)
+
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	db, fake := dbtest.Open()
+	now := time.Now()
+
+	fake.Add("groups", dbtest.Row{"id": groupID, "name": "Flat", "created_by": member})
+	fake.Add("group_members", dbtest.Row{"group_id": groupID, "user_id": member, "role": "admin", "is_active": true})
+	fake.Add("budgets", dbtest.Row{"id": budgetID, "user_id": member, "group_id": groupID, "category": "Food",
+		"amount": 500.0, "period": "monthly", "start_date": now.AddDate(0, 0, -10), "end_date": now.AddDate(0, 0, 20)})
+
+	h := NewHandler(db, budget.NewTracker(db, nil))
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userId", c.Get("X-User"))
+		return c.Next()
+	})
+	app.Post("/budgets", h.CreateBudget)
+	app.Get("/budgets/:budgetId/suggestion", h.GetBudgetSuggestion)
+	app.Get("/budgets/:budgetId/adjustments", h.ListBudgetAdjustments)
+	return app
+}
+
+// TestBudgetRoutesDenyOutsiders checks that a user outside the group gets
+// 403 for its budgets and 404 for ids that don't exist
+func TestBudgetRoutesDenyOutsiders(t *testing.T) {
+	routes := []struct {
+		method, path, body string
+		existing           string
+	}{
+		{"POST", "/budgets", `{"category": "Food", "amount": 100, "period": "monthly", "groupId": "%s"}`, groupID},
+		{"GET", "/budgets/%s/suggestion", "", budgetID},
+		{"GET", "/budgets/%s/adjustments", "", budgetID},
+	}
+	for _, r := range routes {
+		t.Run(r.method+" "+r.path, func(t *testing.T) {
+			for _, tt := range []struct {
+				id   string
+				want int
+			}{
+				{r.existing, fiber.StatusForbidden},
+				{missingID, fiber.StatusNotFound},
+			} {
+				path, body := r.path, r.body
+				if strings.Contains(path, "%s") {
+					path = fmt.Sprintf(path, tt.id)
+				} else {
+					body = fmt.Sprintf(body, tt.id)
+				}
+				req := httptest.NewRequest(r.method, path, strings.NewReader(body))
+				req.Header.Set("X-User", outsider)
+				req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				resp, err := newTestApp(t).Test(req, -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != tt.want {
+					t.Errorf("id %s: status = %d, want %d (%s)", tt.id, resp.StatusCode, tt.want, b)
+				}
+			}
+		})
+	}
+}
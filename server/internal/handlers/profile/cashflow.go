@@ -0,0 +1,118 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/cashflow"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 365
+)
+
+// MarkIncomeReceived records a payment on an income stream and schedules the
+// next one from its frequency
+func (h *Handler) MarkIncomeReceived(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	streamID := c.Params("streamId")
+
+	var req struct {
+		ReceivedAt *time.Time `json:"receivedAt"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid request body",
+			})
+		}
+	}
+
+	receivedAt := time.Now()
+	if req.ReceivedAt != nil {
+		receivedAt = *req.ReceivedAt
+	}
+
+	var stream models.IncomeStream
+	if err := h.db.Where("id = ? AND user_id = ?", streamID, userID).First(&stream).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Income stream not found",
+		})
+	}
+
+	if err := h.income.Receive(&stream, receivedAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update income stream",
+		})
+	}
+
+	if err := h.income.SyncSalaryDate(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update next salary date",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    stream,
+	})
+}
+
+// GetCashflow forecasts the user's cash position over the next N days.
+// Optional query parameters: days, startingBalance, and plannedAmount with
+// plannedDate (YYYY-MM-DD) to check whether a one-off spend is affordable.
+func (h *Handler) GetCashflow(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	days := c.QueryInt("days", defaultForecastDays)
+	if days <= 0 || days > maxForecastDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "days must be between 1 and 365",
+		})
+	}
+
+	opts := cashflow.Options{
+		From:            time.Now(),
+		Days:            days,
+		StartingBalance: c.QueryFloat("startingBalance", 0),
+	}
+
+	if amount := c.QueryFloat("plannedAmount", 0); amount > 0 {
+		planned := &cashflow.Event{
+			Date:        opts.From,
+			Description: c.Query("plannedDescription", "Planned spend"),
+			Amount:      -amount,
+		}
+		if date := c.Query("plannedDate"); date != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", date, time.Local)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"error":   "plannedDate must be in YYYY-MM-DD format",
+				})
+			}
+			planned.Date = parsed
+		}
+		opts.Planned = planned
+	}
+
+	forecast, err := h.forecaster.Forecast(userID, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not build cash-flow forecast",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    forecast,
+	})
+}
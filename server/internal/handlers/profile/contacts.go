@@ -0,0 +1,51 @@
+package profile
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/contacts"
+)
+
+// MatchContacts finds discoverable users among the caller's contacts. The
+// client sends SHA-256 hashes of normalized phone numbers and email addresses
+// (see contacts.HashPhone and contacts.HashEmail) and gets back only the
+// display name and handle of each match.
+func (h *Handler) MatchContacts(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	var req struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+
+	matches, err := h.contacts.Match(userID, req.Hashes)
+	if err != nil {
+		switch {
+		case errors.Is(err, contacts.ErrRateLimited):
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"error":   "Too many contact lookups, please try again later",
+			})
+		case errors.Is(err, contacts.ErrTooManyHashes), errors.Is(err, contacts.ErrMalformedHash):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not match contacts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    matches,
+	})
+}
@@ -0,0 +1,51 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+func (h *Handler) ListNotifications(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	query := h.db.Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC").Limit(100).Find(&notifications).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not fetch notifications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    notifications,
+	})
+}
+
+func (h *Handler) MarkNotificationRead(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+	notificationID := c.Params("notificationId")
+
+	result := h.db.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", notificationID, userID).
+		Update("read_at", time.Now())
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update notification",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Notification marked as read",
+	})
+}
@@ -0,0 +1,26 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AnalyzeBehavioralPatterns re-runs spending pattern detection for the user
+// immediately instead of waiting for the daily job
+func (h *Handler) AnalyzeBehavioralPatterns(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	patterns, err := h.analyzer.Analyze(userID, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not analyze spending patterns",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    patterns,
+	})
+}
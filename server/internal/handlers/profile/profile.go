@@ -1,20 +1,45 @@
 package profile
 
 import (
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/cashflow"
+	"github.com/sukh-j-14/fingenie-main/internal/contacts"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/notify"
+	"github.com/sukh-j-14/fingenie-main/internal/patterns"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	budgets    *budget.Tracker
+	income     *cashflow.Scheduler
+	forecaster *cashflow.Forecaster
+	analyzer   *patterns.Analyzer
+	contacts   *contacts.Matcher
+	policy     *policy.Policy
+	categories *taxonomy.Service
 }
 
-func NewHandler(db *gorm.DB) *Handler {
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+func NewHandler(db *gorm.DB, budgets *budget.Tracker) *Handler {
 	return &Handler{
-		db: db,
+		db:         db,
+		budgets:    budgets,
+		income:     cashflow.NewScheduler(db),
+		forecaster: cashflow.NewForecaster(db),
+		analyzer:   patterns.NewAnalyzer(db),
+		contacts:   contacts.NewMatcher(db),
+		policy:     policy.New(db),
+		categories: taxonomy.New(db),
 	}
 }
 
@@ -48,8 +73,6 @@ func (h *Handler) UpdateProfile(c *fiber.Ctx) error {
 		DisplayName       string     `json:"displayName"`
 		PhoneNumber       string     `json:"phoneNumber"`
 		PreferredCurrency string     `json:"preferredCurrency"`
-		TelegramID        string     `json:"telegramId"`
-		WhatsappNumber    string     `json:"whatsappNumber"`
 		NextSalaryDate    *time.Time `json:"nextSalaryDate"`
 	}
 
@@ -60,6 +83,57 @@ func (h *Handler) UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	var channelData struct {
+		NotificationChannels []string `json:"notificationChannels"`
+	}
+	if err := c.BodyParser(&channelData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	var discoveryData struct {
+		Handle       *string `json:"handle"`
+		Discoverable *bool   `json:"discoverable"`
+	}
+	if err := c.BodyParser(&discoveryData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if discoveryData.Handle != nil {
+		handle := strings.ToLower(strings.TrimSpace(*discoveryData.Handle))
+		if !handlePattern.MatchString(handle) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Handle must be 3-30 letters, digits or underscores",
+			})
+		}
+		discoveryData.Handle = &handle
+	}
+
+	for _, channel := range channelData.NotificationChannels {
+		if !notify.IsValidChannel(channel) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Unknown notification channel: " + channel,
+			})
+		}
+	}
+
+	// A changed phone number has to be verified again
+	if updateData.PhoneNumber != "" {
+		if err := h.db.Model(&models.User{}).
+			Where("id = ? AND phone_number IS DISTINCT FROM ?", userID, updateData.PhoneNumber).
+			Updates(map[string]interface{}{"phone_verified_at": nil, "phone_hash": ""}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not update profile",
+			})
+		}
+	}
+
 	result := h.db.Model(&models.User{}).
 		Where("id = ?", userID).
 		Updates(updateData)
@@ -71,6 +145,50 @@ func (h *Handler) UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	if discoveryData.Handle != nil {
+		var taken int64
+		if err := h.db.Model(&models.User{}).Where("handle = ? AND id <> ?", *discoveryData.Handle, userID).Count(&taken).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not check handle",
+			})
+		}
+		if taken > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   "Handle is already taken",
+			})
+		}
+		if err := h.db.Model(&models.User{}).Where("id = ?", userID).Update("handle", *discoveryData.Handle).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not update handle",
+			})
+		}
+	}
+	if discoveryData.Discoverable != nil {
+		if err := h.db.Model(&models.User{}).Where("id = ?", userID).Update("discoverable", *discoveryData.Discoverable).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not update discoverability",
+			})
+		}
+	}
+
+	if channelData.NotificationChannels != nil {
+		result = h.db.Model(&models.User{}).
+			Where("id = ?", userID).
+			Select("NotificationChannels").
+			Updates(models.User{NotificationChannels: channelData.NotificationChannels})
+
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not update notification channels",
+			})
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Profile updated successfully",
@@ -89,6 +207,7 @@ func (h *Handler) AddIncomeStream(c *fiber.Ctx) error {
 	}
 
 	incomeStream.UserID = userID
+	cashflow.ScheduleStream(&incomeStream, time.Now())
 
 	if result := h.db.Create(&incomeStream); result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -97,6 +216,13 @@ func (h *Handler) AddIncomeStream(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := h.income.SyncSalaryDate(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not update next salary date",
+		})
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"data":    incomeStream,
@@ -126,6 +252,24 @@ func (h *Handler) UpdateIncomeStream(c *fiber.Ctx) error {
 		})
 	}
 
+	// Frequency or dates may have changed, so reschedule the next payment
+	var stream models.IncomeStream
+	if err := h.db.Where("id = ? AND user_id = ?", streamID, userID).First(&stream).Error; err == nil {
+		cashflow.ScheduleStream(&stream, time.Now())
+		if err := h.db.Model(&stream).Update("next_expected", stream.NextExpected).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not update income stream",
+			})
+		}
+		if err := h.income.SyncSalaryDate(userID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not update next salary date",
+			})
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Income stream updated successfully",
@@ -151,39 +295,3 @@ func (h *Handler) DeleteIncomeStream(c *fiber.Ctx) error {
 		"message": "Income stream deleted successfully",
 	})
 }
-
-func (h *Handler) GetUsersByPhoneNumber(c *fiber.Ctx) error {
-	phoneNumber := c.Params("phoneNumber")
-
-	// Basic validation for phone number
-	if phoneNumber == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Phone number is required",
-		})
-	}
-
-	var users []models.User
-	result := h.db.Select("id, display_name, phone_number, telegram_id, whatsapp_number").
-		Where("phone_number = ?", phoneNumber).
-		Find(&users)
-
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Error fetching users",
-		})
-	}
-
-	if len(users) == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "No users found with this phone number",
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    users,
-	})
-}
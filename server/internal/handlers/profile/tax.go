@@ -0,0 +1,57 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/tax"
+)
+
+// GetTaxSummary returns the yearly tax summary as JSON, or as a CSV download
+// when format=csv
+func (h *Handler) GetTaxSummary(c *fiber.Ctx) error {
+	userID := c.Locals("userId").(string)
+
+	now := time.Now()
+	year := c.QueryInt("year", now.Year())
+	if year < 1970 || year > now.Year() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid year",
+		})
+	}
+
+	summary, err := tax.NewReporter(h.db).Summary(userID, year, now)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Could not build tax summary",
+		})
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    summary,
+		})
+	case "csv":
+		var buf bytes.Buffer
+		if err := tax.WriteCSV(&buf, summary); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Could not export tax summary",
+			})
+		}
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="tax-summary-%d.csv"`, year))
+		return c.Send(buf.Bytes())
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "format must be json or csv",
+		})
+	}
+}
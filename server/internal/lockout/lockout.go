@@ -0,0 +1,214 @@
+package lockout
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// Login methods recorded in the history
+const (
+	MethodPassword = "password"
+	MethodPhoneOTP = "phone_otp"
+	// MethodStepUp is a second factor check on an existing session
+	MethodStepUp = "step_up"
+)
+
+const (
+	// FreeAttempts failed logins are allowed before delays kick in
+	FreeAttempts = 3
+	// MaxDelay caps the wait between failed attempts on one account
+	MaxDelay = 5 * time.Minute
+	// LockoutThreshold consecutive failures lock the account for LockDuration
+	LockoutThreshold = 10
+	LockDuration     = 30 * time.Minute
+	// MaxIPFailures failed logins from one IP within IPWindow block the IP
+	// until the window has passed
+	MaxIPFailures = 30
+	IPWindow      = 15 * time.Minute
+	// UnknownWindow is how far back failures on identifiers that match no
+	// account are replayed
+	UnknownWindow = 24 * time.Hour
+)
+
+// BlockedError is returned when a login may not be attempted yet
+type BlockedError struct {
+	Reason string
+	Until  time.Time
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("login blocked until %s: %s", e.Until.Format(time.RFC3339), e.Reason)
+}
+
+// Client describes where a login attempt came from
+type Client struct {
+	IPAddress string
+	UserAgent string
+}
+
+// Guard tracks failed logins per account and per IP and decides when further
+// attempts have to wait
+type Guard struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewGuard(db *gorm.DB) *Guard {
+	return &Guard{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Check returns a *BlockedError if the IP or the account may not attempt a
+// login right now. It should be called before checking credentials. When no
+// account matches, identifier is held back the same way an account would
+// be, so a blocked login doesn't reveal whether the account exists.
+func (g *Guard) Check(user *models.User, identifier, ip string) error {
+	now := g.now()
+
+	var ipFailures []models.LoginAttempt
+	if err := g.db.Select("created_at").
+		Where("ip_address = ? AND success = ? AND created_at > ?", ip, false, now.Add(-IPWindow)).
+		Order("created_at").
+		Find(&ipFailures).Error; err != nil {
+		return err
+	}
+	if len(ipFailures) >= MaxIPFailures {
+		return &BlockedError{
+			Reason: "too many failed logins from this address",
+			Until:  ipFailures[len(ipFailures)-MaxIPFailures].CreatedAt.Add(IPWindow),
+		}
+	}
+
+	if user == nil {
+		if identifier == "" {
+			return nil
+		}
+		var failures []models.LoginAttempt
+		if err := g.db.Select("created_at").
+			Where("identifier = ? AND user_id IS NULL AND success = ? AND created_at > ?", identifier, false, now.Add(-UnknownWindow)).
+			Order("created_at").
+			Find(&failures).Error; err != nil {
+			return err
+		}
+		user = &models.User{}
+		for _, f := range failures {
+			failed(user, f.CreatedAt)
+		}
+	}
+
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return &BlockedError{Reason: "account temporarily locked", Until: *user.LockedUntil}
+	}
+	if user.LastFailedLoginAt != nil {
+		if until := user.LastFailedLoginAt.Add(Delay(user.FailedLoginCount)); now.Before(until) {
+			return &BlockedError{Reason: "too many failed attempts", Until: until}
+		}
+	}
+	return nil
+}
+
+// failed applies a failed login at the given time to the account's counter,
+// the way Record does in the database
+func failed(user *models.User, at time.Time) {
+	user.FailedLoginCount++
+	user.LastFailedLoginAt = &at
+	if user.FailedLoginCount >= LockoutThreshold {
+		until := at.Add(LockDuration)
+		user.FailedLoginCount, user.LastFailedLoginAt, user.LockedUntil = 0, nil, &until
+	}
+}
+
+// Delay is the wait imposed after the given number of consecutive failures.
+// It doubles with each failure past FreeAttempts, up to MaxDelay.
+func Delay(failures int) time.Duration {
+	if failures < FreeAttempts {
+		return 0
+	}
+	exp := failures - FreeAttempts
+	if exp > 16 {
+		exp = 16
+	}
+	delay := time.Duration(math.Pow(2, float64(exp))) * time.Second
+	if delay > MaxDelay {
+		return MaxDelay
+	}
+	return delay
+}
+
+// Record stores the attempt in the login history and updates the account's
+// failure counter. user may be nil when the login didn't match an account.
+func (g *Guard) Record(user *models.User, identifier, method string, client Client, success bool) error {
+	now := g.now()
+
+	attempt := models.LoginAttempt{
+		Identifier: identifier,
+		Method:     method,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		Success:    success,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+		if success {
+			newDevice, err := g.isNewDevice(user.ID, client)
+			if err != nil {
+				return err
+			}
+			attempt.NewDevice = newDevice
+		}
+	}
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		if user == nil {
+			return nil
+		}
+
+		if success {
+			return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"failed_login_count":   0,
+				"last_failed_login_at": nil,
+				"locked_until":         nil,
+			}).Error
+		}
+
+		// The counter is read and written in one statement so concurrent
+		// failures can't both see the same count; every expression sees the
+		// row as it was before the update
+		reached := fmt.Sprintf("failed_login_count + 1 >= %d", LockoutThreshold)
+		updates := map[string]interface{}{
+			"failed_login_count":   gorm.Expr("CASE WHEN " + reached + " THEN 0 ELSE failed_login_count + 1 END"),
+			"last_failed_login_at": gorm.Expr("CASE WHEN "+reached+" THEN NULL ELSE ?::timestamptz END", now),
+			"locked_until":         gorm.Expr("CASE WHEN "+reached+" THEN ?::timestamptz ELSE locked_until END", now.Add(LockDuration)),
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	})
+}
+
+// isNewDevice reports whether the user has never signed in successfully from
+// this IP address and user agent before
+func (g *Guard) isNewDevice(userID string, client Client) (bool, error) {
+	var seen int64
+	err := g.db.Model(&models.LoginAttempt{}).
+		Where("user_id = ? AND success = ? AND ip_address = ? AND user_agent = ?", userID, true, client.IPAddress, client.UserAgent).
+		Count(&seen).Error
+	return seen == 0, err
+}
+
+// History returns the user's most recent login attempts
+func (g *Guard) History(userID string, limit int) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := g.db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&attempts).Error
+	return attempts, err
+}
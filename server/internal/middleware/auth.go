@@ -1,14 +1,19 @@
 package middleware
 
 import (
-	"os"
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
 )
 
-func AuthMiddleware() fiber.Handler {
+// AuthMiddleware accepts a session access token or an API key as a bearer
+// token. API keys are only let through to routes that name a resource their
+// scopes cover: GET and HEAD requests need "<resource>:read" or
+// "<resource>:write", anything else "<resource>:write". Routes that name no
+// resources are for signed-in sessions only.
+func AuthMiddleware(tokens *token.Manager, resources ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -26,43 +31,77 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			jwtSecret = "your-default-secret-key"
+		var claims *token.Claims
+		var err error
+		if strings.HasPrefix(parts[1], token.APIKeyPrefix) {
+			claims, err = tokens.VerifyAPIKey(parts[1], c.IP())
+		} else {
+			claims, err = tokens.Verify(parts[1])
 		}
-
-		token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token signing method")
-			}
-			return []byte(jwtSecret), nil
-		})
-
 		if err != nil {
+			message := "Invalid token"
+			switch {
+			case errors.Is(err, token.ErrExpiredToken):
+				message = "Token has expired"
+			case errors.Is(err, token.ErrSessionRevoked):
+				message = "Session has been revoked"
+			case errors.Is(err, token.ErrAPIKeyRevoked):
+				message = "API key has been revoked"
+			}
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"success": false,
-				"error":   "Invalid token",
+				"error":   message,
 			})
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		if claims.APIKeyID != "" && !allowsAny(claims, resources, c.Method()) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"success": false,
-				"error":   "Invalid token claims",
+				"error":   "API key is not allowed to access this endpoint",
 			})
 		}
 
-		if exp, ok := claims["exp"].(float64); !ok || int64(exp) < jwt.NewNumericDate(c.Context().Time()).Unix() {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		c.Locals("userId", claims.UserID)
+		c.Locals("email", claims.Email)
+		c.Locals("sessionId", claims.SessionID)
+		c.Locals("apiKeyId", claims.APIKeyID)
+
+		return c.Next()
+	}
+}
+
+func allowsAny(claims *token.Claims, resources []string, method string) bool {
+	write := method != fiber.MethodGet && method != fiber.MethodHead
+	for _, resource := range resources {
+		if claims.Allows(resource, write) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireStepUp guards high-risk routes. Users with 2FA must have re-entered
+// a code on this session within token.StepUpWindow (see POST /auth/step-up).
+// It must run after AuthMiddleware.
+func RequireStepUp(tokens *token.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("userId").(string)
+		sessionID, _ := c.Locals("sessionId").(string)
+
+		required, err := tokens.StepUpRequired(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
-				"error":   "Token has expired",
+				"error":   "Could not verify two-factor status",
+			})
+		}
+		if required {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success":        false,
+				"error":          "Two-factor verification required",
+				"stepUpRequired": true,
 			})
 		}
-
-		c.Locals("userId", claims["userId"])
-		c.Locals("email", claims["email"])
 
 		return c.Next()
 	}
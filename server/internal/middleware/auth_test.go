@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/token"
+)
+
+const userID = "00000000-0000-4000-8000-0000000000a1"
+
+// newAuthApp serves /groups, scoped to groups, and /sessions, which names no
+// resource. It returns the access token of a session of the user.
+func newAuthApp(t *testing.T) (*fiber.App, *token.Manager, string) {
+	t.Helper()
+	db, fake := dbtest.Open()
+	fake.Add("users", dbtest.Row{"id": userID, "email": "asha@example.com"})
+
+	key, err := token.NewHMACKey("test", strings.Repeat("k", token.MinSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := token.NewKeySet("test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := token.NewManager(db, token.Config{Keys: keys, AccessTTL: token.DefaultAccessTTL, RefreshTTL: token.DefaultRefreshTTL})
+	pair, err := tokens.Issue(models.User{Base: models.Base{ID: userID}, Email: "asha@example.com"}, token.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendString(c.Locals("userId").(string)) }
+	groups := app.Group("/groups", AuthMiddleware(tokens, token.ResourceGroups))
+	groups.Get("/", ok)
+	groups.Post("/", ok)
+	app.Get("/sessions", AuthMiddleware(tokens), ok)
+	return app, tokens, pair.AccessToken
+}
+
+func apiKey(t *testing.T, tokens *token.Manager, scopes ...string) string {
+	t.Helper()
+	raw, _, err := tokens.CreateAPIKey(userID, "test", scopes, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return raw
+}
+
+func request(t *testing.T, app *fiber.App, method, path, authorization string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if authorization != "" {
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp.StatusCode
+}
+
+func TestAuthMiddlewareScopes(t *testing.T) {
+	app, tokens, session := newAuthApp(t)
+	read := apiKey(t, tokens, "groups:read")
+	write := apiKey(t, tokens, "groups:write")
+	other := apiKey(t, tokens, "expenses:write", "profile:read")
+
+	tests := []struct {
+		name         string
+		method, path string
+		bearer       string
+		want         int
+	}{
+		{"session reads", "GET", "/groups/", session, fiber.StatusOK},
+		{"session writes", "POST", "/groups/", session, fiber.StatusOK},
+		{"session on an unscoped route", "GET", "/sessions", session, fiber.StatusOK},
+		{"read key reads", "GET", "/groups/", read, fiber.StatusOK},
+		{"read key can't write", "POST", "/groups/", read, fiber.StatusForbidden},
+		{"write key reads", "GET", "/groups/", write, fiber.StatusOK},
+		{"write key writes", "POST", "/groups/", write, fiber.StatusOK},
+		{"key for other resources", "GET", "/groups/", other, fiber.StatusForbidden},
+		{"key on an unscoped route", "GET", "/sessions", write, fiber.StatusForbidden},
+		{"unknown key", "GET", "/groups/", token.APIKeyPrefix + "nope", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if status := request(t, app, tt.method, tt.path, "Bearer "+tt.bearer); status != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, status, tt.want)
+		}
+	}
+}
+
+func TestAuthMiddlewareRejectsBadHeaders(t *testing.T) {
+	app, tokens, session := newAuthApp(t)
+	raw, key, err := tokens.CreateAPIKey(userID, "revoked", []string{"groups:write"}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := tokens.RevokeAPIKey(userID, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	for _, header := range []string{"", session, "Basic " + session, "Bearer", "Bearer not-a-jwt", "Bearer " + raw} {
+		if status := request(t, app, "GET", "/groups/", header); status != fiber.StatusUnauthorized {
+			t.Errorf("Authorization %q = %d, want 401", header, status)
+		}
+	}
+}
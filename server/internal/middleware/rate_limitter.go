@@ -1 +1,156 @@
 package middleware
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimitStore counts requests per key in fixed windows. Increment adds one
+// hit and returns the count so far in the current window and when it resets.
+type RateLimitStore interface {
+	Increment(ctx context.Context, key string, window time.Duration) (count int, resetAt time.Time, err error)
+}
+
+// Limit allows Max requests per Window
+type Limit struct {
+	Max    int
+	Window time.Duration
+}
+
+// KeyFunc picks what a limit is counted against
+type KeyFunc func(c *fiber.Ctx) string
+
+// KeyByIP counts requests per client IP
+func KeyByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// KeyByUser counts requests per signed-in user, falling back to the client IP
+// when the request isn't authenticated. It must run after AuthMiddleware.
+func KeyByUser(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("userId").(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return KeyByIP(c)
+}
+
+// RateLimit rejects requests over the limit with 429 and a Retry-After
+// header. name separates the counters of different limits sharing a store.
+// If the store fails the request is let through.
+func RateLimit(store RateLimitStore, name string, limit Limit, key KeyFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		count, resetAt, err := store.Increment(c.Context(), "ratelimit:"+name+":"+key(c), limit.Window)
+		if err != nil {
+			log.Printf("ratelimit: %s: %v", name, err)
+			return c.Next()
+		}
+
+		remaining := limit.Max - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Set("X-RateLimit-Limit", strconv.Itoa(limit.Max))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+		if count > limit.Max {
+			retryAfter := int(time.Until(resetAt).Seconds() + 0.999)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"error":   "Too many requests, please try again later",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// MemoryStore keeps counters in process memory. Limits are per instance, so
+// use a shared store such as RedisStore when running more than one.
+type MemoryStore struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+type memoryWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		windows: make(map[string]*memoryWindow),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Increment(_ context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(s.nextSweep) {
+		for k, w := range s.windows {
+			if !now.Before(w.resetAt) {
+				delete(s.windows, k)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &memoryWindow{resetAt: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.resetAt, nil
+}
+
+// RedisClient is the subset of Redis commands RedisStore needs. Any Redis
+// client can be adapted to it in a few lines.
+type RedisClient interface {
+	Incr(ctx context.Context, key string) (int64, error)
+	PExpire(ctx context.Context, key string, ttl time.Duration) error
+	PTTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// RedisStore shares counters between instances through Redis
+type RedisStore struct {
+	client RedisClient
+}
+
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	count, err := s.client.Incr(ctx, key)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	ttl, err := s.client.PTTL(ctx, key)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	// A new key, or one left without an expiry by a failed earlier call
+	if count == 1 || ttl < 0 {
+		if err := s.client.PExpire(ctx, key, window); err != nil {
+			return 0, time.Time{}, err
+		}
+		ttl = window
+	}
+	return int(count), time.Now().Add(ttl), nil
+}
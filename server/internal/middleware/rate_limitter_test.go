@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemoryStoreFixedWindow(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	steps := []struct {
+		after     time.Duration // since the previous step
+		key       string
+		wantCount int
+		wantReset time.Time
+	}{
+		{0, "a", 1, now.Add(time.Minute)},
+		{10 * time.Second, "a", 2, now.Add(time.Minute)},
+		{0, "b", 1, now.Add(70 * time.Second)},           // keys count separately
+		{49 * time.Second, "a", 3, now.Add(time.Minute)}, // the window doesn't slide
+		{time.Second, "a", 1, now.Add(2 * time.Minute)},  // a new window starts on the reset
+		{0, "b", 2, now.Add(70 * time.Second)},
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+		count, resetAt, err := store.Increment(ctx, s.key, time.Minute)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if count != s.wantCount || !resetAt.Equal(s.wantReset) {
+			t.Errorf("step %d: Increment(%s) = %d resetting at %s, want %d at %s",
+				i, s.key, count, resetAt.Format(time.TimeOnly), s.wantCount, s.wantReset.Format(time.TimeOnly))
+		}
+	}
+}
+
+func TestMemoryStoreSweepsExpiredWindows(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		store.Increment(ctx, key, 30*time.Second)
+	}
+	store.Increment(ctx, "long", time.Hour)
+
+	now = now.Add(2 * time.Minute)
+	store.Increment(ctx, "d", 30*time.Second)
+	if len(store.windows) != 2 {
+		t.Errorf("%d windows kept, want the unexpired 2: %v", len(store.windows), store.windows)
+	}
+	if _, ok := store.windows["long"]; !ok {
+		t.Error("an unexpired window was swept")
+	}
+}
+
+// newLimitedApp serves GET / behind a limit of 2 a minute. X-User signs the
+// request in and X-Forwarded-For sets the client IP.
+func newLimitedApp(store RateLimitStore, key KeyFunc) *fiber.App {
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Use(func(c *fiber.Ctx) error {
+		if user := c.Get("X-User"); user != "" {
+			c.Locals("userId", user)
+		}
+		return c.Next()
+	})
+	app.Get("/", RateLimit(store, "test", Limit{Max: 2, Window: time.Minute}, key), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, ip, user string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderXForwardedFor, ip)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter)
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	type request struct {
+		ip, user string
+		want     int
+	}
+	tests := []struct {
+		name     string
+		key      KeyFunc
+		requests []request
+	}{
+		{"by IP", KeyByIP, []request{
+			{"10.0.0.1", "asha", 200},
+			{"10.0.0.1", "ravi", 200},
+			{"10.0.0.1", "priya", 429}, // signing in doesn't reset the count
+			{"10.0.0.2", "", 200},
+		}},
+		{"by user", KeyByUser, []request{
+			{"10.0.0.1", "asha", 200},
+			{"10.0.0.2", "asha", 200},
+			{"10.0.0.3", "asha", 429}, // changing IP doesn't reset the count
+			{"10.0.0.1", "ravi", 200},
+			{"10.0.0.1", "", 200}, // signed out requests fall back to the IP
+			{"10.0.0.1", "", 200},
+			{"10.0.0.1", "", 429},
+			{"10.0.0.1", "ravi", 200},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newLimitedApp(NewMemoryStore(), tt.key)
+			for i, r := range tt.requests {
+				if status, _ := get(t, app, r.ip, r.user); status != r.want {
+					t.Errorf("request %d from %s as %q = %d, want %d", i, r.ip, r.user, status, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	app := newLimitedApp(NewMemoryStore(), KeyByIP)
+	for i := 0; i < 2; i++ {
+		if status, retry := get(t, app, "10.0.0.1", ""); status != fiber.StatusOK || retry != "" {
+			t.Fatalf("request %d = %d with Retry-After %q, want 200 without it", i, status, retry)
+		}
+	}
+	status, retry := get(t, app, "10.0.0.1", "")
+	if status != fiber.StatusTooManyRequests {
+		t.Fatalf("third request = %d, want 429", status)
+	}
+	if seconds, err := strconv.Atoi(retry); err != nil || seconds < 59 || seconds > 60 {
+		t.Errorf("Retry-After = %q, want about 60 seconds", retry)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Increment(context.Context, string, time.Duration) (int, time.Time, error) {
+	return 0, time.Time{}, errors.New("connection refused")
+}
+
+func TestRateLimitLetsThroughWhenStoreFails(t *testing.T) {
+	app := newLimitedApp(failingStore{}, KeyByIP)
+	for i := 0; i < 3; i++ {
+		if status, _ := get(t, app, "10.0.0.1", ""); status != fiber.StatusOK {
+			t.Errorf("request %d = %d, want 200", i, status)
+		}
+	}
+}
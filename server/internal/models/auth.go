@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one signed-in device. Access tokens carry the session ID, so
+// revoking the session immediately invalidates them as well as the session's
+// refresh tokens.
+type Session struct {
+	Base
+	UserID     string     `gorm:"type:uuid;not null;index" json:"userId"`
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expiresAt"`
+	RevokedAt  *time.Time `gorm:"index" json:"revokedAt,omitempty"`
+	// StepUpAt is the last time the session re-checked the second factor
+	StepUpAt *time.Time `json:"-"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// RefreshToken is a single-use token in a session's rotation chain. Only a
+// hash of the token is stored. Presenting a token that has already been used
+// revokes the whole session.
+type RefreshToken struct {
+	Base
+	SessionID  string     `gorm:"type:uuid;not null;index" json:"sessionId"`
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt     *time.Time `json:"usedAt,omitempty"`
+	ReplacedBy *string    `gorm:"type:uuid" json:"replacedBy,omitempty"`
+
+	Session Session `gorm:"foreignKey:SessionID" json:"-"`
+}
+
+// One-time token purposes
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeTelegramLink      = "telegram_link"
+	PurposeWhatsAppLink      = "whatsapp_link"
+)
+
+// OneTimeToken is an expiring, single-use token sent to the user out of band,
+// e.g. in a password reset email. Only a hash of the token is stored.
+type OneTimeToken struct {
+	Base
+	UserID    string     `gorm:"type:uuid;not null;index" json:"userId"`
+	Purpose   string     `gorm:"not null;index" json:"purpose"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// Phone OTP purposes
+const (
+	PurposePhoneVerification = "phone_verification"
+	PurposePhoneLogin        = "phone_login"
+)
+
+// PhoneOTP is a short numeric code texted to a phone number. Only a hash of
+// the code is stored.
+type PhoneOTP struct {
+	Base
+	UserID      *string    `gorm:"type:uuid;index" json:"userId"`
+	PhoneNumber string     `gorm:"not null;index" json:"phoneNumber"`
+	Purpose     string     `gorm:"not null" json:"purpose"`
+	CodeHash    string     `gorm:"not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expiresAt"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	ConsumedAt  *time.Time `json:"consumedAt,omitempty"`
+}
+
+// LoginAttempt is one entry in a user's sign-in history. Failed attempts that
+// didn't match an account have no UserID and are kept for per-IP limits.
+type LoginAttempt struct {
+	Base
+	UserID     *string `gorm:"type:uuid;index" json:"userId,omitempty"`
+	Identifier string  `gorm:"index" json:"identifier"`
+	Method     string  `gorm:"not null" json:"method"`
+	IPAddress  string  `gorm:"index" json:"ipAddress"`
+	UserAgent  string  `json:"userAgent"`
+	Success    bool    `gorm:"not null" json:"success"`
+	// NewDevice marks a successful sign-in from an IP and user agent not
+	// seen for this user before
+	NewDevice bool `gorm:"default:false" json:"newDevice"`
+}
+
+// RecoveryCode is a single-use backup code for 2FA. Only a hash is stored.
+type RecoveryCode struct {
+	Base
+	UserID   string     `gorm:"type:uuid;not null;index" json:"userId"`
+	CodeHash string     `gorm:"not null;index" json:"-"`
+	UsedAt   *time.Time `json:"usedAt,omitempty"`
+}
+
+// APIKey is a long-lived personal access token that lets bots and scripts act
+// for a user. It only reaches the routes its scopes allow. Only a hash of the
+// key is stored; Prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	Base
+	UserID     string      `gorm:"type:uuid;not null;index" json:"userId"`
+	Name       string      `gorm:"not null" json:"name"`
+	Prefix     string      `gorm:"not null" json:"prefix"`
+	KeyHash    string      `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     StringArray `gorm:"type:text[]" json:"scopes"`
+	ExpiresAt  *time.Time  `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time  `json:"lastUsedAt,omitempty"`
+	LastUsedIP string      `json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time  `gorm:"index" json:"revokedAt,omitempty"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// Category is an entry in the category taxonomy. System categories belong to
+// no one; custom ones belong to a user or to a group. Categories nest one
+// level deep: a subcategory's parent is always a top-level category.
+type Category struct {
+	Base
+	Name string `gorm:"not null" json:"name"`
+	// Slug is the name folded for comparison, so "Food" and "food " are the
+	// same category
+	Slug     string  `gorm:"not null;index" json:"slug"`
+	ParentID *string `gorm:"type:uuid;index" json:"parentId"`
+	UserID   *string `gorm:"type:uuid;index" json:"userId,omitempty"`
+	GroupID  *string `gorm:"type:uuid;index" json:"groupId,omitempty"`
+	Icon     string  `json:"icon"`
+	Color    string  `gorm:"type:varchar(7)" json:"color"` // #RRGGBB
+	Position int     `gorm:"default:0" json:"position"`
+}
+
+// IsSystem reports whether the category is one of the defaults everyone shares
+func (c *Category) IsSystem() bool {
+	return c.UserID == nil && c.GroupID == nil
+}
+
+// CategoryRule sets the category and tags of expenses whose description
+// matches Pattern. Rules without a UserID are global and apply to everyone
+// after the user's own rules.
+type CategoryRule struct {
+	Base
+	UserID    *string  `gorm:"type:uuid;index" json:"userId"`
+	Pattern   string   `gorm:"not null" json:"pattern"`
+	MatchType string   `gorm:"type:varchar(10);not null;default:'keyword'" json:"matchType"` // keyword, regex
+	Category  string   `gorm:"not null" json:"category"`
+	Tags      []string `gorm:"type:jsonb;serializer:json" json:"tags"`
+	Priority  int      `gorm:"default:0" json:"priority"`
+	// Status is proposed for rules learned from the user's corrections until
+	// they accept them
+	Status string `gorm:"type:varchar(10);not null;default:'active';index" json:"status"` // active, proposed
+	Source string `gorm:"type:varchar(10);not null;default:'manual'" json:"source"`       // manual, learned, system
+	// Hits counts the corrections behind a learned rule
+	Hits int `gorm:"default:0" json:"hits"`
+
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ProcessedMessage records a message a messaging webhook has handled, so a
+// redelivered webhook doesn't run the same command twice
+type ProcessedMessage struct {
+	Base
+	Channel   string `gorm:"type:varchar(20);not null;uniqueIndex:idx_processed_message" json:"channel"`
+	MessageID string `gorm:"not null;uniqueIndex:idx_processed_message" json:"messageId"`
+}
+
+// PendingDraft is an expense or payment drafted in chat, waiting for the
+// user to reply yes. A user has at most one.
+type PendingDraft struct {
+	Base
+	UserID    string    `gorm:"type:uuid;not null;uniqueIndex" json:"userId"`
+	Draft     JSON      `gorm:"type:jsonb;not null" json:"draft"`
+	ExpiresAt time.Time `gorm:"not null" json:"expiresAt"`
+}
@@ -51,16 +51,83 @@ type Expense struct {
 	OriginalCurrency string    `gorm:"not null" json:"originalCurrency"`
 	ConvertedAmount  float64   `json:"convertedAmount"`
 	Category         string    `gorm:"not null" json:"category"`
+	CategoryID       *string   `gorm:"type:uuid;index" json:"categoryId"`
 	Description      string    `json:"description"`
 	Date             time.Time `gorm:"not null" json:"date"`
 	IsVerified       bool      `gorm:"default:false" json:"isVerified"`
+	Tags             []string  `gorm:"type:jsonb;serializer:json" json:"tags"`
+	// ImportKey identifies expenses created by an import so re-running it
+	// doesn't duplicate them
+	ImportKey *string `gorm:"uniqueIndex" json:"-"`
 	// Relations
 	User          User           `gorm:"foreignKey:UserID" json:"-"`
 	Group         *Group         `gorm:"foreignKey:GroupID" json:"group,omitempty"`
 	SplitExpenses []SplitExpense `gorm:"foreignKey:ExpenseID" json:"splitExpenses,omitempty"`
+	Attachments   []Attachment   `gorm:"foreignKey:ExpenseID" json:"attachments,omitempty"`
 }
 
-// RecurringExpense represents a recurring expense pattern
+// TagPayment marks expenses that record one person paying another back,
+// such as Splitwise payments. They aren't spending, so budgets leave them out.
+const TagPayment = "payment"
+
+// IsPayment reports whether the expense is tagged as a payment
+func (e *Expense) IsPayment() bool {
+	for _, tag := range e.Tags {
+		if tag == TagPayment {
+			return true
+		}
+	}
+	return false
+}
+
+// Attachment is a file kept with an expense, usually a photo of the receipt.
+// The bytes live in blob storage under StorageKey; ThumbnailKey is empty for
+// files without a thumbnail, e.g. PDFs.
+type Attachment struct {
+	Base
+	ExpenseID    string `gorm:"type:uuid;not null;index" json:"expenseId"`
+	UploadedBy   string `gorm:"type:uuid;not null" json:"uploadedBy"`
+	FileName     string `gorm:"not null" json:"fileName"`
+	ContentType  string `gorm:"not null" json:"contentType"`
+	Size         int64  `gorm:"not null" json:"size"`
+	SHA256       string `gorm:"type:char(64);not null;index" json:"sha256"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	StorageKey   string `gorm:"not null" json:"-"`
+	ThumbnailKey string `json:"-"`
+	// Receipt is the OCR result for the file, once the app has sent one
+	Receipt *Receipt `gorm:"type:jsonb;serializer:json" json:"receipt,omitempty"`
+
+	// Relations
+	Expense Expense `gorm:"foreignKey:ExpenseID" json:"-"`
+}
+
+// Receipt is the structured OCR output the app extracts from a photo
+type Receipt struct {
+	Merchant string        `json:"merchant"`
+	Date     string        `json:"date"` // YYYY-MM-DD or RFC 3339
+	Currency string        `json:"currency"`
+	Items    []ReceiptItem `json:"items"`
+	Subtotal float64       `json:"subtotal"`
+	Tax      float64       `json:"tax"`
+	Tip      float64       `json:"tip"`
+	Discount float64       `json:"discount"`
+	Total    float64       `json:"total"`
+}
+
+// ReceiptItem is one line of a receipt. Amount is the line total; when it is
+// missing it is worked out from Quantity and UnitPrice. Discount lines may
+// be negative.
+type ReceiptItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity,omitempty"`
+	UnitPrice   float64 `json:"unitPrice,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+// RecurringExpense represents a recurring expense pattern. Nothing creates
+// them yet; whatever does must set CategoryID with taxonomy Find, as expenses
+// do, so it can't point at another user's or group's category.
 type RecurringExpense struct {
 	Base
 	UserID        string     `gorm:"type:uuid;not null;index" json:"userId"`
@@ -68,6 +135,7 @@ type RecurringExpense struct {
 	Amount        float64    `gorm:"not null" json:"amount"`
 	Currency      string     `gorm:"not null" json:"currency"`
 	Category      string     `gorm:"not null" json:"category"`
+	CategoryID    *string    `gorm:"type:uuid;index" json:"categoryId"`
 	Description   string     `json:"description"`
 	Frequency     string     `gorm:"not null" json:"frequency"` // daily, weekly, monthly, yearly
 	StartDate     time.Time  `gorm:"not null" json:"startDate"`
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql/driver"
 	"errors"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -39,6 +40,113 @@ func (j JSON) Value() (driver.Value, error) {
 	return string(j), nil
 }
 
+// MarshalJSON emits the stored document as-is instead of base64-encoding it
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON keeps a copy of the raw document
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	if j == nil {
+		return errors.New("JSON: UnmarshalJSON on nil pointer")
+	}
+	*j = append((*j)[0:0], data...)
+	return nil
+}
+
+// StringArray maps a []string onto a Postgres text[] column
+type StringArray []string
+
+// Scan implements the sql.Scanner interface
+func (a *StringArray) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	var s string
+	switch v := value.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return errors.New("invalid scan source for StringArray")
+	}
+	parsed, err := parseArrayLiteral(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (a StringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, s := range a {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('"')
+		for _, r := range s {
+			if r == '"' || r == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+// parseArrayLiteral parses a one-dimensional Postgres array literal such as
+// {a,"b c",NULL}
+func parseArrayLiteral(s string) ([]string, error) {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, errors.New("invalid array literal")
+	}
+	s = s[1 : len(s)-1]
+	result := []string{}
+	if s == "" {
+		return result, nil
+	}
+
+	var item strings.Builder
+	quoted, inQuotes, escaped := false, false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			item.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			quoted = true
+		case r == ',' && !inQuotes:
+			if quoted || item.String() != "NULL" {
+				result = append(result, item.String())
+			}
+			item.Reset()
+			quoted = false
+		default:
+			item.WriteRune(r)
+		}
+	}
+	if quoted || item.String() != "NULL" {
+		result = append(result, item.String())
+	}
+	return result, nil
+}
+
 // Enum types
 type GroupType string
 type SplitType string
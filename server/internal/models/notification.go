@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification is an in-app message delivered to a user. Every notification is
+// stored here regardless of which external channels it was also sent through.
+type Notification struct {
+	Base
+	UserID string     `gorm:"type:uuid;not null;index" json:"userId"`
+	Type   string     `gorm:"type:varchar(50);not null;index" json:"type"`
+	Title  string     `gorm:"not null" json:"title"`
+	Body   string     `json:"body"`
+	Data   JSON       `gorm:"type:jsonb" json:"data"`
+	ReadAt *time.Time `json:"readAt,omitempty"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -9,16 +9,41 @@ type User struct {
 	DisplayName            string     `gorm:"not null" json:"displayName"`
 	Email                  string     `gorm:"uniqueIndex;not null" json:"email"`
 	Password               string     `gorm:"not null" json:"-"`
+	EmailVerifiedAt        *time.Time `json:"emailVerifiedAt"`
 	PhoneNumber            string     `gorm:"uniqueIndex" json:"phoneNumber"`
+	PhoneVerifiedAt        *time.Time `json:"phoneVerifiedAt"`
+	FailedLoginCount       int        `gorm:"default:0" json:"-"`
+	LastFailedLoginAt      *time.Time `json:"-"`
+	LockedUntil            *time.Time `json:"-"`
+	TOTPSecret             string     `json:"-"`
+	TOTPLastStep           int64      `gorm:"default:0" json:"-"`
+	TwoFactorEnabledAt     *time.Time `json:"twoFactorEnabledAt"`
 	SocialScore            float64    `gorm:"default:0" json:"socialScore"`
 	IsPremium              bool       `gorm:"default:false" json:"isPremium"`
 	PreferredCurrency      string     `gorm:"not null;default:'USD'" json:"preferredCurrency"`
-	TelegramID             string     `json:"telegramId"`
-	WhatsappNumber         string     `json:"whatsappNumber"`
+	TelegramID             string     `gorm:"index" json:"telegramId"`
+	WhatsappNumber         string     `gorm:"index" json:"whatsappNumber"`
+	WhatsappVerifiedAt     *time.Time `json:"whatsappVerifiedAt"`
 	CreditLimit            float64    `gorm:"default:0" json:"creditLimit"`
 	NextSalaryDate         *time.Time `json:"nextSalaryDate"`
 	HasDefaultHistory      bool       `gorm:"default:false" json:"hasDefaultHistory"`
 	SecurityDepositBalance float64    `gorm:"default:0" json:"securityDepositBalance"`
+	NotificationChannels   []string   `gorm:"type:jsonb;serializer:json" json:"notificationChannels"`
+	// Handle is the public name other users see in contact matches
+	Handle       *string `gorm:"uniqueIndex" json:"handle"`
+	Discoverable bool    `gorm:"default:false" json:"discoverable"`
+	// IsPlaceholder marks a stand-in for someone without an account, such as
+	// a participant of an imported Splitwise group. Placeholders can't log in.
+	IsPlaceholder bool `gorm:"default:false" json:"isPlaceholder"`
+	// LearnCategories proposes category rules when the user recategorises
+	// an expense
+	LearnCategories bool `gorm:"default:false" json:"learnCategories"`
+	// Hashed identifiers for contact matching, see package contacts
+	EmailHash string `gorm:"index" json:"-"`
+	PhoneHash string `gorm:"index" json:"-"`
+	// WhatsappUnlinkedAt is set when the user unlinks WhatsApp, after which
+	// messages from their verified phone number aren't taken as theirs either
+	WhatsappUnlinkedAt *time.Time `json:"-"`
 
 	// Relations
 	Expenses           []Expense            `gorm:"foreignKey:UserID" json:"expenses,omitempty"`
@@ -44,32 +69,88 @@ type IncomeStream struct {
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
 
+// IncomeReceipt is a single payment received on an income stream. The tax
+// fields are copied from the stream so later edits don't rewrite history.
+type IncomeReceipt struct {
+	Base
+	UserID         string    `gorm:"type:uuid;not null;index" json:"userId"`
+	IncomeStreamID string    `gorm:"type:uuid;not null;index" json:"incomeStreamId"`
+	Amount         float64   `gorm:"not null" json:"amount"`
+	ReceivedAt     time.Time `gorm:"not null;index" json:"receivedAt"`
+	TaxCategory    string    `json:"taxCategory"`
+	IsFreelance    bool      `gorm:"default:false" json:"isFreelance"`
+
+	User         User         `gorm:"foreignKey:UserID" json:"-"`
+	IncomeStream IncomeStream `gorm:"foreignKey:IncomeStreamID" json:"-"`
+}
+
 type BehavioralPattern struct {
 	Base
-	UserID         string   `gorm:"type:uuid;not null;index" json:"userId"`
-	PatternType    string   `gorm:"not null" json:"patternType"`
-	Frequency      float64  `json:"frequency"`
-	TriggerFactors []string `gorm:"type:text[]" json:"triggerFactors"`
-	RiskLevel      string   `json:"riskLevel"`
-	Suggestions    JSON     `gorm:"type:jsonb" json:"suggestions"`
+	UserID         string      `gorm:"type:uuid;not null;index" json:"userId"`
+	PatternType    string      `gorm:"not null" json:"patternType"`
+	Frequency      float64     `json:"frequency"`
+	TriggerFactors StringArray `gorm:"type:text[]" json:"triggerFactors"`
+	RiskLevel      string      `json:"riskLevel"`
+	Suggestions    JSON        `gorm:"type:jsonb" json:"suggestions"`
 
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
 
 type Budget struct {
 	Base
-	UserID            string    `gorm:"type:uuid;not null;index" json:"userId"`
-	GroupID           *string   `gorm:"type:uuid;index" json:"groupId"`
-	Category          string    `gorm:"not null" json:"category"`
-	Tags              []string  `gorm:"type:text[];serializer:json" json:"tags"`
-	Amount            float64   `gorm:"not null" json:"amount"`
-	Period            string    `gorm:"not null" json:"period"`
-	StartDate         time.Time `gorm:"not null" json:"startDate"`
-	EndDate           time.Time `gorm:"not null" json:"endDate"`
-	CurrentSpent      float64   `gorm:"default:0" json:"currentSpent"`
-	AISuggestedAmount float64   `json:"aiSuggestedAmount"`
-	IsAutoAdjusting   bool      `gorm:"default:false" json:"isAutoAdjusting"`
+	UserID     string    `gorm:"type:uuid;not null;index" json:"userId"`
+	GroupID    *string   `gorm:"type:uuid;index" json:"groupId"`
+	Category   string    `gorm:"not null" json:"category"`
+	CategoryID *string   `gorm:"type:uuid;index" json:"categoryId"`
+	Tags       []string  `gorm:"type:text[];serializer:json" json:"tags"`
+	Amount     float64   `gorm:"not null" json:"amount"`
+	Period     string    `gorm:"not null" json:"period"`
+	StartDate  time.Time `gorm:"not null" json:"startDate"`
+	EndDate    time.Time `gorm:"not null" json:"endDate"`
+	// PeriodAnchor is the start of the first period; later periods are
+	// counted from it so month ends don't drift
+	PeriodAnchor      *time.Time `json:"periodAnchor,omitempty"`
+	CurrentSpent      float64    `gorm:"default:0" json:"currentSpent"`
+	AISuggestedAmount float64    `json:"aiSuggestedAmount"`
+	IsAutoAdjusting   bool       `gorm:"default:false" json:"isAutoAdjusting"`
+	AlertThresholds   []int      `gorm:"type:jsonb;serializer:json" json:"alertThresholds"`
 
 	User  User   `gorm:"foreignKey:UserID" json:"-"`
 	Group *Group `gorm:"foreignKey:GroupID" json:"group,omitempty"`
 }
+
+// BudgetAlert records that a spending threshold was crossed for a budget period,
+// so each threshold only triggers one alert per period.
+type BudgetAlert struct {
+	Base
+	BudgetID    string    `gorm:"type:uuid;not null;uniqueIndex:idx_budget_alert_period" json:"budgetId"`
+	Threshold   int       `gorm:"not null;uniqueIndex:idx_budget_alert_period" json:"threshold"`
+	PeriodStart time.Time `gorm:"not null;uniqueIndex:idx_budget_alert_period" json:"periodStart"`
+	Spent       float64   `json:"spent"`
+	TriggeredAt time.Time `gorm:"not null" json:"triggeredAt"`
+
+	Budget Budget `gorm:"foreignKey:BudgetID" json:"-"`
+}
+
+// BudgetAdjustment records an automatic change to an auto-adjusting budget at
+// rollover, together with the reasoning behind the new amount.
+type BudgetAdjustment struct {
+	Base
+	BudgetID        string    `gorm:"type:uuid;not null;index" json:"budgetId"`
+	PeriodStart     time.Time `gorm:"not null" json:"periodStart"`
+	PreviousAmount  float64   `json:"previousAmount"`
+	NewAmount       float64   `json:"newAmount"`
+	TrailingAverage float64   `json:"trailingAverage"`
+	SeasonalFactor  float64   `json:"seasonalFactor"`
+	PeriodIncome    float64   `json:"periodIncome"`
+	Reasons         []string  `gorm:"type:jsonb;serializer:json" json:"reasons"`
+
+	Budget Budget `gorm:"foreignKey:BudgetID" json:"-"`
+}
+
+// ContactLookup records a contact matching request for rate limiting
+type ContactLookup struct {
+	Base
+	UserID string `gorm:"type:uuid;not null;index" json:"userId"`
+	Hashes int    `gorm:"not null" json:"hashes"`
+}
@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"github.com/sukh-j-14/fingenie-main/internal/mail"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+// EmailNotifier delivers notifications to the user's email address
+type EmailNotifier struct {
+	mailer mail.Mailer
+}
+
+func NewEmailNotifier(mailer mail.Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer}
+}
+
+func (n *EmailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+func (n *EmailNotifier) Send(user models.User, msg Message) error {
+	return n.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: msg.Title,
+		Body:    msg.Body,
+	})
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// Notification channels. ChannelInApp is always delivered by storing a
+// models.Notification row.
+const (
+	ChannelInApp    = "in_app"
+	ChannelEmail    = "email"
+	ChannelPush     = "push"
+	ChannelTelegram = "telegram"
+	ChannelWhatsApp = "whatsapp"
+)
+
+// IsValidChannel reports whether users may opt into the given channel
+func IsValidChannel(channel string) bool {
+	switch channel {
+	case ChannelInApp, ChannelEmail, ChannelPush, ChannelTelegram, ChannelWhatsApp:
+		return true
+	}
+	return false
+}
+
+// Message is a channel-independent notification payload
+type Message struct {
+	Type  string                 `json:"type"`
+	Title string                 `json:"title"`
+	Body  string                 `json:"body"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// Notifier delivers a message to a user over a single external channel
+type Notifier interface {
+	Channel() string
+	Send(user models.User, msg Message) error
+}
+
+// Dispatcher stores every message in-app and fans it out to the channels each
+// user has configured in User.NotificationChannels.
+type Dispatcher struct {
+	db        *gorm.DB
+	notifiers map[string]Notifier
+}
+
+func NewDispatcher(db *gorm.DB, notifiers ...Notifier) *Dispatcher {
+	d := &Dispatcher{
+		db:        db,
+		notifiers: make(map[string]Notifier),
+	}
+	for _, n := range notifiers {
+		d.Register(n)
+	}
+	return d
+}
+
+// Register adds or replaces the notifier for its channel
+func (d *Dispatcher) Register(n Notifier) {
+	d.notifiers[n.Channel()] = n
+}
+
+// Notify sends msg to a single user. External channel failures are logged and
+// do not fail the call, since the in-app copy has already been stored.
+func (d *Dispatcher) Notify(userID string, msg Message) error {
+	var user models.User
+	if err := d.db.First(&user, "id = ?", userID).Error; err != nil {
+		return fmt.Errorf("could not load user %s: %w", userID, err)
+	}
+
+	var data models.JSON
+	if len(msg.Data) > 0 {
+		raw, err := json.Marshal(msg.Data)
+		if err != nil {
+			return fmt.Errorf("could not encode notification data: %w", err)
+		}
+		data = raw
+	}
+
+	notification := models.Notification{
+		UserID: user.ID,
+		Type:   msg.Type,
+		Title:  msg.Title,
+		Body:   msg.Body,
+		Data:   data,
+	}
+	if err := d.db.Create(&notification).Error; err != nil {
+		return fmt.Errorf("could not store notification: %w", err)
+	}
+
+	for _, channel := range user.NotificationChannels {
+		if channel == ChannelInApp {
+			continue
+		}
+		n, ok := d.notifiers[channel]
+		if !ok {
+			continue
+		}
+		if err := n.Send(user, msg); err != nil {
+			log.Printf("notify: %s delivery to user %s failed: %v", channel, user.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// NotifyAll sends msg to each user, continuing past individual failures
+func (d *Dispatcher) NotifyAll(userIDs []string, msg Message) error {
+	var firstErr error
+	for _, userID := range userIDs {
+		if err := d.Notify(userID, msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// LogNotifier writes messages to the server log. It is useful in development
+// for channels that have no real transport configured.
+type LogNotifier struct {
+	channel string
+}
+
+func NewLogNotifier(channel string) *LogNotifier {
+	return &LogNotifier{channel: channel}
+}
+
+func (n *LogNotifier) Channel() string {
+	return n.channel
+}
+
+func (n *LogNotifier) Send(user models.User, msg Message) error {
+	log.Printf("notify[%s] to %s: %s - %s", n.channel, user.ID, msg.Title, msg.Body)
+	return nil
+}
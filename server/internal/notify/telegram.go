@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"errors"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/telegram"
+)
+
+var ErrTelegramNotLinked = errors.New("user has not linked a Telegram chat")
+
+// TelegramNotifier delivers notifications to the user's linked Telegram chat
+type TelegramNotifier struct {
+	client *telegram.Client
+}
+
+func NewTelegramNotifier(client *telegram.Client) *TelegramNotifier {
+	return &TelegramNotifier{client: client}
+}
+
+func (n *TelegramNotifier) Channel() string {
+	return ChannelTelegram
+}
+
+func (n *TelegramNotifier) Send(user models.User, msg Message) error {
+	if user.TelegramID == "" {
+		return ErrTelegramNotLinked
+	}
+	return n.client.SendMessage(user.TelegramID, msg.Title+"\n\n"+msg.Body)
+}
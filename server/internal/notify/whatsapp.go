@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"errors"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/whatsapp"
+)
+
+var ErrWhatsAppNotLinked = errors.New("user has not linked a WhatsApp number")
+
+// WhatsAppNotifier delivers notifications to the user's linked WhatsApp
+// number. WhatsApp only allows business-initiated messages as approved
+// templates, so every message is sent through one template that takes the
+// title and body as parameters.
+type WhatsAppNotifier struct {
+	client   *whatsapp.Client
+	template string
+	language string
+}
+
+func NewWhatsAppNotifier(client *whatsapp.Client, template, language string) *WhatsAppNotifier {
+	return &WhatsAppNotifier{client: client, template: template, language: language}
+}
+
+func (n *WhatsAppNotifier) Channel() string {
+	return ChannelWhatsApp
+}
+
+func (n *WhatsAppNotifier) Send(user models.User, msg Message) error {
+	if user.WhatsappNumber == "" || user.WhatsappVerifiedAt == nil {
+		return ErrWhatsAppNotLinked
+	}
+	return n.client.SendTemplate(user.WhatsappNumber, n.template, n.language, msg.Title, msg.Body)
+}
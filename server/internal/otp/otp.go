@@ -0,0 +1,215 @@
+package otp
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	CodeLength  = 6
+	CodeTTL     = 10 * time.Minute
+	MaxAttempts = 5
+	// ResendDelay is the minimum time between two codes to the same number
+	ResendDelay = time.Minute
+	// MaxPerHour caps the codes sent to one number for one purpose per hour
+	MaxPerHour = 5
+)
+
+var (
+	ErrInvalidPhone    = errors.New("invalid phone number")
+	ErrInvalidCode     = errors.New("invalid code")
+	ErrExpiredCode     = errors.New("code has expired")
+	ErrTooManyAttempts = errors.New("too many attempts")
+	ErrTooManyRequests = errors.New("too many codes requested")
+)
+
+// SMSSender delivers text messages
+type SMSSender interface {
+	Send(to, body string) error
+}
+
+// LogSMSSender writes messages to the server log. It stands in for a real SMS
+// provider during development.
+type LogSMSSender struct{}
+
+func NewLogSMSSender() *LogSMSSender {
+	return &LogSMSSender{}
+}
+
+func (s *LogSMSSender) Send(to, body string) error {
+	log.Printf("sms to %s: %s", to, body)
+	return nil
+}
+
+// NormalizePhone strips formatting from a phone number and checks it is in
+// international (E.164) form, e.g. "+91 98765-43210" -> "+919876543210"
+func NormalizePhone(phone string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	normalized := b.String()
+	if !strings.HasPrefix(normalized, "+") || len(normalized) < 9 || len(normalized) > 16 {
+		return "", ErrInvalidPhone
+	}
+	return normalized, nil
+}
+
+// Service sends one-time codes by SMS and checks them
+type Service struct {
+	db  *gorm.DB
+	sms SMSSender
+	now func() time.Time
+}
+
+func NewService(db *gorm.DB, sms SMSSender) *Service {
+	return &Service{
+		db:  db,
+		sms: sms,
+		now: time.Now,
+	}
+}
+
+// Send texts a new code to the phone number. userID is the account the code
+// is for and may be empty when it's not known yet. Any earlier code for the
+// same number, purpose and account stops working; codes other accounts are
+// waiting on for the number keep working.
+func (s *Service) Send(phone, purpose, userID string) error {
+	now := s.now()
+
+	var recent []models.PhoneOTP
+	if err := s.db.Where("phone_number = ? AND purpose = ? AND created_at > ?", phone, purpose, now.Add(-time.Hour)).
+		Order("created_at DESC").
+		Find(&recent).Error; err != nil {
+		return fmt.Errorf("could not load recent codes: %w", err)
+	}
+	if len(recent) >= MaxPerHour || (len(recent) > 0 && now.Sub(recent[0].CreatedAt) < ResendDelay) {
+		return ErrTooManyRequests
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	record := models.PhoneOTP{
+		PhoneNumber: phone,
+		Purpose:     purpose,
+		CodeHash:    string(hash),
+		ExpiresAt:   now.Add(CodeTTL),
+	}
+	if userID != "" {
+		record.UserID = &userID
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := forUser(tx.Model(&models.PhoneOTP{}), userID).
+			Where("phone_number = ? AND purpose = ? AND consumed_at IS NULL", phone, purpose).
+			Update("consumed_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not store code: %w", err)
+	}
+
+	body := fmt.Sprintf("Your FinGenie code is %s. It expires in %d minutes. Don't share it with anyone.", code, int(CodeTTL.Minutes()))
+	if err := s.sms.Send(phone, body); err != nil {
+		return fmt.Errorf("could not send code: %w", err)
+	}
+	return nil
+}
+
+// Verify checks a code against the latest one sent to the number for userID,
+// empty as in Send, and marks it used. After MaxAttempts wrong guesses the
+// code is burned and a new one has to be requested.
+func (s *Service) Verify(phone, purpose, userID, code string) (*models.PhoneOTP, error) {
+	now := s.now()
+
+	var record models.PhoneOTP
+	if err := forUser(s.db, userID).Where("phone_number = ? AND purpose = ? AND consumed_at IS NULL", phone, purpose).
+		Order("created_at DESC").
+		First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCode
+		}
+		return nil, err
+	}
+	if now.After(record.ExpiresAt) {
+		return nil, ErrExpiredCode
+	}
+	if record.Attempts >= MaxAttempts {
+		return nil, ErrTooManyAttempts
+	}
+
+	// Count the attempt before comparing so concurrent guesses can't exceed
+	// the limit
+	result := s.db.Model(&models.PhoneOTP{}).
+		Where("id = ? AND attempts < ?", record.ID, MaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTooManyAttempts
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(record.CodeHash), []byte(strings.TrimSpace(code))) != nil {
+		return nil, ErrInvalidCode
+	}
+
+	result = s.db.Model(&models.PhoneOTP{}).
+		Where("id = ? AND consumed_at IS NULL", record.ID).
+		Update("consumed_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidCode
+	}
+	return &record, nil
+}
+
+// forUser limits a query to the codes of userID, or to codes for no account
+// when it's empty
+func forUser(db *gorm.DB, userID string) *gorm.DB {
+	if userID == "" {
+		return db.Where("user_id IS NULL")
+	}
+	return db.Where("user_id = ?", userID)
+}
+
+func generateCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < CodeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", CodeLength, n), nil
+}
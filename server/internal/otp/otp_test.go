@@ -0,0 +1,123 @@
+package otp
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+const (
+	phone = "+919876543210"
+	asha  = "00000000-0000-4000-8000-0000000000a1"
+	ravi  = "00000000-0000-4000-8000-0000000000a2"
+)
+
+// inbox keeps the codes texted to each number
+type inbox map[string][]string
+
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+func (in inbox) Send(to, body string) error {
+	in[to] = append(in[to], codePattern.FindString(body))
+	return nil
+}
+
+func (in inbox) last(to string) string {
+	return in[to][len(in[to])-1]
+}
+
+// newService returns a service whose clock moves past ResendDelay with every
+// code sent
+func newService() (*Service, inbox) {
+	db, _ := dbtest.Open()
+	sms := inbox{}
+	s := NewService(db, sms)
+	now := time.Now()
+	s.now = func() time.Time {
+		now = now.Add(ResendDelay + time.Second)
+		return now
+	}
+	return s, sms
+}
+
+func TestSendKeepsOtherAccountsCodes(t *testing.T) {
+	s, sms := newService()
+	if err := s.Send(phone, models.PurposePhoneVerification, asha); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	ashaCode := sms.last(phone)
+	// Someone else claims the number on their account
+	if err := s.Send(phone, models.PurposePhoneVerification, ravi); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	record, err := s.Verify(phone, models.PurposePhoneVerification, asha, ashaCode)
+	if err != nil {
+		t.Fatalf("Verify of the first account's code = %v, want it still valid", err)
+	}
+	if record.UserID == nil || *record.UserID != asha {
+		t.Errorf("verified a code for %v, want %s", record.UserID, asha)
+	}
+	if _, err := s.Verify(phone, models.PurposePhoneVerification, ravi, ashaCode); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("one account's code for another = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestSendReplacesOwnCode(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+	}{
+		{"account", asha},
+		{"no account", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, sms := newService()
+			if err := s.Send(phone, models.PurposePhoneLogin, tt.user); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			first := sms.last(phone)
+			if err := s.Send(phone, models.PurposePhoneLogin, tt.user); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			second := sms.last(phone)
+
+			if first != second {
+				if _, err := s.Verify(phone, models.PurposePhoneLogin, tt.user, first); !errors.Is(err, ErrInvalidCode) {
+					t.Errorf("replaced code = %v, want ErrInvalidCode", err)
+				}
+			}
+			if _, err := s.Verify(phone, models.PurposePhoneLogin, tt.user, second); err != nil {
+				t.Errorf("new code = %v, want it valid", err)
+			}
+			if _, err := s.Verify(phone, models.PurposePhoneLogin, tt.user, second); !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("code used twice = %v, want ErrInvalidCode", err)
+			}
+		})
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := map[string]string{
+		"+91 98765-43210":    "+919876543210",
+		" +1 (415) 555.0100": "+14155550100",
+		"9876543210":         "",
+		"+91 98765 4321x":    "",
+		"+1234":              "",
+	}
+	for in, want := range tests {
+		got, err := NormalizePhone(in)
+		if want == "" {
+			if !errors.Is(err, ErrInvalidPhone) {
+				t.Errorf("NormalizePhone(%q) = %q, %v; want ErrInvalidPhone", in, got, err)
+			}
+		} else if got != want || err != nil {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package parse
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/budget"
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/policy"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
+	"gorm.io/gorm"
+)
+
+// LoadContext collects the user and the active groups they belong to, with
+// their other members, for Expense. A groupID the user isn't an active
+// member of gives policy.ErrNotFound.
+func LoadContext(db *gorm.DB, userID, groupID string) (Context, error) {
+	var user models.User
+	if err := db.First(&user, "id = ?", userID).Error; err != nil {
+		return Context{}, err
+	}
+
+	var groups []models.Group
+	if err := db.Where("id IN (?)", policy.New(db).MemberGroups(userID)).
+		Preload("Members", "is_active = ?", true).
+		Preload("Members.User").
+		Order("name").
+		Find(&groups).Error; err != nil {
+		return Context{}, err
+	}
+
+	ctx := Context{
+		Self:            member(user),
+		GroupID:         groupID,
+		DefaultCurrency: user.PreferredCurrency,
+	}
+	found := groupID == ""
+	for _, g := range groups {
+		group := Group{ID: g.ID, Name: g.Name, DefaultCurrency: g.DefaultCurrency}
+		for _, m := range g.Members {
+			if m.UserID != userID {
+				group.Members = append(group.Members, member(m.User))
+			}
+		}
+		ctx.Groups = append(ctx.Groups, group)
+		found = found || g.ID == groupID
+	}
+	if !found {
+		return Context{}, policy.ErrNotFound
+	}
+	return ctx, nil
+}
+
+func member(user models.User) Member {
+	m := Member{UserID: user.ID, DisplayName: user.DisplayName}
+	if user.Handle != nil {
+		m.Handle = *user.Handle
+	}
+	return m
+}
+
+// ApplyRules replaces the parser's keyword guess with the user's category
+// rules, which are more specific, when one matches the description
+func (d *Draft) ApplyRules(m *categorize.Matcher) {
+	m.Match(d.Expense.Description).Apply(&d.Expense.Category, &d.Expense.Tags)
+}
+
+// Save records a confirmed draft: the expense and, when it has shares, its
+// split. Splits are due in a week.
+func Save(db *gorm.DB, budgets *budget.Tracker, userID string, draft *Draft) (*models.Expense, error) {
+	if len(draft.Unresolved) > 0 {
+		return nil, errors.New("draft has unresolved names")
+	}
+
+	now := time.Now()
+	expense := models.Expense{
+		UserID:           userID,
+		Amount:           draft.Expense.Amount,
+		OriginalCurrency: draft.Expense.OriginalCurrency,
+		Category:         draft.Expense.Category,
+		Description:      draft.Expense.Description,
+		Date:             now,
+		Tags:             draft.Expense.Tags,
+	}
+	if draft.Expense.Date != nil && !draft.Expense.Date.IsZero() {
+		expense.Date = *draft.Expense.Date
+	}
+	if draft.Expense.GroupID != "" {
+		expense.GroupID = &draft.Expense.GroupID
+	}
+	category, err := taxonomy.New(db).FindOrOther(taxonomy.ScopeOf(userID, expense.GroupID), expense.Category)
+	if err != nil {
+		return nil, err
+	}
+	expense.Category, expense.CategoryID = category.Name, &category.ID
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&expense).Error; err != nil {
+			return err
+		}
+		if len(draft.Shares) == 0 || expense.GroupID == nil {
+			return nil
+		}
+
+		split := models.SplitExpense{
+			GroupID:      *expense.GroupID,
+			ExpenseID:    expense.ID,
+			CreatedBy:    userID,
+			TotalAmount:  expense.Amount,
+			SplitType:    draft.Expense.SplitType,
+			GraceEndDate: now.AddDate(0, 0, 7),
+			DueDate:      now.AddDate(0, 0, 7),
+		}
+		if err := tx.Create(&split).Error; err != nil {
+			return err
+		}
+		for _, share := range draft.Shares {
+			if err := tx.Create(&models.SplitShare{
+				SplitExpenseID: split.ID,
+				UserID:         share.UserID,
+				Amount:         share.Amount,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	budgets.ExpenseChanged(expense)
+	return &expense, nil
+}
@@ -0,0 +1,809 @@
+// Package parse reads expenses people describe in words, such as "paid 1200
+// for dinner with Asha and Ravi, split equally", into drafts to confirm.
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+// ErrNoAmount is returned when a message doesn't contain an amount
+var ErrNoAmount = errors.New("no amount found")
+
+// Member is someone an expense can be split with
+type Member struct {
+	UserID      string `json:"userId"`
+	DisplayName string `json:"displayName"`
+	Handle      string `json:"handle,omitempty"`
+}
+
+// Group is a group the author belongs to, with its other members
+type Group struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	DefaultCurrency string   `json:"defaultCurrency"`
+	Members         []Member `json:"members"`
+}
+
+// Context is what Expense resolves names against. Self is the
+// person who paid. GroupID, when set, restricts names to that group;
+// otherwise the group is picked from an "in <group>" phrase or from the
+// people named.
+type Context struct {
+	Self            Member
+	Groups          []Group
+	GroupID         string
+	DefaultCurrency string
+}
+
+// Draft is a parsed expense for the user to confirm. Shares is empty for
+// personal expenses and whenever a name couldn't be resolved; such names are
+// listed in Unresolved.
+type Draft struct {
+	Expense    Details  `json:"expense"`
+	Shares     []Share  `json:"shares,omitempty"`
+	GroupName  string   `json:"groupName,omitempty"`
+	Unresolved []string `json:"unresolved,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// Details are the fields of a drafted expense, named as clients send them
+// when creating it
+type Details struct {
+	Amount           float64    `json:"amount"`
+	Category         string     `json:"category"`
+	GroupID          string     `json:"groupId"`
+	Description      string     `json:"description"`
+	OriginalCurrency string     `json:"originalCurrency"`
+	SplitType        string     `json:"splitType"`
+	Tags             []string   `json:"tags"`
+	Date             *time.Time `json:"date,omitempty"`
+}
+
+// Share is one person's part of a drafted split
+type Share struct {
+	UserID      string  `json:"userId"`
+	Amount      float64 `json:"amount"`
+	DisplayName string  `json:"displayName"`
+}
+
+// currencies maps symbols, codes and words to ISO codes
+var currencies = map[string]string{
+	"₹": "INR", "rs": "INR", "rs.": "INR", "inr": "INR", "rupee": "INR", "rupees": "INR",
+	"$": "USD", "usd": "USD", "dollar": "USD", "dollars": "USD", "bucks": "USD",
+	"€": "EUR", "eur": "EUR", "euro": "EUR", "euros": "EUR",
+	"£": "GBP", "gbp": "GBP", "pound": "GBP", "pounds": "GBP",
+	"aed": "AED", "dirham": "AED", "dirhams": "AED",
+	"sgd": "SGD", "aud": "AUD", "cad": "CAD", "jpy": "JPY", "yen": "JPY",
+}
+
+// categoryKeywords maps words in a description to a category
+var categoryKeywords = map[string]string{
+	"breakfast": "Food", "lunch": "Food", "dinner": "Food", "brunch": "Food", "food": "Food",
+	"restaurant": "Food", "pizza": "Food", "coffee": "Food", "snacks": "Food", "drinks": "Food",
+	"takeaway": "Food", "swiggy": "Food", "zomato": "Food",
+	"groceries": "Groceries", "grocery": "Groceries", "supermarket": "Groceries",
+	"vegetables": "Groceries", "milk": "Groceries",
+	"taxi": "Transport", "cab": "Transport", "uber": "Transport", "ola": "Transport",
+	"auto": "Transport", "bus": "Transport", "train": "Transport", "metro": "Transport",
+	"fuel": "Transport", "petrol": "Transport", "diesel": "Transport", "parking": "Transport",
+	"flight": "Travel", "flights": "Travel", "hotel": "Travel", "trip": "Travel", "airbnb": "Travel",
+	"rent":        "Rent",
+	"electricity": "Utilities", "water": "Utilities", "wifi": "Utilities", "internet": "Utilities",
+	"broadband": "Utilities", "gas": "Utilities", "utilities": "Utilities", "bill": "Utilities",
+	"movie": "Entertainment", "movies": "Entertainment", "concert": "Entertainment",
+	"netflix": "Entertainment", "tickets": "Entertainment", "party": "Entertainment",
+	"shopping": "Shopping", "clothes": "Shopping", "gift": "Shopping", "gifts": "Shopping",
+	"medicine": "Health", "medicines": "Health", "doctor": "Health", "pharmacy": "Health",
+	"gym": "Health",
+}
+
+// DefaultCategory is used when no keyword matches
+const DefaultCategory = "Other"
+
+var (
+	numberPattern = regexp.MustCompile(`^(\d{1,3}(,\d{3})+|\d+)(\.\d{1,2})?(k)?$`)
+	ratioPattern  = regexp.MustCompile(`^\d+(\.\d+)?%?([/:-]\d+(\.\d+)?%?)+$`)
+)
+
+var (
+	splitWords  = map[string]bool{"split": true, "divide": true, "divided": true, "shared": true, "share": true}
+	equalWords  = map[string]bool{"equally": true, "evenly": true, "equal": true, "even": true}
+	selfWords   = map[string]bool{"me": true, "i": true, "myself": true}
+	allWords    = map[string]bool{"everyone": true, "everybody": true, "all": true, "group": true, "the group": true, "whole group": true}
+	separators  = map[string]bool{",": true, "and": true, "&": true, "+": true}
+	fillerWords = map[string]bool{
+		"it": true, "the": true, "bill": true, "cost": true, "between": true, "among": true,
+		"amongst": true, "with": true, "as": true, "by": true, "into": true, "ways": true, "way": true,
+		"rest": true, "remaining": true, "remainder": true, "others": true, "of": true, "us": true,
+	}
+	leadingWords = map[string]bool{
+		"i": true, "paid": true, "pay": true, "spent": true, "spend": true, "add": true, "/add": true,
+		"expense": true, "an": true, "a": true,
+	}
+	articleWords = map[string]bool{"a": true, "an": true, "the": true, "our": true, "my": true, "some": true}
+	countWords   = map[string]bool{
+		"two": true, "three": true, "four": true, "five": true, "six": true,
+		"seven": true, "eight": true, "nine": true, "ten": true,
+	}
+)
+
+type word struct {
+	text  string // as typed
+	lower string
+}
+
+// splitPart is a name from the split phrase with an optional amount or
+// percentage
+type splitPart struct {
+	name    string
+	value   float64
+	percent bool
+	hasVal  bool
+}
+
+// parsed is the structure of a message before names are resolved
+type parsed struct {
+	amount      float64
+	currency    string
+	description []word
+	names       []string
+	groupName   string
+	split       bool
+	ratio       []float64
+	ratioPct    bool
+	parts       []splitPart
+}
+
+// Expense turns a message like "paid 1200 for dinner with Asha and
+// Ravi, split equally" into a draft expense. It understands amounts with
+// optional currencies ("₹1,200", "20 dollars", "1.5k"), picks a category
+// from keywords in the description, resolves names against the groups in
+// ctx and reads split phrases: "split equally", ratios ("60/40", "2:1:1",
+// in the order the payer, then the people named) and per-person amounts or
+// percentages ("split asha 300, ravi 500" or "asha 30%"). Without a split
+// phrase an expense with other people is split equally. The payer always
+// takes part. Parsing is deterministic and needs no network.
+func Expense(text string, ctx Context) (*Draft, error) {
+	p, err := parse(tokenize(text), ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	draft := &Draft{
+		Expense: Details{
+			Amount:           p.amount,
+			OriginalCurrency: p.currency,
+			Description:      describe(p.description),
+			Category:         keywordCategory(p.description),
+		},
+	}
+
+	group, people, err := pickGroup(p, ctx, draft)
+	if err != nil {
+		return nil, err
+	}
+	if group != nil {
+		draft.Expense.GroupID = group.ID
+		draft.GroupName = group.Name
+		if draft.Expense.OriginalCurrency == "" {
+			draft.Expense.OriginalCurrency = group.DefaultCurrency
+		}
+	}
+	if draft.Expense.OriginalCurrency == "" {
+		draft.Expense.OriginalCurrency = ctx.DefaultCurrency
+	}
+	if len(draft.Unresolved) > 0 || len(people) < 2 {
+		return draft, nil
+	}
+
+	if err := splitDraft(draft, p, people); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// tokenize splits on spaces and commas, keeping commas inside numbers such
+// as "1,200" and dropping trailing punctuation
+func tokenize(text string) []word {
+	var b strings.Builder
+	runes := []rune(text)
+	for i, r := range runes {
+		if r == ',' && !(i > 0 && i+1 < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1])) {
+			b.WriteString(" , ")
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	var words []word
+	for _, f := range strings.Fields(b.String()) {
+		f = strings.TrimRight(f, "?!.;")
+		if f == "" {
+			continue
+		}
+		words = append(words, word{text: f, lower: strings.ToLower(f)})
+	}
+	return words
+}
+
+func parse(words []word, ctx Context) (*parsed, error) {
+	p := &parsed{}
+
+	// Everything after "split" describes how to split
+	main, clause := words, []word(nil)
+	for i, w := range words {
+		if splitWords[w.lower] {
+			main, clause = words[:i], words[i+1:]
+			p.split = true
+			break
+		}
+	}
+
+	// The amount is the first number with a currency, or else the first
+	// number, so "2 pizzas for ₹800" reads as 800
+	at, n := -1, 0
+	for i := range main {
+		if amount, currency, used, ok := readMoney(main, i); ok && (at < 0 || currency != "" && p.currency == "") {
+			at, n = i, used
+			p.amount, p.currency = amount, currency
+			if currency != "" {
+				break
+			}
+		}
+	}
+	if at < 0 {
+		return nil, ErrNoAmount
+	}
+
+	var rest []word
+	for i, w := range main {
+		switch {
+		case i >= at && i < at+n:
+		case equalWords[w.lower]:
+			p.split = true
+		default:
+			rest = append(rest, w)
+		}
+	}
+
+	rest = takeGroupName(rest, ctx, p)
+
+	// "with a, b and c" lists the people, up to a "for" or "on" starting
+	// the description
+	for i, w := range rest {
+		if w.lower != "with" {
+			continue
+		}
+		end := len(rest)
+		for j := i + 1; j < len(rest); j++ {
+			if rest[j].lower == "for" || rest[j].lower == "on" {
+				end = j
+				break
+			}
+		}
+		p.names = nameList(rest[i+1 : end])
+		rest = append(rest[:i:i], rest[end:]...)
+		break
+	}
+
+	// The description follows "for" or "on"; otherwise it's what is left
+	for len(rest) > 0 && (leadingWords[rest[0].lower] || rest[0].lower == ",") {
+		rest = rest[1:]
+	}
+	for i, w := range rest {
+		if (w.lower == "for" || w.lower == "on") && i+1 < len(rest) {
+			rest = rest[i+1:]
+			break
+		}
+		if w.lower == "for" || w.lower == "on" {
+			rest = rest[:i]
+		}
+	}
+	for len(rest) > 0 && (articleWords[rest[0].lower] || rest[0].lower == ",") {
+		rest = rest[1:]
+	}
+	for len(rest) > 0 && rest[len(rest)-1].lower == "," {
+		rest = rest[:len(rest)-1]
+	}
+	p.description = rest
+
+	if err := parseSplit(clause, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// moneyPrefixes are currencies that can be written stuck to the number,
+// longest first
+var moneyPrefixes = []string{"rs.", "rs", "₹", "$", "€", "£"}
+
+// readMoney reads an amount at words[i] with an optional currency before or
+// after it. It returns how many words were used.
+func readMoney(words []word, i int) (float64, string, int, bool) {
+	token := words[i].lower
+
+	// A currency word before the number: "rs 500", "usd 20"
+	if code, ok := currencies[token]; ok {
+		if i+1 < len(words) {
+			if amount, ok := readNumber(words[i+1].lower); ok {
+				return amount, code, 2, true
+			}
+		}
+		return 0, "", 0, false
+	}
+
+	// A symbol stuck to the number: "₹500", "$20", "rs.500"
+	for _, prefix := range moneyPrefixes {
+		if strings.HasPrefix(token, prefix) && len(token) > len(prefix) {
+			if amount, ok := readNumber(token[len(prefix):]); ok {
+				return amount, currencies[prefix], 1, true
+			}
+		}
+	}
+
+	amount, ok := readNumber(token)
+	if !ok {
+		return 0, "", 0, false
+	}
+	if i+1 < len(words) {
+		if code, ok := currencies[words[i+1].lower]; ok {
+			return amount, code, 2, true
+		}
+	}
+	return amount, "", 1, true
+}
+
+// readNumber reads "1200", "1,200", "99.50" or "1.5k"
+func readNumber(s string) (float64, bool) {
+	m := numberPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", "")+m[3], 64)
+	if err != nil {
+		return 0, false
+	}
+	if m[4] != "" {
+		amount *= 1000
+	}
+	amount = math.Round(amount*100) / 100
+	return amount, amount > 0
+}
+
+// takeGroupName removes an "in <group name>" phrase naming one of the
+// author's groups
+func takeGroupName(words []word, ctx Context, p *parsed) []word {
+	for i, w := range words {
+		if w.lower != "in" {
+			continue
+		}
+		for _, g := range ctx.Groups {
+			name := strings.Fields(strings.ToLower(g.Name))
+			if len(name) == 0 || i+1+len(name) > len(words) {
+				continue
+			}
+			match := true
+			for j, n := range name {
+				if words[i+1+j].lower != n {
+					match = false
+					break
+				}
+			}
+			if match {
+				p.groupName = g.Name
+				return append(words[:i:i], words[i+1+len(name):]...)
+			}
+		}
+	}
+	return words
+}
+
+// nameList reads "asha, ravi and priya rao" into names
+func nameList(words []word) []string {
+	var names []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			names = append(names, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	for _, w := range words {
+		switch {
+		case separators[w.lower]:
+			flush()
+		case articleWords[w.lower] && len(current) == 0:
+		default:
+			current = append(current, w.lower)
+		}
+	}
+	flush()
+	return names
+}
+
+// parseSplit reads the words after "split"
+func parseSplit(words []word, p *parsed) error {
+	var part splitPart
+	var name []string
+	flush := func() {
+		if len(name) > 0 || part.hasVal {
+			part.name = strings.Join(name, " ")
+			p.parts = append(p.parts, part)
+		}
+		part, name = splitPart{}, nil
+	}
+
+	for _, w := range words {
+		switch {
+		case equalWords[w.lower], fillerWords[w.lower] && len(name) == 0:
+		case countWords[w.lower] && len(name) == 0 && !part.hasVal:
+			// "split three ways" repeats the head count
+		case ratioPattern.MatchString(w.lower) && len(name) == 0:
+			ratio, pct := readRatio(w.lower)
+			if ratio == nil {
+				return fmt.Errorf("can't read the split %q", w.text)
+			}
+			p.ratio, p.ratioPct = ratio, pct
+		case separators[w.lower]:
+			flush()
+		default:
+			token := strings.TrimPrefix(w.lower, "₹")
+			token = strings.TrimPrefix(strings.TrimPrefix(token, "$"), "€")
+			token = strings.TrimPrefix(token, "£")
+			percent := strings.HasSuffix(token, "%")
+			if value, ok := readNumber(strings.TrimSuffix(token, "%")); ok {
+				if len(name) == 0 && !part.hasVal {
+					// "split 3 ways" repeats the head count
+					continue
+				}
+				part.value, part.percent, part.hasVal = value, percent, true
+				flush()
+				continue
+			}
+			if _, ok := currencies[w.lower]; ok {
+				continue
+			}
+			if part.hasVal {
+				flush()
+			}
+			name = append(name, w.lower)
+		}
+	}
+	flush()
+
+	for _, part := range p.parts {
+		if part.name == "" {
+			return errors.New("each amount in the split needs a name, e.g. \"split asha 300, ravi 500\"")
+		}
+	}
+	return nil
+}
+
+// readRatio reads "60/40", "2:1:1" or "50-50". It reports whether the parts
+// are percentages, i.e. they add up to 100 or carry a % sign.
+func readRatio(s string) ([]float64, bool) {
+	pct := strings.Contains(s, "%")
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == ':' || r == '-' })
+	ratio := make([]float64, len(fields))
+	sum := 0.0
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(f, "%"), 64)
+		if err != nil || v < 0 {
+			return nil, false
+		}
+		ratio[i] = v
+		sum += v
+	}
+	if sum <= 0 {
+		return nil, false
+	}
+	return ratio, pct || math.Abs(sum-100) < 0.001
+}
+
+// Category picks the category of a description from its keywords, or
+// DefaultCategory
+func Category(description string) string {
+	return keywordCategory(tokenize(description))
+}
+
+func describe(words []word) string {
+	texts := make([]string, len(words))
+	for i, w := range words {
+		texts[i] = w.text
+	}
+	return strings.Join(texts, " ")
+}
+
+func keywordCategory(words []word) string {
+	for _, w := range words {
+		if category, ok := categoryKeywords[w.lower]; ok {
+			return category
+		}
+		if category, ok := categoryKeywords[strings.TrimSuffix(w.lower, "s")]; ok {
+			return category
+		}
+	}
+	return DefaultCategory
+}
+
+// pickGroup chooses the expense's group and resolves the people it is split
+// with. The payer comes first.
+func pickGroup(p *parsed, ctx Context, draft *Draft) (*Group, []Member, error) {
+	names := append([]string(nil), p.names...)
+	for _, part := range p.parts {
+		names = append(names, part.name)
+	}
+
+	var candidates []Group
+	for _, g := range ctx.Groups {
+		switch {
+		case ctx.GroupID != "":
+			if g.ID == ctx.GroupID {
+				candidates = append(candidates, g)
+			}
+		case p.groupName != "":
+			if g.Name == p.groupName {
+				candidates = append(candidates, g)
+			}
+		default:
+			candidates = append(candidates, g)
+		}
+	}
+	if ctx.GroupID != "" && len(candidates) == 0 {
+		return nil, nil, errors.New("group not found")
+	}
+	if len(names) == 0 && !(p.split && (ctx.GroupID != "" || p.groupName != "")) {
+		if len(candidates) == 1 && (ctx.GroupID != "" || p.groupName != "") {
+			return &candidates[0], nil, nil
+		}
+		return nil, nil, nil
+	}
+
+	// Without names, a split covers the whole group
+	if len(names) == 0 {
+		names = []string{"everyone"}
+	}
+
+	var matching []Group
+	var best []string
+	for _, g := range candidates {
+		unresolved := unresolvedNames(names, ctx.Self, g.Members)
+		if len(unresolved) == 0 {
+			matching = append(matching, g)
+		}
+		if best == nil || len(unresolved) < len(best) {
+			best = unresolved
+		}
+	}
+
+	switch len(matching) {
+	case 0:
+		if len(candidates) == 0 {
+			best = names
+		}
+		draft.Unresolved = best
+		if len(candidates) == 1 {
+			return &candidates[0], nil, nil
+		}
+		return nil, nil, nil
+	case 1:
+	default:
+		groupNames := make([]string, len(matching))
+		for i, g := range matching {
+			groupNames[i] = g.Name
+		}
+		sort.Strings(groupNames)
+		draft.Warnings = append(draft.Warnings, fmt.Sprintf(
+			"These people are in more than one of your groups (%s); say which with \"in <group>\".", strings.Join(groupNames, ", ")))
+	}
+
+	group := matching[0]
+	people := []Member{ctx.Self}
+	seen := map[string]bool{ctx.Self.UserID: true}
+	for _, n := range names {
+		for _, m := range resolve(n, ctx.Self, group.Members) {
+			if !seen[m.UserID] {
+				seen[m.UserID] = true
+				people = append(people, m)
+			}
+		}
+	}
+	return &group, people, nil
+}
+
+func unresolvedNames(names []string, self Member, members []Member) []string {
+	unresolved := []string{}
+	for _, n := range names {
+		if resolve(n, self, members) == nil {
+			unresolved = append(unresolved, n)
+		}
+	}
+	return unresolved
+}
+
+// resolve finds who a name refers to: a handle, then a full display name,
+// then a first name shared by no one else. It returns nil when the name is
+// unknown or ambiguous.
+func resolve(name string, self Member, members []Member) []Member {
+	name = strings.TrimPrefix(strings.ToLower(name), "@")
+	if selfWords[name] {
+		return []Member{self}
+	}
+	if allWords[name] {
+		if len(members) == 0 {
+			return nil
+		}
+		return members
+	}
+
+	for _, m := range members {
+		if m.Handle != "" && strings.ToLower(m.Handle) == name {
+			return []Member{m}
+		}
+	}
+	var byName, byFirst []Member
+	for _, m := range members {
+		full := strings.ToLower(strings.TrimSpace(m.DisplayName))
+		if full == name {
+			byName = append(byName, m)
+		}
+		if first := strings.Fields(full); len(first) > 0 && first[0] == name {
+			byFirst = append(byFirst, m)
+		}
+	}
+	if len(byName) == 1 {
+		return byName
+	}
+	if len(byName) == 0 && len(byFirst) == 1 {
+		return byFirst
+	}
+	return nil
+}
+
+// splitDraft works out each person's share in cents so shares always add up
+// to the total
+func splitDraft(draft *Draft, p *parsed, people []Member) error {
+	total := int64(math.Round(draft.Expense.Amount * 100))
+	var cents []int64
+
+	switch {
+	case p.ratio != nil:
+		if len(p.ratio) != len(people) {
+			return fmt.Errorf("the split has %d parts but %d people are sharing; list yourself first, then the others in order", len(p.ratio), len(people))
+		}
+		cents = Allocate(total, p.ratio)
+		draft.Expense.SplitType = string(models.SplitTypeShares)
+		if p.ratioPct {
+			draft.Expense.SplitType = string(models.SplitTypePercentage)
+		}
+	case len(p.parts) > 0 && hasValues(p.parts):
+		var err error
+		cents, err = customShares(total, p.parts, people, draft)
+		if err != nil {
+			return err
+		}
+	default:
+		weights := make([]float64, len(people))
+		for i := range weights {
+			weights[i] = 1
+		}
+		cents = Allocate(total, weights)
+		draft.Expense.SplitType = string(models.SplitTypeEqual)
+	}
+
+	for i, m := range people {
+		draft.Shares = append(draft.Shares, Share{UserID: m.UserID, Amount: float64(cents[i]) / 100, DisplayName: m.DisplayName})
+	}
+	return nil
+}
+
+func hasValues(parts []splitPart) bool {
+	for _, part := range parts {
+		if part.hasVal {
+			return true
+		}
+	}
+	return false
+}
+
+// customShares applies "asha 300, ravi 500" or "asha 30%". People without a
+// value split what is left equally.
+func customShares(total int64, parts []splitPart, people []Member, draft *Draft) ([]int64, error) {
+	values := make([]float64, len(people))
+	given := make([]bool, len(people))
+	percent, seen := false, false
+
+	for _, part := range parts {
+		if !part.hasVal {
+			continue
+		}
+		if seen && part.percent != percent {
+			return nil, errors.New("use either amounts or percentages in a split, not both")
+		}
+		percent, seen = part.percent, true
+		for _, m := range resolve(part.name, people[0], people[1:]) {
+			for j, person := range people {
+				if person.UserID == m.UserID {
+					values[j], given[j] = part.value, true
+				}
+			}
+		}
+	}
+
+	whole := float64(total) / 100
+	if percent {
+		whole = 100
+	}
+	assigned, open := 0.0, 0
+	for i := range people {
+		if given[i] {
+			assigned += values[i]
+		} else {
+			open++
+		}
+	}
+	left := whole - assigned
+	if left < -0.001 || (open == 0 && math.Abs(left) > 0.001) {
+		if percent {
+			return nil, errors.New("the percentages must add up to 100")
+		}
+		return nil, fmt.Errorf("the amounts add up to %.2f but the expense is %.2f", assigned, whole)
+	}
+	for i := range people {
+		if !given[i] {
+			values[i] = left / float64(open)
+		}
+	}
+
+	draft.Expense.SplitType = string(models.SplitTypeCustom)
+	if percent {
+		draft.Expense.SplitType = string(models.SplitTypePercentage)
+	}
+	return Allocate(total, values), nil
+}
+
+// Allocate divides total cents by weight. Leftover cents go to the largest
+// remainders, earlier people first on ties, so the parts always add up to
+// total. Weights that add up to nothing divide equally.
+func Allocate(total int64, weights []float64) []int64 {
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	if !(sum > 0) {
+		equal := make([]float64, len(weights))
+		for i := range equal {
+			equal[i] = 1
+		}
+		weights, sum = equal, float64(len(equal))
+	}
+	cents := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	var assigned int64
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		cents[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(cents[i])
+		assigned += cents[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]]+1e-9 })
+	for i := int64(0); i < total-assigned; i++ {
+		cents[order[i%int64(len(order))]]++
+	}
+	return cents
+}
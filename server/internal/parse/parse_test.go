@@ -0,0 +1,186 @@
+package parse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var (
+	me    = Member{UserID: "me", DisplayName: "Sam Lee"}
+	asha  = Member{UserID: "asha", DisplayName: "Asha Rao", Handle: "asha_r"}
+	ravi  = Member{UserID: "ravi", DisplayName: "Ravi Kumar"}
+	priya = Member{UserID: "priya", DisplayName: "Priya Shah"}
+
+	flat = Group{ID: "flat", Name: "Flat", DefaultCurrency: "INR", Members: []Member{asha, ravi}}
+	trip = Group{ID: "trip", Name: "Goa Trip", DefaultCurrency: "INR", Members: []Member{asha, priya}}
+
+	testContext = Context{Self: me, Groups: []Group{flat, trip}, DefaultCurrency: "USD"}
+)
+
+type share struct {
+	user   string
+	amount float64
+}
+
+func shares(d *Draft) []share {
+	var got []share
+	for _, s := range d.Shares {
+		got = append(got, share{s.UserID, s.Amount})
+	}
+	return got
+}
+
+func TestExpense(t *testing.T) {
+	tests := []struct {
+		text        string
+		amount      float64
+		currency    string
+		description string
+		category    string
+		group       string
+		splitType   string
+		shares      []share
+	}{
+		{"paid 250 for coffee", 250, "USD", "coffee", "Food", "", "", nil},
+		{"spent ₹1,200 on groceries", 1200, "INR", "groceries", "Groceries", "", "", nil},
+		{"20 dollars taxi", 20, "USD", "taxi", "Transport", "", "", nil},
+		{"1.5k rent", 1500, "USD", "rent", "Rent", "", "", nil},
+		{"2 pizzas for ₹800", 800, "INR", "2 pizzas", "Food", "", "", nil},
+		{"paid 1200 for dinner with Asha and Ravi, split equally", 1200, "INR", "dinner", "Food", "Flat", "EQUAL",
+			[]share{{"me", 400}, {"asha", 400}, {"ravi", 400}}},
+		{"with asha, ravi 300", 300, "INR", "", "Other", "Flat", "EQUAL",
+			[]share{{"me", 100}, {"asha", 100}, {"ravi", 100}}},
+		{"with Asha, Ravi 300 for dinner", 300, "INR", "dinner", "Food", "Flat", "EQUAL",
+			[]share{{"me", 100}, {"asha", 100}, {"ravi", 100}}},
+		{"100 lunch with @asha_r", 100, "INR", "lunch", "Food", "Flat", "EQUAL",
+			[]share{{"me", 50}, {"asha", 50}}},
+		{"900 hotel in goa trip split equally", 900, "INR", "hotel", "Travel", "Goa Trip", "EQUAL",
+			[]share{{"me", 300}, {"asha", 300}, {"priya", 300}}},
+		{"1000 dinner with asha split 60/40", 1000, "INR", "dinner", "Food", "Flat", "PERCENTAGE",
+			[]share{{"me", 600}, {"asha", 400}}},
+		{"400 cab with asha and ravi split 2:1:1", 400, "INR", "cab", "Transport", "Flat", "SHARES",
+			[]share{{"me", 200}, {"asha", 100}, {"ravi", 100}}},
+		{"1000 dinner split asha 300, ravi 500", 1000, "INR", "dinner", "Food", "Flat", "CUSTOM",
+			[]share{{"me", 200}, {"asha", 300}, {"ravi", 500}}},
+		{"200 movie split asha 25%", 200, "INR", "movie", "Entertainment", "Flat", "PERCENTAGE",
+			[]share{{"me", 150}, {"asha", 50}}},
+		{"100 snacks with asha and ravi", 100, "INR", "snacks", "Food", "Flat", "EQUAL",
+			[]share{{"me", 33.34}, {"asha", 33.33}, {"ravi", 33.33}}},
+		{"0.01 with asha and ravi", 0.01, "INR", "", "Other", "Flat", "EQUAL",
+			[]share{{"me", 0.01}, {"asha", 0}, {"ravi", 0}}},
+		{"0.01 with asha and ravi split three ways", 0.01, "INR", "", "Other", "Flat", "EQUAL",
+			[]share{{"me", 0.01}, {"asha", 0}, {"ravi", 0}}},
+		{"0.02 in flat split 3 ways", 0.02, "INR", "", "Other", "Flat", "EQUAL",
+			[]share{{"me", 0.01}, {"asha", 0.01}, {"ravi", 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			draft, err := Expense(tt.text, testContext)
+			if err != nil {
+				t.Fatalf("Expense: %v", err)
+			}
+			e := draft.Expense
+			if e.Amount != tt.amount || e.OriginalCurrency != tt.currency || e.Description != tt.description || e.Category != tt.category {
+				t.Errorf("expense = %v %s %q (%s), want %v %s %q (%s)",
+					e.Amount, e.OriginalCurrency, e.Description, e.Category, tt.amount, tt.currency, tt.description, tt.category)
+			}
+			if draft.GroupName != tt.group || e.SplitType != tt.splitType {
+				t.Errorf("group %q split %q, want %q split %q", draft.GroupName, e.SplitType, tt.group, tt.splitType)
+			}
+			if len(draft.Unresolved) > 0 {
+				t.Errorf("unresolved %v", draft.Unresolved)
+			}
+			if got := shares(draft); !reflect.DeepEqual(got, tt.shares) {
+				t.Errorf("shares = %v, want %v", got, tt.shares)
+			}
+		})
+	}
+}
+
+func TestExpenseUnresolved(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"300 dinner with bob", []string{"bob"}},
+		{"300 dinner with asha and bob", []string{"bob"}},
+		// No group has both, so the names missing from the first closest one
+		// are reported
+		{"300 dinner with priya, ravi", []string{"priya"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			draft, err := Expense(tt.text, testContext)
+			if err != nil {
+				t.Fatalf("Expense: %v", err)
+			}
+			if !reflect.DeepEqual(draft.Unresolved, tt.want) {
+				t.Errorf("unresolved = %v, want %v", draft.Unresolved, tt.want)
+			}
+			if len(draft.Shares) != 0 {
+				t.Errorf("shares = %v, want none", shares(draft))
+			}
+		})
+	}
+}
+
+func TestExpenseErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want error
+	}{
+		{"dinner with asha", ErrNoAmount},
+		{"1000 dinner with asha split 60/30/10", nil},
+		{"1000 dinner split asha 300, ravi 800", nil},
+		{"1000 dinner split asha 30%, ravi 500", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := Expense(tt.text, testContext)
+			if err == nil {
+				t.Fatal("Expense succeeded, want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		total   int64
+		weights []float64
+		want    []int64
+	}{
+		{100, []float64{1, 1, 1}, []int64{34, 33, 33}},
+		{1, []float64{1, 1, 1}, []int64{1, 0, 0}},
+		{2, []float64{1, 1, 1}, []int64{1, 1, 0}},
+		{1000, []float64{60, 40}, []int64{600, 400}},
+		{10, []float64{1, 2}, []int64{3, 7}},
+		{0, []float64{1, 1}, []int64{0, 0}},
+		{1, []float64{0, 0, 0}, []int64{1, 0, 0}},
+	}
+	for _, tt := range tests {
+		got := Allocate(tt.total, tt.weights)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Allocate(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+		}
+	}
+}
+
+func TestCategory(t *testing.T) {
+	tests := map[string]string{
+		"Uber to the airport": "Transport",
+		"weekly groceries":    "Groceries",
+		"Movies":              "Entertainment",
+		"something else":      DefaultCategory,
+		"":                    DefaultCategory,
+	}
+	for text, want := range tests {
+		if got := Category(text); got != want {
+			t.Errorf("Category(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package patterns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/cashflow"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+	"gorm.io/gorm"
+)
+
+// Analyzer loads expense history, runs the detection rules and stores the
+// results as BehavioralPattern rows
+type Analyzer struct {
+	db *gorm.DB
+}
+
+func NewAnalyzer(db *gorm.DB) *Analyzer {
+	return &Analyzer{db: db}
+}
+
+// Run analyses every user with recent expenses each interval until ctx is done
+func (a *Analyzer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.AnalyzeAll(time.Now()); err != nil {
+			log.Printf("patterns: analysis failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AnalyzeAll re-runs detection for every user with expenses in the window
+func (a *Analyzer) AnalyzeAll(now time.Time) error {
+	var userIDs []string
+	if err := a.db.Model(&models.Expense{}).
+		Where("date >= ?", now.Add(-Window)).
+		Distinct().
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return fmt.Errorf("could not load users to analyse: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if _, err := a.Analyze(userID, now); err != nil {
+			log.Printf("patterns: could not analyse user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// Analyze replaces the user's behavioural patterns with a fresh detection run
+// and returns the stored rows
+func (a *Analyzer) Analyze(userID string, now time.Time) ([]models.BehavioralPattern, error) {
+	in := Input{Now: now}
+
+	if err := a.db.Where("user_id = ? AND date >= ? AND date <= ?", userID, now.Add(-Window), now).
+		Order("date").
+		Find(&in.Expenses).Error; err != nil {
+		return nil, fmt.Errorf("could not load expenses: %w", err)
+	}
+
+	payDates, err := a.payDates(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	in.PayDates = payDates
+
+	var patterns []models.BehavioralPattern
+	for _, d := range Detect(in) {
+		suggestions, err := json.Marshal(d.Suggestions)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode suggestions: %w", err)
+		}
+		patterns = append(patterns, models.BehavioralPattern{
+			UserID:         userID,
+			PatternType:    d.PatternType,
+			Frequency:      d.Frequency,
+			TriggerFactors: d.TriggerFactors,
+			RiskLevel:      d.RiskLevel,
+			Suggestions:    suggestions,
+		})
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.BehavioralPattern{}).Error; err != nil {
+			return err
+		}
+		if len(patterns) == 0 {
+			return nil
+		}
+		return tx.Create(&patterns).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not store behavioral patterns: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// payDates returns salary payments in the window. Recorded receipts from
+// salary income streams are preferred; otherwise dates are projected monthly
+// backwards from User.NextSalaryDate.
+func (a *Analyzer) payDates(userID string, now time.Time) ([]time.Time, error) {
+	var receipts []models.IncomeReceipt
+	if err := a.db.Joins("JOIN income_streams ON income_streams.id = income_receipts.income_stream_id").
+		Where("income_receipts.user_id = ? AND income_receipts.received_at >= ?", userID, now.Add(-Window)).
+		Where("LOWER(income_streams.type) IN ?", cashflow.SalaryTypes).
+		Find(&receipts).Error; err != nil {
+		return nil, fmt.Errorf("could not load salary receipts: %w", err)
+	}
+
+	var dates []time.Time
+	for _, r := range receipts {
+		dates = append(dates, r.ReceivedAt)
+	}
+	if len(dates) > 0 {
+		return dates, nil
+	}
+
+	var user models.User
+	if err := a.db.Select("id", "next_salary_date").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("could not load user: %w", err)
+	}
+	if user.NextSalaryDate == nil {
+		return nil, nil
+	}
+
+	start := now.Add(-Window)
+	for n := 0; ; n-- {
+		date := schedule.Shift(*user.NextSalaryDate, schedule.Monthly, n)
+		if date.Before(start) {
+			break
+		}
+		if date.Before(now) {
+			dates = append(dates, date)
+		}
+	}
+	return dates, nil
+}
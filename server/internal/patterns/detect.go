@@ -0,0 +1,444 @@
+package patterns
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+// Pattern types written to BehavioralPattern.PatternType
+const (
+	WeekendOverspending = "weekend_overspending"
+	PostPaydaySpike     = "post_payday_spike"
+	SmallSubscriptions  = "recurring_small_subscriptions"
+	CategoryCreep       = "category_creep"
+)
+
+// Risk levels written to BehavioralPattern.RiskLevel
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+const (
+	// Window is how much expense history the rules look at
+	Window = 180 * 24 * time.Hour
+
+	// weekendRatio is how much higher daily weekend spend must be than
+	// weekday spend to count as overspending
+	weekendRatio = 1.5
+	// minWeekendDays with spending before the weekend rule applies
+	minWeekendDays = 4
+
+	// paydayDays is the number of days from payday (inclusive) that are
+	// compared with the rest of the pay cycle
+	paydayDays = 3
+	// paydayRatio is how much higher post-payday daily spend must be
+	paydayRatio = 1.75
+
+	// a subscription must be seen in at least this many separate months
+	minSubscriptionMonths = 3
+	// amounts of a subscription may vary by this fraction
+	subscriptionTolerance = 0.1
+	// days between charges of weekly and monthly subscriptions
+	minWeeklyGap, maxWeeklyGap   = 6, 8
+	minMonthlyGap, maxMonthlyGap = 26, 35
+
+	// creepMonths is the number of full months compared for category creep
+	creepMonths = 4
+	// creepGrowth is the minimum growth from the first to the last month
+	creepGrowth = 1.3
+)
+
+// Detection is one pattern found in a user's spending
+type Detection struct {
+	PatternType    string
+	Frequency      float64
+	TriggerFactors []string
+	RiskLevel      string
+	Suggestions    []string
+}
+
+// Input is everything the rules need, so they run without a database
+type Input struct {
+	Expenses []models.Expense
+	// PayDates are past salary payments, in any order
+	PayDates []time.Time
+	Now      time.Time
+}
+
+// Detect runs every rule over the input and returns the patterns found
+func Detect(in Input) []Detection {
+	var found []Detection
+	for _, rule := range []func(Input) *Detection{
+		detectWeekendOverspending,
+		detectPostPaydaySpike,
+		detectSmallSubscriptions,
+		detectCategoryCreep,
+	} {
+		if d := rule(in); d != nil {
+			found = append(found, *d)
+		}
+	}
+	return found
+}
+
+// dailyTotals sums expenses per calendar day
+func dailyTotals(expenses []models.Expense) map[time.Time]float64 {
+	totals := make(map[time.Time]float64)
+	for _, e := range expenses {
+		totals[day(e.Date)] += e.Amount
+	}
+	return totals
+}
+
+func detectWeekendOverspending(in Input) *Detection {
+	if len(in.Expenses) == 0 {
+		return nil
+	}
+
+	start := day(in.Now.Add(-Window))
+	totals := dailyTotals(in.Expenses)
+
+	var weekendSpend, weekdaySpend float64
+	var weekendDays, weekdayDays, weekendsWithSpend int
+	for d := start; d.Before(day(in.Now)); d = d.AddDate(0, 0, 1) {
+		spent := totals[d]
+		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			weekendSpend += spent
+			weekendDays++
+			if spent > 0 {
+				weekendsWithSpend++
+			}
+		} else {
+			weekdaySpend += spent
+			weekdayDays++
+		}
+	}
+	if weekendDays == 0 || weekdayDays == 0 || weekendsWithSpend < minWeekendDays || weekdaySpend == 0 {
+		return nil
+	}
+
+	weekendAvg := weekendSpend / float64(weekendDays)
+	weekdayAvg := weekdaySpend / float64(weekdayDays)
+	ratio := weekendAvg / weekdayAvg
+	if ratio < weekendRatio {
+		return nil
+	}
+
+	return &Detection{
+		PatternType: WeekendOverspending,
+		Frequency:   round(float64(weekendsWithSpend) / float64(weekendDays)),
+		TriggerFactors: append([]string{fmt.Sprintf("weekend spend is %.1fx weekday spend", ratio)},
+			topCategories(in.Expenses, isWeekend, 3)...),
+		RiskLevel: riskFor(ratio, 1.8, 2.5),
+		Suggestions: []string{
+			"Set a separate weekend spending limit",
+			"Plan weekend activities and their cost in advance",
+		},
+	}
+}
+
+func detectPostPaydaySpike(in Input) *Detection {
+	if len(in.PayDates) == 0 || len(in.Expenses) == 0 {
+		return nil
+	}
+
+	start := day(in.Now.Add(-Window))
+	paydays := make(map[time.Time]bool)
+	for _, p := range in.PayDates {
+		if d := day(p); !d.Before(start) && d.Before(day(in.Now)) {
+			paydays[d] = true
+		}
+	}
+	if len(paydays) == 0 {
+		return nil
+	}
+
+	totals := dailyTotals(in.Expenses)
+	inWindow := func(d time.Time) bool {
+		for i := 0; i < paydayDays; i++ {
+			if paydays[d.AddDate(0, 0, -i)] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var postSpend, otherSpend float64
+	var postDays, otherDays int
+	for d := start; d.Before(day(in.Now)); d = d.AddDate(0, 0, 1) {
+		if inWindow(d) {
+			postSpend += totals[d]
+			postDays++
+		} else {
+			otherSpend += totals[d]
+			otherDays++
+		}
+	}
+	if postDays == 0 || otherDays == 0 || otherSpend == 0 {
+		return nil
+	}
+
+	ratio := (postSpend / float64(postDays)) / (otherSpend / float64(otherDays))
+	if ratio < paydayRatio {
+		return nil
+	}
+
+	// Frequency is the share of paydays that were followed by a spike
+	otherAvg := otherSpend / float64(otherDays)
+	spikes := 0
+	for p := range paydays {
+		var spent float64
+		for i := 0; i < paydayDays; i++ {
+			spent += totals[p.AddDate(0, 0, i)]
+		}
+		if spent/paydayDays >= otherAvg*paydayRatio {
+			spikes++
+		}
+	}
+
+	return &Detection{
+		PatternType:    PostPaydaySpike,
+		Frequency:      round(float64(spikes) / float64(len(paydays))),
+		TriggerFactors: []string{fmt.Sprintf("spending in the %d days after payday is %.1fx the usual daily spend", paydayDays, ratio)},
+		RiskLevel:      riskFor(ratio, 2.5, 4),
+		Suggestions: []string{
+			"Move savings out automatically on payday before spending",
+			"Wait 48 hours before large purchases right after payday",
+		},
+	}
+}
+
+var digits = regexp.MustCompile(`[0-9#]+`)
+
+// merchantKey normalises a description so repeated charges from the same
+// merchant group together
+func merchantKey(e models.Expense) string {
+	key := strings.ToLower(e.Description)
+	key = digits.ReplaceAllString(key, "")
+	key = strings.Join(strings.Fields(key), " ")
+	if key == "" {
+		return ""
+	}
+	return strings.ToLower(e.Category) + "|" + key
+}
+
+func detectSmallSubscriptions(in Input) *Detection {
+	if len(in.Expenses) < minSubscriptionMonths {
+		return nil
+	}
+
+	amounts := make([]float64, 0, len(in.Expenses))
+	for _, e := range in.Expenses {
+		amounts = append(amounts, e.Amount)
+	}
+	small := median(amounts)
+
+	groups := make(map[string][]models.Expense)
+	for _, e := range in.Expenses {
+		if e.Amount > small {
+			continue
+		}
+		if key := merchantKey(e); key != "" {
+			groups[key] = append(groups[key], e)
+		}
+	}
+
+	var names []string
+	var monthlyCost float64
+	for _, group := range groups {
+		months := make(map[string]bool)
+		var total float64
+		for _, e := range group {
+			months[e.Date.Format("2006-01")] = true
+			total += e.Amount
+		}
+		if len(months) < minSubscriptionMonths {
+			continue
+		}
+
+		mean := total / float64(len(group))
+		consistent := true
+		for _, e := range group {
+			if math.Abs(e.Amount-mean) > mean*subscriptionTolerance {
+				consistent = false
+				break
+			}
+		}
+		if !consistent || !regularInterval(group) {
+			continue
+		}
+
+		names = append(names, group[0].Description)
+		monthlyCost += total / float64(len(months))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	var totalSpend float64
+	for _, a := range amounts {
+		totalSpend += a
+	}
+	months := Window.Hours() / 24 / 30
+	share := monthlyCost / (totalSpend / months)
+
+	return &Detection{
+		PatternType:    SmallSubscriptions,
+		Frequency:      float64(len(names)),
+		TriggerFactors: names,
+		RiskLevel:      riskFor(share, 0.05, 0.15),
+		Suggestions: []string{
+			fmt.Sprintf("Review %d recurring small charges costing about %.2f a month", len(names), monthlyCost),
+			"Cancel subscriptions you have not used in the last month",
+		},
+	}
+}
+
+// regularInterval reports whether charges repeat roughly weekly or monthly,
+// judged by the median gap between consecutive charges
+func regularInterval(group []models.Expense) bool {
+	dates := make([]time.Time, 0, len(group))
+	for _, e := range group {
+		dates = append(dates, day(e.Date))
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	gaps := make([]float64, 0, len(dates)-1)
+	for i := 1; i < len(dates); i++ {
+		gaps = append(gaps, dates[i].Sub(dates[i-1]).Hours()/24)
+	}
+	gap := median(gaps)
+	return (gap >= minWeeklyGap && gap <= maxWeeklyGap) || (gap >= minMonthlyGap && gap <= maxMonthlyGap)
+}
+
+func detectCategoryCreep(in Input) *Detection {
+	now := in.Now.UTC()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	firstMonth := currentMonth.AddDate(0, -creepMonths, 0)
+
+	// monthly[category][i] is spend in month i, oldest first
+	monthly := make(map[string][]float64)
+	labels := make(map[string]string)
+	for _, e := range in.Expenses {
+		if e.Date.Before(firstMonth) || !e.Date.Before(currentMonth) {
+			continue
+		}
+		key := strings.ToLower(e.Category)
+		if _, ok := monthly[key]; !ok {
+			monthly[key] = make([]float64, creepMonths)
+			labels[key] = e.Category
+		}
+		date := e.Date.UTC()
+		i := (date.Year()-firstMonth.Year())*12 + int(date.Month()-firstMonth.Month())
+		monthly[key][i] += e.Amount
+	}
+
+	var creeping []string
+	var maxGrowth float64
+	for key, series := range monthly {
+		if series[0] <= 0 {
+			continue
+		}
+		increasing := true
+		for i := 1; i < len(series); i++ {
+			if series[i] <= series[i-1] {
+				increasing = false
+				break
+			}
+		}
+		growth := series[len(series)-1] / series[0]
+		if !increasing || growth < creepGrowth {
+			continue
+		}
+		creeping = append(creeping, fmt.Sprintf("%s up %.0f%% over %d months", labels[key], (growth-1)*100, creepMonths))
+		maxGrowth = math.Max(maxGrowth, growth)
+	}
+	if len(creeping) == 0 {
+		return nil
+	}
+	sort.Strings(creeping)
+
+	return &Detection{
+		PatternType:    CategoryCreep,
+		Frequency:      float64(len(creeping)),
+		TriggerFactors: creeping,
+		RiskLevel:      riskFor(maxGrowth, 1.6, 2.0),
+		Suggestions: []string{
+			"Set a budget for the categories that keep growing",
+			"Compare recent purchases in these categories with earlier months",
+		},
+	}
+}
+
+func isWeekend(e models.Expense) bool {
+	weekday := e.Date.UTC().Weekday()
+	return weekday == time.Saturday || weekday == time.Sunday
+}
+
+// topCategories returns the categories with the highest spend among the
+// expenses matching filter
+func topCategories(expenses []models.Expense, filter func(models.Expense) bool, n int) []string {
+	totals := make(map[string]float64)
+	for _, e := range expenses {
+		if filter(e) {
+			totals[e.Category] += e.Amount
+		}
+	}
+	categories := make([]string, 0, len(totals))
+	for c := range totals {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if totals[categories[i]] == totals[categories[j]] {
+			return categories[i] < categories[j]
+		}
+		return totals[categories[i]] > totals[categories[j]]
+	})
+	if len(categories) > n {
+		categories = categories[:n]
+	}
+	return categories
+}
+
+func riskFor(value, medium, high float64) string {
+	switch {
+	case value >= high:
+		return RiskHigh
+	case value >= medium:
+		return RiskMedium
+	}
+	return RiskLow
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// day truncates t to midnight UTC so days compare equal regardless of the
+// location the database returned
+func day(t time.Time) time.Time {
+	year, month, d := t.UTC().Date()
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,235 @@
+package patterns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+// now is a Wednesday; the window starts on Jan 2
+var now = time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func expense(date time.Time, category, description string, amount float64) models.Expense {
+	return models.Expense{Date: date, Category: category, Description: description, Amount: amount}
+}
+
+// everyDay spends weekday on weekdays and weekend on the first weekendDays
+// weekend days of the window, or all of them when weekendDays is negative
+func everyDay(weekday, weekend float64, weekendDays int) []models.Expense {
+	var expenses []models.Expense
+	for d := day(now.Add(-Window)); d.Before(day(now)); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			if weekday > 0 {
+				expenses = append(expenses, expense(d, "Food", "lunch", weekday))
+			}
+			continue
+		}
+		if weekendDays == 0 {
+			continue
+		}
+		weekendDays--
+		expenses = append(expenses, expense(d, "Entertainment", "movies", weekend))
+	}
+	return expenses
+}
+
+func TestWeekendOverspending(t *testing.T) {
+	tests := []struct {
+		name     string
+		expenses []models.Expense
+		risk     string // empty when nothing is detected
+	}{
+		{"no expenses", nil, ""},
+		{"below ratio", everyDay(100, 149, -1), ""},
+		{"at ratio", everyDay(100, 150, -1), RiskLow},
+		{"medium", everyDay(100, 180, -1), RiskMedium},
+		{"high", everyDay(100, 250, -1), RiskHigh},
+		{"too few weekends", everyDay(10, 5000, minWeekendDays-1), ""},
+		{"enough weekends", everyDay(10, 5000, minWeekendDays), RiskHigh},
+		{"no weekday spend", everyDay(0, 100, -1), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := detectWeekendOverspending(Input{Expenses: tt.expenses, Now: now})
+			checkRisk(t, d, WeekendOverspending, tt.risk)
+		})
+	}
+}
+
+// paydaySpend spends base every day and post on the paydayDays days from
+// each payday
+func paydaySpend(base, post float64, paydays []time.Time) []models.Expense {
+	after := make(map[time.Time]bool)
+	for _, p := range paydays {
+		for i := 0; i < paydayDays; i++ {
+			after[day(p).AddDate(0, 0, i)] = true
+		}
+	}
+	var expenses []models.Expense
+	for d := day(now.Add(-Window)); d.Before(day(now)); d = d.AddDate(0, 0, 1) {
+		amount := base
+		if after[d] {
+			amount = post
+		}
+		expenses = append(expenses, expense(d, "Shopping", "store", amount))
+	}
+	return expenses
+}
+
+func TestPostPaydaySpike(t *testing.T) {
+	var paydays []time.Time
+	for m := time.February; m <= time.June; m++ {
+		paydays = append(paydays, time.Date(2026, m, 1, 9, 0, 0, 0, time.UTC))
+	}
+	old := []time.Time{time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name     string
+		expenses []models.Expense
+		paydays  []time.Time
+		risk     string
+	}{
+		{"no paydays", paydaySpend(100, 500, nil), nil, ""},
+		{"paydays before the window", paydaySpend(100, 500, old), old, ""},
+		{"below ratio", paydaySpend(100, 174, paydays), paydays, ""},
+		{"at ratio", paydaySpend(100, 175, paydays), paydays, RiskLow},
+		{"medium", paydaySpend(100, 250, paydays), paydays, RiskMedium},
+		{"high", paydaySpend(100, 400, paydays), paydays, RiskHigh},
+		{"no other spend", paydaySpend(0, 400, paydays), paydays, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := detectPostPaydaySpike(Input{Expenses: tt.expenses, PayDates: tt.paydays, Now: now})
+			checkRisk(t, d, PostPaydaySpike, tt.risk)
+			if d != nil && d.Frequency != 1 {
+				t.Errorf("frequency = %v, want every payday", d.Frequency)
+			}
+		})
+	}
+}
+
+// charges repeats a charge every gap days from Jan 15, count times
+func charges(description string, amount float64, gap, count int) []models.Expense {
+	var expenses []models.Expense
+	start := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		expenses = append(expenses, expense(start.AddDate(0, 0, gap*i), "Entertainment", description, amount))
+	}
+	return expenses
+}
+
+// filler adds ten uneven grocery bills totalling total, larger than any
+// subscription so the subscriptions stay under the median
+func filler(total float64) []models.Expense {
+	var expenses []models.Expense
+	for i := 0; i < 10; i++ {
+		amount := total / 10 * (0.5 + float64(i)/9)
+		expenses = append(expenses, expense(time.Date(2026, 2, 1+i, 0, 0, 0, 0, time.UTC), "Food", "groceries", amount))
+	}
+	return expenses
+}
+
+func join(parts ...[]models.Expense) []models.Expense {
+	var all []models.Expense
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return all
+}
+
+func TestSmallSubscriptions(t *testing.T) {
+	varying := charges("Netflix", 100, 30, 6)
+	varying[3].Amount = 120
+
+	// Six monthly charges of 100 are 100 a month; the share of monthly
+	// spend is 600 / total
+	tests := []struct {
+		name     string
+		expenses []models.Expense
+		risk     string
+	}{
+		{"too few expenses", charges("Netflix", 100, 30, 2), ""},
+		{"two months", join(charges("Netflix", 100, 30, 2), filler(20000)), ""},
+		{"three months", join(charges("Netflix", 100, 30, 3), filler(20000)), RiskLow},
+		{"weekly", join(charges("Gym", 100, 7, 12), filler(50000)), RiskLow},
+		{"irregular", join(charges("Netflix", 100, 15, 8), filler(20000)), ""},
+		{"amount varies", join(varying, filler(20000)), ""},
+		{"above median", join(charges("Netflix", 5000, 30, 6), filler(2000)), ""},
+		{"low share", join(charges("Netflix", 100, 30, 6), filler(19400)), RiskLow},
+		{"medium share", join(charges("Netflix", 100, 30, 6), filler(5400)), RiskMedium},
+		{"high share", join(charges("Netflix", 100, 30, 6), filler(2400)), RiskHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := detectSmallSubscriptions(Input{Expenses: tt.expenses, Now: now})
+			checkRisk(t, d, SmallSubscriptions, tt.risk)
+			if d != nil && (len(d.TriggerFactors) != 1 || d.Frequency != 1) {
+				t.Errorf("found %v, want one subscription", d.TriggerFactors)
+			}
+		})
+	}
+}
+
+// monthly spends the amounts in March to June, the four months before now
+func monthly(amounts ...float64) []models.Expense {
+	var expenses []models.Expense
+	for i, amount := range amounts {
+		date := time.Date(2026, time.March+time.Month(i), 10, 0, 0, 0, 0, time.UTC)
+		expenses = append(expenses, expense(date, "Dining", "dinner", amount))
+	}
+	return expenses
+}
+
+func TestCategoryCreep(t *testing.T) {
+	tests := []struct {
+		name     string
+		expenses []models.Expense
+		risk     string
+	}{
+		{"no expenses", nil, ""},
+		{"flat", monthly(100, 100, 100, 100), ""},
+		{"below growth", monthly(100, 110, 120, 129), ""},
+		{"at growth", monthly(100, 110, 120, 130), RiskLow},
+		{"medium", monthly(100, 120, 150, 160), RiskMedium},
+		{"high", monthly(100, 150, 180, 200), RiskHigh},
+		{"not increasing", monthly(100, 150, 150, 200), ""},
+		{"nothing in the first month", monthly(0, 100, 150, 200), ""},
+		{"current month ignored", append(monthly(100, 100, 100, 100), expense(now, "Dining", "dinner", 900)), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := detectCategoryCreep(Input{Expenses: tt.expenses, Now: now})
+			checkRisk(t, d, CategoryCreep, tt.risk)
+		})
+	}
+}
+
+func TestDetectRunsEveryRule(t *testing.T) {
+	if found := Detect(Input{Now: now}); len(found) != 0 {
+		t.Fatalf("Detect found %v without expenses", found)
+	}
+
+	found := Detect(Input{Expenses: join(everyDay(100, 300, -1), monthly(100, 150, 180, 200)), Now: now})
+	types := make(map[string]bool)
+	for _, d := range found {
+		types[d.PatternType] = true
+	}
+	if !types[WeekendOverspending] || !types[CategoryCreep] {
+		t.Fatalf("Detect found %v, want weekend overspending and category creep", types)
+	}
+}
+
+func checkRisk(t *testing.T, d *Detection, patternType, risk string) {
+	t.Helper()
+	switch {
+	case risk == "" && d != nil:
+		t.Fatalf("detected %s (%s), want nothing", d.PatternType, d.RiskLevel)
+	case risk != "" && d == nil:
+		t.Fatalf("nothing detected, want %s risk", risk)
+	case d != nil && d.PatternType != patternType:
+		t.Fatalf("pattern = %s, want %s", d.PatternType, patternType)
+	case d != nil && d.RiskLevel != risk:
+		t.Fatalf("risk = %s, want %s", d.RiskLevel, risk)
+	}
+}
@@ -0,0 +1,283 @@
+package policy
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// Action is something a user wants to do with a resource
+type Action string
+
+const (
+	// ActionView reads the resource
+	ActionView Action = "view"
+	// ActionContribute adds things to a group, such as expenses or budgets
+	ActionContribute Action = "contribute"
+	// ActionEdit changes the resource
+	ActionEdit Action = "edit"
+	// ActionDelete removes the resource
+	ActionDelete Action = "delete"
+	// ActionManage changes who belongs to a group or split
+	ActionManage Action = "manage"
+	// ActionSettle changes what a share is worth or marks it paid
+	ActionSettle Action = "settle"
+)
+
+const RoleAdmin = "admin"
+
+// Handlers map these to responses the same way everywhere: ErrNotFound is a
+// 404 and ErrForbidden a 403. ErrNotFound means the resource doesn't exist;
+// ErrForbidden that it does but the user isn't a member of its group or may
+// not do the requested action.
+var (
+	ErrNotFound  = errors.New("resource not found")
+	ErrForbidden = errors.New("not allowed")
+)
+
+var idPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Policy decides what users may do with groups, expenses, splits and budgets.
+// Access comes from owning a resource or from an active membership, and role,
+// in the group it belongs to.
+type Policy struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Policy {
+	return &Policy{db: db}
+}
+
+// membership returns the user's active membership of a group, or nil
+func (p *Policy) membership(userID string, groupID *string) (*models.GroupMember, error) {
+	if groupID == nil || *groupID == "" {
+		return nil, nil
+	}
+	var member models.GroupMember
+	err := p.db.Where("group_id = ? AND user_id = ? AND is_active = ?", *groupID, userID, true).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func isAdmin(member *models.GroupMember) bool {
+	return member != nil && member.Role == RoleAdmin
+}
+
+// Group checks an action on a group. Members may view and contribute; only
+// admins may edit, delete or manage members.
+func (p *Policy) Group(userID, groupID string, action Action) (*models.Group, error) {
+	var group models.Group
+	if err := first(p.db, &group, groupID); err != nil {
+		return nil, err
+	}
+
+	member, err := p.membership(userID, &group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrForbidden
+	}
+
+	switch action {
+	case ActionView, ActionContribute:
+		return &group, nil
+	default:
+		if !isAdmin(member) {
+			return nil, ErrForbidden
+		}
+		return &group, nil
+	}
+}
+
+// Expense checks an action on an expense. The owner may do anything; other
+// members of the expense's group may view it and group admins may also edit
+// or delete it.
+func (p *Policy) Expense(userID, expenseID string, action Action) (*models.Expense, error) {
+	var expense models.Expense
+	if err := first(p.db, &expense, expenseID); err != nil {
+		return nil, err
+	}
+	if expense.UserID == userID {
+		return &expense, nil
+	}
+
+	member, err := p.membership(userID, expense.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrForbidden
+	}
+	if action == ActionView || isAdmin(member) {
+		return &expense, nil
+	}
+	return nil, ErrForbidden
+}
+
+// SplitExpense checks an action on a split. Its creator and group admins may
+// do anything; people with a share and group members may view it.
+func (p *Policy) SplitExpense(userID, splitExpenseID string, action Action) (*models.SplitExpense, error) {
+	var split models.SplitExpense
+	if err := first(p.db, &split, splitExpenseID); err != nil {
+		return nil, err
+	}
+	if split.CreatedBy == userID {
+		return &split, nil
+	}
+
+	member, err := p.membership(userID, &split.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin(member) {
+		return &split, nil
+	}
+
+	var shares int64
+	if err := p.db.Model(&models.SplitShare{}).
+		Where("split_expense_id = ? AND user_id = ?", split.ID, userID).
+		Count(&shares).Error; err != nil {
+		return nil, err
+	}
+	if member == nil && shares == 0 {
+		return nil, ErrForbidden
+	}
+	if action == ActionView {
+		return &split, nil
+	}
+	return nil, ErrForbidden
+}
+
+// SplitShare checks an action on a share. The split's creator, who is owed
+// the share, and group admins may do anything. The person who owes it may
+// view it and edit its reminders but not settle it, so they can't wipe out
+// their own debt; the owner of the split's expense may also settle it. Other
+// group members may view it.
+func (p *Policy) SplitShare(userID, splitShareID string, action Action) (*models.SplitShare, error) {
+	if !idPattern.MatchString(splitShareID) {
+		return nil, ErrNotFound
+	}
+	var share models.SplitShare
+	if err := p.db.Preload("SplitExpense").Where("id = ?", splitShareID).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if share.SplitExpense.CreatedBy == userID {
+		return &share, nil
+	}
+
+	member, err := p.membership(userID, &share.SplitExpense.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin(member) {
+		return &share, nil
+	}
+
+	owner := share.UserID == userID
+	switch {
+	case action == ActionSettle:
+		var owned int64
+		if err := p.db.Model(&models.Expense{}).
+			Where("id = ? AND user_id = ?", share.SplitExpense.ExpenseID, userID).
+			Count(&owned).Error; err != nil {
+			return nil, err
+		}
+		if owned > 0 {
+			return &share, nil
+		}
+	case !owner && member == nil:
+	case action == ActionView:
+		return &share, nil
+	case action == ActionEdit && owner:
+		return &share, nil
+	}
+	return nil, ErrForbidden
+}
+
+// Budget checks an action on a budget. Personal budgets belong to their
+// owner; group budgets can be viewed by members and changed by admins.
+func (p *Policy) Budget(userID, budgetID string, action Action) (*models.Budget, error) {
+	var budget models.Budget
+	if err := first(p.db, &budget, budgetID); err != nil {
+		return nil, err
+	}
+	if budget.UserID == userID {
+		return &budget, nil
+	}
+
+	member, err := p.membership(userID, budget.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrForbidden
+	}
+	if action == ActionView || isAdmin(member) {
+		return &budget, nil
+	}
+	return nil, ErrForbidden
+}
+
+// AllMembers reports whether every user is an active member of the group
+func (p *Policy) AllMembers(groupID string, userIDs []string) (bool, error) {
+	unique := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return true, nil
+	}
+	ids := make([]string, 0, len(unique))
+	for id := range unique {
+		ids = append(ids, id)
+	}
+
+	var members int64
+	if err := p.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id IN ? AND is_active = ?", groupID, ids, true).
+		Distinct("user_id").
+		Count(&members).Error; err != nil {
+		return false, err
+	}
+	return members == int64(len(ids)), nil
+}
+
+// MemberGroups is a subquery of the IDs of groups the user is an active
+// member of, for scoping list queries
+func (p *Policy) MemberGroups(userID string) *gorm.DB {
+	return p.db.Model(&models.GroupMember{}).
+		Select("group_id").
+		Where("user_id = ? AND is_active = ?", userID, true)
+}
+
+// VisibleExpenses scopes an expense query to what the user may view: their
+// own expenses and those of their groups
+func (p *Policy) VisibleExpenses(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("expenses.user_id = ? OR expenses.group_id IN (?)", userID, p.MemberGroups(userID))
+	}
+}
+
+// first loads a resource by id. Ids that aren't UUIDs can't exist, and
+// Postgres would fail on them rather than find nothing.
+func first(db *gorm.DB, dest interface{}, id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	err := db.Where("id = ?", id).First(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+// Tolerance is how far apart two totals may be and still count as equal.
+// OCR often rounds each line, so a few cents of drift is expected.
+const Tolerance = 0.05
+
+// MaxItems caps the line items accepted from one receipt
+const MaxItems = 200
+
+// Check is the outcome of validating a receipt. Balanced means the items,
+// with tax, tip and discount, add up to the total and nothing in Problems
+// needs correcting.
+type Check struct {
+	ItemsTotal float64  `json:"itemsTotal"`
+	Total      float64  `json:"total"`
+	Difference float64  `json:"difference"`
+	Balanced   bool     `json:"balanced"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+var ErrNoTotal = errors.New("receipt total must be greater than zero")
+
+// Normalize tidies OCR output: trims text, upper-cases the currency, fills
+// in missing line amounts and rounds money to cents
+func Normalize(r *models.Receipt) {
+	r.Merchant = strings.TrimSpace(r.Merchant)
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	for i := range r.Items {
+		item := &r.Items[i]
+		item.Description = strings.TrimSpace(item.Description)
+		if item.Amount == 0 && item.UnitPrice != 0 {
+			quantity := item.Quantity
+			if quantity == 0 {
+				quantity = 1
+			}
+			item.Amount = quantity * item.UnitPrice
+		}
+		item.Amount = round(item.Amount)
+	}
+	r.Subtotal, r.Tax, r.Tip = round(r.Subtotal), round(r.Tax), round(r.Tip)
+	r.Discount, r.Total = round(math.Abs(r.Discount)), round(r.Total)
+}
+
+// ParsedDate returns the receipt date, or nil when it is missing
+func ParsedDate(r *models.Receipt) (*time.Time, error) {
+	if r.Date == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, r.Date); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("date %q is not YYYY-MM-DD", r.Date)
+}
+
+// Validate checks a normalized receipt. Items may add up to the total on
+// their own (prices including tax) or once tax and tip are added and the
+// discount taken off. A receipt without items is balanced if its total is
+// set.
+func Validate(r *models.Receipt, now time.Time) (Check, error) {
+	if r.Total <= 0 {
+		return Check{}, ErrNoTotal
+	}
+	if len(r.Items) > MaxItems {
+		return Check{}, fmt.Errorf("receipt has more than %d items", MaxItems)
+	}
+
+	check := Check{Total: r.Total}
+	for i, item := range r.Items {
+		if item.Quantity < 0 {
+			check.Problems = append(check.Problems, fmt.Sprintf("item %d has a negative quantity", i+1))
+		}
+		if item.Quantity > 0 && item.UnitPrice != 0 && !Equal(item.Quantity*item.UnitPrice, item.Amount) {
+			check.Problems = append(check.Problems, fmt.Sprintf("item %d: %g x %.2f is not %.2f", i+1, item.Quantity, item.UnitPrice, item.Amount))
+		}
+		check.ItemsTotal += item.Amount
+	}
+	check.ItemsTotal = round(check.ItemsTotal)
+
+	if r.Tax < 0 || r.Tip < 0 {
+		check.Problems = append(check.Problems, "tax and tip can't be negative")
+	}
+	if date, err := ParsedDate(r); err != nil {
+		check.Problems = append(check.Problems, err.Error())
+	} else if date != nil && date.After(now.Add(24*time.Hour)) {
+		check.Problems = append(check.Problems, "receipt date is in the future")
+	}
+
+	if len(r.Items) == 0 {
+		check.Balanced = len(check.Problems) == 0
+		return check, nil
+	}
+
+	withExtras := round(check.ItemsTotal + r.Tax + r.Tip - r.Discount)
+	if r.Subtotal != 0 && !Equal(r.Subtotal, check.ItemsTotal) && !Equal(r.Subtotal+r.Tax+r.Tip-r.Discount, r.Total) {
+		check.Problems = append(check.Problems, fmt.Sprintf("subtotal %.2f doesn't match the items (%.2f)", r.Subtotal, check.ItemsTotal))
+	}
+
+	switch {
+	case Equal(withExtras, r.Total):
+		check.Difference = round(r.Total - withExtras)
+	case Equal(check.ItemsTotal, r.Total):
+		check.Difference = round(r.Total - check.ItemsTotal)
+	default:
+		check.Difference = round(r.Total - withExtras)
+		check.Problems = append(check.Problems, fmt.Sprintf("items add up to %.2f but the total is %.2f", withExtras, r.Total))
+	}
+	check.Balanced = len(check.Problems) == 0
+	return check, nil
+}
+
+// Matches reports whether the receipt backs up an expense of amount in
+// currency. A receipt without a currency matches any.
+func Matches(r *models.Receipt, amount float64, currency string) bool {
+	if r.Currency != "" && currency != "" && !strings.EqualFold(r.Currency, currency) {
+		return false
+	}
+	return r.Total > 0 && Equal(r.Total, amount)
+}
+
+// Equal compares money within Tolerance
+func Equal(a, b float64) bool {
+	return math.Abs(a-b) <= Tolerance+1e-9
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,130 @@
+package receipt
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+func items(amounts ...float64) []models.ReceiptItem {
+	var out []models.ReceiptItem
+	for _, a := range amounts {
+		out = append(out, models.ReceiptItem{Description: "item", Amount: a})
+	}
+	return out
+}
+
+func TestNormalize(t *testing.T) {
+	r := models.Receipt{
+		Merchant: "  Blue Tokai ",
+		Currency: " inr",
+		Items: []models.ReceiptItem{
+			{Description: " Latte ", Quantity: 2, UnitPrice: 180},
+			{Description: "Croissant", UnitPrice: 145.504},
+			{Description: "Cookie", Amount: 60.004},
+		},
+		Tax:      29.999,
+		Discount: -50,
+		Total:    545.5,
+	}
+	Normalize(&r)
+	want := models.Receipt{
+		Merchant: "Blue Tokai",
+		Currency: "INR",
+		Items: []models.ReceiptItem{
+			{Description: "Latte", Quantity: 2, UnitPrice: 180, Amount: 360},
+			{Description: "Croissant", UnitPrice: 145.504, Amount: 145.5},
+			{Description: "Cookie", Amount: 60},
+		},
+		Tax:      30,
+		Discount: 50,
+		Total:    545.5,
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Normalize = %+v, want %+v", r, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		receipt    models.Receipt
+		balanced   bool
+		difference float64
+		problem    string // part of a problem, when unbalanced
+	}{
+		{"items add up", models.Receipt{Items: items(12.5, 7.5), Total: 20}, true, 0, ""},
+		{"within tolerance", models.Receipt{Items: items(12.5, 7.5), Total: 20.05}, true, 0.05, ""},
+		{"beyond tolerance", models.Receipt{Items: items(12.5, 7.5), Total: 20.06}, false, 0.06, "items add up to 20.00"},
+		{"tax and tip", models.Receipt{Items: items(100), Tax: 18, Tip: 10, Total: 128}, true, 0, ""},
+		{"prices include tax", models.Receipt{Items: items(100, 18), Tax: 18, Total: 118}, true, 0, ""},
+		{"discount", models.Receipt{Items: items(80, 20), Tax: 5, Discount: 15, Total: 90}, true, 0, ""},
+		{"discount line", models.Receipt{Items: items(80, 20, -15), Total: 85}, true, 0, ""},
+		{"discount missing", models.Receipt{Items: items(80, 20), Tax: 5, Total: 90}, false, -15, "items add up to 105.00"},
+		{"subtotal matches the items", models.Receipt{Items: items(80, 20), Subtotal: 100, Tax: 5, Total: 105}, true, 0, ""},
+		{"discount as a line and on the total", models.Receipt{Items: items(80, 20, -10), Subtotal: 100, Discount: 10, Total: 90}, true, 0, ""},
+		{"subtotal adds up to the total", models.Receipt{Items: items(100, 18), Subtotal: 100, Tax: 18, Total: 118}, true, 0, ""},
+		{"subtotal off", models.Receipt{Items: items(80, 20), Subtotal: 120, Tax: 5, Total: 105}, false, 0, "subtotal 120.00 doesn't match the items (100.00)"},
+		{"no items", models.Receipt{Total: 42}, true, 0, ""},
+		{"negative tax", models.Receipt{Total: 42, Tax: -1}, false, 0, "can't be negative"},
+		{"negative quantity", models.Receipt{Items: []models.ReceiptItem{{Quantity: -1, Amount: 10}}, Total: 10}, false, 0, "negative quantity"},
+		{"quantity times price", models.Receipt{Items: []models.ReceiptItem{{Quantity: 3, UnitPrice: 2, Amount: 7}}, Total: 7}, false, 0, "3 x 2.00 is not 7.00"},
+		{"date tomorrow", models.Receipt{Date: "2025-03-11", Total: 42}, true, 0, ""},
+		{"date in the future", models.Receipt{Date: "2025-03-12", Total: 42}, false, 0, "in the future"},
+		{"unreadable date", models.Receipt{Date: "10/03/2025", Total: 42}, false, 0, "is not YYYY-MM-DD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, err := Validate(&tt.receipt, now)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if check.Balanced != tt.balanced || !Equal(check.Difference, tt.difference) || check.Difference != round(check.Difference) {
+				t.Errorf("Validate = %+v, want balanced %v with difference %.2f", check, tt.balanced, tt.difference)
+			}
+			if tt.problem != "" && !strings.Contains(strings.Join(check.Problems, "; "), tt.problem) {
+				t.Errorf("problems = %q, want one saying %q", check.Problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	for _, r := range []models.Receipt{{}, {Total: -5, Items: items(-5)}} {
+		if _, err := Validate(&r, time.Now()); !errors.Is(err, ErrNoTotal) {
+			t.Errorf("total %.2f: err = %v, want ErrNoTotal", r.Total, err)
+		}
+	}
+	r := models.Receipt{Items: make([]models.ReceiptItem, MaxItems+1), Total: 10}
+	if _, err := Validate(&r, time.Now()); err == nil {
+		t.Errorf("%d items: no error", len(r.Items))
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		receipt  models.Receipt
+		amount   float64
+		currency string
+		want     bool
+	}{
+		{models.Receipt{Currency: "INR", Total: 545.5}, 545.5, "INR", true},
+		{models.Receipt{Currency: "INR", Total: 545.5}, 545.45, "inr", true},
+		{models.Receipt{Currency: "INR", Total: 545.5}, 545.44, "INR", false},
+		{models.Receipt{Currency: "INR", Total: 545.5}, 545.5, "USD", false},
+		{models.Receipt{Total: 545.5}, 545.5, "USD", true},
+		{models.Receipt{Currency: "INR", Total: 545.5}, 545.5, "", true},
+		{models.Receipt{Currency: "INR"}, 0, "INR", false},
+	}
+	for _, tt := range tests {
+		if got := Matches(&tt.receipt, tt.amount, tt.currency); got != tt.want {
+			t.Errorf("Matches(%s %.2f, %s %.2f) = %v, want %v",
+				tt.receipt.Currency, tt.receipt.Total, tt.currency, tt.amount, got, tt.want)
+		}
+	}
+}
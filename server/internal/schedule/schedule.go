@@ -0,0 +1,120 @@
+package schedule
+
+import (
+	"strings"
+	"time"
+)
+
+// Frequencies used by IncomeStream, RecurringExpense and Budget periods
+const (
+	Daily     = "daily"
+	Weekly    = "weekly"
+	Biweekly  = "biweekly"
+	Monthly   = "monthly"
+	Quarterly = "quarterly"
+	Yearly    = "yearly"
+)
+
+// Normalize maps the spellings clients send onto the constants above. Unknown
+// values are returned lower-cased and unchanged.
+func Normalize(frequency string) string {
+	f := strings.ToLower(strings.TrimSpace(frequency))
+	switch f {
+	case "day", "daily":
+		return Daily
+	case "week", "weekly":
+		return Weekly
+	case "fortnight", "fortnightly", "biweekly", "bi-weekly":
+		return Biweekly
+	case "month", "monthly":
+		return Monthly
+	case "quarter", "quarterly":
+		return Quarterly
+	case "year", "yearly", "annual", "annually":
+		return Yearly
+	}
+	return f
+}
+
+// IsKnown reports whether the frequency can be scheduled
+func IsKnown(frequency string) bool {
+	switch Normalize(frequency) {
+	case Daily, Weekly, Biweekly, Monthly, Quarterly, Yearly:
+		return true
+	}
+	return false
+}
+
+// Advance returns t moved forward by one occurrence of frequency. Month based
+// frequencies keep the day of month, clamped to the length of the target month.
+// Unknown frequencies return t unchanged.
+func Advance(t time.Time, frequency string) time.Time {
+	return Shift(t, frequency, 1)
+}
+
+// Shift moves t by n occurrences of frequency; n may be negative
+func Shift(t time.Time, frequency string, n int) time.Time {
+	switch Normalize(frequency) {
+	case Daily:
+		return t.AddDate(0, 0, n)
+	case Weekly:
+		return t.AddDate(0, 0, 7*n)
+	case Biweekly:
+		return t.AddDate(0, 0, 14*n)
+	case Monthly:
+		return addMonths(t, n)
+	case Quarterly:
+		return addMonths(t, 3*n)
+	case Yearly:
+		return addMonths(t, 12*n)
+	}
+	return t
+}
+
+// NextAfter returns the first occurrence of frequency counted from the anchor
+// that is strictly after now. Occurrences are computed from the anchor rather
+// than from each other, so a monthly schedule anchored on the 31st returns to
+// the 31st after a short month.
+func NextAfter(anchor time.Time, frequency string, now time.Time) time.Time {
+	if !IsKnown(frequency) {
+		return anchor
+	}
+	next := anchor
+	for n := 1; !next.After(now); n++ {
+		next = Shift(anchor, frequency, n)
+	}
+	return next
+}
+
+// PerMonth converts an amount paid at the given frequency into its average
+// monthly equivalent
+func PerMonth(amount float64, frequency string) float64 {
+	switch Normalize(frequency) {
+	case Daily:
+		return amount * 365 / 12
+	case Weekly:
+		return amount * 52 / 12
+	case Biweekly:
+		return amount * 26 / 12
+	case Monthly:
+		return amount
+	case Quarterly:
+		return amount / 3
+	case Yearly:
+		return amount / 12
+	}
+	return 0
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	target := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := daysIn(target.Year(), target.Month(), t.Location()); day > last {
+		day = last
+	}
+	return time.Date(target.Year(), target.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func daysIn(year int, month time.Month, loc *time.Location) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+}
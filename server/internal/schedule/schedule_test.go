@@ -0,0 +1,80 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 9, 30, 0, 0, time.UTC)
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Monthly": Monthly, " fortnightly ": Biweekly, "bi-weekly": Biweekly,
+		"annual": Yearly, "quarter": Quarterly, "day": Daily, "Whenever": "whenever",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if IsKnown("whenever") || !IsKnown("Weekly") {
+		t.Error("IsKnown disagrees with Normalize")
+	}
+}
+
+func TestShift(t *testing.T) {
+	tests := []struct {
+		from      time.Time
+		frequency string
+		n         int
+		want      time.Time
+	}{
+		{day(2026, 1, 31), Daily, 1, day(2026, 2, 1)},
+		{day(2026, 1, 31), Weekly, 1, day(2026, 2, 7)},
+		{day(2026, 1, 31), Biweekly, -1, day(2026, 1, 17)},
+		{day(2026, 1, 31), Monthly, 1, day(2026, 2, 28)},
+		{day(2028, 1, 31), Monthly, 1, day(2028, 2, 29)},
+		{day(2026, 3, 31), Monthly, -1, day(2026, 2, 28)},
+		{day(2026, 11, 30), Quarterly, 1, day(2027, 2, 28)},
+		{day(2028, 2, 29), Yearly, 1, day(2029, 2, 28)},
+		{day(2026, 1, 31), "whenever", 1, day(2026, 1, 31)},
+	}
+	for _, tt := range tests {
+		if got := Shift(tt.from, tt.frequency, tt.n); !got.Equal(tt.want) {
+			t.Errorf("Shift(%v, %s, %d) = %v, want %v", tt.from, tt.frequency, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNextAfter(t *testing.T) {
+	tests := []struct {
+		anchor    time.Time
+		frequency string
+		now       time.Time
+		want      time.Time
+	}{
+		// Counted from the anchor, so the 31st comes back after February
+		{day(2026, 1, 31), Monthly, day(2026, 3, 1), day(2026, 3, 31)},
+		{day(2026, 1, 31), Monthly, day(2026, 2, 28), day(2026, 3, 31)},
+		{day(2026, 1, 31), Monthly, day(2026, 2, 27), day(2026, 2, 28)},
+		{day(2026, 1, 1), Weekly, day(2025, 12, 1), day(2026, 1, 1)},
+		{day(2026, 1, 1), Weekly, day(2026, 1, 1), day(2026, 1, 8)},
+		{day(2026, 1, 1), "whenever", day(2026, 6, 1), day(2026, 1, 1)},
+	}
+	for _, tt := range tests {
+		if got := NextAfter(tt.anchor, tt.frequency, tt.now); !got.Equal(tt.want) {
+			t.Errorf("NextAfter(%v, %s, %v) = %v, want %v", tt.anchor, tt.frequency, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestPerMonth(t *testing.T) {
+	tests := map[string]float64{Weekly: 520, Biweekly: 260, Monthly: 120, Quarterly: 40, Yearly: 10, "whenever": 0}
+	for frequency, want := range tests {
+		if got := PerMonth(120, frequency); got != want {
+			t.Errorf("PerMonth(120, %s) = %v, want %v", frequency, got, want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package splitwise reads the CSV export of a Splitwise group
+package splitwise
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CategoryPayment marks rows where one person paid another back
+	CategoryPayment = "Payment"
+	// CategoryGeneral is what Splitwise uses for uncategorized expenses
+	CategoryGeneral = "General"
+)
+
+// MaxRows caps the rows read from one file
+const MaxRows = 20000
+
+// fixedColumns come before the participant columns
+var fixedColumns = []string{"date", "description", "category", "cost", "currency"}
+
+var ErrNotSplitwise = errors.New("file is not a Splitwise group export")
+
+// File is a parsed export. Participants are the names of the balance
+// columns, in file order.
+type File struct {
+	Participants []string
+	Rows         []Row
+}
+
+// Row is one expense or payment. Balances holds each participant's net
+// effect: positive for what they paid beyond their share, negative for what
+// they owe.
+type Row struct {
+	Line        int
+	Date        time.Time
+	Description string
+	Category    string
+	Cost        float64
+	Currency    string
+	Balances    []float64
+}
+
+// Share is what one participant owes for a row
+type Share struct {
+	Participant int
+	Amount      float64
+}
+
+// Parse reads a Splitwise export. The trailing "Total balance" row and blank
+// lines are skipped.
+func Parse(r io.Reader) (*File, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrNotSplitwise
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+	if len(header) <= len(fixedColumns) {
+		return nil, ErrNotSplitwise
+	}
+	for i, name := range fixedColumns {
+		if !strings.EqualFold(strings.TrimSpace(header[i]), name) {
+			return nil, ErrNotSplitwise
+		}
+	}
+
+	file := &File{}
+	seen := map[string]bool{}
+	for _, name := range header[len(fixedColumns):] {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("participant column %q is empty or repeated", name)
+		}
+		seen[strings.ToLower(name)] = true
+		file.Participants = append(file.Participants, name)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The reader skips blank lines, so count lines by its position
+		line, _ := reader.FieldPos(0)
+		if blank(record) || strings.EqualFold(strings.TrimSpace(field(record, 1)), "Total balance") {
+			continue
+		}
+		if len(file.Rows) == MaxRows {
+			return nil, fmt.Errorf("file has more than %d rows", MaxRows)
+		}
+
+		row, err := parseRow(record, len(file.Participants))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		row.Line = line
+		file.Rows = append(file.Rows, row)
+	}
+	return file, nil
+}
+
+func parseRow(record []string, participants int) (Row, error) {
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(field(record, 0)))
+	if err != nil {
+		return Row{}, fmt.Errorf("date %q is not YYYY-MM-DD", field(record, 0))
+	}
+	cost, err := number(field(record, 3))
+	if err != nil || cost < 0 {
+		return Row{}, fmt.Errorf("cost %q is not an amount", field(record, 3))
+	}
+	row := Row{
+		Date:        date,
+		Description: strings.TrimSpace(field(record, 1)),
+		Category:    strings.TrimSpace(field(record, 2)),
+		Cost:        cost,
+		Currency:    strings.ToUpper(strings.TrimSpace(field(record, 4))),
+		Balances:    make([]float64, participants),
+	}
+	for i := range row.Balances {
+		value := field(record, len(fixedColumns)+i)
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if row.Balances[i], err = number(value); err != nil {
+			return Row{}, fmt.Errorf("balance %q is not an amount", value)
+		}
+	}
+	return row, nil
+}
+
+// IsPayment reports whether the row settles a debt rather than records
+// spending
+func (r *Row) IsPayment() bool {
+	return strings.EqualFold(r.Category, CategoryPayment)
+}
+
+// Split turns the row's balances into who paid and what each participant
+// owes them. The participant with the largest positive balance is the payer;
+// anyone else owing money has a share of what they owe, and the payer's own
+// share is the rest of the cost. Rows without anyone owing, such as an
+// expense the payer kept to themselves, have no payer (-1). Warnings explain
+// rows that don't convert exactly.
+func (r *Row) Split() (payer int, shares []Share, warnings []string) {
+	payer = -1
+	sum := 0.0
+	for i, balance := range r.Balances {
+		sum += balance
+		if balance > 0.005 && (payer < 0 || balance > r.Balances[payer]) {
+			payer = i
+		}
+	}
+	if math.Abs(sum) > 0.01 {
+		warnings = append(warnings, fmt.Sprintf("balances add up to %.2f instead of zero", sum))
+	}
+	if payer < 0 {
+		return -1, nil, append(warnings, "no one owes anything for this row")
+	}
+
+	owed := 0.0
+	for i, balance := range r.Balances {
+		if i == payer {
+			continue
+		}
+		if balance > 0.005 {
+			warnings = append(warnings, "several people paid; the largest payer is treated as the only one")
+			continue
+		}
+		if balance < -0.005 {
+			shares = append(shares, Share{Participant: i, Amount: round(-balance)})
+			owed += -balance
+		}
+	}
+	if own := round(r.Cost - owed); own > 0.005 && !r.IsPayment() {
+		shares = append([]Share{{Participant: payer, Amount: own}}, shares...)
+	}
+	return payer, shares, warnings
+}
+
+// Key identifies a row for idempotent imports. occurrence tells identical
+// rows in one file apart. Only non-zero balances count, so a later export
+// with more participant columns gives the same keys.
+func (r *Row) Key(scope string, participants []string, occurrence int) string {
+	var balances []string
+	for i, balance := range r.Balances {
+		if balance != 0 {
+			balances = append(balances, fmt.Sprintf("%s=%.2f", strings.ToLower(participants[i]), balance))
+		}
+	}
+	sort.Strings(balances)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%.2f\x00%s\x00%d\x00%s", scope,
+		r.Date.Format("2006-01-02"), r.Description, r.Category, r.Cost, r.Currency, occurrence,
+		strings.Join(balances, "\x00"))
+	return "splitwise:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func field(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+func blank(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func number(s string) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errors.New("not a number")
+	}
+	return round(v), nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
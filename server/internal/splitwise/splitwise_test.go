@@ -0,0 +1,138 @@
+package splitwise
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// export is a Splitwise group export as the site writes it, with a byte
+// order mark, a blank line and the closing balance row
+const export = "\uFEFFDate,Description,Category,Cost,Currency,Asha Rao,Ravi,Priya\n" +
+	"2025-01-05,Groceries,Groceries,90.00,USD,60.00,-30.00,-30.00\n" +
+	"2025-01-06,\"Taxi, airport\",Taxi,\"1,200.50\",inr,-600.25,600.25,\n" +
+	"\n" +
+	"2025-01-07,Payment,Payment,20.00,USD,-20.00,0.00,20.00\n" +
+	"2025-01-08,Total balance, , ,USD,40.00,-30.00,-10.00\n"
+
+func TestParse(t *testing.T) {
+	file, err := Parse(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := []string{"Asha Rao", "Ravi", "Priya"}; !reflect.DeepEqual(file.Participants, want) {
+		t.Errorf("participants = %q, want %q", file.Participants, want)
+	}
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	want := []Row{
+		{Line: 2, Date: day(5), Description: "Groceries", Category: "Groceries", Cost: 90, Currency: "USD", Balances: []float64{60, -30, -30}},
+		{Line: 3, Date: day(6), Description: "Taxi, airport", Category: "Taxi", Cost: 1200.5, Currency: "INR", Balances: []float64{-600.25, 600.25, 0}},
+		{Line: 5, Date: day(7), Description: "Payment", Category: "Payment", Cost: 20, Currency: "USD", Balances: []float64{-20, 0, 20}},
+	}
+	if !reflect.DeepEqual(file.Rows, want) {
+		t.Errorf("rows = %+v, want %+v", file.Rows, want)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	const header = "Date,Description,Category,Cost,Currency,Asha,Ravi\n"
+	tests := []struct {
+		name string
+		file string
+		want string // part of the error
+	}{
+		{"empty", "", ErrNotSplitwise.Error()},
+		{"no participants", "Date,Description,Category,Cost,Currency\n", ErrNotSplitwise.Error()},
+		{"other columns", "Date,Payee,Category,Cost,Currency,Asha\n", ErrNotSplitwise.Error()},
+		{"repeated participant", "Date,Description,Category,Cost,Currency,Asha,asha\n", "empty or repeated"},
+		{"bad date", header + "05/01/2025,Lunch,Food,10,USD,5,-5\n", "line 2: date"},
+		{"negative cost", header + "2025-01-05,Lunch,Food,-10,USD,5,-5\n", "line 2: cost"},
+		{"bad balance", header + "2025-01-05,Lunch,Food,10,USD,5,five\n", "line 2: balance"},
+		{"unclosed quote", header + "2025-01-05,\"Lunch,Food,10,USD,5,-5\n", "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse = %v, want an error saying %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := Parse(strings.NewReader("")); !errors.Is(err, ErrNotSplitwise) {
+		t.Errorf("empty file: err = %v, want ErrNotSplitwise", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		row      Row
+		payer    int
+		shares   []Share
+		warnings int
+	}{
+		{"equal split", Row{Cost: 90, Balances: []float64{60, -30, -30}},
+			0, []Share{{0, 30}, {1, 30}, {2, 30}}, 0},
+		{"payer not first", Row{Cost: 40, Balances: []float64{-15, 15, 0}},
+			1, []Share{{1, 25}, {0, 15}}, 0},
+		{"paid for others only", Row{Cost: 50, Balances: []float64{50, -20, -30}},
+			0, []Share{{1, 20}, {2, 30}}, 0},
+		{"payment", Row{Cost: 20, Category: "payment", Balances: []float64{-20, 0, 20}},
+			2, []Share{{0, 20}}, 0},
+		{"kept to themselves", Row{Cost: 12, Balances: []float64{0, 0, 0}},
+			-1, nil, 1},
+		{"several payers", Row{Cost: 100, Balances: []float64{30, 10, -40}},
+			0, []Share{{0, 60}, {2, 40}}, 1},
+		{"balances off", Row{Cost: 90, Balances: []float64{60, -30, -20}},
+			0, []Share{{0, 40}, {1, 30}, {2, 20}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payer, shares, warnings := tt.row.Split()
+			if payer != tt.payer || !reflect.DeepEqual(shares, tt.shares) || len(warnings) != tt.warnings {
+				t.Errorf("Split = %d, %v, %q; want %d, %v with %d warnings", payer, shares, warnings, tt.payer, tt.shares, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	date := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	row := Row{Date: date, Description: "Taxi", Category: "Taxi", Cost: 30, Currency: "USD", Balances: []float64{-15, 15}}
+	people := []string{"Asha", "Ravi"}
+	key := row.Key("group", people, 0)
+	if !strings.HasPrefix(key, "splitwise:") {
+		t.Errorf("key %q has no splitwise: prefix", key)
+	}
+
+	// A later export with another participant column, in another order
+	wider := Row{Date: date, Description: "Taxi", Category: "Taxi", Cost: 30, Currency: "USD", Balances: []float64{0, 15, -15}}
+	if got := wider.Key("group", []string{"Priya", "RAVI", "asha"}, 0); got != key {
+		t.Errorf("the same row in a wider export has key %s, want %s", got, key)
+	}
+
+	changed := map[string]string{
+		"second occurrence": row.Key("group", people, 1),
+		"other group":       row.Key("other", people, 0),
+		"other payer":       row.Key("group", []string{"Ravi", "Asha"}, 0),
+	}
+	edits := map[string]func(*Row){
+		"other date":        func(r *Row) { r.Date = date.AddDate(0, 0, 1) },
+		"other description": func(r *Row) { r.Description = "Taxi home" },
+		"other cost":        func(r *Row) { r.Cost = 30.01 },
+		"other currency":    func(r *Row) { r.Currency = "INR" },
+		"other balances":    func(r *Row) { r.Balances = []float64{-10, 10} },
+	}
+	for name, edit := range edits {
+		r := row
+		edit(&r)
+		changed[name] = r.Key("group", people, 0)
+	}
+	for name, got := range changed {
+		if got == key {
+			t.Errorf("%s has the same key as the original row", name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CSVConfig describes a bank's CSV layout. Columns are header names, or
+// 1-based positions for files without a header. Use Amount for a signed
+// column, or Debit and Credit when the bank splits them.
+type CSVConfig struct {
+	Delimiter    string `json:"delimiter"`    // defaults to ","
+	NoHeader     bool   `json:"noHeader"`     // the first row is a transaction
+	Date         string `json:"date"`         // defaults to "Date"
+	Description  string `json:"description"`  // defaults to "Description"
+	Amount       string `json:"amount"`       // defaults to "Amount" when Debit is empty
+	Debit        string `json:"debit"`        // money out, as a positive number
+	Credit       string `json:"credit"`       // money in
+	Memo         string `json:"memo"`         // optional
+	ID           string `json:"id"`           // optional bank reference
+	DateFormat   string `json:"dateFormat"`   // such as DD/MM/YYYY; guessed when empty
+	DecimalComma bool   `json:"decimalComma"` // amounts like 1.234,56
+	// DebitsPositive is for banks that list money out as positive amounts
+	DebitsPositive bool `json:"debitsPositive"`
+	// SkipRows are lines before the header, such as account details
+	SkipRows int `json:"skipRows"`
+}
+
+// ParseCSV reads a CSV statement laid out as cfg describes
+func ParseCSV(r io.Reader, cfg CSVConfig) (*Statement, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+	if cfg.Delimiter != "" {
+		delimiter := []rune(cfg.Delimiter)
+		if cfg.Delimiter == `\t` {
+			delimiter = []rune{'\t'}
+		}
+		if len(delimiter) != 1 {
+			return nil, errors.New("delimiter must be a single character")
+		}
+		reader.Comma = delimiter[0]
+	}
+	if cfg.Date == "" {
+		cfg.Date = "Date"
+	}
+	if cfg.Description == "" {
+		cfg.Description = "Description"
+	}
+	if cfg.Amount == "" && cfg.Debit == "" {
+		cfg.Amount = "Amount"
+	}
+
+	for i := 0; i < cfg.SkipRows; i++ {
+		if _, err := reader.Read(); err != nil {
+			return nil, errors.New("file has fewer rows than skipRows")
+		}
+	}
+
+	var header []string
+	if !cfg.NoHeader {
+		var err error
+		if header, err = reader.Read(); err != nil {
+			return nil, errors.New("file has no header row")
+		}
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+		}
+	}
+	column := func(name string, required bool) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			return n - 1, nil
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i, nil
+			}
+		}
+		if !required {
+			return -1, nil
+		}
+		return -1, fmt.Errorf("column %q not found", name)
+	}
+
+	var cols struct{ date, description, amount, debit, credit, memo, id int }
+	var err error
+	for _, c := range []struct {
+		dst      *int
+		name     string
+		required bool
+	}{
+		{&cols.date, cfg.Date, true},
+		{&cols.description, cfg.Description, true},
+		{&cols.amount, cfg.Amount, cfg.Debit == ""},
+		{&cols.debit, cfg.Debit, cfg.Debit != ""},
+		{&cols.credit, cfg.Credit, cfg.Credit != ""},
+		{&cols.memo, cfg.Memo, false},
+		{&cols.id, cfg.ID, false},
+	} {
+		if *c.dst, err = column(c.name, c.required); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Statement{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err // a csv.ParseError, which has the line
+		}
+		// The reader skips blank lines, so count lines by its position
+		line, _ := reader.FieldPos(0)
+		get := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if get(cols.date) == "" {
+			continue // blank lines and trailing totals
+		}
+
+		t := Transaction{ID: get(cols.id), Description: get(cols.description), Memo: get(cols.memo)}
+		if t.Date, err = parseDate(get(cols.date), cfg.DateFormat); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if cols.amount >= 0 && get(cols.amount) != "" {
+			if t.Amount, err = parseAmount(get(cols.amount), cfg.DecimalComma); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if cfg.DebitsPositive {
+				t.Amount = -t.Amount
+			}
+		} else {
+			if debit := get(cols.debit); debit != "" {
+				v, err := parseAmount(debit, cfg.DecimalComma)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				t.Amount -= math.Abs(v)
+			}
+			if credit := get(cols.credit); credit != "" {
+				v, err := parseAmount(credit, cfg.DecimalComma)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				t.Amount += math.Abs(v)
+			}
+		}
+		if err := add(s, t); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,99 @@
+package statement
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxOFXSize caps how much of an OFX file is read
+const maxOFXSize = 20 << 20
+
+// ParseOFX reads OFX 1.x (SGML, where leaf tags aren't closed) and OFX 2.x
+// (XML) statements. Only the transaction list and currency are read.
+func ParseOFX(r io.Reader) (*Statement, error) {
+	data, err := io.ReadAll(io.LimitReader(bufio.NewReader(r), maxOFXSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxOFXSize {
+		return nil, errors.New("statement is too large")
+	}
+	body := string(data)
+	start := strings.Index(strings.ToUpper(body), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("file is not an OFX statement")
+	}
+
+	s := &Statement{}
+	var (
+		current *Transaction
+		tag     string
+	)
+	for _, part := range strings.Split(body[start:], "<")[1:] {
+		end := strings.IndexByte(part, '>')
+		if end < 0 {
+			continue
+		}
+		tag = strings.ToUpper(strings.TrimSpace(part[:end]))
+		value := strings.TrimSpace(html.UnescapeString(part[end+1:]))
+
+		switch tag {
+		case "STMTTRN":
+			current = &Transaction{}
+			continue
+		case "/STMTTRN":
+			if current != nil {
+				if current.Date.IsZero() {
+					return nil, fmt.Errorf("transaction %q has no date", current.ID)
+				}
+				if err := add(s, *current); err != nil {
+					return nil, err
+				}
+			}
+			current = nil
+			continue
+		case "CURDEF":
+			s.Currency = strings.ToUpper(value)
+			continue
+		}
+		if current == nil || value == "" {
+			continue
+		}
+
+		switch tag {
+		case "FITID":
+			current.ID = value
+		case "DTPOSTED":
+			if current.Date, err = ofxDate(value); err != nil {
+				return nil, err
+			}
+		case "TRNAMT":
+			if current.Amount, err = parseAmount(value, false); err != nil {
+				return nil, err
+			}
+		case "NAME", "PAYEE":
+			current.Description = value
+		case "MEMO":
+			current.Memo = value
+		}
+	}
+	return s, nil
+}
+
+// ofxDate reads YYYYMMDD with an optional time and [offset:zone] suffix. Only
+// the date is kept.
+func ofxDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("date %q is not YYYYMMDD", value)
+	}
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %q is not YYYYMMDD", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,114 @@
+package statement
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseQIF reads a QIF bank or card register. dateFormat picks between
+// month-first (the default, as Quicken writes it) and day-first dates.
+func ParseQIF(r io.Reader, dateFormat string) (*Statement, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	dateFormat = qifFormat(dateFormat)
+	s := &Statement{}
+	var (
+		current Transaction
+		started bool
+		dated   bool
+	)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\uFEFF")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		code, value := text[0], strings.TrimSpace(text[1:])
+
+		var err error
+		switch code {
+		case '!':
+			// Section headers such as !Type:Bank
+		case 'D':
+			if current.Date, err = parseDate(qifDate(value), dateFormat); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			started, dated = true, true
+		case 'T', 'U':
+			if current.Amount, err = parseAmount(value, false); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			started = true
+		case 'P':
+			current.Description, started = value, true
+		case 'M':
+			current.Memo, started = value, true
+		case 'L':
+			// Transfers are written as [Account]
+			if !strings.HasPrefix(value, "[") {
+				current.Category = value
+			}
+			started = true
+		case '^':
+			if started {
+				if !dated {
+					return nil, fmt.Errorf("line %d: transaction has no date", line)
+				}
+				if err := add(s, current); err != nil {
+					return nil, err
+				}
+			}
+			current, started, dated = Transaction{}, false, false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// qifFormat turns a day- or month-first format into the one qifDate's
+// output is in, such as DD/MM/YY into DD/MM/YYYY
+func qifFormat(format string) string {
+	f := strings.ToUpper(strings.TrimSpace(format))
+	if f == "" || strings.HasPrefix(f, "YYYY") {
+		return format
+	}
+	f = strings.NewReplacer("-", "/", ".", "/").Replace(f)
+	if !strings.HasSuffix(f, "YYYY") {
+		f = strings.TrimSuffix(f, "YY") + "YYYY"
+	}
+	if _, ok := dateLayouts[f]; !ok {
+		return format // parseDate reports it as unknown
+	}
+	return f
+}
+
+// qifDate rewrites Quicken's dates, such as 1/ 2'05 or 01/02/2005, with
+// slashes and a four-digit year
+func qifDate(value string) string {
+	value = strings.ReplaceAll(value, " ", "")
+	if len(value) >= 4 && !strings.ContainsAny(value[:4], "/-'.") {
+		return value // year first, such as 2005-01-02
+	}
+	value = strings.NewReplacer("'", "/", "-", "/", ".", "/").Replace(value)
+	parts := strings.Split(value, "/")
+	if len(parts) != 3 {
+		return value
+	}
+	if year, err := strconv.Atoi(parts[2]); err == nil && len(parts[2]) <= 2 {
+		if year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+		parts[2] = strconv.Itoa(year)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,174 @@
+// Package statement reads bank statements in OFX, QIF and CSV. Everything is
+// parsed locally; nothing is sent to the bank or a third party.
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatOFX = "ofx"
+	FormatQIF = "qif"
+	FormatCSV = "csv"
+)
+
+// MaxTransactions caps the transactions read from one statement
+const MaxTransactions = 10000
+
+var (
+	ErrUnknownFormat = errors.New("format must be ofx, qif or csv")
+	ErrEmpty         = errors.New("statement has no transactions")
+)
+
+// Transaction is one statement line. Amount is negative for money leaving
+// the account. ID is the bank's own transaction ID when the format has one.
+type Transaction struct {
+	ID          string    `json:"id,omitempty"`
+	Date        time.Time `json:"date"`
+	Amount      float64   `json:"amount"`
+	Description string    `json:"description"`
+	Memo        string    `json:"memo,omitempty"`
+	Category    string    `json:"category,omitempty"` // from QIF files
+}
+
+// Statement is a parsed file. Currency is empty when the format doesn't say.
+type Statement struct {
+	Currency     string
+	Transactions []Transaction
+}
+
+// Detect guesses the format from the file name, then from the content
+func Detect(name string, head []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ofx", ".qfx":
+		return FormatOFX
+	case ".qif":
+		return FormatQIF
+	case ".csv":
+		return FormatCSV
+	}
+	text := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(string(head), "\uFEFF")))
+	switch {
+	case strings.HasPrefix(text, "OFXHEADER") || strings.Contains(text, "<OFX>"):
+		return FormatOFX
+	case strings.HasPrefix(text, "!TYPE:") || strings.HasPrefix(text, "!ACCOUNT"):
+		return FormatQIF
+	}
+	return FormatCSV
+}
+
+// Parse reads a statement in format. csv is only used for CSV files.
+func Parse(format string, r io.Reader, csv CSVConfig) (*Statement, error) {
+	var (
+		s   *Statement
+		err error
+	)
+	switch format {
+	case FormatOFX:
+		s, err = ParseOFX(r)
+	case FormatQIF:
+		s, err = ParseQIF(r, csv.DateFormat)
+	case FormatCSV:
+		s, err = ParseCSV(r, csv)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Transactions) == 0 {
+		return nil, ErrEmpty
+	}
+	return s, nil
+}
+
+// dateLayouts maps the date formats users can name to Go layouts
+var dateLayouts = map[string]string{
+	"YYYY-MM-DD": "2006-01-02",
+	"MM/DD/YYYY": "01/02/2006",
+	"DD/MM/YYYY": "02/01/2006",
+	"DD.MM.YYYY": "02.01.2006",
+	"DD-MM-YYYY": "02-01-2006",
+	"YYYYMMDD":   "20060102",
+	"MM/DD/YY":   "01/02/06",
+	"DD/MM/YY":   "02/01/06",
+}
+
+// defaultLayouts are tried in order when no date format is given
+var defaultLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "20060102", "02.01.2006"}
+
+func parseDate(value, format string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	layouts := defaultLayouts
+	if format != "" {
+		layout, ok := dateLayouts[strings.ToUpper(format)]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown date format %q", format)
+		}
+		layouts = []string{layout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+		// Day and month without leading zeros
+		if t, err := time.Parse(strings.NewReplacer("01", "1", "02", "2").Replace(layout), value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date %q doesn't match %s", value, strings.Join(layouts, " or "))
+}
+
+// parseAmount reads a money amount. decimalComma swaps the roles of "." and
+// ",", as in "1.234,56". Parentheses and a trailing minus mean negative.
+func parseAmount(value string, decimalComma bool) (float64, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative, s = true, s[1:len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		negative, s = true, strings.TrimSuffix(s, "-")
+	}
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '-', r == '+', r == '.', r == ',':
+			return r
+		}
+		return -1 // currency symbols and spaces
+	}, s)
+	if decimalComma {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("amount %q is not a number", value)
+	}
+	if negative {
+		v = -math.Abs(v)
+	}
+	return math.Round(v*100) / 100, nil
+}
+
+func add(s *Statement, t Transaction) error {
+	if len(s.Transactions) == MaxTransactions {
+		return fmt.Errorf("statement has more than %d transactions", MaxTransactions)
+	}
+	t.Description = strings.Join(strings.Fields(t.Description), " ")
+	t.Memo = strings.Join(strings.Fields(t.Memo), " ")
+	if t.Description == "" {
+		t.Description = t.Memo
+	}
+	s.Transactions = append(s.Transactions, t)
+	return nil
+}
@@ -0,0 +1,330 @@
+package statement
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20240305120000</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>1<STMTRS>
+<CURDEF>inr
+<BANKACCTFROM><BANKID>HDFC0001<ACCTID>50100012345<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST><DTSTART>20240301<DTEND>20240305
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240302093000[+5:30:IST]
+<TRNAMT>-1,250.00
+<FITID>202403020001
+<NAME>SWIGGY   BANGALORE
+<MEMO>UPI/4061234/food
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240304
+<TRNAMT>45000
+<FITID>202403040007
+<NAME>SALARY ACME &amp; CO
+</STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20240115000000.000[-5:EST]</DTPOSTED>
+            <TRNAMT>-42.50</TRNAMT>
+            <FITID>3A9F-0115</FITID>
+            <PAYEE>Café Nero</PAYEE>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20240116</DTPOSTED>
+            <TRNAMT>-9.99</TRNAMT>
+            <FITID>3A9F-0116</FITID>
+            <MEMO>SPOTIFY P2B1C3</MEMO>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		currency string
+		want     []Transaction
+	}{
+		{"sgml", ofxSGML, "INR", []Transaction{
+			{ID: "202403020001", Date: day("2024-03-02"), Amount: -1250, Description: "SWIGGY BANGALORE", Memo: "UPI/4061234/food"},
+			{ID: "202403040007", Date: day("2024-03-04"), Amount: 45000, Description: "SALARY ACME & CO"},
+		}},
+		{"xml", ofxXML, "EUR", []Transaction{
+			{ID: "3A9F-0115", Date: day("2024-01-15"), Amount: -42.5, Description: "Café Nero"},
+			{ID: "3A9F-0116", Date: day("2024-01-16"), Amount: -9.99, Description: "SPOTIFY P2B1C3", Memo: "SPOTIFY P2B1C3"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseOFX(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("ParseOFX: %v", err)
+			}
+			if s.Currency != tt.currency {
+				t.Errorf("currency = %q, want %q", s.Currency, tt.currency)
+			}
+			if !reflect.DeepEqual(s.Transactions, tt.want) {
+				t.Errorf("transactions = %+v, want %+v", s.Transactions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOFXRejects(t *testing.T) {
+	tests := map[string]string{
+		"not ofx":  "Date,Amount\n2024-01-01,5\n",
+		"no date":  "<OFX><STMTTRN><TRNAMT>-5<FITID>1</STMTTRN></OFX>",
+		"bad date": "<OFX><STMTTRN><DTPOSTED>2024-01-01<TRNAMT>-5</STMTTRN></OFX>",
+		"amount":   "<OFX><STMTTRN><DTPOSTED>20240101<TRNAMT>five</STMTTRN></OFX>",
+	}
+	for name, file := range tests {
+		if _, err := ParseOFX(strings.NewReader(file)); err == nil {
+			t.Errorf("%s: ParseOFX succeeded", name)
+		}
+	}
+}
+
+const qifBank = "\uFEFF!Type:Bank\r\n" +
+	"D1/ 2'24\r\n" +
+	"T-1,234.50\r\n" +
+	"PAMAZON   MKTPLACE\r\n" +
+	"LShopping\r\n" +
+	"^\r\n" +
+	"\r\n" +
+	"D12/31/99\r\n" +
+	"U-20.00\r\n" +
+	"MATM withdrawal\r\n" +
+	"L[Savings]\r\n" +
+	"^\r\n"
+
+const qifDayFirst = `!Type:CCard
+D25/12/23
+T-899.00
+PCROMA RETAIL
+^
+D03/01/24
+T150.00
+PRefund
+^
+`
+
+func TestParseQIF(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		format string
+		want   []Transaction
+	}{
+		{"quicken", qifBank, "", []Transaction{
+			{Date: day("2024-01-02"), Amount: -1234.5, Description: "AMAZON MKTPLACE", Category: "Shopping"},
+			{Date: day("1999-12-31"), Amount: -20, Description: "ATM withdrawal", Memo: "ATM withdrawal"},
+		}},
+		{"month first", qifBank, "MM/DD/YYYY", []Transaction{
+			{Date: day("2024-01-02"), Amount: -1234.5, Description: "AMAZON MKTPLACE", Category: "Shopping"},
+			{Date: day("1999-12-31"), Amount: -20, Description: "ATM withdrawal", Memo: "ATM withdrawal"},
+		}},
+		{"day first", qifDayFirst, "DD/MM/YY", []Transaction{
+			{Date: day("2023-12-25"), Amount: -899, Description: "CROMA RETAIL"},
+			{Date: day("2024-01-03"), Amount: 150, Description: "Refund"},
+		}},
+		{"day first, long year", qifDayFirst, "DD/MM/YYYY", []Transaction{
+			{Date: day("2023-12-25"), Amount: -899, Description: "CROMA RETAIL"},
+			{Date: day("2024-01-03"), Amount: 150, Description: "Refund"},
+		}},
+		{"day first with dots", "D25.12.2023\nT-5\nPTea\n^\n", "DD.MM.YYYY", []Transaction{
+			{Date: day("2023-12-25"), Amount: -5, Description: "Tea"},
+		}},
+		{"year first", "D2024-02-29\nT-5\nPTea\n^\n", "YYYY-MM-DD", []Transaction{
+			{Date: day("2024-02-29"), Amount: -5, Description: "Tea"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseQIF(strings.NewReader(tt.file), tt.format)
+			if err != nil {
+				t.Fatalf("ParseQIF: %v", err)
+			}
+			if !reflect.DeepEqual(s.Transactions, tt.want) {
+				t.Errorf("transactions = %+v, want %+v", s.Transactions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQIFRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		format string
+		err    string
+	}{
+		{"month first as day first", qifDayFirst, "", "line 2"},
+		{"no date", "!Type:Bank\nT-5\nPTea\n^\n", "", "line 4"},
+		{"amount", "!Type:Bank\nD01/02/24\nTfive\n^\n", "", "line 3"},
+		{"unknown format", qifDayFirst, "DD/MM", "unknown date format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseQIF(strings.NewReader(tt.file), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseQIF = %v, want an error about %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		cfg  CSVConfig
+		want []Transaction
+	}{
+		{"signed amount",
+			"\uFEFFDate,Description,Amount,Reference\n" +
+				"2024-03-01,\"UBER   *TRIP\",-312.40,TX1\n" +
+				"2024-03-02,Salary,\"50,000.00\",TX2\n",
+			CSVConfig{ID: "Reference"},
+			[]Transaction{
+				{ID: "TX1", Date: day("2024-03-01"), Amount: -312.4, Description: "UBER *TRIP"},
+				{ID: "TX2", Date: day("2024-03-02"), Amount: 50000, Description: "Salary"},
+			}},
+		{"debit and credit",
+			"Account,50100012345\n" +
+				"Period,Mar 2024\n" +
+				"Txn Date;Narration;Withdrawal;Deposit\n" +
+				"05/03/2024;ZOMATO ORDER;1.250,00;\n" +
+				"\n" +
+				"06/03/2024;NEFT ACME;;80.000,00\n" +
+				";Closing balance;;\n",
+			CSVConfig{SkipRows: 2, Delimiter: ";", Date: "txn date", Description: "Narration",
+				Debit: "Withdrawal", Credit: "Deposit", DateFormat: "DD/MM/YYYY", DecimalComma: true},
+			[]Transaction{
+				{Date: day("2024-03-05"), Amount: -1250, Description: "ZOMATO ORDER"},
+				{Date: day("2024-03-06"), Amount: 80000, Description: "NEFT ACME"},
+			}},
+		{"no header, debits positive",
+			"3/1/2024\tNetflix\t649.00\tmonthly\n" +
+				"3/2/2024\tRefund\t(100.00)\t\n",
+			CSVConfig{NoHeader: true, Delimiter: `\t`, Date: "1", Description: "2", Amount: "3", Memo: "4",
+				DebitsPositive: true},
+			[]Transaction{
+				{Date: day("2024-03-01"), Amount: -649, Description: "Netflix", Memo: "monthly"},
+				{Date: day("2024-03-02"), Amount: 100, Description: "Refund"},
+			}},
+		{"memo as description",
+			"Date,Description,Amount,Details\n01/15/24,,-7.5,COFFEE HOUSE\n",
+			CSVConfig{Memo: "Details", DateFormat: "MM/DD/YY"},
+			[]Transaction{
+				{Date: day("2024-01-15"), Amount: -7.5, Description: "COFFEE HOUSE", Memo: "COFFEE HOUSE"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCSV(strings.NewReader(tt.file), tt.cfg)
+			if err != nil {
+				t.Fatalf("ParseCSV: %v", err)
+			}
+			if !reflect.DeepEqual(s.Transactions, tt.want) {
+				t.Errorf("transactions = %+v, want %+v", s.Transactions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		cfg  CSVConfig
+		err  string
+	}{
+		{"missing column", "Date,Narration,Amount\n2024-03-01,Tea,-5\n", CSVConfig{}, `column "Description" not found`},
+		{"bad date after a blank line", "Date,Description,Amount\n2024-03-01,Tea,-5\n\n\n31/02/2024,Tea,-5\n",
+			CSVConfig{}, "line 5"},
+		{"bad amount", "Date,Description,Amount\n2024-03-01,Tea,five\n", CSVConfig{}, "line 2"},
+		{"skipped everything", "Account,1\n", CSVConfig{SkipRows: 3}, "skipRows"},
+		{"delimiter", "Date,Description,Amount\n", CSVConfig{Delimiter: ";;"}, "single character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(tt.file), tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseCSV = %v, want an error about %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("pdf", strings.NewReader(ofxSGML), CSVConfig{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("pdf = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Parse(FormatCSV, strings.NewReader("Date,Description,Amount\n"), CSVConfig{}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("header only = %v, want ErrEmpty", err)
+	}
+	s, err := Parse(FormatQIF, strings.NewReader(qifDayFirst), CSVConfig{DateFormat: "DD/MM/YY"})
+	if err != nil || len(s.Transactions) != 2 {
+		t.Errorf("QIF = %v, %v; want the date format passed on", s, err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"Statement.QFX", "", FormatOFX},
+		{"export.qif", "", FormatQIF},
+		{"march.CSV", "", FormatCSV},
+		{"download", ofxSGML, FormatOFX},
+		{"download", ofxXML, FormatOFX},
+		{"download", qifBank, FormatQIF},
+		{"download", qifDayFirst, FormatQIF},
+		{"download", "Date,Description,Amount\n", FormatCSV},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.name, []byte(tt.head)); got != tt.want {
+			t.Errorf("Detect(%q, %.20q) = %s, want %s", tt.name, tt.head, got, tt.want)
+		}
+	}
+}
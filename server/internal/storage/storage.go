@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore keeps uploaded files. Keys are slash separated paths such as
+// "receipts/<expense id>/<attachment id>".
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	// Open returns ErrNotFound when there is no blob with the key
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// FromEnv builds the store selected by STORAGE_DRIVER:
+//
+//	local (default)  files under STORAGE_DIR, default "./uploads"
+//	s3               an S3-compatible bucket, see S3ConfigFromEnv
+func FromEnv() (BlobStore, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		cfg, err := S3ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Store(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+// validKey rejects keys that could escape the store's root
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,315 @@
+package tax
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/export"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/schedule"
+	"gorm.io/gorm"
+)
+
+// UncategorizedIncome is used for income streams without a TaxCategory
+const UncategorizedIncome = "uncategorized"
+
+// deductibleTags mark an expense as tax deductible (compared case-insensitively)
+var deductibleTags = []string{"deductible", "tax-deductible", "tax_deductible"}
+
+// IsDeductible reports whether an expense has been tagged as deductible
+func IsDeductible(expense models.Expense) bool {
+	for _, tag := range expense.Tags {
+		for _, d := range deductibleTags {
+			if strings.EqualFold(strings.TrimSpace(tag), d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IncomeLine is the income from one stream during the year
+type IncomeLine struct {
+	IncomeStreamID string  `json:"incomeStreamId"`
+	Name           string  `json:"name"`
+	Amount         float64 `json:"amount"`
+	Payments       int     `json:"payments"`
+	// Estimated is set when no payments were recorded and the amount was
+	// projected from the stream's schedule instead
+	Estimated bool `json:"estimated"`
+}
+
+// CategoryTotal groups income lines by tax category
+type CategoryTotal struct {
+	TaxCategory string       `json:"taxCategory"`
+	Total       float64      `json:"total"`
+	Lines       []IncomeLine `json:"lines"`
+}
+
+type DeductibleExpense struct {
+	ExpenseID   string    `json:"expenseId"`
+	Date        time.Time `json:"date"`
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	Tags        []string  `json:"tags"`
+}
+
+// CurrencyTotal is the sum of amounts in one currency
+type CurrencyTotal struct {
+	Currency string  `json:"currency"`
+	Total    float64 `json:"total"`
+}
+
+// Summary is a year of income and deductible expenses. Income streams are
+// kept in the user's preferred currency, Currency, while expenses can be in
+// any, so deductible expenses are totalled per currency.
+type Summary struct {
+	Year               int                 `json:"year"`
+	Currency           string              `json:"currency"`
+	Income             []CategoryTotal     `json:"income"`
+	FreelanceIncome    []CategoryTotal     `json:"freelanceIncome"`
+	IncomeTotal        float64             `json:"incomeTotal"`
+	FreelanceTotal     float64             `json:"freelanceTotal"`
+	DeductibleExpenses []DeductibleExpense `json:"deductibleExpenses"`
+	DeductibleTotals   []CurrencyTotal     `json:"deductibleTotals"`
+}
+
+type Reporter struct {
+	db *gorm.DB
+}
+
+func NewReporter(db *gorm.DB) *Reporter {
+	return &Reporter{db: db}
+}
+
+// Summary builds the user's tax summary for a calendar year. Income comes from
+// recorded IncomeReceipts; streams with no receipts in the year are estimated
+// from their schedule up to today. Freelance income is reported separately
+// from other income.
+func (r *Reporter) Summary(userID string, year int, now time.Time) (*Summary, error) {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, now.Location())
+	to := from.AddDate(1, 0, 0)
+
+	var user models.User
+	if err := r.db.Select("id", "preferred_currency").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("could not load user: %w", err)
+	}
+
+	var streams []models.IncomeStream
+	if err := r.db.Unscoped().Where("user_id = ?", userID).Find(&streams).Error; err != nil {
+		return nil, fmt.Errorf("could not load income streams: %w", err)
+	}
+
+	var receipts []models.IncomeReceipt
+	if err := r.db.Where("user_id = ? AND received_at >= ? AND received_at < ?", userID, from, to).
+		Order("received_at").
+		Find(&receipts).Error; err != nil {
+		return nil, fmt.Errorf("could not load income receipts: %w", err)
+	}
+
+	var expenses []models.Expense
+	if err := r.db.Where("user_id = ? AND date >= ? AND date < ?", userID, from, to).
+		Order("date").
+		Find(&expenses).Error; err != nil {
+		return nil, fmt.Errorf("could not load expenses: %w", err)
+	}
+
+	type key struct {
+		streamID    string
+		taxCategory string
+		freelance   bool
+	}
+	lines := make(map[key]*IncomeLine)
+	var order []key
+
+	add := func(k key, name string, amount float64, payments int, estimated bool) {
+		line, ok := lines[k]
+		if !ok {
+			line = &IncomeLine{IncomeStreamID: k.streamID, Name: name, Estimated: estimated}
+			lines[k] = line
+			order = append(order, k)
+		}
+		line.Amount += amount
+		line.Payments += payments
+	}
+
+	names := make(map[string]string)
+	for _, stream := range streams {
+		names[stream.ID] = stream.Name
+	}
+
+	received := make(map[string]bool)
+	for _, receipt := range receipts {
+		received[receipt.IncomeStreamID] = true
+		add(key{receipt.IncomeStreamID, receipt.TaxCategory, receipt.IsFreelance},
+			names[receipt.IncomeStreamID], receipt.Amount, 1, false)
+	}
+
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+	for _, stream := range streams {
+		if received[stream.ID] || stream.DeletedAt.Valid || !schedule.IsKnown(stream.Frequency) {
+			continue
+		}
+		if payments := estimatedPayments(stream, from, end); payments > 0 {
+			add(key{stream.ID, stream.TaxCategory, stream.IsFreelance},
+				stream.Name, stream.Amount*float64(payments), payments, true)
+		}
+	}
+
+	summary := &Summary{Year: year, Currency: user.PreferredCurrency}
+	regular := make(map[string]*CategoryTotal)
+	freelance := make(map[string]*CategoryTotal)
+	for _, k := range order {
+		line := lines[k]
+		category := k.taxCategory
+		if category == "" {
+			category = UncategorizedIncome
+		}
+
+		groups := regular
+		if k.freelance {
+			groups = freelance
+			summary.FreelanceTotal += line.Amount
+		}
+		summary.IncomeTotal += line.Amount
+
+		group, ok := groups[category]
+		if !ok {
+			group = &CategoryTotal{TaxCategory: category}
+			groups[category] = group
+		}
+		group.Total += line.Amount
+		group.Lines = append(group.Lines, *line)
+	}
+	summary.Income = sortedTotals(regular)
+	summary.FreelanceIncome = sortedTotals(freelance)
+
+	deductible := make(map[string]float64)
+	for _, expense := range expenses {
+		if !IsDeductible(expense) {
+			continue
+		}
+		currency := strings.ToUpper(strings.TrimSpace(expense.OriginalCurrency))
+		if currency == "" {
+			currency = summary.Currency
+		}
+		summary.DeductibleExpenses = append(summary.DeductibleExpenses, DeductibleExpense{
+			ExpenseID:   expense.ID,
+			Date:        expense.Date,
+			Category:    expense.Category,
+			Description: expense.Description,
+			Amount:      expense.Amount,
+			Currency:    currency,
+			Tags:        expense.Tags,
+		})
+		deductible[currency] += expense.Amount
+	}
+	for currency, total := range deductible {
+		summary.DeductibleTotals = append(summary.DeductibleTotals, CurrencyTotal{Currency: currency, Total: total})
+	}
+	sort.Slice(summary.DeductibleTotals, func(i, j int) bool {
+		return summary.DeductibleTotals[i].Currency < summary.DeductibleTotals[j].Currency
+	})
+
+	return summary, nil
+}
+
+// estimatedPayments counts the scheduled payments of a stream within
+// [from, to). The schedule is anchored on LastReceived, NextExpected or, for
+// streams that were never scheduled, the date the stream was added; payments
+// before the stream was added are not counted.
+func estimatedPayments(stream models.IncomeStream, from, to time.Time) int {
+	anchor := stream.CreatedAt
+	switch {
+	case stream.LastReceived != nil:
+		anchor = *stream.LastReceived
+	case stream.NextExpected != nil:
+		anchor = *stream.NextExpected
+	}
+
+	// Walk back to the first occurrence on or after the stream was created
+	n := 0
+	for !schedule.Shift(anchor, stream.Frequency, n-1).Before(stream.CreatedAt) {
+		n--
+	}
+
+	count := 0
+	for ; ; n++ {
+		date := schedule.Shift(anchor, stream.Frequency, n)
+		if !date.Before(to) {
+			break
+		}
+		if !date.Before(from) && !date.Before(stream.CreatedAt) {
+			count++
+		}
+	}
+	return count
+}
+
+func sortedTotals(groups map[string]*CategoryTotal) []CategoryTotal {
+	totals := make([]CategoryTotal, 0, len(groups))
+	for _, group := range groups {
+		totals = append(totals, *group)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].TaxCategory < totals[j].TaxCategory
+	})
+	return totals
+}
+
+// WriteCSV writes the summary as a flat CSV with one row per income line and
+// deductible expense, followed by total rows, one per currency for
+// deductible expenses. Text users wrote is escaped like expense exports, so
+// spreadsheet apps don't run it as a formula.
+func WriteCSV(w io.Writer, s *Summary) error {
+	cw := csv.NewWriter(w)
+
+	rows := [][]string{{"section", "tax_category", "source", "date", "description", "amount", "currency", "payments", "estimated"}}
+
+	incomeRows := func(section string, totals []CategoryTotal) {
+		for _, group := range totals {
+			for _, line := range group.Lines {
+				rows = append(rows, []string{
+					section, export.SafeText(group.TaxCategory), export.SafeText(line.Name), "", "",
+					money(line.Amount), s.Currency, strconv.Itoa(line.Payments), strconv.FormatBool(line.Estimated),
+				})
+			}
+		}
+	}
+	incomeRows("income", s.Income)
+	incomeRows("freelance_income", s.FreelanceIncome)
+
+	for _, e := range s.DeductibleExpenses {
+		rows = append(rows, []string{
+			"deductible_expense", export.SafeText(e.Category), "", e.Date.Format("2006-01-02"), export.SafeText(e.Description),
+			money(e.Amount), e.Currency, "", "",
+		})
+	}
+
+	rows = append(rows,
+		[]string{"total", "income", "", "", "", money(s.IncomeTotal), s.Currency, "", ""},
+		[]string{"total", "freelance_income", "", "", "", money(s.FreelanceTotal), s.Currency, "", ""},
+	)
+	for _, total := range s.DeductibleTotals {
+		rows = append(rows, []string{"total", "deductible_expenses", "", "", "", money(total.Total), total.Currency, "", ""})
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("could not write tax summary csv: %w", err)
+	}
+	return nil
+}
+
+func money(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
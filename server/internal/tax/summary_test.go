@@ -0,0 +1,125 @@
+package tax
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func at(t time.Time) *time.Time { return &t }
+
+func TestEstimatedPayments(t *testing.T) {
+	from, to := date(2026, 1, 1), date(2027, 1, 1)
+	stream := func(frequency string, created time.Time, last, next *time.Time) models.IncomeStream {
+		return models.IncomeStream{Base: models.Base{CreatedAt: created}, Frequency: frequency, LastReceived: last, NextExpected: next}
+	}
+	tests := []struct {
+		name   string
+		stream models.IncomeStream
+		to     time.Time
+		want   int
+	}{
+		{"monthly all year", stream("monthly", date(2025, 6, 15), nil, nil), to, 12},
+		{"added mid year", stream("monthly", date(2026, 7, 1), nil, nil), to, 6},
+		{"up to today", stream("monthly", date(2025, 6, 15), nil, nil), date(2026, 4, 1), 3},
+		{"anchored on last payment", stream("weekly", date(2025, 1, 1), at(date(2026, 12, 25)), nil), to, 52},
+		{"anchored on next payment", stream("quarterly", date(2025, 1, 1), nil, at(date(2026, 2, 10))), to, 4},
+		{"not before it was added", stream("yearly", date(2026, 3, 1), nil, at(date(2026, 2, 1))), to, 0},
+		{"added after the year", stream("monthly", date(2027, 2, 1), nil, nil), to, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimatedPayments(tt.stream, from, tt.to); got != tt.want {
+				t.Errorf("estimatedPayments = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	const (
+		userID = "00000000-0000-4000-8000-0000000000a1"
+		salary = "00000000-0000-4000-8000-0000000000c1"
+		design = "00000000-0000-4000-8000-0000000000c2"
+	)
+	db, fake := dbtest.Open()
+	fake.Add("users", dbtest.Row{"id": userID, "preferred_currency": "INR"})
+	fake.Add("income_streams",
+		dbtest.Row{"id": salary, "user_id": userID, "name": "Acme", "frequency": "monthly", "amount": 1000.0,
+			"tax_category": "salary", "is_freelance": false, "created_at": date(2025, 1, 1), "deleted_at": nil},
+		dbtest.Row{"id": design, "user_id": userID, "name": "Logo work", "frequency": "whenever", "amount": 0.0,
+			"tax_category": "", "is_freelance": true, "created_at": date(2025, 1, 1), "deleted_at": nil},
+	)
+	fake.Add("income_receipts",
+		dbtest.Row{"user_id": userID, "income_stream_id": design, "amount": 300.0, "received_at": date(2026, 2, 1), "is_freelance": true, "tax_category": ""},
+		dbtest.Row{"user_id": userID, "income_stream_id": design, "amount": 200.0, "received_at": date(2026, 3, 1), "is_freelance": true, "tax_category": ""},
+	)
+	fake.Add("expenses",
+		dbtest.Row{"user_id": userID, "date": date(2026, 2, 2), "amount": 50.0, "original_currency": "usd", "tags": `["Deductible"]`},
+		dbtest.Row{"user_id": userID, "date": date(2026, 2, 3), "amount": 900.0, "original_currency": "INR", "tags": `["tax-deductible"]`},
+		dbtest.Row{"user_id": userID, "date": date(2026, 2, 4), "amount": 25.0, "original_currency": "USD", "tags": `["deductible"]`},
+		dbtest.Row{"user_id": userID, "date": date(2026, 2, 5), "amount": 70.0, "original_currency": "USD", "tags": `["food"]`},
+	)
+
+	s, err := NewReporter(db).Summary(userID, 2026, date(2026, 4, 15))
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if s.Currency != "INR" || s.IncomeTotal != 4500 || s.FreelanceTotal != 500 {
+		t.Errorf("income %v, freelance %v in %s; want 4500, 500 in INR", s.IncomeTotal, s.FreelanceTotal, s.Currency)
+	}
+	if len(s.Income) != 1 || s.Income[0].TaxCategory != "salary" || !s.Income[0].Lines[0].Estimated || s.Income[0].Lines[0].Payments != 4 {
+		t.Errorf("income = %+v, want 4 estimated salary payments", s.Income)
+	}
+	if len(s.FreelanceIncome) != 1 || s.FreelanceIncome[0].TaxCategory != UncategorizedIncome || s.FreelanceIncome[0].Lines[0].Payments != 2 {
+		t.Errorf("freelance income = %+v, want 2 uncategorized payments", s.FreelanceIncome)
+	}
+	want := []CurrencyTotal{{"INR", 900}, {"USD", 75}}
+	if !reflect.DeepEqual(s.DeductibleTotals, want) {
+		t.Errorf("deductible totals = %v, want %v", s.DeductibleTotals, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	s := &Summary{
+		Year:     2026,
+		Currency: "INR",
+		Income: []CategoryTotal{{TaxCategory: "=salary", Total: 1000, Lines: []IncomeLine{
+			{Name: "@Acme", Amount: 1000, Payments: 1}}}},
+		IncomeTotal: 1000,
+		DeductibleExpenses: []DeductibleExpense{
+			{Date: date(2026, 2, 2), Category: "+Office", Description: `=HYPERLINK("http://x","y")`, Amount: -5, Currency: "USD"},
+		},
+		DeductibleTotals: []CurrencyTotal{{"INR", 900}, {"USD", -5}},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, s); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("reading the CSV back: %v", err)
+	}
+
+	want := [][]string{
+		{"section", "tax_category", "source", "date", "description", "amount", "currency", "payments", "estimated"},
+		{"income", "'=salary", "'@Acme", "", "", "1000.00", "INR", "1", "false"},
+		{"deductible_expense", "'+Office", "", "2026-02-02", `'=HYPERLINK("http://x","y")`, "-5.00", "USD", "", ""},
+		{"total", "income", "", "", "", "1000.00", "INR", "", ""},
+		{"total", "freelance_income", "", "", "", "0.00", "INR", "", ""},
+		{"total", "deductible_expenses", "", "", "", "900.00", "INR", "", ""},
+		{"total", "deductible_expenses", "", "", "", "-5.00", "USD", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV =\n%v\nwant\n%v", rows, want)
+	}
+}
@@ -0,0 +1,156 @@
+package taxonomy
+
+import (
+	"errors"
+	"log"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// defaultCategory is a system category and the names of its subcategories,
+// which share its icon and colour
+type defaultCategory struct {
+	Name     string
+	Icon     string
+	Color    string
+	Children []string
+}
+
+// defaults are the system categories. They include every category the
+// expense parser and the global category rules pick.
+var defaults = []defaultCategory{
+	{"Food", "restaurant", "#F97316", []string{"Groceries", "Restaurants", "Coffee"}},
+	{"Transport", "directions_car", "#3B82F6", []string{"Fuel", "Taxi", "Public Transport", "Parking"}},
+	{"Travel", "flight", "#06B6D4", []string{"Flights", "Hotels"}},
+	{"Housing", "home", "#8B5CF6", []string{"Rent", "Utilities", "Maintenance"}},
+	{"Entertainment", "movie", "#EC4899", []string{"Movies", "Subscriptions", "Games"}},
+	{"Shopping", "shopping_bag", "#EAB308", []string{"Clothes", "Electronics", "Gifts"}},
+	{"Health", "favorite", "#EF4444", []string{"Pharmacy", "Doctor", "Fitness"}},
+	{"Education", "school", "#14B8A6", nil},
+	{"Personal Care", "spa", "#F472B6", nil},
+	{"Bills & Fees", "receipt", "#64748B", []string{"Insurance", "Taxes", "Bank Fees"}},
+	// Money paid back between people, such as Splitwise payments
+	{"Transfers", "swap_horiz", "#10B981", nil},
+	{Other, "category", "#9CA3AF", nil},
+}
+
+// aliases map other common names, including Splitwise's categories, to the
+// system category they mean
+var aliases = map[string]string{
+	"grocery": "Groceries", "supermarket": "Groceries",
+	"dining": "Restaurants", "dining out": "Restaurants", "eating out": "Restaurants", "restaurant": "Restaurants",
+	"transportation": "Transport", "commute": "Transport", "car": "Transport",
+	"gas/fuel": "Fuel", "petrol": "Fuel",
+	"cab": "Taxi", "bus/train": "Public Transport", "public transit": "Public Transport",
+	"plane": "Flights", "flight": "Flights", "hotel": "Hotels",
+	"mortgage": "Housing", "household": "Housing", "household supplies": "Housing", "furniture": "Housing",
+	"bills": "Utilities", "utility": "Utilities", "electricity": "Utilities", "water": "Utilities",
+	"heat/gas": "Utilities", "tv/phone/internet": "Utilities", "internet": "Utilities",
+	"movie": "Movies", "subscription": "Subscriptions", "music": "Entertainment",
+	"clothing": "Clothes", "gift": "Gifts",
+	"medical": "Health", "medical expenses": "Health", "healthcare": "Health", "medicine": "Pharmacy",
+	"gym": "Fitness", "sports": "Fitness",
+	"tax": "Taxes", "fees": "Bank Fees", "bank charges": "Bank Fees",
+	"payment": "Transfers", "transfer": "Transfers", "settlement": "Transfers",
+	"general": Other, "misc": Other, "miscellaneous": Other, "others": Other,
+	"uncategorized": Other, "uncategorised": Other,
+}
+
+// SeedDefaults adds the system categories that are missing, so defaults
+// added later reach existing databases
+func SeedDefaults(db *gorm.DB) error {
+	var existing []models.Category
+	if err := db.Where("user_id IS NULL AND group_id IS NULL").Find(&existing).Error; err != nil {
+		return err
+	}
+	bySlug := make(map[string]*models.Category, len(existing))
+	for i := range existing {
+		bySlug[existing[i].Slug] = &existing[i]
+	}
+
+	add := func(name, icon, color string, parentID *string, position int) (*models.Category, error) {
+		if category, ok := bySlug[Slug(name)]; ok {
+			return category, nil
+		}
+		category := &models.Category{
+			Name:     name,
+			Slug:     Slug(name),
+			ParentID: parentID,
+			Icon:     icon,
+			Color:    color,
+			Position: position,
+		}
+		if err := db.Create(category).Error; err != nil {
+			return nil, err
+		}
+		return category, nil
+	}
+	for i, d := range defaults {
+		parent, err := add(d.Name, d.Icon, d.Color, nil, i)
+		if err != nil {
+			return err
+		}
+		for j, child := range d.Children {
+			if _, err := add(child, d.Icon, d.Color, &parent.ID, j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Migrate links expenses, recurring expenses and budgets saved before
+// categories were managed to a category. Their free-text category is looked
+// up like a client's would be; names that match nothing become custom
+// categories of the user, or of the group for group rows, so no one loses
+// the categories they used. Linked rows are skipped, so running it on every
+// start is cheap.
+func Migrate(db *gorm.DB) error {
+	s := New(db)
+	for _, model := range categorized {
+		var rows []struct {
+			UserID   string
+			GroupID  *string
+			Category string
+		}
+		if err := db.Unscoped().Model(model).
+			Select("user_id, group_id, category").
+			Where("category_id IS NULL").
+			Group("user_id, group_id, category").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			scope := ScopeOf(row.UserID, row.GroupID)
+			category, err := s.Find(scope, "", row.Category)
+			if errors.Is(err, ErrUnknown) {
+				category = &models.Category{Name: row.Category}
+				if err = s.Create(scope, category); errors.Is(err, ErrInvalid) {
+					log.Printf("taxonomy: could not keep category %q, using %s: %v", row.Category, Other, err)
+					category, err = s.system(Other)
+				}
+			} else if errors.Is(err, ErrRequired) {
+				category, err = s.system(Other)
+			}
+			if err != nil {
+				return err
+			}
+
+			query := db.Unscoped().Model(model).Where("category_id IS NULL AND user_id = ? AND category = ?", row.UserID, row.Category)
+			if scope.GroupID != nil {
+				query = query.Where("group_id = ?", *scope.GroupID)
+			} else {
+				query = query.Where("group_id IS NULL")
+			}
+			if err := query.UpdateColumns(map[string]interface{}{
+				"category_id": category.ID,
+				"category":    category.Name,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package taxonomy
+
+import (
+	"testing"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+)
+
+const (
+	userID  = "00000000-0000-4000-8000-0000000000a1"
+	groupID = "00000000-0000-4000-8000-0000000000b1"
+)
+
+func expense(groupID *string, category string, categoryID *string) dbtest.Row {
+	return dbtest.Row{"user_id": userID, "group_id": groupID, "category": category, "category_id": categoryID}
+}
+
+func TestMigrate(t *testing.T) {
+	db, fake := dbtest.Open()
+	if err := SeedDefaults(db); err != nil {
+		t.Fatalf("SeedDefaults: %v", err)
+	}
+	// Seeding again adds nothing
+	seeded := len(fake.Rows("categories"))
+	if err := SeedDefaults(db); err != nil {
+		t.Fatalf("SeedDefaults: %v", err)
+	}
+	if n := len(fake.Rows("categories")); n != seeded {
+		t.Errorf("seeding twice left %d categories, want %d", n, seeded)
+	}
+
+	group, linked := groupID, "00000000-0000-4000-8000-0000000000c1"
+	fake.Add("expenses",
+		expense(nil, "grocery", nil),
+		expense(nil, "Pottery", nil),
+		expense(nil, " pottery", nil),
+		expense(&group, "Pottery", nil),
+		expense(nil, "", nil),
+		expense(nil, "Whatever", &linked),
+	)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	categories := map[string]dbtest.Row{}
+	for _, c := range fake.Rows("categories") {
+		categories[c["id"].(string)] = c
+	}
+	owner := func(c dbtest.Row) string {
+		switch {
+		case c["group_id"] != nil:
+			return "group"
+		case c["user_id"] != nil:
+			return "user"
+		}
+		return "system"
+	}
+
+	want := []struct {
+		category string
+		owner    string
+	}{
+		{"Groceries", "system"},
+		{"Pottery", "user"},
+		{"Pottery", "user"},
+		{"Pottery", "group"},
+		{Other, "system"},
+	}
+	rows := fake.Rows("expenses")
+	var userPottery interface{}
+	for i, w := range want {
+		row := rows[i]
+		id, _ := row["category_id"].(string)
+		c, ok := categories[id]
+		if !ok {
+			t.Errorf("expense %d (%q) links to %v, not a category", i, row["category"], row["category_id"])
+			continue
+		}
+		if row["category"] != w.category || c["name"] != w.category || owner(c) != w.owner {
+			t.Errorf("expense %d is in %v, the %s category %v; want the %s category %s",
+				i, row["category"], owner(c), c["name"], w.owner, w.category)
+		}
+		if w.owner == "user" {
+			if userPottery != nil && userPottery != id {
+				t.Errorf("expense %d made a second category for the same name", i)
+			}
+			userPottery = id
+		}
+	}
+	if id, _ := rows[5]["category_id"].(string); id != linked || rows[5]["category"] != "Whatever" {
+		t.Errorf("linked expense changed to %v (%v)", rows[5]["category"], rows[5]["category_id"])
+	}
+	if n := len(fake.Rows("categories")); n != seeded+2 {
+		t.Errorf("Migrate left %d categories, want %d", n, seeded+2)
+	}
+}
@@ -0,0 +1,402 @@
+// Package taxonomy manages expense categories: the system defaults everyone
+// shares, custom categories of users and groups, and working out which
+// category a name a client sends means.
+package taxonomy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// Other is the system category for anything that fits nowhere else
+	Other = "Other"
+
+	MaxNameLength = 50
+	MaxIconLength = 32
+	// MaxCustomCategories caps the custom categories of one user or group
+	MaxCustomCategories = 200
+)
+
+var (
+	ErrRequired = errors.New("category is required")
+	ErrUnknown  = errors.New("unknown category")
+	// ErrInvalid wraps the reasons a custom category can't be saved
+	ErrInvalid = errors.New("invalid category")
+	ErrTooMany = fmt.Errorf("%w: at most %d custom categories are allowed", ErrInvalid, MaxCustomCategories)
+)
+
+var (
+	colorPattern = regexp.MustCompile(`^#[0-9A-F]{6}$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// categorized are the models that carry a category
+var categorized = []interface{}{&models.Expense{}, &models.RecurringExpense{}, &models.Budget{}}
+
+// IsID reports whether id looks like a category id, so malformed ones can
+// be turned away before reaching the database
+func IsID(id string) bool {
+	return uuidPattern.MatchString(id)
+}
+
+// Slug folds a category name for comparison
+func Slug(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Scope says whose custom categories can be used besides the system ones:
+// the group's for group expenses and budgets, otherwise the user's
+type Scope struct {
+	UserID  string
+	GroupID *string
+}
+
+// ScopeOf returns the scope of something belonging to userID and, when
+// groupID is set, to a group
+func ScopeOf(userID string, groupID *string) Scope {
+	if groupID != nil && *groupID == "" {
+		groupID = nil
+	}
+	return Scope{UserID: userID, GroupID: groupID}
+}
+
+// visible limits a query to the categories the scope can use
+func (s Scope) visible(db *gorm.DB) *gorm.DB {
+	if s.GroupID != nil {
+		return db.Where("((user_id IS NULL AND group_id IS NULL) OR group_id = ?)", *s.GroupID)
+	}
+	return db.Where("((user_id IS NULL AND group_id IS NULL) OR (user_id = ? AND group_id IS NULL))", s.UserID)
+}
+
+// owned limits a query to the scope's custom categories
+func (s Scope) owned(db *gorm.DB) *gorm.DB {
+	if s.GroupID != nil {
+		return db.Where("group_id = ?", *s.GroupID)
+	}
+	return db.Where("user_id = ? AND group_id IS NULL", s.UserID)
+}
+
+// Owns reports whether category is one of the scope's custom categories
+func (s Scope) Owns(category *models.Category) bool {
+	if s.GroupID != nil {
+		return category.GroupID != nil && *category.GroupID == *s.GroupID
+	}
+	return category.GroupID == nil && category.UserID != nil && *category.UserID == s.UserID
+}
+
+// Of returns the scope a custom category belongs to
+func Of(category *models.Category) Scope {
+	scope := Scope{GroupID: category.GroupID}
+	if category.UserID != nil {
+		scope.UserID = *category.UserID
+	}
+	return scope
+}
+
+// Service looks up and changes categories
+type Service struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// List returns the categories the scope can use, in display order
+func (s *Service) List(scope Scope) ([]models.Category, error) {
+	var categories []models.Category
+	if err := scope.visible(s.db).
+		Order("user_id IS NOT NULL OR group_id IS NOT NULL, position, name").
+		Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Find returns the category with id or, when id is empty, the one called
+// name. Custom categories win over system ones with the same name, and a few
+// common names such as "grocery" or "dining out" find the system category
+// they mean.
+func (s *Service) Find(scope Scope, id, name string) (*models.Category, error) {
+	var category models.Category
+	if id = strings.TrimSpace(id); id != "" {
+		if !IsID(id) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknown, id)
+		}
+		err := scope.visible(s.db.Where("id = ?", id)).First(&category).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknown, id)
+		}
+		return &category, err
+	}
+
+	slug := Slug(name)
+	if slug == "" {
+		return nil, ErrRequired
+	}
+	err := scope.visible(s.db.Where("slug = ?", slug)).
+		Order("user_id IS NULL AND group_id IS NULL").
+		First(&category).Error
+	if err == nil {
+		return &category, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if alias, ok := aliases[slug]; ok {
+		return s.system(alias)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknown, strings.TrimSpace(name))
+}
+
+// FindOrOther is Find for categories no one picked from the list, such as
+// imported or guessed ones: names that match nothing become Other
+func (s *Service) FindOrOther(scope Scope, name string) (*models.Category, error) {
+	category, err := s.Find(scope, "", name)
+	if errors.Is(err, ErrUnknown) || errors.Is(err, ErrRequired) {
+		return s.system(Other)
+	}
+	return category, err
+}
+
+func (s *Service) system(name string) (*models.Category, error) {
+	var category models.Category
+	if err := s.db.Where("slug = ? AND user_id IS NULL AND group_id IS NULL", Slug(name)).
+		First(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Validate tidies the fields a client sets on a custom category and checks
+// them on their own; Create and Update check them against other categories
+func Validate(category *models.Category) error {
+	category.Name = strings.Join(strings.Fields(category.Name), " ")
+	category.Slug = Slug(category.Name)
+	category.Icon = strings.TrimSpace(category.Icon)
+	category.Color = strings.ToUpper(strings.TrimSpace(category.Color))
+	if category.ParentID != nil && *category.ParentID == "" {
+		category.ParentID = nil
+	}
+	switch {
+	case category.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	case utf8.RuneCountInString(category.Name) > MaxNameLength:
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalid, MaxNameLength)
+	case utf8.RuneCountInString(category.Icon) > MaxIconLength:
+		return fmt.Errorf("%w: icon must be at most %d characters", ErrInvalid, MaxIconLength)
+	case category.Color != "" && !colorPattern.MatchString(category.Color):
+		return fmt.Errorf("%w: color must look like #1A2B3C", ErrInvalid)
+	}
+	return nil
+}
+
+// check validates a custom category against the others its scope can see.
+// Names must be unique among them, and a parent must be one of them, on the
+// top level and not the category itself. Categories with subcategories stay
+// on the top level.
+func (s *Service) check(db *gorm.DB, scope Scope, category *models.Category) error {
+	var taken int64
+	query := scope.visible(db.Model(&models.Category{}).Where("slug = ?", category.Slug))
+	if category.ID != "" {
+		query = query.Where("id <> ?", category.ID)
+	}
+	if err := query.Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return errTaken(category)
+	}
+
+	if category.ParentID == nil {
+		return nil
+	}
+	if *category.ParentID == category.ID {
+		return fmt.Errorf("%w: a category can't be its own parent", ErrInvalid)
+	}
+	parent, err := s.Find(scope, *category.ParentID, "")
+	if errors.Is(err, ErrUnknown) {
+		return fmt.Errorf("%w: parent not found", ErrInvalid)
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != nil {
+		return fmt.Errorf("%w: subcategories can't have subcategories", ErrInvalid)
+	}
+	if category.ID != "" {
+		var children int64
+		if err := db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return fmt.Errorf("%w: a category with subcategories can't have a parent", ErrInvalid)
+		}
+	}
+	return nil
+}
+
+func errTaken(category *models.Category) error {
+	return fmt.Errorf("%w: there is already a category called %q", ErrInvalid, category.Name)
+}
+
+// duplicate reports the unique index turning away a name that check let
+// through, because another request saved it first
+func duplicate(err error, category *models.Category) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errTaken(category)
+	}
+	return err
+}
+
+// Create adds a custom category to scope
+func (s *Service) Create(scope Scope, category *models.Category) error {
+	if err := Validate(category); err != nil {
+		return err
+	}
+	category.ID = ""
+	category.UserID, category.GroupID = nil, scope.GroupID
+	if scope.GroupID == nil {
+		category.UserID = &scope.UserID
+	}
+
+	var count int64
+	if err := scope.owned(s.db.Model(&models.Category{})).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= MaxCustomCategories {
+		return ErrTooMany
+	}
+	if err := s.check(s.db, scope, category); err != nil {
+		return err
+	}
+	return duplicate(s.db.Create(category).Error, category)
+}
+
+// Update saves changes to a custom category. Expenses, recurring expenses and
+// budgets keep a copy of the name, so a rename is copied to them, and to the
+// owner's category rules.
+func (s *Service) Update(category *models.Category, previousName string) error {
+	if category.IsSystem() {
+		return fmt.Errorf("%w: system categories can't be changed", ErrInvalid)
+	}
+	if err := Validate(category); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.check(tx, Of(category), category); err != nil {
+			return err
+		}
+		if err := tx.Select("name", "slug", "parent_id", "icon", "color", "position").Save(category).Error; err != nil {
+			return duplicate(err, category)
+		}
+		if category.Name == previousName {
+			return nil
+		}
+		for _, model := range categorized {
+			if err := tx.Unscoped().Model(model).Where("category_id = ?", category.ID).
+				UpdateColumn("category", category.Name).Error; err != nil {
+				return err
+			}
+		}
+		// Rules name categories rather than point at them; only the owner's
+		// rules can use a user's category
+		if category.UserID != nil && category.GroupID == nil {
+			return tx.Model(&models.CategoryRule{}).
+				Where("user_id = ? AND LOWER(category) = ?", *category.UserID, Slug(previousName)).
+				Update("category", category.Name).Error
+		}
+		return nil
+	})
+}
+
+// Delete removes a custom category without subcategories. Expenses, recurring
+// expenses and budgets in it move to replacement.
+func (s *Service) Delete(category, replacement *models.Category) error {
+	if category.IsSystem() {
+		return fmt.Errorf("%w: system categories can't be deleted", ErrInvalid)
+	}
+	if replacement.ID == category.ID {
+		return fmt.Errorf("%w: a category can't replace itself", ErrInvalid)
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return fmt.Errorf("%w: delete or move its subcategories first", ErrInvalid)
+		}
+		for _, model := range categorized {
+			if err := tx.Unscoped().Model(model).Where("category_id = ?", category.ID).
+				UpdateColumns(map[string]interface{}{"category_id": replacement.ID, "category": replacement.Name}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(category).Error
+	})
+}
+
+// Node is a category with its subcategories
+type Node struct {
+	models.Category
+	System   bool   `json:"system"`
+	Children []Node `json:"children,omitempty"`
+}
+
+// Tree nests categories under their parents, keeping their order
+func Tree(categories []models.Category) []Node {
+	children := map[string][]Node{}
+	top := make(map[string]bool, len(categories))
+	for i := range categories {
+		if categories[i].ParentID == nil {
+			top[categories[i].ID] = true
+		}
+	}
+	var roots []Node
+	for i := range categories {
+		c := categories[i]
+		node := Node{Category: c, System: c.IsSystem()}
+		if c.ParentID != nil && top[*c.ParentID] {
+			children[*c.ParentID] = append(children[*c.ParentID], node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	for i := range roots {
+		roots[i].Children = children[roots[i].ID]
+	}
+	return roots
+}
+
+// Lookup runs FindOrOther for many names in one scope, such as the rows of
+// an import, asking the database once per name
+type Lookup struct {
+	service *Service
+	scope   Scope
+	found   map[string]*models.Category
+}
+
+func (s *Service) Lookup(scope Scope) *Lookup {
+	return &Lookup{service: s, scope: scope, found: map[string]*models.Category{}}
+}
+
+func (l *Lookup) FindOrOther(name string) (*models.Category, error) {
+	slug := Slug(name)
+	if category, ok := l.found[slug]; ok {
+		return category, nil
+	}
+	category, err := l.service.FindOrOther(l.scope, name)
+	if err != nil {
+		return nil, err
+	}
+	l.found[slug] = category
+	return category, nil
+}
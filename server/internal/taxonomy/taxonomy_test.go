@@ -0,0 +1,121 @@
+package taxonomy
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Food":                  "food",
+		"  Public   Transport ": "public transport",
+		"BILLS &\tFees":         "bills & fees",
+		"Café":                  "café",
+		"   ":                   "",
+	}
+	for name, want := range tests {
+		if got := Slug(name); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	empty := ""
+	tests := []struct {
+		name     string
+		category models.Category
+		want     models.Category // the tidied category, when valid
+		err      string          // part of the error, when invalid
+	}{
+		{"tidied", models.Category{Name: "  Board   Games ", Icon: " casino ", Color: "#1a2b3c", ParentID: &empty},
+			models.Category{Name: "Board Games", Slug: "board games", Icon: "casino", Color: "#1A2B3C"}, ""},
+		{"no colour", models.Category{Name: "Pets"}, models.Category{Name: "Pets", Slug: "pets"}, ""},
+		{"longest name", models.Category{Name: strings.Repeat("é", MaxNameLength)},
+			models.Category{Name: strings.Repeat("é", MaxNameLength), Slug: strings.Repeat("é", MaxNameLength)}, ""},
+		{"blank name", models.Category{Name: "  "}, models.Category{}, "name is required"},
+		{"long name", models.Category{Name: strings.Repeat("a", MaxNameLength+1)}, models.Category{}, "name must be"},
+		{"long icon", models.Category{Name: "Pets", Icon: strings.Repeat("a", MaxIconLength+1)}, models.Category{}, "icon must be"},
+		{"colour name", models.Category{Name: "Pets", Color: "red"}, models.Category{}, "color must"},
+		{"short colour", models.Category{Name: "Pets", Color: "#FFF"}, models.Category{}, "color must"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category := tt.category
+			err := Validate(&category)
+			if tt.err != "" {
+				if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Validate = %v, want ErrInvalid saying %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !reflect.DeepEqual(category, tt.want) {
+				t.Errorf("Validate tidied to %+v, want %+v", category, tt.want)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	user := "user"
+	id := func(s string) *string { return &s }
+	categories := []models.Category{
+		{Base: models.Base{ID: "food"}, Name: "Food"},
+		{Base: models.Base{ID: "coffee"}, Name: "Coffee", ParentID: id("food")},
+		{Base: models.Base{ID: "travel"}, Name: "Travel"},
+		{Base: models.Base{ID: "groceries"}, Name: "Groceries", ParentID: id("food")},
+		{Base: models.Base{ID: "pets"}, Name: "Pets", UserID: &user},
+		// A parent the scope can't see, or a subcategory, doesn't nest
+		{Base: models.Base{ID: "orphan"}, Name: "Orphan", ParentID: id("gone"), UserID: &user},
+		{Base: models.Base{ID: "deep"}, Name: "Deep", ParentID: id("coffee"), UserID: &user},
+	}
+
+	type node struct {
+		id       string
+		system   bool
+		children []string
+	}
+	var got []node
+	for _, n := range Tree(categories) {
+		var children []string
+		for _, c := range n.Children {
+			children = append(children, c.ID)
+		}
+		got = append(got, node{n.ID, n.System, children})
+	}
+	want := []node{
+		{"food", true, []string{"coffee", "groceries"}},
+		{"travel", true, nil},
+		{"pets", false, nil},
+		{"orphan", false, nil},
+		{"deep", false, nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tree = %v, want %v", got, want)
+	}
+	if Tree(nil) != nil {
+		t.Error("Tree(nil) isn't empty")
+	}
+}
+
+func TestDuplicateIsInvalid(t *testing.T) {
+	category := &models.Category{Name: "Pets"}
+	if err := duplicate(gorm.ErrDuplicatedKey, category); !errors.Is(err, ErrInvalid) {
+		t.Errorf("duplicate key = %v, want ErrInvalid", err)
+	}
+	other := errors.New("connection reset")
+	if err := duplicate(other, category); err != other {
+		t.Errorf("other error = %v, want it unchanged", err)
+	}
+	if err := duplicate(nil, category); err != nil {
+		t.Errorf("no error = %v, want nil", err)
+	}
+}
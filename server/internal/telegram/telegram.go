@@ -0,0 +1,145 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the Bot API endpoint. TELEGRAM_API_URL can point the
+// client at another server, e.g. cmd/telegram-fake for local testing.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Config holds the bot settings:
+//
+//	TELEGRAM_BOT_TOKEN      token from @BotFather; the integration is off without it
+//	TELEGRAM_BOT_USERNAME   the bot's username, used for t.me link URLs
+//	TELEGRAM_WEBHOOK_SECRET secret Telegram sends with every webhook call
+//	TELEGRAM_WEBHOOK_URL    if set, the webhook is registered on startup
+//	TELEGRAM_API_URL        Bot API base URL, defaults to DefaultAPIURL
+type Config struct {
+	Token         string
+	Username      string
+	WebhookSecret string
+	WebhookURL    string
+	APIURL        string
+}
+
+// ConfigFromEnv reads the bot settings. It returns false when no bot token
+// is set. A webhook secret is required when the bot is enabled so nobody else
+// can post updates.
+func ConfigFromEnv() (Config, bool, error) {
+	cfg := Config{
+		Token:         os.Getenv("TELEGRAM_BOT_TOKEN"),
+		Username:      strings.TrimPrefix(os.Getenv("TELEGRAM_BOT_USERNAME"), "@"),
+		WebhookSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		WebhookURL:    os.Getenv("TELEGRAM_WEBHOOK_URL"),
+		APIURL:        os.Getenv("TELEGRAM_API_URL"),
+	}
+	if cfg.Token == "" {
+		return cfg, false, nil
+	}
+	if cfg.WebhookSecret == "" {
+		return cfg, false, errors.New("TELEGRAM_WEBHOOK_SECRET is required when TELEGRAM_BOT_TOKEN is set")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	return cfg, true, nil
+}
+
+// Update is an incoming webhook update. Only the fields the bot uses are
+// decoded.
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message,omitempty"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from,omitempty"`
+	Chat      Chat   `json:"chat"`
+	Date      int64  `json:"date"`
+	Text      string `json:"text"`
+}
+
+type User struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username,omitempty"`
+}
+
+type Chat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+// Client calls the Telegram Bot API
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(cfg Config) *Client {
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{
+		baseURL: strings.TrimRight(apiURL, "/") + "/bot" + cfg.Token,
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendMessage sends a plain text message to a chat
+func (c *Client) SendMessage(chatID, text string) error {
+	return c.call("sendMessage", map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	})
+}
+
+// SetWebhook points Telegram at the server's webhook URL
+func (c *Client) SetWebhook(url, secret string) error {
+	return c.call("setWebhook", map[string]interface{}{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message"},
+	})
+}
+
+func (c *Client) call(method string, params map[string]interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Post(c.baseURL+"/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL contains the bot token, keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram %s: unexpected response (status %d)", method, resp.StatusCode)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram %s: %s", method, result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks a bearer token as an API key rather than a JWT
+const APIKeyPrefix = "fgk_"
+
+const (
+	// MaxAPIKeys is how many active keys a user may have at once
+	MaxAPIKeys = 20
+	// apiKeyUsageInterval limits how often last-used details are written
+	apiKeyUsageInterval = time.Minute
+)
+
+var (
+	ErrAPIKeyRevoked = errors.New("API key has been revoked")
+	ErrInvalidScope  = errors.New("invalid API key scope")
+	ErrInvalidExpiry = errors.New("API key expiry must be in the future")
+	ErrTooManyKeys   = errors.New("too many API keys")
+	ErrKeyNotFound   = errors.New("API key not found")
+)
+
+// Resources API keys can be scoped to. A scope is "<resource>:read" or
+// "<resource>:write"; write also allows reading.
+const (
+	ResourceExpenses = "expenses"
+	ResourceBalances = "balances"
+	ResourceGroups   = "groups"
+	ResourceProfile  = "profile"
+)
+
+var resources = map[string]bool{
+	ResourceExpenses: true,
+	ResourceBalances: true,
+	ResourceGroups:   true,
+	ResourceProfile:  true,
+}
+
+// Allows reports whether the token may read, or with write set change, the
+// resource. Session tokens may do anything; API keys need a matching scope.
+func (c *Claims) Allows(resource string, write bool) bool {
+	if c.APIKeyID == "" {
+		return true
+	}
+	for _, scope := range c.Scopes {
+		r, access, _ := strings.Cut(scope, ":")
+		if r != resource {
+			continue
+		}
+		if access == "write" || !write {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScopes validates the scopes and returns them sorted and without
+// duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		resource, access, ok := strings.Cut(scope, ":")
+		if !ok || !resources[resource] || (access != "read" && access != "write") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			out = append(out, scope)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// CreateAPIKey issues a key for the user. The returned raw key is shown once;
+// only its hash is kept. A nil expiresAt makes a key that lasts until revoked.
+func (m *Manager) CreateAPIKey(userID, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(m.now()) {
+		return "", nil, ErrInvalidExpiry
+	}
+
+	var active int64
+	if err := m.db.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, m.now()).
+		Count(&active).Error; err != nil {
+		return "", nil, err
+	}
+	if active >= MaxAPIKeys {
+		return "", nil, ErrTooManyKeys
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := APIKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(APIKeyPrefix)+8],
+		KeyHash:   hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := m.db.Create(&key).Error; err != nil {
+		return "", nil, fmt.Errorf("could not create API key: %w", err)
+	}
+	return raw, &key, nil
+}
+
+// VerifyAPIKey checks an API key and records when and from where it was last
+// used
+func (m *Manager) VerifyAPIKey(raw, ipAddress string) (*Claims, error) {
+	now := m.now()
+
+	var key models.APIKey
+	if err := m.db.Preload("User").Where("key_hash = ?", hashToken(raw)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if key.User.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUsageInterval || key.LastUsedIP != ipAddress {
+		// Usage tracking is best effort and never fails the request
+		m.db.Model(&key).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ipAddress,
+		})
+	}
+
+	return &Claims{
+		UserID:   key.UserID,
+		Email:    key.User.Email,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+// APIKeys lists the user's keys that haven't been revoked, newest first
+func (m *Manager) APIKeys(userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := m.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey revokes one of the user's keys
+func (m *Manager) RevokeAPIKey(userID, keyID string) error {
+	result := m.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", m.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAllAPIKeys revokes every key of the user, e.g. when the account is
+// deleted
+func (m *Manager) RevokeAllAPIKeys(userID string) error {
+	return m.db.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", m.now()).Error
+}
@@ -0,0 +1,131 @@
+package token
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		want   []string // nil when invalid
+	}{
+		{[]string{"groups:read"}, []string{"groups:read"}},
+		{[]string{" Expenses:WRITE ", "balances:read", "expenses:write"}, []string{"balances:read", "expenses:write"}},
+		{nil, nil},
+		{[]string{"groups"}, nil},
+		{[]string{"groups:admin"}, nil},
+		{[]string{"sessions:read"}, nil},
+		{[]string{"groups:read", ""}, nil},
+	}
+	for _, tt := range tests {
+		got, err := normalizeScopes(tt.scopes)
+		if tt.want == nil {
+			if !errors.Is(err, ErrInvalidScope) {
+				t.Errorf("normalizeScopes(%q) = %v, %v; want ErrInvalidScope", tt.scopes, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeScopes(%q) = %v, %v; want %v", tt.scopes, got, err, tt.want)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	key := &Claims{APIKeyID: "key", Scopes: []string{"expenses:read", "groups:write"}}
+	tests := []struct {
+		claims   *Claims
+		resource string
+		write    bool
+		want     bool
+	}{
+		{key, ResourceExpenses, false, true},
+		{key, ResourceExpenses, true, false},
+		{key, ResourceGroups, false, true}, // write also allows reading
+		{key, ResourceGroups, true, true},
+		{key, ResourceProfile, false, false},
+		{&Claims{APIKeyID: "key"}, ResourceExpenses, false, false},
+		{&Claims{SessionID: "session"}, ResourceProfile, true, true}, // sessions aren't scoped
+	}
+	for _, tt := range tests {
+		if got := tt.claims.Allows(tt.resource, tt.write); got != tt.want {
+			t.Errorf("%v.Allows(%s, write %v) = %v, want %v", tt.claims.Scopes, tt.resource, tt.write, got, tt.want)
+		}
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	m, fake, now := newManager(t)
+	raw, key, err := m.CreateAPIKey(userID, "CI", []string{"groups:write", "expenses:read"}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(raw, APIKeyPrefix) || !strings.HasPrefix(raw, key.Prefix) {
+		t.Errorf("raw key %q doesn't start with %s and its prefix %q", raw, APIKeyPrefix, key.Prefix)
+	}
+	stored := fake.Rows("api_keys")
+	if len(stored) != 1 || stored[0]["key_hash"] != hashToken(raw) || strings.Contains(stored[0]["key_hash"].(string), raw) {
+		t.Errorf("stored keys = %v, want only the hash of the raw key", stored)
+	}
+
+	claims, err := m.VerifyAPIKey(raw, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("VerifyAPIKey: %v", err)
+	}
+	if claims.UserID != userID || claims.APIKeyID != key.ID || !reflect.DeepEqual([]string(claims.Scopes), []string{"expenses:read", "groups:write"}) {
+		t.Errorf("claims = %+v, want the user's key with its sorted scopes", claims)
+	}
+	if !claims.Allows(ResourceGroups, true) || claims.Allows(ResourceExpenses, true) {
+		t.Errorf("claims allow the wrong access: %v", claims.Scopes)
+	}
+
+	past := now.Add(-time.Second)
+	if _, _, err := m.CreateAPIKey(userID, "old", []string{"groups:read"}, &past); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("expired key: err = %v, want ErrInvalidExpiry", err)
+	}
+	if _, _, err := m.CreateAPIKey(userID, "bad", []string{"sessions:write"}, nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("unknown scope: err = %v, want ErrInvalidScope", err)
+	}
+}
+
+func TestVerifyAPIKeyRejects(t *testing.T) {
+	m, _, now := newManager(t)
+	expiresAt := now.Add(time.Hour)
+	revoked, revokedKey, err := m.CreateAPIKey(userID, "revoked", []string{"groups:read"}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	expiring, _, err := m.CreateAPIKey(userID, "expiring", []string{"groups:read"}, &expiresAt)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := m.RevokeAPIKey(userID, revokedKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if err := m.RevokeAPIKey(userID, revokedKey.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("revoking twice: err = %v, want ErrKeyNotFound", err)
+	}
+
+	if _, err := m.VerifyAPIKey(expiring, ""); err != nil {
+		t.Errorf("key before expiry: %v", err)
+	}
+	*now = now.Add(2 * time.Hour)
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"revoked", revoked, ErrAPIKeyRevoked},
+		{"expired", expiring, ErrExpiredToken},
+		{"unknown", APIKeyPrefix + "nope", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		if _, err := m.VerifyAPIKey(tt.raw, ""); !errors.Is(err, tt.want) {
+			t.Errorf("%s key: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+const (
+	// ChallengeTTL is how long a user has to enter their second factor after
+	// their password was accepted
+	ChallengeTTL = 5 * time.Minute
+	// StepUpWindow is how long a second-factor check on a session covers
+	// high-risk actions
+	StepUpWindow = 10 * time.Minute
+
+	challengeType = "2fa_challenge"
+)
+
+// Challenge is a short-lived token proving the first login factor passed
+type Challenge struct {
+	Token     string    `json:"challengeToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// IssueChallenge signs a challenge for a user who still has to pass 2FA.
+// method is the first factor used, for the login history.
+func (m *Manager) IssueChallenge(userID, method string) (*Challenge, error) {
+	now := m.now()
+	expiresAt := now.Add(ChallengeTTL)
+	signed, err := m.cfg.Keys.sign(jwt.MapClaims{
+		"typ":    challengeType,
+		"sub":    userID,
+		"method": method,
+		"iat":    now.Unix(),
+		"exp":    expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Challenge{Token: signed, ExpiresAt: expiresAt}, nil
+}
+
+// VerifyChallenge returns the user and first-factor method of a challenge
+func (m *Manager) VerifyChallenge(challenge string) (string, string, error) {
+	t, err := jwt.Parse(challenge, m.cfg.Keys.keyFunc, jwt.WithTimeFunc(m.now), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return "", "", ErrExpiredToken
+		}
+		return "", "", ErrInvalidToken
+	}
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != challengeType {
+		return "", "", ErrInvalidToken
+	}
+	userID, _ := claims["sub"].(string)
+	method, _ := claims["method"].(string)
+	if userID == "" {
+		return "", "", ErrInvalidToken
+	}
+	return userID, method, nil
+}
+
+// MarkSteppedUp records that the session just passed a second-factor check
+func (m *Manager) MarkSteppedUp(sessionID string) error {
+	return m.db.Model(&models.Session{}).Where("id = ?", sessionID).Update("step_up_at", m.now()).Error
+}
+
+// StepUpRequired reports whether a high-risk action on this session needs a
+// fresh second-factor check. Users without 2FA are never asked.
+func (m *Manager) StepUpRequired(userID, sessionID string) (bool, error) {
+	var user models.User
+	if err := m.db.Select("id", "two_factor_enabled_at").First(&user, "id = ?", userID).Error; err != nil {
+		return false, err
+	}
+	if user.TwoFactorEnabledAt == nil {
+		return false, nil
+	}
+
+	var session models.Session
+	if err := m.db.Select("id", "step_up_at").First(&session, "id = ?", sessionID).Error; err != nil {
+		return true, nil
+	}
+	return session.StepUpAt == nil || m.now().Sub(*session.StepUpAt) > StepUpWindow, nil
+}
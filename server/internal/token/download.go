@@ -0,0 +1,63 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DownloadTTL is how long a signed download URL works
+const DownloadTTL = 5 * time.Minute
+
+const downloadType = "download"
+
+// Download is what a signed download URL grants: one user fetching one file
+// in one variant, e.g. an attachment's thumbnail
+type Download struct {
+	UserID     string
+	ResourceID string
+	Variant    string
+}
+
+// IssueDownload signs a short-lived token for a download URL. The user is
+// included so access can be checked again when the URL is used.
+func (m *Manager) IssueDownload(d Download) (string, time.Time, error) {
+	now := m.now()
+	expiresAt := now.Add(DownloadTTL)
+	signed, err := m.cfg.Keys.sign(jwt.MapClaims{
+		"typ":     downloadType,
+		"sub":     d.UserID,
+		"res":     d.ResourceID,
+		"variant": d.Variant,
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// VerifyDownload checks a download token and returns what it grants
+func (m *Manager) VerifyDownload(raw string) (*Download, error) {
+	t, err := jwt.Parse(raw, m.cfg.Keys.keyFunc, jwt.WithTimeFunc(m.now), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != downloadType {
+		return nil, ErrInvalidToken
+	}
+	d := &Download{}
+	d.UserID, _ = claims["sub"].(string)
+	d.ResourceID, _ = claims["res"].(string)
+	d.Variant, _ = claims["variant"].(string)
+	if d.UserID == "" || d.ResourceID == "" {
+		return nil, ErrInvalidToken
+	}
+	return d, nil
+}
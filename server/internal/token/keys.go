@@ -0,0 +1,245 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinSecretLength is the shortest HMAC secret accepted for HS256
+const MinSecretLength = 32
+
+// LegacyKeyID is the kid assumed for tokens signed before key IDs were added
+// and for a key configured through JWT_SECRET alone
+const LegacyKeyID = "default"
+
+var ErrNoSigningKey = errors.New("no JWT signing key configured")
+
+// Key is one signing key. Asymmetric keys publish their public half through
+// KeySet.JWKS so other services can verify tokens without the private key.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+func NewHMACKey(id, secret string) (*Key, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("JWT key %q: secret must be at least %d bytes", id, MinSecretLength)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}, nil
+}
+
+// ParsePrivateKey builds a key from a PEM encoded Ed25519 (EdDSA) or RSA
+// (RS256) private key
+func ParsePrivateKey(id string, pemData []byte) (*Key, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %q: no PEM data found", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("JWT key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("JWT key %q: %w", id, err)
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, sign: key, verify: key.Public()}, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("JWT key %q: RSA keys must be at least 2048 bits", id)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, sign: key, verify: &key.PublicKey}, nil
+	default:
+		return nil, fmt.Errorf("JWT key %q: unsupported private key type %T", id, parsed)
+	}
+}
+
+// KeySet holds every key tokens may be verified with. New tokens are signed
+// with the active key only, so a key can be rotated out by making another one
+// active and removing the old key once its tokens have expired.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+func NewKeySet(activeID string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key)}
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	if len(set.keys) == 0 {
+		return nil, ErrNoSigningKey
+	}
+
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT key %q is not configured", activeID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// sign signs the claims with the active key and records its kid in the header
+func (s *KeySet) sign(claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(s.active.Method, claims)
+	t.Header["kid"] = s.active.ID
+	return t.SignedString(s.active.sign)
+}
+
+// keyFunc picks the verification key by kid and rejects tokens whose
+// algorithm doesn't match the key's
+func (s *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.verify, nil
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set. HMAC keys
+// are secret and never included.
+func (s *KeySet) JWKS() map[string]interface{} {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := []map[string]string{}
+	for _, id := range ids {
+		key := s.keys[id]
+		switch pub := key.verify.(type) {
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"alg": key.Method.Alg(),
+				"kid": key.ID,
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": key.Method.Alg(),
+				"kid": key.ID,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// KeySetFromEnv loads signing keys from the environment:
+//
+//	JWT_KEYS              comma separated kid=secret HMAC keys
+//	JWT_PRIVATE_KEY_FILES comma separated kid=path PEM files (EdDSA or RS256)
+//	JWT_ACTIVE_KID        the kid new tokens are signed with
+//	JWT_SECRET            a single HMAC key with kid "default"
+//
+// JWT_ACTIVE_KID may be omitted when exactly one key is configured. There is
+// no fallback key; an empty configuration is an error.
+func KeySetFromEnv() (*KeySet, error) {
+	var keys []*Key
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key, err := NewHMACKey(LegacyKeyID, secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	entries, err := parseKeyList("JWT_KEYS", os.Getenv("JWT_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		key, err := NewHMACKey(e[0], e[1])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	entries, err = parseKeyList("JWT_PRIVATE_KEY_FILES", os.Getenv("JWT_PRIVATE_KEY_FILES"))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(e[1])
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", e[0], err)
+		}
+		key, err := ParsePrivateKey(e[0], data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: set JWT_SECRET, JWT_KEYS or JWT_PRIVATE_KEY_FILES", ErrNoSigningKey)
+	}
+
+	active := os.Getenv("JWT_ACTIVE_KID")
+	if active == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("JWT_ACTIVE_KID is required when more than one JWT key is configured")
+		}
+		active = keys[0].ID
+	}
+	return NewKeySet(active, keys...)
+}
+
+// parseKeyList splits "kid=value,kid=value"
+func parseKeyList(name, value string) ([][2]string, error) {
+	var entries [][2]string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, v, ok := strings.Cut(item, "=")
+		id, v = strings.TrimSpace(id), strings.TrimSpace(v)
+		if !ok || id == "" || v == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected kid=value", name, item)
+		}
+		entries = append(entries, [2]string{id, v})
+	}
+	return entries, nil
+}
@@ -0,0 +1,77 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 48 * time.Hour
+	// LinkCodeTTL is how long a code for linking a chat account stays valid
+	LinkCodeTTL = 10 * time.Minute
+)
+
+// IssueOneTime creates a single-use token for the given purpose and returns
+// the raw token to send to the user. Earlier unused tokens for the same
+// purpose stop working.
+func (m *Manager) IssueOneTime(userID, purpose string, ttl time.Duration) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := m.now()
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.OneTimeToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OneTimeToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(raw),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not issue %s token: %w", purpose, err)
+	}
+	return raw, nil
+}
+
+// ConsumeOneTime marks a token as used and returns the user it was issued to.
+// Unknown, used and wrong-purpose tokens all return ErrInvalidToken.
+func (m *Manager) ConsumeOneTime(raw, purpose string) (string, error) {
+	now := m.now()
+
+	var stored models.OneTimeToken
+	if err := m.db.Where("token_hash = ? AND purpose = ?", hashToken(raw), purpose).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrInvalidToken
+		}
+		return "", err
+	}
+	if stored.UsedAt != nil {
+		return "", ErrInvalidToken
+	}
+	if now.After(stored.ExpiresAt) {
+		return "", ErrExpiredToken
+	}
+
+	result := m.db.Model(&models.OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL", stored.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrInvalidToken
+	}
+	return stored.UserID, nil
+}
@@ -0,0 +1,323 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrExpiredToken   = errors.New("token has expired")
+	ErrSessionRevoked = errors.New("session has been revoked")
+	// ErrTokenReuse is returned when a refresh token is presented a second
+	// time. The session it belongs to is revoked when this happens.
+	ErrTokenReuse = errors.New("refresh token reuse detected")
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+type Config struct {
+	Keys       *KeySet
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// ConfigFromEnv reads the signing keys (see KeySetFromEnv), JWT_ACCESS_TTL and
+// JWT_REFRESH_TTL. The TTLs use Go duration syntax, e.g. "15m" or "720h".
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		AccessTTL:  DefaultAccessTTL,
+		RefreshTTL: DefaultRefreshTTL,
+	}
+
+	keys, err := KeySetFromEnv()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Keys = keys
+
+	if v := os.Getenv("JWT_ACCESS_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid JWT_ACCESS_TTL: %w", err)
+		}
+		cfg.AccessTTL = d
+	}
+	if v := os.Getenv("JWT_REFRESH_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid JWT_REFRESH_TTL: %w", err)
+		}
+		cfg.RefreshTTL = d
+	}
+	return cfg, nil
+}
+
+// Pair is what clients receive after signing in or refreshing
+type Pair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	SessionID    string    `json:"sessionId"`
+}
+
+// Claims are the verified contents of an access token or API key. API keys
+// have no session and carry the scopes they were issued with.
+type Claims struct {
+	UserID    string
+	Email     string
+	SessionID string
+	APIKeyID  string
+	Scopes    []string
+}
+
+// ClientInfo describes the device a session was created from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Manager issues and verifies access tokens and manages sessions and their
+// rotating refresh tokens
+type Manager struct {
+	db  *gorm.DB
+	cfg Config
+	now func() time.Time
+}
+
+func NewManager(db *gorm.DB, cfg Config) *Manager {
+	return &Manager{
+		db:  db,
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+// Issue starts a new session for the user and returns its first token pair
+func (m *Manager) Issue(user models.User, client ClientInfo) (*Pair, error) {
+	now := m.now()
+	session := models.Session{
+		UserID:     user.ID,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(m.cfg.RefreshTTL),
+	}
+
+	var pair *Pair
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, _, err = m.issuePair(tx, user, session.ID, now)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not start session: %w", err)
+	}
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token can be
+// used once; presenting a used token revokes the session (ErrTokenReuse).
+func (m *Manager) Refresh(raw string) (*Pair, error) {
+	now := m.now()
+
+	var stored models.RefreshToken
+	if err := m.db.Preload("Session").Where("token_hash = ?", hashToken(raw)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	session := stored.Session
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+	if stored.UsedAt != nil {
+		if err := m.RevokeSession(session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReuse
+	}
+	if now.After(stored.ExpiresAt) || now.After(session.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	var user models.User
+	if err := m.db.First(&user, "id = ?", session.UserID).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var pair *Pair
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		// Claim the token atomically so two concurrent refreshes can't both win
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenReuse
+		}
+
+		var next *models.RefreshToken
+		var err error
+		pair, next, err = m.issuePair(tx, user, session.ID, now)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&stored).Update("replaced_by", next.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"expires_at":   now.Add(m.cfg.RefreshTTL),
+		}).Error
+	})
+	if errors.Is(err, ErrTokenReuse) {
+		if err := m.RevokeSession(session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReuse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not refresh session: %w", err)
+	}
+	return pair, nil
+}
+
+// Verify checks an access token's signature and expiry and that its session
+// is still active
+func (m *Manager) Verify(tokenString string) (*Claims, error) {
+	token, err := jwt.Parse(tokenString, m.cfg.Keys.keyFunc, jwt.WithTimeFunc(m.now))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := mapClaims["exp"]; !ok {
+		return nil, ErrInvalidToken
+	}
+	// Only access tokens are accepted, not e.g. 2FA challenges
+	if _, ok := mapClaims["typ"]; ok {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{}
+	claims.UserID, _ = mapClaims["userId"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.SessionID, _ = mapClaims["sid"].(string)
+	if claims.UserID == "" || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var session models.Session
+	if err := m.db.Select("id", "user_id", "revoked_at", "expires_at").
+		First(&session, "id = ?", claims.SessionID).Error; err != nil {
+		return nil, ErrSessionRevoked
+	}
+	if session.RevokedAt != nil || session.UserID != claims.UserID || m.now().After(session.ExpiresAt) {
+		return nil, ErrSessionRevoked
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public verification keys for other services
+func (m *Manager) JWKS() map[string]interface{} {
+	return m.cfg.Keys.JWKS()
+}
+
+// RevokeSession signs one device out
+func (m *Manager) RevokeSession(sessionID string) error {
+	return m.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", m.now()).Error
+}
+
+// RevokeAll signs the user out on every device
+func (m *Manager) RevokeAll(userID string) error {
+	return m.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", m.now()).Error
+}
+
+// ActiveSessions lists the user's signed-in devices
+func (m *Manager) ActiveSessions(userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := m.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, m.now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (m *Manager) issuePair(tx *gorm.DB, user models.User, sessionID string, now time.Time) (*Pair, *models.RefreshToken, error) {
+	expiresAt := now.Add(m.cfg.AccessTTL)
+	accessString, err := m.cfg.Keys.sign(jwt.MapClaims{
+		"userId": user.ID,
+		"email":  user.Email,
+		"sid":    sessionID,
+		"iat":    now.Unix(),
+		"exp":    expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh := models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(m.cfg.RefreshTTL),
+	}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &Pair{
+		AccessToken:  accessString,
+		RefreshToken: raw,
+		ExpiresAt:    expiresAt,
+		SessionID:    sessionID,
+	}, &refresh, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,142 @@
+package token
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/dbtest"
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+)
+
+const userID = "00000000-0000-4000-8000-0000000000a1"
+
+var user = models.User{Base: models.Base{ID: userID}, Email: "asha@example.com"}
+
+// newManager returns a manager over a fake database holding user, with a
+// clock the test can move
+func newManager(t *testing.T) (*Manager, *dbtest.DB, *time.Time) {
+	t.Helper()
+	db, fake := dbtest.Open()
+	fake.Add("users", dbtest.Row{"id": userID, "email": user.Email})
+
+	key, err := NewHMACKey("test", strings.Repeat("k", MinSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeySet("test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	m := NewManager(db, Config{Keys: keys, AccessTTL: DefaultAccessTTL, RefreshTTL: DefaultRefreshTTL})
+	m.now = func() time.Time { return now }
+	return m, fake, &now
+}
+
+func TestRefreshRotates(t *testing.T) {
+	m, fake, _ := newManager(t)
+	first, err := m.Issue(user, ClientInfo{UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	second, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.SessionID != first.SessionID {
+		t.Errorf("refresh gave %+v, want a new refresh token in session %s", second, first.SessionID)
+	}
+	claims, err := m.Verify(second.AccessToken)
+	if err != nil || claims.UserID != userID || claims.SessionID != first.SessionID {
+		t.Errorf("Verify = %+v, %v; want the user's session", claims, err)
+	}
+
+	tokens := fake.Rows("refresh_tokens")
+	if len(tokens) != 2 || tokens[0]["used_at"] == nil || tokens[0]["replaced_by"] != tokens[1]["id"] || tokens[1]["used_at"] != nil {
+		t.Errorf("refresh tokens = %v, want the first used and replaced by the second", tokens)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	m, _, _ := newManager(t)
+	first, err := m.Issue(user, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	second, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Someone replays the token that was already exchanged
+	if _, err := m.Refresh(first.RefreshToken); !errors.Is(err, ErrTokenReuse) {
+		t.Fatalf("replayed Refresh = %v, want ErrTokenReuse", err)
+	}
+	// Which ends the session for whoever holds the current tokens too
+	if _, err := m.Refresh(second.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Refresh after reuse = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := m.Verify(second.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Verify after reuse = %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestRevokedSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(m *Manager, pair *Pair) error
+	}{
+		{"logout", func(m *Manager, pair *Pair) error { return m.RevokeSession(pair.SessionID) }},
+		{"logout everywhere", func(m *Manager, pair *Pair) error { return m.RevokeAll(userID) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, _ := newManager(t)
+			pair, err := m.Issue(user, ClientInfo{})
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			other, err := m.Issue(user, ClientInfo{})
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			if err := tt.revoke(m, pair); err != nil {
+				t.Fatalf("revoking: %v", err)
+			}
+
+			if _, err := m.Verify(pair.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("Verify = %v, want ErrSessionRevoked", err)
+			}
+			if _, err := m.Refresh(pair.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("Refresh = %v, want ErrSessionRevoked", err)
+			}
+			_, err = m.Verify(other.AccessToken)
+			if everywhere := tt.name == "logout everywhere"; everywhere != errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("other session: Verify = %v", err)
+			}
+		})
+	}
+}
+
+func TestExpiredTokens(t *testing.T) {
+	m, _, now := newManager(t)
+	pair, err := m.Issue(user, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	*now = now.Add(DefaultAccessTTL + time.Minute)
+	if _, err := m.Verify(pair.AccessToken); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify after the access TTL = %v, want ErrExpiredToken", err)
+	}
+	*now = now.Add(DefaultRefreshTTL)
+	if _, err := m.Refresh(pair.RefreshToken); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Refresh after the refresh TTL = %v, want ErrExpiredToken", err)
+	}
+	if _, err := m.Refresh("not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Refresh of an unknown token = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,217 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	Issuer            = "FinGenie"
+	RecoveryCodeCount = 10
+)
+
+var (
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrNotSetUp       = errors.New("two-factor authentication has not been set up")
+	ErrInvalidCode    = errors.New("invalid two-factor code")
+)
+
+// Enrollment is returned when a user starts setting up 2FA
+type Enrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// Service manages TOTP enrolment, code checks and recovery codes
+type Service struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Setup generates a new secret for the user. 2FA stays off until Enable is
+// called with a code from the authenticator app.
+func (s *Service) Setup(user models.User) (*Enrollment, error) {
+	if user.TwoFactorEnabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("could not store TOTP secret: %w", err)
+	}
+
+	return &Enrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, Issuer, user.Email),
+	}, nil
+}
+
+// Enable turns 2FA on once the user proves their app produces valid codes,
+// and returns a fresh set of recovery codes
+func (s *Service) Enable(user models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrNotSetUp
+	}
+	step, ok := totp.Validate(user.TOTPSecret, code, s.now(), user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"two_factor_enabled_at": s.now(),
+			"totp_last_step":        step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not enable two-factor authentication: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable turns 2FA off and removes the secret and recovery codes
+func (s *Service) Disable(userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"two_factor_enabled_at": nil,
+			"totp_secret":           "",
+			"totp_last_step":        0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// Verify checks a TOTP code or, if code is empty, a recovery code. Each TOTP
+// code and each recovery code can only be used once.
+func (s *Service) Verify(user models.User, code, recoveryCode string) error {
+	if user.TwoFactorEnabledAt == nil {
+		return ErrNotEnabled
+	}
+
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, s.now(), user.TOTPLastStep)
+		if !ok {
+			return ErrInvalidCode
+		}
+		// Guard against the same code being accepted twice concurrently
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	if recoveryCode == "" {
+		return ErrInvalidCode
+	}
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(recoveryCode)).
+		Update("used_at", s.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes
+func (s *Service) RegenerateRecoveryCodes(user models.User) ([]string, error) {
+	if user.TwoFactorEnabledAt == nil {
+		return nil, ErrNotEnabled
+	}
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes
+func (s *Service) RemainingRecoveryCodes(userID string) (int64, error) {
+	var n int64
+	err := s.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n).Error
+	return n, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]models.RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7f3q-x2m9p"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed
+// loosely
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
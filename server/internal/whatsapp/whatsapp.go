@@ -0,0 +1,210 @@
+package whatsapp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the WhatsApp Cloud API endpoint. WHATSAPP_API_URL can
+// point the client at another server, e.g. cmd/whatsapp-fake for local
+// testing.
+const DefaultAPIURL = "https://graph.facebook.com/v19.0"
+
+// Config holds the WhatsApp Business settings:
+//
+//	WHATSAPP_ACCESS_TOKEN      Cloud API access token; the integration is off without it
+//	WHATSAPP_PHONE_NUMBER_ID   ID of the business phone number messages are sent from
+//	WHATSAPP_APP_SECRET        app secret webhook payloads are signed with
+//	WHATSAPP_VERIFY_TOKEN      token echoed back when the webhook is registered
+//	WHATSAPP_BUSINESS_NUMBER   the business number in international form, for wa.me links
+//	WHATSAPP_TEMPLATE          approved template notifications are sent with,
+//	                           taking the title and body as its two parameters
+//	WHATSAPP_TEMPLATE_LANGUAGE language code of the template, defaults to "en"
+//	WHATSAPP_API_URL           API base URL, defaults to DefaultAPIURL
+type Config struct {
+	AccessToken      string
+	PhoneNumberID    string
+	AppSecret        string
+	VerifyToken      string
+	BusinessNumber   string
+	Template         string
+	TemplateLanguage string
+	APIURL           string
+}
+
+// ConfigFromEnv reads the WhatsApp settings. It returns false when no access
+// token is set.
+func ConfigFromEnv() (Config, bool, error) {
+	cfg := Config{
+		AccessToken:      os.Getenv("WHATSAPP_ACCESS_TOKEN"),
+		PhoneNumberID:    os.Getenv("WHATSAPP_PHONE_NUMBER_ID"),
+		AppSecret:        os.Getenv("WHATSAPP_APP_SECRET"),
+		VerifyToken:      os.Getenv("WHATSAPP_VERIFY_TOKEN"),
+		BusinessNumber:   os.Getenv("WHATSAPP_BUSINESS_NUMBER"),
+		Template:         os.Getenv("WHATSAPP_TEMPLATE"),
+		TemplateLanguage: os.Getenv("WHATSAPP_TEMPLATE_LANGUAGE"),
+		APIURL:           os.Getenv("WHATSAPP_API_URL"),
+	}
+	if cfg.AccessToken == "" {
+		return cfg, false, nil
+	}
+	if cfg.PhoneNumberID == "" || cfg.AppSecret == "" || cfg.VerifyToken == "" {
+		return cfg, false, errors.New("WHATSAPP_PHONE_NUMBER_ID, WHATSAPP_APP_SECRET and WHATSAPP_VERIFY_TOKEN are required when WHATSAPP_ACCESS_TOKEN is set")
+	}
+	if cfg.Template == "" {
+		cfg.Template = "fingenie_notification"
+	}
+	if cfg.TemplateLanguage == "" {
+		cfg.TemplateLanguage = "en"
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	return cfg, true, nil
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header of a webhook call,
+// an HMAC-SHA256 of the raw body keyed with the app secret
+func VerifySignature(appSecret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// Webhook is the payload of an incoming webhook call. Only the fields the
+// bot uses are decoded.
+type Webhook struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		Changes []struct {
+			Field string `json:"field"`
+			Value struct {
+				Messages []Message `json:"messages"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// Message is an inbound message. From is the sender's number in
+// international form without the leading "+".
+type Message struct {
+	ID   string `json:"id"`
+	From string `json:"from"`
+	Type string `json:"type"`
+	Text struct {
+		Body string `json:"body"`
+	} `json:"text"`
+}
+
+// Messages returns every inbound message in the payload
+func (w *Webhook) Messages() []Message {
+	var messages []Message
+	for _, entry := range w.Entry {
+		for _, change := range entry.Changes {
+			if change.Field == "messages" {
+				messages = append(messages, change.Value.Messages...)
+			}
+		}
+	}
+	return messages
+}
+
+// Client sends messages through the WhatsApp Cloud API
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	return &Client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendText sends a free-form text message. WhatsApp only delivers these
+// within 24 hours of the user's last message, so use SendTemplate otherwise.
+func (c *Client) SendText(to, body string) error {
+	return c.send(map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                strings.TrimPrefix(to, "+"),
+		"type":              "text",
+		"text":              map[string]string{"body": body},
+	})
+}
+
+// SendTemplate sends a pre-approved template message with the given body
+// parameters
+func (c *Client) SendTemplate(to, template, language string, params ...string) error {
+	parameters := make([]map[string]string, len(params))
+	for i, p := range params {
+		parameters[i] = map[string]string{"type": "text", "text": p}
+	}
+	return c.send(map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                strings.TrimPrefix(to, "+"),
+		"type":              "template",
+		"template": map[string]interface{}{
+			"name":     template,
+			"language": map[string]string{"code": language},
+			"components": []map[string]interface{}{
+				{"type": "body", "parameters": parameters},
+			},
+		},
+	})
+}
+
+func (c *Client) send(payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimRight(c.cfg.APIURL, "/") + "/" + c.cfg.PhoneNumberID + "/messages"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.cfg.AccessToken)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("whatsapp send: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var result struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if result.Error.Message == "" {
+			result.Error.Message = resp.Status
+		}
+		return fmt.Errorf("whatsapp send: %s", result.Error.Message)
+	}
+	return nil
+}
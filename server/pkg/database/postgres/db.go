@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/sukh-j-14/fingenie-main/internal/categorize"
 	"github.com/sukh-j-14/fingenie-main/internal/models"
+	"github.com/sukh-j-14/fingenie-main/internal/taxonomy"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -24,7 +26,8 @@ func NewConnection(config *Config) (*gorm.DB, error) {
 		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError turns unique violations into gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -47,19 +50,40 @@ func NewConnection(config *Config) (*gorm.DB, error) {
 func AutoMigrate(db *gorm.DB) error {
 	log.Println("Running database migrations...")
 
+	// Accounts created before email verification existed are grandfathered
+	// in as verified, once, when the column is added
+	grandfatherEmails := !db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
 	// Migrate in order of dependencies
 	err := db.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.OneTimeToken{},
+		&models.PhoneOTP{},
+		&models.LoginAttempt{},
+		&models.RecoveryCode{},
+		&models.APIKey{},
 		&models.Group{},
 		&models.GroupMember{},
 		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.BudgetAdjustment{},
 		&models.IncomeStream{},
+		&models.IncomeReceipt{},
 		&models.BehavioralPattern{},
 		&models.SocialScoreHistory{},
+		&models.Category{},
 		&models.Expense{},
+		&models.Attachment{},
+		&models.CategoryRule{},
 		&models.RecurringExpense{},
 		&models.SplitExpense{},
 		&models.SplitShare{},
+		&models.Notification{},
+		&models.ContactLookup{},
+		&models.ProcessedMessage{},
+		&models.PendingDraft{},
 	)
 
 	if err != nil {
@@ -67,6 +91,57 @@ func AutoMigrate(db *gorm.DB) error {
 		return err
 	}
 
+	// Custom category names are unique per owner; the taxonomy checks this
+	// too, but only the index holds when two requests race
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_owner_slug ON categories (slug, COALESCE(user_id::text, ''), COALESCE(group_id::text, '')) WHERE deleted_at IS NULL").Error; err != nil {
+		log.Printf("Error indexing category names: %v", err)
+		return err
+	}
+
+	if grandfatherEmails {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Printf("Error grandfathering email verification: %v", err)
+			return err
+		}
+	}
+
+	// Backfill contact matching hashes for accounts created before they existed
+	if err := db.Exec("UPDATE users SET email_hash = encode(sha256(convert_to(lower(trim(email)), 'UTF8')), 'hex') WHERE email_hash IS NULL OR email_hash = ''").Error; err != nil {
+		log.Printf("Error backfilling email hashes: %v", err)
+		return err
+	}
+
+	// Anchor budgets created before anchors existed on their current period
+	if err := db.Exec("UPDATE budgets SET period_anchor = start_date WHERE period_anchor IS NULL").Error; err != nil {
+		log.Printf("Error backfilling budget anchors: %v", err)
+		return err
+	}
+
+	// Tag Splitwise payments imported before they were told apart from
+	// spending, so budgets leave them out
+	if err := db.Exec(`UPDATE expenses SET tags = COALESCE(tags, '[]'::jsonb) || '["payment"]'::jsonb
+		WHERE import_key IS NOT NULL AND tags @> '["splitwise"]'::jsonb AND NOT tags @> '["payment"]'::jsonb
+		AND LOWER(category) IN ('payment', 'transfers')`).Error; err != nil {
+		log.Printf("Error tagging imported payments: %v", err)
+		return err
+	}
+
+	if err := taxonomy.SeedDefaults(db); err != nil {
+		log.Printf("Error seeding categories: %v", err)
+		return err
+	}
+
+	// Link free-text categories from before the taxonomy to categories
+	if err := taxonomy.Migrate(db); err != nil {
+		log.Printf("Error migrating categories: %v", err)
+		return err
+	}
+
+	if err := categorize.SeedGlobal(db); err != nil {
+		log.Printf("Error seeding category rules: %v", err)
+		return err
+	}
+
 	log.Println("Database migration completed successfully")
 	return nil
 }